@@ -0,0 +1,789 @@
+// Code generated - DO NOT EDIT.
+// This file is a generated binding and any manual changes will be lost.
+
+package tokenprice
+
+import (
+	"errors"
+	"math/big"
+	"strings"
+
+	ethereum "github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/event"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var (
+	_ = errors.New
+	_ = big.NewInt
+	_ = strings.NewReader
+	_ = ethereum.NotFound
+	_ = bind.Bind
+	_ = common.Big1
+	_ = types.BloomLookup
+	_ = event.NewSubscription
+	_ = abi.ConvertType
+)
+
+// TokenPriceMetaData contains all meta data concerning the TokenPrice contract.
+var TokenPriceMetaData = &bind.MetaData{
+	ABI: "[{\"inputs\":[{\"internalType\":\"address\",\"name\":\"poolAddr\",\"type\":\"address\"}],\"name\":\"price\",\"outputs\":[{\"internalType\":\"uint256\",\"name\":\"\",\"type\":\"uint256\"}],\"stateMutability\":\"view\",\"type\":\"function\"},{\"inputs\":[{\"internalType\":\"address\",\"name\":\"pairAddr\",\"type\":\"address\"}],\"name\":\"priceV2\",\"outputs\":[{\"internalType\":\"uint256\",\"name\":\"\",\"type\":\"uint256\"}],\"stateMutability\":\"view\",\"type\":\"function\"}]",
+}
+
+// TokenPriceABI is the input ABI used to generate the binding from.
+// Deprecated: Use TokenPriceMetaData.ABI instead.
+var TokenPriceABI = TokenPriceMetaData.ABI
+
+// TokenPrice is an auto generated Go binding around an Ethereum contract.
+type TokenPrice struct {
+	TokenPriceCaller     // Read-only binding to the contract
+	TokenPriceTransactor // Write-only binding to the contract
+	TokenPriceFilterer   // Log filterer for contract events
+}
+
+// TokenPriceCaller is an auto generated read-only Go binding around an Ethereum contract.
+type TokenPriceCaller struct {
+	contract *bind.BoundContract // Generic contract wrapper for the low level calls
+}
+
+// TokenPriceTransactor is an auto generated write-only Go binding around an Ethereum contract.
+type TokenPriceTransactor struct {
+	contract *bind.BoundContract // Generic contract wrapper for the low level calls
+}
+
+// TokenPriceFilterer is an auto generated log filtering Go binding around an Ethereum contract events.
+type TokenPriceFilterer struct {
+	contract *bind.BoundContract // Generic contract wrapper for the low level calls
+}
+
+// TokenPriceSession is an auto generated Go binding around an Ethereum contract,
+// with pre-set call and transact options.
+type TokenPriceSession struct {
+	Contract     *TokenPrice       // Generic contract binding to set the session for
+	CallOpts     bind.CallOpts     // Call options to use throughout this session
+	TransactOpts bind.TransactOpts // Transaction auth options to use throughout this session
+}
+
+// TokenPriceCallerSession is an auto generated read-only Go binding around an Ethereum contract,
+// with pre-set call options.
+type TokenPriceCallerSession struct {
+	Contract *TokenPriceCaller // Generic contract caller binding to set the session for
+	CallOpts bind.CallOpts     // Call options to use throughout this session
+}
+
+// TokenPriceTransactorSession is an auto generated write-only Go binding around an Ethereum contract,
+// with pre-set transact options.
+type TokenPriceTransactorSession struct {
+	Contract     *TokenPriceTransactor // Generic contract transactor binding to set the session for
+	TransactOpts bind.TransactOpts     // Transaction auth options to use throughout this session
+}
+
+// TokenPriceRaw is an auto generated low-level Go binding around an Ethereum contract.
+type TokenPriceRaw struct {
+	Contract *TokenPrice // Generic contract binding to access the raw methods on
+}
+
+// TokenPriceCallerRaw is an auto generated low-level read-only Go binding around an Ethereum contract.
+type TokenPriceCallerRaw struct {
+	Contract *TokenPriceCaller // Generic read-only contract binding to access the raw methods on
+}
+
+// TokenPriceTransactorRaw is an auto generated low-level write-only Go binding around an Ethereum contract.
+type TokenPriceTransactorRaw struct {
+	Contract *TokenPriceTransactor // Generic write-only contract binding to access the raw methods on
+}
+
+// NewTokenPrice creates a new instance of TokenPrice, bound to a specific deployed contract.
+func NewTokenPrice(address common.Address, backend bind.ContractBackend) (*TokenPrice, error) {
+	contract, err := bindTokenPrice(address, backend, backend, backend)
+	if err != nil {
+		return nil, err
+	}
+	return &TokenPrice{TokenPriceCaller: TokenPriceCaller{contract: contract}, TokenPriceTransactor: TokenPriceTransactor{contract: contract}, TokenPriceFilterer: TokenPriceFilterer{contract: contract}}, nil
+}
+
+// NewTokenPriceCaller creates a new read-only instance of TokenPrice, bound to a specific deployed contract.
+func NewTokenPriceCaller(address common.Address, caller bind.ContractCaller) (*TokenPriceCaller, error) {
+	contract, err := bindTokenPrice(address, caller, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &TokenPriceCaller{contract: contract}, nil
+}
+
+// NewTokenPriceTransactor creates a new write-only instance of TokenPrice, bound to a specific deployed contract.
+func NewTokenPriceTransactor(address common.Address, transactor bind.ContractTransactor) (*TokenPriceTransactor, error) {
+	contract, err := bindTokenPrice(address, nil, transactor, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &TokenPriceTransactor{contract: contract}, nil
+}
+
+// NewTokenPriceFilterer creates a new log filterer instance of TokenPrice, bound to a specific deployed contract.
+func NewTokenPriceFilterer(address common.Address, filterer bind.ContractFilterer) (*TokenPriceFilterer, error) {
+	contract, err := bindTokenPrice(address, nil, nil, filterer)
+	if err != nil {
+		return nil, err
+	}
+	return &TokenPriceFilterer{contract: contract}, nil
+}
+
+// bindTokenPrice binds a generic wrapper to an already deployed contract.
+func bindTokenPrice(address common.Address, caller bind.ContractCaller, transactor bind.ContractTransactor, filterer bind.ContractFilterer) (*bind.BoundContract, error) {
+	parsed, err := TokenPriceMetaData.GetAbi()
+	if err != nil {
+		return nil, err
+	}
+	return bind.NewBoundContract(address, *parsed, caller, transactor, filterer), nil
+}
+
+// Call invokes the (constant) contract method with params as input values and
+// sets the output to result. The result type might be a single field for simple
+// returns, a slice of interfaces for anonymous returns and a struct for named
+// returns.
+func (_TokenPrice *TokenPriceRaw) Call(opts *bind.CallOpts, result *[]interface{}, method string, params ...interface{}) error {
+	return _TokenPrice.Contract.TokenPriceCaller.contract.Call(opts, result, method, params...)
+}
+
+// Transfer initiates a plain transaction to move funds to the contract, calling
+// its default method if one is available.
+func (_TokenPrice *TokenPriceRaw) Transfer(opts *bind.TransactOpts) (*types.Transaction, error) {
+	return _TokenPrice.Contract.TokenPriceTransactor.contract.Transfer(opts)
+}
+
+// Transact invokes the (paid) contract method with params as input values.
+func (_TokenPrice *TokenPriceRaw) Transact(opts *bind.TransactOpts, method string, params ...interface{}) (*types.Transaction, error) {
+	return _TokenPrice.Contract.TokenPriceTransactor.contract.Transact(opts, method, params...)
+}
+
+// Call invokes the (constant) contract method with params as input values and
+// sets the output to result. The result type might be a single field for simple
+// returns, a slice of interfaces for anonymous returns and a struct for named
+// returns.
+func (_TokenPrice *TokenPriceCallerRaw) Call(opts *bind.CallOpts, result *[]interface{}, method string, params ...interface{}) error {
+	return _TokenPrice.Contract.contract.Call(opts, result, method, params...)
+}
+
+// Transfer initiates a plain transaction to move funds to the contract, calling
+// its default method if one is available.
+func (_TokenPrice *TokenPriceTransactorRaw) Transfer(opts *bind.TransactOpts) (*types.Transaction, error) {
+	return _TokenPrice.Contract.contract.Transfer(opts)
+}
+
+// Transact invokes the (paid) contract method with params as input values.
+func (_TokenPrice *TokenPriceTransactorRaw) Transact(opts *bind.TransactOpts, method string, params ...interface{}) (*types.Transaction, error) {
+	return _TokenPrice.Contract.contract.Transact(opts, method, params...)
+}
+
+// Price is a free data retrieval call binding the contract method 0xaea91078.
+//
+// Solidity: function price(address poolAddr) view returns(uint256)
+func (_TokenPrice *TokenPriceCaller) Price(opts *bind.CallOpts, poolAddr common.Address) (*big.Int, error) {
+	var out []interface{}
+	err := _TokenPrice.contract.Call(opts, &out, "price", poolAddr)
+
+	if err != nil {
+		return *new(*big.Int), err
+	}
+
+	out0 := *abi.ConvertType(out[0], new(*big.Int)).(**big.Int)
+
+	return out0, err
+
+}
+
+// Price is a free data retrieval call binding the contract method 0xaea91078.
+//
+// Solidity: function price(address poolAddr) view returns(uint256)
+func (_TokenPrice *TokenPriceSession) Price(poolAddr common.Address) (*big.Int, error) {
+	return _TokenPrice.Contract.Price(&_TokenPrice.CallOpts, poolAddr)
+}
+
+// Price is a free data retrieval call binding the contract method 0xaea91078.
+//
+// Solidity: function price(address poolAddr) view returns(uint256)
+func (_TokenPrice *TokenPriceCallerSession) Price(poolAddr common.Address) (*big.Int, error) {
+	return _TokenPrice.Contract.Price(&_TokenPrice.CallOpts, poolAddr)
+}
+
+// PriceV2 is a free data retrieval call binding the contract method 0x981bcefa.
+//
+// Solidity: function priceV2(address pairAddr) view returns(uint256)
+func (_TokenPrice *TokenPriceCaller) PriceV2(opts *bind.CallOpts, pairAddr common.Address) (*big.Int, error) {
+	var out []interface{}
+	err := _TokenPrice.contract.Call(opts, &out, "priceV2", pairAddr)
+
+	if err != nil {
+		return *new(*big.Int), err
+	}
+
+	out0 := *abi.ConvertType(out[0], new(*big.Int)).(**big.Int)
+
+	return out0, err
+
+}
+
+// PriceV2 is a free data retrieval call binding the contract method 0x981bcefa.
+//
+// Solidity: function priceV2(address pairAddr) view returns(uint256)
+func (_TokenPrice *TokenPriceSession) PriceV2(pairAddr common.Address) (*big.Int, error) {
+	return _TokenPrice.Contract.PriceV2(&_TokenPrice.CallOpts, pairAddr)
+}
+
+// PriceV2 is a free data retrieval call binding the contract method 0x981bcefa.
+//
+// Solidity: function priceV2(address pairAddr) view returns(uint256)
+func (_TokenPrice *TokenPriceCallerSession) PriceV2(pairAddr common.Address) (*big.Int, error) {
+	return _TokenPrice.Contract.PriceV2(&_TokenPrice.CallOpts, pairAddr)
+}
+
+// UniswapV2PairMetaData contains all meta data concerning the UniswapV2Pair contract.
+var UniswapV2PairMetaData = &bind.MetaData{
+	ABI: "[{\"inputs\":[],\"name\":\"getReserves\",\"outputs\":[{\"internalType\":\"uint112\",\"name\":\"_reserve0\",\"type\":\"uint112\"},{\"internalType\":\"uint112\",\"name\":\"_reserve1\",\"type\":\"uint112\"},{\"internalType\":\"uint32\",\"name\":\"_blockTimestampLast\",\"type\":\"uint32\"}],\"stateMutability\":\"view\",\"type\":\"function\"},{\"inputs\":[],\"name\":\"token0\",\"outputs\":[{\"internalType\":\"address\",\"name\":\"\",\"type\":\"address\"}],\"stateMutability\":\"view\",\"type\":\"function\"},{\"inputs\":[],\"name\":\"token1\",\"outputs\":[{\"internalType\":\"address\",\"name\":\"\",\"type\":\"address\"}],\"stateMutability\":\"view\",\"type\":\"function\"}]",
+}
+
+// UniswapV2PairABI is the input ABI used to generate the binding from.
+// Deprecated: Use UniswapV2PairMetaData.ABI instead.
+var UniswapV2PairABI = UniswapV2PairMetaData.ABI
+
+// UniswapV2Pair is an auto generated Go binding around an Ethereum contract.
+type UniswapV2Pair struct {
+	UniswapV2PairCaller     // Read-only binding to the contract
+	UniswapV2PairTransactor // Write-only binding to the contract
+	UniswapV2PairFilterer   // Log filterer for contract events
+}
+
+// UniswapV2PairCaller is an auto generated read-only Go binding around an Ethereum contract.
+type UniswapV2PairCaller struct {
+	contract *bind.BoundContract // Generic contract wrapper for the low level calls
+}
+
+// UniswapV2PairTransactor is an auto generated write-only Go binding around an Ethereum contract.
+type UniswapV2PairTransactor struct {
+	contract *bind.BoundContract // Generic contract wrapper for the low level calls
+}
+
+// UniswapV2PairFilterer is an auto generated log filtering Go binding around an Ethereum contract events.
+type UniswapV2PairFilterer struct {
+	contract *bind.BoundContract // Generic contract wrapper for the low level calls
+}
+
+// UniswapV2PairSession is an auto generated Go binding around an Ethereum contract,
+// with pre-set call and transact options.
+type UniswapV2PairSession struct {
+	Contract     *UniswapV2Pair    // Generic contract binding to set the session for
+	CallOpts     bind.CallOpts     // Call options to use throughout this session
+	TransactOpts bind.TransactOpts // Transaction auth options to use throughout this session
+}
+
+// UniswapV2PairCallerSession is an auto generated read-only Go binding around an Ethereum contract,
+// with pre-set call options.
+type UniswapV2PairCallerSession struct {
+	Contract *UniswapV2PairCaller // Generic contract caller binding to set the session for
+	CallOpts bind.CallOpts        // Call options to use throughout this session
+}
+
+// UniswapV2PairTransactorSession is an auto generated write-only Go binding around an Ethereum contract,
+// with pre-set transact options.
+type UniswapV2PairTransactorSession struct {
+	Contract     *UniswapV2PairTransactor // Generic contract transactor binding to set the session for
+	TransactOpts bind.TransactOpts        // Transaction auth options to use throughout this session
+}
+
+// UniswapV2PairRaw is an auto generated low-level Go binding around an Ethereum contract.
+type UniswapV2PairRaw struct {
+	Contract *UniswapV2Pair // Generic contract binding to access the raw methods on
+}
+
+// UniswapV2PairCallerRaw is an auto generated low-level read-only Go binding around an Ethereum contract.
+type UniswapV2PairCallerRaw struct {
+	Contract *UniswapV2PairCaller // Generic read-only contract binding to access the raw methods on
+}
+
+// UniswapV2PairTransactorRaw is an auto generated low-level write-only Go binding around an Ethereum contract.
+type UniswapV2PairTransactorRaw struct {
+	Contract *UniswapV2PairTransactor // Generic write-only contract binding to access the raw methods on
+}
+
+// NewUniswapV2Pair creates a new instance of UniswapV2Pair, bound to a specific deployed contract.
+func NewUniswapV2Pair(address common.Address, backend bind.ContractBackend) (*UniswapV2Pair, error) {
+	contract, err := bindUniswapV2Pair(address, backend, backend, backend)
+	if err != nil {
+		return nil, err
+	}
+	return &UniswapV2Pair{UniswapV2PairCaller: UniswapV2PairCaller{contract: contract}, UniswapV2PairTransactor: UniswapV2PairTransactor{contract: contract}, UniswapV2PairFilterer: UniswapV2PairFilterer{contract: contract}}, nil
+}
+
+// NewUniswapV2PairCaller creates a new read-only instance of UniswapV2Pair, bound to a specific deployed contract.
+func NewUniswapV2PairCaller(address common.Address, caller bind.ContractCaller) (*UniswapV2PairCaller, error) {
+	contract, err := bindUniswapV2Pair(address, caller, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &UniswapV2PairCaller{contract: contract}, nil
+}
+
+// NewUniswapV2PairTransactor creates a new write-only instance of UniswapV2Pair, bound to a specific deployed contract.
+func NewUniswapV2PairTransactor(address common.Address, transactor bind.ContractTransactor) (*UniswapV2PairTransactor, error) {
+	contract, err := bindUniswapV2Pair(address, nil, transactor, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &UniswapV2PairTransactor{contract: contract}, nil
+}
+
+// NewUniswapV2PairFilterer creates a new log filterer instance of UniswapV2Pair, bound to a specific deployed contract.
+func NewUniswapV2PairFilterer(address common.Address, filterer bind.ContractFilterer) (*UniswapV2PairFilterer, error) {
+	contract, err := bindUniswapV2Pair(address, nil, nil, filterer)
+	if err != nil {
+		return nil, err
+	}
+	return &UniswapV2PairFilterer{contract: contract}, nil
+}
+
+// bindUniswapV2Pair binds a generic wrapper to an already deployed contract.
+func bindUniswapV2Pair(address common.Address, caller bind.ContractCaller, transactor bind.ContractTransactor, filterer bind.ContractFilterer) (*bind.BoundContract, error) {
+	parsed, err := UniswapV2PairMetaData.GetAbi()
+	if err != nil {
+		return nil, err
+	}
+	return bind.NewBoundContract(address, *parsed, caller, transactor, filterer), nil
+}
+
+// Call invokes the (constant) contract method with params as input values and
+// sets the output to result. The result type might be a single field for simple
+// returns, a slice of interfaces for anonymous returns and a struct for named
+// returns.
+func (_UniswapV2Pair *UniswapV2PairRaw) Call(opts *bind.CallOpts, result *[]interface{}, method string, params ...interface{}) error {
+	return _UniswapV2Pair.Contract.UniswapV2PairCaller.contract.Call(opts, result, method, params...)
+}
+
+// Transfer initiates a plain transaction to move funds to the contract, calling
+// its default method if one is available.
+func (_UniswapV2Pair *UniswapV2PairRaw) Transfer(opts *bind.TransactOpts) (*types.Transaction, error) {
+	return _UniswapV2Pair.Contract.UniswapV2PairTransactor.contract.Transfer(opts)
+}
+
+// Transact invokes the (paid) contract method with params as input values.
+func (_UniswapV2Pair *UniswapV2PairRaw) Transact(opts *bind.TransactOpts, method string, params ...interface{}) (*types.Transaction, error) {
+	return _UniswapV2Pair.Contract.UniswapV2PairTransactor.contract.Transact(opts, method, params...)
+}
+
+// Call invokes the (constant) contract method with params as input values and
+// sets the output to result. The result type might be a single field for simple
+// returns, a slice of interfaces for anonymous returns and a struct for named
+// returns.
+func (_UniswapV2Pair *UniswapV2PairCallerRaw) Call(opts *bind.CallOpts, result *[]interface{}, method string, params ...interface{}) error {
+	return _UniswapV2Pair.Contract.contract.Call(opts, result, method, params...)
+}
+
+// Transfer initiates a plain transaction to move funds to the contract, calling
+// its default method if one is available.
+func (_UniswapV2Pair *UniswapV2PairTransactorRaw) Transfer(opts *bind.TransactOpts) (*types.Transaction, error) {
+	return _UniswapV2Pair.Contract.contract.Transfer(opts)
+}
+
+// Transact invokes the (paid) contract method with params as input values.
+func (_UniswapV2Pair *UniswapV2PairTransactorRaw) Transact(opts *bind.TransactOpts, method string, params ...interface{}) (*types.Transaction, error) {
+	return _UniswapV2Pair.Contract.contract.Transact(opts, method, params...)
+}
+
+// GetReserves is a free data retrieval call binding the contract method 0x0902f1ac.
+//
+// Solidity: function getReserves() view returns(uint112 _reserve0, uint112 _reserve1, uint32 _blockTimestampLast)
+func (_UniswapV2Pair *UniswapV2PairCaller) GetReserves(opts *bind.CallOpts) (struct {
+	Reserve0           *big.Int
+	Reserve1           *big.Int
+	BlockTimestampLast uint32
+}, error) {
+	var out []interface{}
+	err := _UniswapV2Pair.contract.Call(opts, &out, "getReserves")
+
+	outstruct := new(struct {
+		Reserve0           *big.Int
+		Reserve1           *big.Int
+		BlockTimestampLast uint32
+	})
+	if err != nil {
+		return *outstruct, err
+	}
+
+	outstruct.Reserve0 = *abi.ConvertType(out[0], new(*big.Int)).(**big.Int)
+	outstruct.Reserve1 = *abi.ConvertType(out[1], new(*big.Int)).(**big.Int)
+	outstruct.BlockTimestampLast = *abi.ConvertType(out[2], new(uint32)).(*uint32)
+
+	return *outstruct, err
+
+}
+
+// GetReserves is a free data retrieval call binding the contract method 0x0902f1ac.
+//
+// Solidity: function getReserves() view returns(uint112 _reserve0, uint112 _reserve1, uint32 _blockTimestampLast)
+func (_UniswapV2Pair *UniswapV2PairSession) GetReserves() (struct {
+	Reserve0           *big.Int
+	Reserve1           *big.Int
+	BlockTimestampLast uint32
+}, error) {
+	return _UniswapV2Pair.Contract.GetReserves(&_UniswapV2Pair.CallOpts)
+}
+
+// GetReserves is a free data retrieval call binding the contract method 0x0902f1ac.
+//
+// Solidity: function getReserves() view returns(uint112 _reserve0, uint112 _reserve1, uint32 _blockTimestampLast)
+func (_UniswapV2Pair *UniswapV2PairCallerSession) GetReserves() (struct {
+	Reserve0           *big.Int
+	Reserve1           *big.Int
+	BlockTimestampLast uint32
+}, error) {
+	return _UniswapV2Pair.Contract.GetReserves(&_UniswapV2Pair.CallOpts)
+}
+
+// Token0 is a free data retrieval call binding the contract method 0x0dfe1681.
+//
+// Solidity: function token0() view returns(address)
+func (_UniswapV2Pair *UniswapV2PairCaller) Token0(opts *bind.CallOpts) (common.Address, error) {
+	var out []interface{}
+	err := _UniswapV2Pair.contract.Call(opts, &out, "token0")
+
+	if err != nil {
+		return *new(common.Address), err
+	}
+
+	out0 := *abi.ConvertType(out[0], new(common.Address)).(*common.Address)
+
+	return out0, err
+
+}
+
+// Token0 is a free data retrieval call binding the contract method 0x0dfe1681.
+//
+// Solidity: function token0() view returns(address)
+func (_UniswapV2Pair *UniswapV2PairSession) Token0() (common.Address, error) {
+	return _UniswapV2Pair.Contract.Token0(&_UniswapV2Pair.CallOpts)
+}
+
+// Token0 is a free data retrieval call binding the contract method 0x0dfe1681.
+//
+// Solidity: function token0() view returns(address)
+func (_UniswapV2Pair *UniswapV2PairCallerSession) Token0() (common.Address, error) {
+	return _UniswapV2Pair.Contract.Token0(&_UniswapV2Pair.CallOpts)
+}
+
+// Token1 is a free data retrieval call binding the contract method 0xd21220a7.
+//
+// Solidity: function token1() view returns(address)
+func (_UniswapV2Pair *UniswapV2PairCaller) Token1(opts *bind.CallOpts) (common.Address, error) {
+	var out []interface{}
+	err := _UniswapV2Pair.contract.Call(opts, &out, "token1")
+
+	if err != nil {
+		return *new(common.Address), err
+	}
+
+	out0 := *abi.ConvertType(out[0], new(common.Address)).(*common.Address)
+
+	return out0, err
+
+}
+
+// Token1 is a free data retrieval call binding the contract method 0xd21220a7.
+//
+// Solidity: function token1() view returns(address)
+func (_UniswapV2Pair *UniswapV2PairSession) Token1() (common.Address, error) {
+	return _UniswapV2Pair.Contract.Token1(&_UniswapV2Pair.CallOpts)
+}
+
+// Token1 is a free data retrieval call binding the contract method 0xd21220a7.
+//
+// Solidity: function token1() view returns(address)
+func (_UniswapV2Pair *UniswapV2PairCallerSession) Token1() (common.Address, error) {
+	return _UniswapV2Pair.Contract.Token1(&_UniswapV2Pair.CallOpts)
+}
+
+// UniswapV3PoolMetaData contains all meta data concerning the UniswapV3Pool contract.
+var UniswapV3PoolMetaData = &bind.MetaData{
+	ABI: "[{\"inputs\":[],\"name\":\"slot0\",\"outputs\":[{\"internalType\":\"uint160\",\"name\":\"sqrtPriceX96\",\"type\":\"uint160\"},{\"internalType\":\"int24\",\"name\":\"tick\",\"type\":\"int24\"},{\"internalType\":\"uint16\",\"name\":\"observationIndex\",\"type\":\"uint16\"},{\"internalType\":\"uint16\",\"name\":\"observationCardinality\",\"type\":\"uint16\"},{\"internalType\":\"uint16\",\"name\":\"observationCardinalityNext\",\"type\":\"uint16\"},{\"internalType\":\"uint8\",\"name\":\"feeProtocol\",\"type\":\"uint8\"},{\"internalType\":\"bool\",\"name\":\"unlocked\",\"type\":\"bool\"}],\"stateMutability\":\"view\",\"type\":\"function\"},{\"inputs\":[],\"name\":\"token0\",\"outputs\":[{\"internalType\":\"address\",\"name\":\"\",\"type\":\"address\"}],\"stateMutability\":\"view\",\"type\":\"function\"},{\"inputs\":[],\"name\":\"token1\",\"outputs\":[{\"internalType\":\"address\",\"name\":\"\",\"type\":\"address\"}],\"stateMutability\":\"view\",\"type\":\"function\"}]",
+}
+
+// UniswapV3PoolABI is the input ABI used to generate the binding from.
+// Deprecated: Use UniswapV3PoolMetaData.ABI instead.
+var UniswapV3PoolABI = UniswapV3PoolMetaData.ABI
+
+// UniswapV3Pool is an auto generated Go binding around an Ethereum contract.
+type UniswapV3Pool struct {
+	UniswapV3PoolCaller     // Read-only binding to the contract
+	UniswapV3PoolTransactor // Write-only binding to the contract
+	UniswapV3PoolFilterer   // Log filterer for contract events
+}
+
+// UniswapV3PoolCaller is an auto generated read-only Go binding around an Ethereum contract.
+type UniswapV3PoolCaller struct {
+	contract *bind.BoundContract // Generic contract wrapper for the low level calls
+}
+
+// UniswapV3PoolTransactor is an auto generated write-only Go binding around an Ethereum contract.
+type UniswapV3PoolTransactor struct {
+	contract *bind.BoundContract // Generic contract wrapper for the low level calls
+}
+
+// UniswapV3PoolFilterer is an auto generated log filtering Go binding around an Ethereum contract events.
+type UniswapV3PoolFilterer struct {
+	contract *bind.BoundContract // Generic contract wrapper for the low level calls
+}
+
+// UniswapV3PoolSession is an auto generated Go binding around an Ethereum contract,
+// with pre-set call and transact options.
+type UniswapV3PoolSession struct {
+	Contract     *UniswapV3Pool    // Generic contract binding to set the session for
+	CallOpts     bind.CallOpts     // Call options to use throughout this session
+	TransactOpts bind.TransactOpts // Transaction auth options to use throughout this session
+}
+
+// UniswapV3PoolCallerSession is an auto generated read-only Go binding around an Ethereum contract,
+// with pre-set call options.
+type UniswapV3PoolCallerSession struct {
+	Contract *UniswapV3PoolCaller // Generic contract caller binding to set the session for
+	CallOpts bind.CallOpts        // Call options to use throughout this session
+}
+
+// UniswapV3PoolTransactorSession is an auto generated write-only Go binding around an Ethereum contract,
+// with pre-set transact options.
+type UniswapV3PoolTransactorSession struct {
+	Contract     *UniswapV3PoolTransactor // Generic contract transactor binding to set the session for
+	TransactOpts bind.TransactOpts        // Transaction auth options to use throughout this session
+}
+
+// UniswapV3PoolRaw is an auto generated low-level Go binding around an Ethereum contract.
+type UniswapV3PoolRaw struct {
+	Contract *UniswapV3Pool // Generic contract binding to access the raw methods on
+}
+
+// UniswapV3PoolCallerRaw is an auto generated low-level read-only Go binding around an Ethereum contract.
+type UniswapV3PoolCallerRaw struct {
+	Contract *UniswapV3PoolCaller // Generic read-only contract binding to access the raw methods on
+}
+
+// UniswapV3PoolTransactorRaw is an auto generated low-level write-only Go binding around an Ethereum contract.
+type UniswapV3PoolTransactorRaw struct {
+	Contract *UniswapV3PoolTransactor // Generic write-only contract binding to access the raw methods on
+}
+
+// NewUniswapV3Pool creates a new instance of UniswapV3Pool, bound to a specific deployed contract.
+func NewUniswapV3Pool(address common.Address, backend bind.ContractBackend) (*UniswapV3Pool, error) {
+	contract, err := bindUniswapV3Pool(address, backend, backend, backend)
+	if err != nil {
+		return nil, err
+	}
+	return &UniswapV3Pool{UniswapV3PoolCaller: UniswapV3PoolCaller{contract: contract}, UniswapV3PoolTransactor: UniswapV3PoolTransactor{contract: contract}, UniswapV3PoolFilterer: UniswapV3PoolFilterer{contract: contract}}, nil
+}
+
+// NewUniswapV3PoolCaller creates a new read-only instance of UniswapV3Pool, bound to a specific deployed contract.
+func NewUniswapV3PoolCaller(address common.Address, caller bind.ContractCaller) (*UniswapV3PoolCaller, error) {
+	contract, err := bindUniswapV3Pool(address, caller, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &UniswapV3PoolCaller{contract: contract}, nil
+}
+
+// NewUniswapV3PoolTransactor creates a new write-only instance of UniswapV3Pool, bound to a specific deployed contract.
+func NewUniswapV3PoolTransactor(address common.Address, transactor bind.ContractTransactor) (*UniswapV3PoolTransactor, error) {
+	contract, err := bindUniswapV3Pool(address, nil, transactor, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &UniswapV3PoolTransactor{contract: contract}, nil
+}
+
+// NewUniswapV3PoolFilterer creates a new log filterer instance of UniswapV3Pool, bound to a specific deployed contract.
+func NewUniswapV3PoolFilterer(address common.Address, filterer bind.ContractFilterer) (*UniswapV3PoolFilterer, error) {
+	contract, err := bindUniswapV3Pool(address, nil, nil, filterer)
+	if err != nil {
+		return nil, err
+	}
+	return &UniswapV3PoolFilterer{contract: contract}, nil
+}
+
+// bindUniswapV3Pool binds a generic wrapper to an already deployed contract.
+func bindUniswapV3Pool(address common.Address, caller bind.ContractCaller, transactor bind.ContractTransactor, filterer bind.ContractFilterer) (*bind.BoundContract, error) {
+	parsed, err := UniswapV3PoolMetaData.GetAbi()
+	if err != nil {
+		return nil, err
+	}
+	return bind.NewBoundContract(address, *parsed, caller, transactor, filterer), nil
+}
+
+// Call invokes the (constant) contract method with params as input values and
+// sets the output to result. The result type might be a single field for simple
+// returns, a slice of interfaces for anonymous returns and a struct for named
+// returns.
+func (_UniswapV3Pool *UniswapV3PoolRaw) Call(opts *bind.CallOpts, result *[]interface{}, method string, params ...interface{}) error {
+	return _UniswapV3Pool.Contract.UniswapV3PoolCaller.contract.Call(opts, result, method, params...)
+}
+
+// Transfer initiates a plain transaction to move funds to the contract, calling
+// its default method if one is available.
+func (_UniswapV3Pool *UniswapV3PoolRaw) Transfer(opts *bind.TransactOpts) (*types.Transaction, error) {
+	return _UniswapV3Pool.Contract.UniswapV3PoolTransactor.contract.Transfer(opts)
+}
+
+// Transact invokes the (paid) contract method with params as input values.
+func (_UniswapV3Pool *UniswapV3PoolRaw) Transact(opts *bind.TransactOpts, method string, params ...interface{}) (*types.Transaction, error) {
+	return _UniswapV3Pool.Contract.UniswapV3PoolTransactor.contract.Transact(opts, method, params...)
+}
+
+// Call invokes the (constant) contract method with params as input values and
+// sets the output to result. The result type might be a single field for simple
+// returns, a slice of interfaces for anonymous returns and a struct for named
+// returns.
+func (_UniswapV3Pool *UniswapV3PoolCallerRaw) Call(opts *bind.CallOpts, result *[]interface{}, method string, params ...interface{}) error {
+	return _UniswapV3Pool.Contract.contract.Call(opts, result, method, params...)
+}
+
+// Transfer initiates a plain transaction to move funds to the contract, calling
+// its default method if one is available.
+func (_UniswapV3Pool *UniswapV3PoolTransactorRaw) Transfer(opts *bind.TransactOpts) (*types.Transaction, error) {
+	return _UniswapV3Pool.Contract.contract.Transfer(opts)
+}
+
+// Transact invokes the (paid) contract method with params as input values.
+func (_UniswapV3Pool *UniswapV3PoolTransactorRaw) Transact(opts *bind.TransactOpts, method string, params ...interface{}) (*types.Transaction, error) {
+	return _UniswapV3Pool.Contract.contract.Transact(opts, method, params...)
+}
+
+// Slot0 is a free data retrieval call binding the contract method 0x3850c7bd.
+//
+// Solidity: function slot0() view returns(uint160 sqrtPriceX96, int24 tick, uint16 observationIndex, uint16 observationCardinality, uint16 observationCardinalityNext, uint8 feeProtocol, bool unlocked)
+func (_UniswapV3Pool *UniswapV3PoolCaller) Slot0(opts *bind.CallOpts) (struct {
+	SqrtPriceX96               *big.Int
+	Tick                       *big.Int
+	ObservationIndex           uint16
+	ObservationCardinality     uint16
+	ObservationCardinalityNext uint16
+	FeeProtocol                uint8
+	Unlocked                   bool
+}, error) {
+	var out []interface{}
+	err := _UniswapV3Pool.contract.Call(opts, &out, "slot0")
+
+	outstruct := new(struct {
+		SqrtPriceX96               *big.Int
+		Tick                       *big.Int
+		ObservationIndex           uint16
+		ObservationCardinality     uint16
+		ObservationCardinalityNext uint16
+		FeeProtocol                uint8
+		Unlocked                   bool
+	})
+	if err != nil {
+		return *outstruct, err
+	}
+
+	outstruct.SqrtPriceX96 = *abi.ConvertType(out[0], new(*big.Int)).(**big.Int)
+	outstruct.Tick = *abi.ConvertType(out[1], new(*big.Int)).(**big.Int)
+	outstruct.ObservationIndex = *abi.ConvertType(out[2], new(uint16)).(*uint16)
+	outstruct.ObservationCardinality = *abi.ConvertType(out[3], new(uint16)).(*uint16)
+	outstruct.ObservationCardinalityNext = *abi.ConvertType(out[4], new(uint16)).(*uint16)
+	outstruct.FeeProtocol = *abi.ConvertType(out[5], new(uint8)).(*uint8)
+	outstruct.Unlocked = *abi.ConvertType(out[6], new(bool)).(*bool)
+
+	return *outstruct, err
+
+}
+
+// Slot0 is a free data retrieval call binding the contract method 0x3850c7bd.
+//
+// Solidity: function slot0() view returns(uint160 sqrtPriceX96, int24 tick, uint16 observationIndex, uint16 observationCardinality, uint16 observationCardinalityNext, uint8 feeProtocol, bool unlocked)
+func (_UniswapV3Pool *UniswapV3PoolSession) Slot0() (struct {
+	SqrtPriceX96               *big.Int
+	Tick                       *big.Int
+	ObservationIndex           uint16
+	ObservationCardinality     uint16
+	ObservationCardinalityNext uint16
+	FeeProtocol                uint8
+	Unlocked                   bool
+}, error) {
+	return _UniswapV3Pool.Contract.Slot0(&_UniswapV3Pool.CallOpts)
+}
+
+// Slot0 is a free data retrieval call binding the contract method 0x3850c7bd.
+//
+// Solidity: function slot0() view returns(uint160 sqrtPriceX96, int24 tick, uint16 observationIndex, uint16 observationCardinality, uint16 observationCardinalityNext, uint8 feeProtocol, bool unlocked)
+func (_UniswapV3Pool *UniswapV3PoolCallerSession) Slot0() (struct {
+	SqrtPriceX96               *big.Int
+	Tick                       *big.Int
+	ObservationIndex           uint16
+	ObservationCardinality     uint16
+	ObservationCardinalityNext uint16
+	FeeProtocol                uint8
+	Unlocked                   bool
+}, error) {
+	return _UniswapV3Pool.Contract.Slot0(&_UniswapV3Pool.CallOpts)
+}
+
+// Token0 is a free data retrieval call binding the contract method 0x0dfe1681.
+//
+// Solidity: function token0() view returns(address)
+func (_UniswapV3Pool *UniswapV3PoolCaller) Token0(opts *bind.CallOpts) (common.Address, error) {
+	var out []interface{}
+	err := _UniswapV3Pool.contract.Call(opts, &out, "token0")
+
+	if err != nil {
+		return *new(common.Address), err
+	}
+
+	out0 := *abi.ConvertType(out[0], new(common.Address)).(*common.Address)
+
+	return out0, err
+
+}
+
+// Token0 is a free data retrieval call binding the contract method 0x0dfe1681.
+//
+// Solidity: function token0() view returns(address)
+func (_UniswapV3Pool *UniswapV3PoolSession) Token0() (common.Address, error) {
+	return _UniswapV3Pool.Contract.Token0(&_UniswapV3Pool.CallOpts)
+}
+
+// Token0 is a free data retrieval call binding the contract method 0x0dfe1681.
+//
+// Solidity: function token0() view returns(address)
+func (_UniswapV3Pool *UniswapV3PoolCallerSession) Token0() (common.Address, error) {
+	return _UniswapV3Pool.Contract.Token0(&_UniswapV3Pool.CallOpts)
+}
+
+// Token1 is a free data retrieval call binding the contract method 0xd21220a7.
+//
+// Solidity: function token1() view returns(address)
+func (_UniswapV3Pool *UniswapV3PoolCaller) Token1(opts *bind.CallOpts) (common.Address, error) {
+	var out []interface{}
+	err := _UniswapV3Pool.contract.Call(opts, &out, "token1")
+
+	if err != nil {
+		return *new(common.Address), err
+	}
+
+	out0 := *abi.ConvertType(out[0], new(common.Address)).(*common.Address)
+
+	return out0, err
+
+}
+
+// Token1 is a free data retrieval call binding the contract method 0xd21220a7.
+//
+// Solidity: function token1() view returns(address)
+func (_UniswapV3Pool *UniswapV3PoolSession) Token1() (common.Address, error) {
+	return _UniswapV3Pool.Contract.Token1(&_UniswapV3Pool.CallOpts)
+}
+
+// Token1 is a free data retrieval call binding the contract method 0xd21220a7.
+//
+// Solidity: function token1() view returns(address)
+func (_UniswapV3Pool *UniswapV3PoolCallerSession) Token1() (common.Address, error) {
+	return _UniswapV3Pool.Contract.Token1(&_UniswapV3Pool.CallOpts)
+}
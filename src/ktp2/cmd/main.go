@@ -5,6 +5,7 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"io"
 	"ktp2/src/abis/ktv2"
 	"ktp2/src/ktp2/ktfunc"
 	"ktp2/src/ktp2/tests"
@@ -67,6 +68,7 @@ type Flags struct {
 	printEvents           bool
 	v2Uniswap             bool
 	chunkSize             int
+	rpcBatchSize          int
 	voteToRemoveOC        string
 	voteToAddOC           string
 	resetVoteToAddOC      string
@@ -84,6 +86,38 @@ type Flags struct {
 	showVotes             bool
 	voteFor               string
 	resetLotteryVote      string
+	checkLedger           string
+	tailInterval          time.Duration
+	cacheDir              string
+	diagnosticsDir        string
+	inspectCache          bool
+	address               string
+	blocks                string
+	eventType             string
+	summary               bool
+	stats                 bool
+	format                string
+	out                   string
+	odds                  bool
+	stakerReport          string
+	verifyWinners         string
+	fairnessReport        string
+	exportEpochs          string
+	checkVectors          string
+	makeVector            string
+	converge              bool
+	stakeStats            string
+	topN                  int
+	autoWithdrawFees      string
+	withdrawMaxGas        float64
+	withdrawalLedger      string
+	feeReport             string
+	checkInvariants       bool
+	invariantInterval     time.Duration
+	claimReport           bool
+	previewGive           string
+	tokenPrice            bool
+	donations             string
 }
 
 func main() {
@@ -101,6 +135,12 @@ func main() {
 		os.Exit(0)
 	}
 
+	// --checkVectors is standalone too: vectors carry all their inputs, so
+	// no RPC connection is needed. The exit status reports the outcome.
+	if len(flags.checkVectors) > 0 {
+		os.Exit(runCheckVectors(flags))
+	}
+
 	// Mirror all logging into a rotating file so operators can send us logs.
 	if logPath, err := ktfunc.SetupFileLogging(flags.logDir); err != nil {
 		log.Warnf("Could not set up file logging in %s: %v (continuing with stdout only)", flags.logDir, err)
@@ -174,6 +214,42 @@ func runZipLogs(logDir string) {
 	fmt.Printf("Logs bundled into: %s\n", zipPath)
 }
 
+// runCheckVectors checks the -checkVectors file against this build and
+// returns the process exit status: 0 when every vector passes, 1 otherwise.
+func runCheckVectors(flags Flags) int {
+	log.SetLevel(log.ErrorLevel) // the pipeline narrates every step, including expected clamps
+	format, err := ktfunc.ParseOutputFormat(flags.format)
+	if err != nil {
+		log.Error(err)
+		return 1
+	}
+	f, err := ktfunc.ReadVectorFile(flags.checkVectors)
+	if err != nil {
+		log.Errorf("Failed to read vectors: %v", err)
+		return 1
+	}
+	results := ktfunc.CheckVectors(f)
+	w, closeOut, err := openOutput(flags.out)
+	if err != nil {
+		log.Error(err)
+		return 1
+	}
+	err = ktfunc.WriteVectorResults(w, results, format)
+	if cerr := closeOut(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		log.Error(err)
+		return 1
+	}
+	for _, r := range results {
+		if !r.Pass {
+			return 1
+		}
+	}
+	return 0
+}
+
 // rpcHost extracts just the host from an RPC endpoint so an API key embedded in
 // the URL's path or query never lands in a shared bundle.
 func rpcHost(endpoint string) string {
@@ -187,6 +263,369 @@ func rpcHost(endpoint string) string {
 	return u.Host
 }
 
+// openOutput returns where report commands write: the -out file, or stdout
+// when it is unset. The returned close func reports a failed final write.
+func openOutput(path string) (io.Writer, func() error, error) {
+	if path == "" {
+		return os.Stdout, func() error { return nil }, nil
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	return f, f.Close, nil
+}
+
+// runOdds writes the current epoch's provisional odds in the requested
+// format.
+func runOdds(cProps *ktfunc.ConnectionProps, flags Flags) error {
+	format, err := ktfunc.ParseOutputFormat(flags.format)
+	if err != nil {
+		return err
+	}
+	report, err := ktfunc.EpochOdds(cProps)
+	if err != nil {
+		return err
+	}
+	w, closeOut, err := openOutput(flags.out)
+	if err != nil {
+		return err
+	}
+	if err := ktfunc.WriteOddsReport(w, report, format); err != nil {
+		closeOut()
+		return err
+	}
+	return closeOut()
+}
+
+// runStakerReport writes the -stakerReport history in the requested format.
+func runStakerReport(cProps *ktfunc.ConnectionProps, flags Flags) error {
+	if !common.IsHexAddress(flags.stakerReport) {
+		return fmt.Errorf("invalid address %q", flags.stakerReport)
+	}
+	format, err := ktfunc.ParseOutputFormat(flags.format)
+	if err != nil {
+		return err
+	}
+	report, err := ktfunc.BuildStakerReport(cProps, common.HexToAddress(flags.stakerReport))
+	if err != nil {
+		return err
+	}
+	w, closeOut, err := openOutput(flags.out)
+	if err != nil {
+		return err
+	}
+	if err := ktfunc.WriteStakerReport(w, report, format); err != nil {
+		closeOut()
+		return err
+	}
+	return closeOut()
+}
+
+// runVerifyWinners writes the -verifyWinners audit in the requested format.
+func runVerifyWinners(cProps *ktfunc.ConnectionProps, flags Flags) error {
+	from, to, err := ktfunc.ParseStartEndBlocks(flags.verifyWinners)
+	if err != nil {
+		return err
+	}
+	format, err := ktfunc.ParseOutputFormat(flags.format)
+	if err != nil {
+		return err
+	}
+	audits, err := ktfunc.AuditWinners(cProps, from, to)
+	if err != nil {
+		return err
+	}
+	w, closeOut, err := openOutput(flags.out)
+	if err != nil {
+		return err
+	}
+	if err := ktfunc.WriteWinnerAudit(w, audits, format); err != nil {
+		closeOut()
+		return err
+	}
+	return closeOut()
+}
+
+// runFairnessReport writes the -fairnessReport statistics as a table or JSON.
+func runFairnessReport(cProps *ktfunc.ConnectionProps, flags Flags) error {
+	from, to, err := ktfunc.ParseStartEndBlocks(flags.fairnessReport)
+	if err != nil {
+		return err
+	}
+	format, err := ktfunc.ParseOutputFormat(flags.format)
+	if err != nil {
+		return err
+	}
+	if format == ktfunc.FormatCSV {
+		return fmt.Errorf("-fairnessReport supports -format table or json")
+	}
+	report, err := ktfunc.BuildFairnessReport(cProps, from, to)
+	if err != nil {
+		return err
+	}
+	w, closeOut, err := openOutput(flags.out)
+	if err != nil {
+		return err
+	}
+	if err := ktfunc.WriteFairnessReport(w, report, format); err != nil {
+		closeOut()
+		return err
+	}
+	return closeOut()
+}
+
+// runStakeStats writes the -stakeStats report in the requested format.
+func runStakeStats(cProps *ktfunc.ConnectionProps, flags Flags) error {
+	from, to, err := ktfunc.ParseStartEndBlocks(flags.stakeStats)
+	if err != nil {
+		return err
+	}
+	format, err := ktfunc.ParseOutputFormat(flags.format)
+	if err != nil {
+		return err
+	}
+	report, err := ktfunc.BuildStakeStats(cProps, from, to, flags.topN)
+	if err != nil {
+		return err
+	}
+	w, closeOut, err := openOutput(flags.out)
+	if err != nil {
+		return err
+	}
+	if err := ktfunc.WriteStakeStats(w, report, format); err != nil {
+		closeOut()
+		return err
+	}
+	return closeOut()
+}
+
+// runFeeReport writes the -feeReport report for this node's OC in the
+// requested format.
+func runFeeReport(cProps *ktfunc.ConnectionProps, flags Flags) error {
+	from, to, err := ktfunc.ParseStartEndBlocks(flags.feeReport)
+	if err != nil {
+		return err
+	}
+	format, err := ktfunc.ParseOutputFormat(flags.format)
+	if err != nil {
+		return err
+	}
+	report, err := ktfunc.BuildFeeReport(cProps, cProps.MyPubKey, from, to)
+	if err != nil {
+		return err
+	}
+	w, closeOut, err := openOutput(flags.out)
+	if err != nil {
+		return err
+	}
+	if err := ktfunc.WriteFeeReport(w, report, format); err != nil {
+		closeOut()
+		return err
+	}
+	return closeOut()
+}
+
+// runClaimReport writes the -claimReport report in the requested format.
+func runClaimReport(cProps *ktfunc.ConnectionProps, flags Flags) error {
+	format, err := ktfunc.ParseOutputFormat(flags.format)
+	if err != nil {
+		return err
+	}
+	report, err := ktfunc.BuildClaimReport(cProps)
+	if err != nil {
+		return err
+	}
+	w, closeOut, err := openOutput(flags.out)
+	if err != nil {
+		return err
+	}
+	if err := ktfunc.WriteClaimReport(w, report, format); err != nil {
+		closeOut()
+		return err
+	}
+	return closeOut()
+}
+
+// runPreviewGive prints what -previewGive's donation would do.
+func runPreviewGive(cProps *ktfunc.ConnectionProps, flags Flags) error {
+	value, err := ktfunc.ParseEthAmount(flags.previewGive)
+	if err != nil {
+		return err
+	}
+	preview, err := ktfunc.PreviewGive(cProps, value)
+	if err != nil {
+		return err
+	}
+	ktfunc.LogGivePreview(preview)
+	return nil
+}
+
+// runTokenPrice prints the contract's token price and the pool cross-check.
+func runTokenPrice(cProps *ktfunc.ConnectionProps) error {
+	check, err := ktfunc.CheckTokenPrice(cProps)
+	if err != nil {
+		return err
+	}
+	ktfunc.LogTokenPriceCheck(check)
+	return nil
+}
+
+// runDonations writes the -donations report in the requested format.
+func runDonations(cProps *ktfunc.ConnectionProps, flags Flags) error {
+	from, to, err := ktfunc.ParseStartEndBlocks(flags.donations)
+	if err != nil {
+		return err
+	}
+	format, err := ktfunc.ParseOutputFormat(flags.format)
+	if err != nil {
+		return err
+	}
+	report, err := ktfunc.BuildDonationReport(cProps, from, to)
+	if err != nil {
+		return err
+	}
+	w, closeOut, err := openOutput(flags.out)
+	if err != nil {
+		return err
+	}
+	if err := ktfunc.WriteDonationReport(w, report, format); err != nil {
+		closeOut()
+		return err
+	}
+	return closeOut()
+}
+
+// runCheckInvariants runs -checkInvariants. Violations are logged by the
+// report itself; the error is only for a check that could not complete.
+func runCheckInvariants(cProps *ktfunc.ConnectionProps) error {
+	report, err := ktfunc.CheckInvariants(cProps)
+	if err != nil {
+		return err
+	}
+	ktfunc.LogInvariantReport(report)
+	return nil
+}
+
+// runExportEpochs writes the -exportEpochs records as JSON Lines, or CSV
+// with -format csv.
+func runExportEpochs(cProps *ktfunc.ConnectionProps, flags Flags) error {
+	from, to, err := ktfunc.ParseStartEndBlocks(flags.exportEpochs)
+	if err != nil {
+		return err
+	}
+	format, err := ktfunc.ParseOutputFormat(flags.format)
+	if err != nil {
+		return err
+	}
+	records, err := ktfunc.ExportEpochs(cProps, from, to)
+	if err != nil {
+		return err
+	}
+	w, closeOut, err := openOutput(flags.out)
+	if err != nil {
+		return err
+	}
+	if err := ktfunc.WriteEpochRecords(w, records, format); err != nil {
+		closeOut()
+		return err
+	}
+	return closeOut()
+}
+
+// runMakeVector captures the -makeVector epoch. With -out the vector is
+// appended to that vector file (created if missing); otherwise a one-vector
+// file is written to stdout.
+func runMakeVector(cProps *ktfunc.ConnectionProps, flags Flags) error {
+	start, end, err := ktfunc.ParseStartEndBlocks(flags.makeVector)
+	if err != nil {
+		return err
+	}
+	v, err := ktfunc.MakeVector(cProps, start, end, "")
+	if err != nil {
+		return err
+	}
+	if flags.out != "" {
+		if err := ktfunc.AppendVector(flags.out, v); err != nil {
+			return err
+		}
+		log.Infof("Vector %q appended to %s", v.Name, flags.out)
+		return nil
+	}
+	return ktfunc.WriteVectorFile(os.Stdout, &ktfunc.LotteryVectorFile{Version: ktfunc.LotteryVectorVersion, Vectors: []ktfunc.LotteryVector{*v}})
+}
+
+// runConverge prints the convergence plan for the current epoch and, if it
+// can be executed, sends its steps once the operator confirms.
+func runConverge(cProps *ktfunc.ConnectionProps) error {
+	plan, err := ktfunc.PlanConvergence(cProps)
+	if err != nil {
+		return err
+	}
+	ktfunc.WriteConvergePlan(os.Stdout, plan)
+	if !plan.Executable() {
+		return nil
+	}
+
+	fmt.Print("Send these transactions? (y/N): ")
+	scanner := bufio.NewScanner(os.Stdin)
+	scanner.Scan()
+	response := strings.ToLower(strings.TrimSpace(scanner.Text()))
+	if response != "y" && response != "yes" {
+		log.Infof("Nothing sent.")
+		return nil
+	}
+	if err := ktfunc.ExecuteConvergePlan(cProps, plan); err != nil {
+		return err
+	}
+	log.Infof("Done. Run -converge again to see where the epoch stands.")
+	return nil
+}
+
+// runInspectCache turns the -inspectCache filter and section flags into a
+// cache query and writes the report in the requested format.
+func runInspectCache(cProps *ktfunc.ConnectionProps, flags Flags) error {
+	format, err := ktfunc.ParseOutputFormat(flags.format)
+	if err != nil {
+		return err
+	}
+	var q ktfunc.CacheQuery
+	if flags.address != "" {
+		if !common.IsHexAddress(flags.address) {
+			return fmt.Errorf("invalid -address %q", flags.address)
+		}
+		addr := common.HexToAddress(flags.address)
+		q.Addr = &addr
+	}
+	if flags.blocks != "" {
+		if q.FromBlock, q.ToBlock, err = ktfunc.ParseStartEndBlocks(flags.blocks); err != nil {
+			return fmt.Errorf("invalid -blocks: %w", err)
+		}
+		if q.ToBlock < q.FromBlock {
+			return fmt.Errorf("invalid -blocks %s: end is before start", flags.blocks)
+		}
+	}
+	if q.EventType, err = ktfunc.ParseCacheEventType(flags.eventType); err != nil {
+		return err
+	}
+	sections := ktfunc.CacheSections{Summary: flags.summary, Stats: flags.stats}
+	sections.Events = !sections.Summary && !sections.Stats
+
+	report, err := ktfunc.InspectCache(cProps, q, sections)
+	if err != nil {
+		return err
+	}
+	w, closeOut, err := openOutput(flags.out)
+	if err != nil {
+		return err
+	}
+	if err := ktfunc.WriteCacheReport(w, report, format); err != nil {
+		closeOut()
+		return err
+	}
+	return closeOut()
+}
+
 func displayStartupBanner() {
 	fmt.Print("\n")
 	fmt.Print("──────────────────────────────────────────────────────────────────────────────────────────\n")
@@ -239,6 +678,7 @@ func parseFlags() Flags {
 	printEvents := flag.Bool("printEvents", false, "Print the contents of the cache for debugging purposes.")
 	v2Uniswap := flag.Bool("v2Uniswap", false, "Use Uniswap V2 instead of V3 for token swaps. Set this if your token pool is V3.")
 	chunkSize := flag.Int("chunkSize", 0, "Set the chunk size for processing large data sets. Adjust based on performance needs.")
+	rpcBatchSize := flag.Int("rpcBatchSize", 0, fmt.Sprintf("Transaction lookups per JSON-RPC batch request (default: %d). 1 sends each as its own call.", ktfunc.DefaultRPCBatchSize))
 	voteToRemoveOC := flag.String("voteToRemoveOC", "", "Vote to remove an OC with the given Ethereum address")
 	voteToAddOC := flag.String("voteToAddOC", "", "Vote to add an OC with the given Ethereum address")
 	resetVoteToAddOC := flag.String("resetVoteToAddOC", "", "Reset vote to add an OC with the given Ethereum address")
@@ -254,6 +694,38 @@ func parseFlags() Flags {
 	showVotes := flag.Bool("showVotes", false, "Print the current epoch's reward votes: per-candidate tallies and which OC voted for which address.")
 	voteFor := flag.String("voteFor", "", "Manually cast a reward vote for the given address in the current epoch, overriding the lottery. Use to converge a stuck epoch on an agreed winner.")
 	resetLotteryVote := flag.String("resetLotteryVote", "", "Undo this node's reward vote for the given address (the one you previously voted for) in the current epoch, so you can re-vote.")
+	tailInterval := flag.Duration("tailInterval", ktfunc.DefaultTailInterval, fmt.Sprintf("With -run, how often the background tailer moves the event cache forward so the end-of-epoch gather only fetches the last few blocks (ex: 30s, 2m). 0 disables the tailer. Default %s.", ktfunc.DefaultTailInterval))
+	cacheDir := flag.String("cacheDir", "", "Directory for the event, ledger and fee caches (default: cache). Files are kept per chain ID and contract address inside it. Can also be set via the CACHE_DIR env var.")
+	diagnosticsDir := flag.String("diagnosticsDir", "", "Directory for diagnostic bundles, such as the one written when a peer votes for a different winner (default: diagnostics).")
+	inspectCache := flag.Bool("inspectCache", false, "Query the event cache read-only: it never writes the cache or queries the contract, and reports a cache that needs migrating instead of migrating it. Lists cached events by default; narrow with -address, -blocks and -eventType, or ask for -summary and/or -stats instead.")
+	address := flag.String("address", "", "With -inspectCache, only include events of this address.")
+	blocks := flag.String("blocks", "", "With -inspectCache, only include events in <startBlock>:<endBlock> (inclusive).")
+	eventType := flag.String("eventType", "", "With -inspectCache, only include events of this type: stake, withdraw or gave.")
+	summary := flag.Bool("summary", false, "With -inspectCache, report per-address event counts and net stake of the matching events.")
+	stats := flag.Bool("stats", false, "With -inspectCache, report cache stats: chunks, events, tip, tip hash, schema version and size on disk.")
+	odds := flag.Bool("odds", false, "Show every eligible staker's provisional minimum stake and win probability for the epoch in progress, as of the current block. Honours -format and -out.")
+	stakerReport := flag.String("stakerReport", "", "Show one address's history: stake/withdraw timeline, minimum stake and win chance in every rewarded epoch, epochs won and current decline status. Honours -format and -out.")
+	verifyWinners := flag.String("verifyWinners", "", "Replay the winner calculation for every epoch rewarded in <fromBlock>:<toBlock> and report match, mismatch, manual-override or no-stake per epoch. Honours -format and -out.")
+	fairnessReport := flag.String("fairnessReport", "", "Compare expected and observed wins per staker over every lottery draw rewarded in <fromBlock>:<toBlock>, with a chi-square test and the distribution of seed values. Honours -format (table or json) and -out.")
+	exportEpochs := flag.String("exportEpochs", "", "Export one record per epoch rewarded in <fromBlock>:<toBlock> (seed, minimum stakes, probabilities, declines, winner, reward, OC fee, voters) as JSON Lines, or CSV with -format csv. Honours -out.")
+	checkVectors := flag.String("checkVectors", "", "Run the lottery pipeline against every test vector in <file> and report any difference from the expected minimums, probabilities and winner. Needs no RPC connection; exits non-zero on failure.")
+	makeVector := flag.String("makeVector", "", "Capture the epoch <startBlock>:<endBlock> from the chain as a lottery test vector. With -out, appends it to that vector file.")
+	converge := flag.Bool("converge", false, "Explain why the current epoch has not paid out, recompute the lottery winner and print the reset and vote this node should send. Asks for confirmation before sending them, and refuses any step the contract would revert.")
+	stakeStats := flag.String("stakeStats", "", "Report staking health for every epoch rewarded in <fromBlock>:<toBlock> from the replayed minimums: stakers, Gini coefficient, top-N share, effective number of participants by stake and by lottery odds, and declined share, with the change from epoch to epoch. Honours -format and -out.")
+	topN := flag.Int("topN", ktfunc.DefaultTopN, "How many of the largest stakers the -stakeStats top-N share covers.")
+	autoWithdrawFees := flag.String("autoWithdrawFees", "", "With -run, withdraw this node's OC fees once pastOcFees exceeds this many ETH (ex: 0.1). Only done while the epoch still has blocks to run, never in the voting window. Empty disables.")
+	withdrawMaxGas := flag.Float64("withdrawMaxGas", ktfunc.DefaultWithdrawMaxGasFraction, "With -autoWithdrawFees, the largest fraction of the owed fees the withdrawal may spend on gas.")
+	feeReport := flag.String("feeReport", "", "Report this node's OC fee income in blocks <fromBlock>:<toBlock>: the fee accrued per epoch, each recorded withdrawal with its timestamp, amount received and gas, and the running balance owed. Honours -format and -out.")
+	checkInvariants := flag.Bool("checkInvariants", false, "Check the contract's accounting invariants at the current block: the ETH balance covers tlOcFees, tlOcFees equals the pastOcFees and current-epoch ocFees of every OC that has voted or rewarded, and totalStk equals the stake less withdrawals and burns seen in events. Violations are logged as INVARIANT errors.")
+	invariantInterval := flag.Duration("invariantInterval", ktfunc.DefaultInvariantCheckInterval, fmt.Sprintf("With -run, how often to check the contract's invariants (ex: 30m, 6h). A violation is alerted once until it changes. 0 disables. Default %s.", ktfunc.DefaultInvariantCheckInterval))
+	claimReport := flag.Bool("claimReport", false, "Compare the stakers' claims (staked less withdrawn) with totalStk, which give() burns reduce without touching any claim: the shortfall, each staker's claim and how much of it is at risk if the others withdraw first, and every burn since creation. Honours -format and -out.")
+	previewGive := flag.String("previewGive", "", "Preview a give() of this many ETH (ex: 0.5) without sending it: the donation, the token equivalent at the contract's pool price, the burn tier and the tokens it would burn.")
+	tokenPrice := flag.Bool("tokenPrice", false, "Read the token price give() uses from the contract's TokenPrice contract, cross-checked against the pool's slot0 or reserves.")
+	donations := flag.String("donations", "", "List the give() donations in blocks <fromBlock>:<toBlock> with totals per donor and per epoch and the tokens each epoch's donations burned, reconciled against totalGvn and totalBurned. Honours -format and -out.")
+	withdrawalLedger := flag.String("withdrawalLedger", "", fmt.Sprintf("JSON Lines file OC fee withdrawals are recorded in (default: %s).", ktfunc.DefaultWithdrawalLedger))
+	format := flag.String("format", "table", "Output format for report commands: table, json or csv.")
+	out := flag.String("out", "", "Write report output to this file instead of stdout.")
+	checkLedger := flag.String("checkLedger", "", "Compare the stake ledger against a full rebuild from the creation block for the epoch <startBlock>:<endBlock> and report any difference in minimum stakes.")
 
 	// Testing Commands (for development and testing)
 	continuous := flag.Bool("continuous", false, "TESTING: Run continuous operations in a loop, simulating various actions (e.g., staking, giving ETH). For development use only.")
@@ -291,14 +763,38 @@ func parseFlags() Flags {
 		fmt.Fprintf(os.Stderr, "  -waitDuration <duration> %s\n", "Set the duration to wait between operations (e.g., 1s, 2m).")
 		fmt.Fprintf(os.Stderr, "  -v2Uniswap          %s\n", "Use Uniswap V2 instead of V3 for token swaps.")
 		fmt.Fprintf(os.Stderr, "  -chunkSize <n>      %s\n", "Set the chunk size for processing large data sets.")
+		fmt.Fprintf(os.Stderr, "  -rpcBatchSize <n>   %s\n", "Transaction lookups per JSON-RPC batch request. 1 sends each as its own call.")
 		fmt.Fprintf(os.Stderr, "  -setOCFee <n>       %s\n", "Set the OC fee to the specified uint16 value. Multiply by ten. For example, use 20 for 2% fee.")
 		fmt.Fprintf(os.Stderr, "  -withdrawFees       %s\n", "Withdraw owed fees from kt.")
 		fmt.Fprintf(os.Stderr, "  -verifyLastWinner   %s\n", "Verify the last rewarded winner was correctly and fairly selected.")
 		fmt.Fprintf(os.Stderr, "  -showVotes          %s\n", "Show the current epoch's reward votes: per-candidate tallies and which OC voted for which address.")
 		fmt.Fprintf(os.Stderr, "  -voteFor <address>  %s\n", "Manually cast a reward vote for an address this epoch (override the lottery). Use to converge a stuck epoch.")
 		fmt.Fprintf(os.Stderr, "  -resetLotteryVote <address> %s\n", "Undo this node's reward vote (the address you voted for) so you can re-vote this epoch.")
+		fmt.Fprintf(os.Stderr, "  -tailInterval <duration> %s\n", "With -run, how often to keep the event cache warm in the background (0 disables).")
+		fmt.Fprintf(os.Stderr, "  -autoWithdrawFees <eth> %s\n", "With -run, withdraw OC fees once they exceed this many ETH, outside the voting window (-withdrawMaxGas caps gas as a fraction, -withdrawalLedger sets the record file).")
+		fmt.Fprintf(os.Stderr, "  -checkLedger <start:end> %s\n", "Check the stake ledger against a full rebuild from the creation block for one epoch.")
+		fmt.Fprintf(os.Stderr, "  -inspectCache       %s\n", "Query the event cache. Filters: -address <addr>, -blocks <start:end>, -eventType stake|withdraw|gave. Sections: -summary, -stats.")
+		fmt.Fprintf(os.Stderr, "  -odds               %s\n", "Preview this epoch's win probabilities from the stakes seen so far (provisional until the epoch ends).")
+		fmt.Fprintf(os.Stderr, "  -stakerReport <address> %s\n", "Show a staker's timeline, per-epoch minimum and odds, wins and decline status.")
+		fmt.Fprintf(os.Stderr, "  -verifyWinners <from:to> %s\n", "Audit every rewarded epoch in a block range against a replay of the lottery.")
+		fmt.Fprintf(os.Stderr, "  -fairnessReport <from:to> %s\n", "Test the lottery's fairness over many draws: expected vs observed wins and seed uniformity.")
+		fmt.Fprintf(os.Stderr, "  -exportEpochs <from:to> %s\n", "Export per-epoch records for analysis as JSON Lines (or CSV with -format csv).")
+		fmt.Fprintf(os.Stderr, "  -checkVectors <file> %s\n", "Check this build against lottery test vectors (offline; non-zero exit on failure).")
+		fmt.Fprintf(os.Stderr, "  -makeVector <start:end> %s\n", "Capture a real epoch as a lottery test vector (appended to -out if given).")
+		fmt.Fprintf(os.Stderr, "  -converge           %s\n", "Diagnose a stuck epoch and plan (and, if confirmed, send) this node's reset and vote.")
+		fmt.Fprintf(os.Stderr, "  -stakeStats <from:to> %s\n", "Stake concentration and participation per rewarded epoch (-topN <n> sets the top-N share, default 5).")
+		fmt.Fprintf(os.Stderr, "  -feeReport <from:to> %s\n", "OC fee income per epoch and per withdrawal, with the running balance owed, for accounting.")
+		fmt.Fprintf(os.Stderr, "  -checkInvariants    %s\n", "Check the contract's fee reserve and stake accounting against their parts (-invariantInterval sets how often -run checks).")
+		fmt.Fprintf(os.Stderr, "  -claimReport        %s\n", "Staker claims against the burn-reduced totalStk: the shortfall and the claims at risk.")
+		fmt.Fprintf(os.Stderr, "  -previewGive <eth>  %s\n", "Show what a donation of this many ETH would burn, computed as the contract's give() does.")
+		fmt.Fprintf(os.Stderr, "  -tokenPrice         %s\n", "The contract's token price, checked against the pool it reads from.")
+		fmt.Fprintf(os.Stderr, "  -donations <from:to> %s\n", "Donations per donor and per epoch, with their burns, checked against totalGvn and totalBurned.")
+		fmt.Fprintf(os.Stderr, "  -format <fmt>       %s\n", "Output format for report commands: table (default), json or csv.")
+		fmt.Fprintf(os.Stderr, "  -out <file>         %s\n", "Write report output to a file instead of stdout.")
 		fmt.Fprintf(os.Stderr, "  -zipLogs            %s\n", "Bundle recent log files into a zip in the current directory for a bug report, then exit.")
 		fmt.Fprintf(os.Stderr, "  -logDir <dir>       %s\n", "Directory for log files (default: logs).")
+		fmt.Fprintf(os.Stderr, "  -cacheDir <dir>     %s\n", "Directory for the event and fee caches (default: cache).")
+		fmt.Fprintf(os.Stderr, "  -diagnosticsDir <dir> %s\n", "Directory for diagnostic bundles (default: diagnostics).")
 		fmt.Fprintf(os.Stderr, "  -confirmationDepth <n> %s\n", "Blocks to wait after the seed block before voting, for reorg safety (does not change the winner).")
 		fmt.Fprintf(os.Stderr, "  -txMineTimeout <duration> %s\n", "How long to wait for a tx to mine before giving up and retrying (e.g., 2m, 10m). Stops the node hanging on a dropped tx.")
 		PrintOCUsage()
@@ -348,6 +844,7 @@ func parseFlags() Flags {
 		waitDuration:          *waitDuration,
 		v2Uniswap:             *v2Uniswap,
 		chunkSize:             *chunkSize,
+		rpcBatchSize:          *rpcBatchSize,
 		printEvents:           *printEvents,
 		voteToRemoveOC:        *voteToRemoveOC,
 		voteToAddOC:           *voteToAddOC,
@@ -364,6 +861,38 @@ func parseFlags() Flags {
 		showVotes:             *showVotes,
 		voteFor:               *voteFor,
 		resetLotteryVote:      *resetLotteryVote,
+		checkLedger:           *checkLedger,
+		tailInterval:          *tailInterval,
+		cacheDir:              *cacheDir,
+		diagnosticsDir:        *diagnosticsDir,
+		inspectCache:          *inspectCache,
+		address:               *address,
+		blocks:                *blocks,
+		eventType:             *eventType,
+		summary:               *summary,
+		stats:                 *stats,
+		format:                *format,
+		out:                   *out,
+		odds:                  *odds,
+		stakerReport:          *stakerReport,
+		verifyWinners:         *verifyWinners,
+		fairnessReport:        *fairnessReport,
+		exportEpochs:          *exportEpochs,
+		checkVectors:          *checkVectors,
+		makeVector:            *makeVector,
+		converge:              *converge,
+		stakeStats:            *stakeStats,
+		topN:                  *topN,
+		autoWithdrawFees:      *autoWithdrawFees,
+		withdrawMaxGas:        *withdrawMaxGas,
+		withdrawalLedger:      *withdrawalLedger,
+		feeReport:             *feeReport,
+		checkInvariants:       *checkInvariants,
+		invariantInterval:     *invariantInterval,
+		claimReport:           *claimReport,
+		previewGive:           *previewGive,
+		tokenPrice:            *tokenPrice,
+		donations:             *donations,
 	}
 }
 
@@ -524,6 +1053,122 @@ func handleSingleOperations(cProps *ktfunc.ConnectionProps, flags Flags) {
 		}
 	}
 
+	if len(flags.checkLedger) > 0 {
+		LogOperationStart("Checking stake ledger")
+		startBlock, endBlock, err := ktfunc.ParseStartEndBlocks(flags.checkLedger)
+		if err != nil {
+			log.Fatalf("Invalid start:end blocks format: %s", flags.checkLedger)
+		}
+		if err := ktfunc.VerifyStakeLedger(cProps, new(big.Int).SetUint64(startBlock), new(big.Int).SetUint64(endBlock)); err != nil {
+			log.Errorf("Stake ledger check failed: %v", err)
+		}
+	}
+
+	if flags.inspectCache {
+		LogOperationStart("Inspecting event cache")
+		if err := runInspectCache(cProps, flags); err != nil {
+			log.Errorf("Cache inspection failed: %v", err)
+		}
+	}
+
+	if flags.odds {
+		LogOperationStart("Previewing current-epoch odds")
+		if err := runOdds(cProps, flags); err != nil {
+			log.Errorf("Odds preview failed: %v", err)
+		}
+	}
+
+	if len(flags.stakerReport) > 0 {
+		LogOperationStart("Building staker report")
+		if err := runStakerReport(cProps, flags); err != nil {
+			log.Errorf("Staker report failed: %v", err)
+		}
+	}
+
+	if len(flags.verifyWinners) > 0 {
+		LogOperationStart("Auditing rewarded epochs")
+		if err := runVerifyWinners(cProps, flags); err != nil {
+			log.Errorf("Winner audit failed: %v", err)
+		}
+	}
+
+	if len(flags.fairnessReport) > 0 {
+		LogOperationStart("Building fairness report")
+		if err := runFairnessReport(cProps, flags); err != nil {
+			log.Errorf("Fairness report failed: %v", err)
+		}
+	}
+
+	if len(flags.stakeStats) > 0 {
+		LogOperationStart("Building stake statistics")
+		if err := runStakeStats(cProps, flags); err != nil {
+			log.Errorf("Stake statistics failed: %v", err)
+		}
+	}
+
+	if len(flags.feeReport) > 0 {
+		LogOperationStart("Building OC fee report")
+		if err := runFeeReport(cProps, flags); err != nil {
+			log.Errorf("OC fee report failed: %v", err)
+		}
+	}
+
+	if flags.checkInvariants {
+		LogOperationStart("Checking contract invariants")
+		if err := runCheckInvariants(cProps); err != nil {
+			log.Errorf("Invariant check failed: %v", err)
+		}
+	}
+
+	if flags.claimReport {
+		LogOperationStart("Building staker claim report")
+		if err := runClaimReport(cProps, flags); err != nil {
+			log.Errorf("Claim report failed: %v", err)
+		}
+	}
+
+	if flags.previewGive != "" {
+		LogOperationStart("Previewing give()")
+		if err := runPreviewGive(cProps, flags); err != nil {
+			log.Errorf("Give preview failed: %v", err)
+		}
+	}
+
+	if flags.tokenPrice {
+		LogOperationStart("Checking token price")
+		if err := runTokenPrice(cProps); err != nil {
+			log.Errorf("Token price check failed: %v", err)
+		}
+	}
+
+	if len(flags.donations) > 0 {
+		LogOperationStart("Building donation report")
+		if err := runDonations(cProps, flags); err != nil {
+			log.Errorf("Donation report failed: %v", err)
+		}
+	}
+
+	if len(flags.exportEpochs) > 0 {
+		LogOperationStart("Exporting epochs")
+		if err := runExportEpochs(cProps, flags); err != nil {
+			log.Errorf("Epoch export failed: %v", err)
+		}
+	}
+
+	if len(flags.makeVector) > 0 {
+		LogOperationStart("Capturing lottery test vector")
+		if err := runMakeVector(cProps, flags); err != nil {
+			log.Errorf("Capturing test vector failed: %v", err)
+		}
+	}
+
+	if flags.converge {
+		LogOperationStart("Planning epoch convergence")
+		if err := runConverge(cProps); err != nil {
+			log.Errorf("Convergence failed: %v", err)
+		}
+	}
+
 	if flags.vote {
 		LogOperationStart("Finding receiver for voting")
 		ktfunc.VoteAndReward(cProps)
@@ -559,6 +1204,11 @@ func handleSingleOperations(cProps *ktfunc.ConnectionProps, flags Flags) {
 	if flags.run {
 		LogOperationStart("Starting normal operations... Press CTRL+C to stop")
 		ktfunc.PrintKtContractVariables(cProps)
+		if flags.tailInterval > 0 {
+			if err := ktfunc.StartEventTailer(context.Background(), cProps, flags.tailInterval); err != nil {
+				log.Warnf("Event tailer not started: %v (the cache will catch up at each epoch end)", err)
+			}
+		}
 		KeepRunning(cProps)
 	}
 
@@ -579,7 +1229,7 @@ func handleSingleOperations(cProps *ktfunc.ConnectionProps, flags Flags) {
 
 	if flags.printEvents {
 		LogOperationStart("Printing database contents")
-		err := ktfunc.PrintEvents(cProps.KtAddr)
+		err := ktfunc.PrintEvents(cProps)
 		if err != nil {
 			log.Errorf("Error printing database contents: %v", err)
 		}
@@ -725,6 +1375,8 @@ func setupConnectionProps(mstProps *ktfunc.Addresses, flags Flags) *ktfunc.Conne
 		cProps.ChunkSize = ktfunc.DefaultChunkSize
 	}
 
+	cProps.RPCBatchSize = flags.rpcBatchSize
+
 	duration := ktfunc.ResolveWaitDuration(mstProps.WaitDuration, flags.waitDuration)
 	if flags.waitDuration != ktfunc.DefaultWaitDuration {
 		log.Infof("Overriding wait duration with command line flag: %v", flags.waitDuration)
@@ -732,6 +1384,29 @@ func setupConnectionProps(mstProps *ktfunc.Addresses, flags Flags) *ktfunc.Conne
 
 	cProps.WaitDuration = duration
 
+	// Resolve cache dir: CLI flag > CACHE_DIR env > default ("cache").
+	if flags.cacheDir != "" {
+		cProps.CacheDir = flags.cacheDir
+	} else {
+		cProps.CacheDir = os.Getenv("CACHE_DIR")
+	}
+	log.Debugf("Using cache dir: %s", cProps.ResolvedCacheDir())
+	cProps.DiagnosticsDir = flags.diagnosticsDir
+	cProps.WithdrawalLedger = flags.withdrawalLedger
+	cProps.InvariantCheckInterval = flags.invariantInterval
+	if flags.autoWithdrawFees != "" {
+		threshold, err := ktfunc.ParseEthAmount(flags.autoWithdrawFees)
+		if err != nil {
+			log.Fatalf("Invalid -autoWithdrawFees: %v", err)
+		}
+		cProps.FeeWithdrawPolicy = &ktfunc.FeeWithdrawPolicy{
+			Threshold:      threshold,
+			MaxGasFraction: flags.withdrawMaxGas,
+		}
+		log.Infof("Automatic OC fee withdrawal above %s ETH, gas at most %.1f%% (recorded in %s)",
+			flags.autoWithdrawFees, 100*flags.withdrawMaxGas, cProps.ResolvedWithdrawalLedger())
+	}
+
 	// Resolve confirmation depth: CLI flag > CONFIRMATION_DEPTH env > default.
 	switch {
 	case flags.confirmationDepth > 0:
@@ -787,6 +1462,7 @@ func setupConnectionProps(mstProps *ktfunc.Addresses, flags Flags) *ktfunc.Conne
 	// direct client and the contract backend point at the counter, so
 	// eth_getLogs / eth_call (the bulk of provider usage) are captured too.
 	counter := ktfunc.NewCountingClient(client)
+	counter.SetBatchCaller(client.Client())
 	cProps.Client = counter
 	cProps.Backend = counter
 	cProps.RPCCounter = counter
@@ -857,7 +1533,7 @@ func getKtInstance(client bind.ContractBackend, ktAddr common.Address) (ktfunc.K
 	}
 
 	log.Debugf("KT instance created for contract: %s", ktAddr.Hex())
-	return &ktfunc.Ktv2Wrapper{instance}, nil
+	return &ktfunc.Ktv2Wrapper{Ktv2: instance}, nil
 }
 
 func KeepRunning(cProps *ktfunc.ConnectionProps) {
@@ -892,6 +1568,19 @@ func KeepRunning(cProps *ktfunc.ConnectionProps) {
 
 // runOnce performs a single vote/reward cycle. Extracted so the backoff
 // bookkeeping in KeepRunning stays small and the cycle is callable on its own.
+// A failed automatic fee withdrawal or invariant check is only logged: neither
+// must back off the vote cycle.
 func runOnce(cProps *ktfunc.ConnectionProps) error {
-	return ktfunc.VoteAndReward(cProps)
+	if err := ktfunc.VoteAndReward(cProps); err != nil {
+		return err
+	}
+	if w, err := ktfunc.MaybeWithdrawOCFees(cProps); err != nil {
+		log.Warnf("Automatic OC fee withdrawal failed: %v", err)
+	} else if w != nil {
+		log.Infof("Automatically withdrew OC fees in tx %s", w.TxHash)
+	}
+	if _, err := ktfunc.MaybeCheckInvariants(cProps); err != nil {
+		log.Warnf("Invariant check failed: %v", err)
+	}
+	return nil
 }
@@ -29,7 +29,7 @@ import (
 )
 
 func TestGatherStakesAndWithdraws_DoesNotRefetchPreviouslyCachedBlocks(t *testing.T) {
-	// Isolate cache in a temp directory. ktfunc writes to ./cache/<addr>.db
+	// Isolate cache in a temp directory. ktfunc writes to ./cache/<chainID>/<addr>.db
 	// relative to CWD, so chdir into a temp dir for the duration of the test.
 	tmp := t.TempDir()
 	oldwd, err := os.Getwd()
@@ -60,6 +60,7 @@ func TestGatherStakesAndWithdraws_DoesNotRefetchPreviouslyCachedBlocks(t *testin
 
 	cProps := &ktfunc.ConnectionProps{
 		KtAddr:    common.HexToAddress("0x000000000000000000000000000000000000ABCD"),
+		ChainID:   big.NewInt(1337),
 		ChunkSize: 500,
 		Client:    &FakeEthClient{}, // only used by debug paths we won't hit
 	}
@@ -123,6 +124,7 @@ func TestGatherStakesAndWithdraws_DetectsReorgAndRebuildsCache(t *testing.T) {
 	contractAddr := common.HexToAddress("0x000000000000000000000000000000000000FACE")
 	cProps := &ktfunc.ConnectionProps{
 		KtAddr:    contractAddr,
+		ChainID:   big.NewInt(1337),
 		ChunkSize: 500,
 	}
 
@@ -181,6 +183,7 @@ func TestGatherStakesAndWithdraws_NoReorgKeepsCache(t *testing.T) {
 	contractAddr := common.HexToAddress("0x000000000000000000000000000000000000C0DE")
 	cProps := &ktfunc.ConnectionProps{
 		KtAddr:    contractAddr,
+		ChainID:   big.NewInt(1337),
 		ChunkSize: 500,
 	}
 
@@ -233,6 +236,7 @@ func TestGatherStakesAndWithdraws_NearHeadTipNotHashChecked(t *testing.T) {
 	contractAddr := common.HexToAddress("0x000000000000000000000000000000000000BEEF")
 	cProps := &ktfunc.ConnectionProps{
 		KtAddr:    contractAddr,
+		ChainID:   big.NewInt(1337),
 		ChunkSize: 500,
 	}
 
@@ -34,6 +34,7 @@ type FakeKtv2 struct {
 
 	FilterStakedFn   func(opts *bind.FilterOpts) (ktfunc.StakedIterator, error)
 	FilterWithdrewFn func(opts *bind.FilterOpts) (ktfunc.WithdrewIterator, error)
+	FilterGaveFn     func(opts *bind.FilterOpts) (ktfunc.GaveIterator, error) // optional; no gives if nil
 }
 
 func (f *FakeKtv2) FilterStaked(opts *bind.FilterOpts) (ktfunc.StakedIterator, error) {
@@ -44,6 +45,13 @@ func (f *FakeKtv2) FilterWithdrew(opts *bind.FilterOpts) (ktfunc.WithdrewIterato
 	return f.FilterWithdrewFn(opts)
 }
 
+func (f *FakeKtv2) FilterGave(opts *bind.FilterOpts) (ktfunc.GaveIterator, error) {
+	if f.FilterGaveFn == nil {
+		return &gaveIter{}, nil
+	}
+	return f.FilterGaveFn(opts)
+}
+
 // FakeEthClient implements ktfunc.EthClient with overridable hooks.
 type FakeEthClient struct {
 	ktfunc.EthClient // nil; any non-overridden call will panic
@@ -93,7 +101,7 @@ func (f *FakeEthClient) FilterLogs(ctx context.Context, q ethereum.FilterQuery)
 	return []types.Log{}, nil
 }
 
-// stakedIter / withdrewIter are minimal in-memory iterator implementations.
+// stakedIter / withdrewIter / gaveIter are minimal in-memory iterator implementations.
 type stakedIter struct {
 	events []ktv2.Ktv2Staked
 	i      int
@@ -125,3 +133,19 @@ func (it *withdrewIter) Next() bool {
 func (it *withdrewIter) Event() *ktv2.Ktv2Withdrew { return &it.events[it.i-1] }
 func (it *withdrewIter) Error() error              { return nil }
 func (it *withdrewIter) Close() error              { return nil }
+
+type gaveIter struct {
+	events []ktv2.Ktv2Gave
+	i      int
+}
+
+func (it *gaveIter) Next() bool {
+	if it.i >= len(it.events) {
+		return false
+	}
+	it.i++
+	return true
+}
+func (it *gaveIter) Event() *ktv2.Ktv2Gave { return &it.events[it.i-1] }
+func (it *gaveIter) Error() error          { return nil }
+func (it *gaveIter) Close() error          { return nil }
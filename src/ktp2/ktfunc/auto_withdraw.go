@@ -0,0 +1,198 @@
+package ktfunc
+
+// Automatic OC fee withdrawal. Fees migrate into pastOcFees as the OC acts
+// in later epochs and stay there until withdrawn. With a FeeWithdrawPolicy
+// set, each -run cycle withdraws them once they are worth more than a
+// threshold and the gas is a small enough fraction of them. It only does so
+// while the epoch has enough blocks left to run that the withdrawal is
+// mined and confirmed before voting opens, so the node's nonce and time are
+// never split between a withdrawal and a vote or reward.
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// DefaultWithdrawMaxGasFraction is the largest share of the withdrawn
+	// amount the policy will spend on gas unless configured otherwise.
+	DefaultWithdrawMaxGasFraction = 0.05
+
+	// DefaultWithdrawalLedger is the file withdrawals are recorded in
+	// unless configured otherwise.
+	DefaultWithdrawalLedger = "fee_withdrawals.jsonl"
+
+	// withdrawFeeGas is what a withdrawOCFee call is expected to use: the
+	// fee migration, the pastOcFees reset and the transfer, with headroom.
+	withdrawFeeGas uint64 = 60_000
+
+	// withdrawLeadBlocks is how many blocks, on top of BlocksToWait, the
+	// epoch must still have to run for a withdrawal to start.
+	withdrawLeadBlocks uint64 = 10
+)
+
+// FeeWithdrawPolicy decides when -run withdraws OC fees on its own.
+type FeeWithdrawPolicy struct {
+	Threshold      *big.Int // pastOcFees, in wei, that must be exceeded
+	MaxGasFraction float64  // of pastOcFees; zero means DefaultWithdrawMaxGasFraction
+}
+
+// FeeWithdrawal is one OC fee withdrawal. Amounts are wei.
+type FeeWithdrawal struct {
+	Time     time.Time `json:"time"`
+	OC       string    `json:"oc"`
+	Block    uint64    `json:"block"`
+	TxHash   string    `json:"txHash"`
+	Owed     string    `json:"owed"`     // pastOcFees before the withdrawal
+	Received string    `json:"received"` // the OC's balance change, net of gas
+	GasCost  string    `json:"gasCost"`
+	Reason   string    `json:"reason,omitempty"`
+}
+
+// MaybeWithdrawOCFees withdraws this node's OC fees if cProps.FeeWithdrawPolicy
+// allows it now, records the withdrawal in the withdrawal ledger and returns
+// it. It returns nil, with no error, when there is no policy or it says to
+// wait.
+func MaybeWithdrawOCFees(cProps *ConnectionProps) (*FeeWithdrawal, error) {
+	policy := cProps.FeeWithdrawPolicy
+	if policy == nil {
+		return nil, nil
+	}
+	reason, ok, err := shouldWithdrawFees(cProps, policy)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		log.Debugf("Not withdrawing OC fees: %s", reason)
+		return nil, nil
+	}
+	log.Infof("Withdrawing OC fees automatically: %s", reason)
+	return withdrawAndRecordOCFees(cProps, "auto", reason)
+}
+
+// withdrawAndRecordOCFees withdraws this node's OC fees and appends the
+// withdrawal, if there was one, to the withdrawal ledger.
+func withdrawAndRecordOCFees(cProps *ConnectionProps, blocks, reason string) (*FeeWithdrawal, error) {
+	w, err := withdrawOCFees(cProps, blocks)
+	if err != nil || w == nil {
+		return nil, err
+	}
+	w.Time = time.Now().UTC()
+	w.Reason = reason
+	if err := appendFeeWithdrawal(cProps.ResolvedWithdrawalLedger(), w); err != nil {
+		return w, fmt.Errorf("withdrew OC fees in tx %s but failed to record it: %w", w.TxHash, err)
+	}
+	return w, nil
+}
+
+// shouldWithdrawFees applies the policy. reason says why it decided either
+// way.
+func shouldWithdrawFees(cProps *ConnectionProps, policy *FeeWithdrawPolicy) (reason string, ok bool, err error) {
+	opts := &bind.CallOpts{Context: context.Background(), From: cProps.MyPubKey}
+	startBlock, err := cProps.Kt.StartBlock(opts)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to get start block: %w", err)
+	}
+	interval, err := cProps.Kt.EpochInterval(opts)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to get epoch interval: %w", err)
+	}
+	head, err := cProps.Client.BlockNumber(context.Background())
+	if err != nil {
+		return "", false, fmt.Errorf("failed to get latest block: %w", err)
+	}
+	end := startBlock.Uint64() + uint64(interval)
+	if lead := withdrawLeadBlocks + cProps.BlocksToWait; head+lead > end {
+		return fmt.Sprintf("block %d is within %d blocks of the voting window opening at %d, or inside it", head, lead, end), false, nil
+	}
+
+	owed, err := cProps.Kt.PastOcFees(opts, cProps.MyPubKey)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to query pastOcFees: %w", err)
+	}
+	if policy.Threshold != nil && owed.Cmp(policy.Threshold) <= 0 {
+		return fmt.Sprintf("%s ETH owed, threshold %s ETH", weiToEthString(owed), weiToEthString(policy.Threshold)), false, nil
+	}
+	if owed.Sign() == 0 {
+		return "nothing owed", false, nil
+	}
+
+	gasPrice, err := cachedSuggestGasPrice(cProps)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to get gas price: %w", err)
+	}
+	gasCost := new(big.Int).Mul(gasPrice, new(big.Int).SetUint64(withdrawFeeGas))
+	maxFraction := policy.MaxGasFraction
+	if maxFraction <= 0 {
+		maxFraction = DefaultWithdrawMaxGasFraction
+	}
+	fraction := ratio(gasCost, owed)
+	if fraction > maxFraction {
+		return fmt.Sprintf("gas of about %s ETH would be %.1f%% of the %s ETH owed, over %.1f%%",
+			weiToEthString(gasCost), 100*fraction, weiToEthString(owed), 100*maxFraction), false, nil
+	}
+	return fmt.Sprintf("%s ETH owed, gas about %s ETH (%.1f%%)", weiToEthString(owed), weiToEthString(gasCost), 100*fraction), true, nil
+}
+
+// appendFeeWithdrawal adds w to the JSON Lines ledger at path.
+func appendFeeWithdrawal(path string, w *FeeWithdrawal) error {
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if err := json.NewEncoder(f).Encode(w); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// ReadFeeWithdrawals returns the withdrawals recorded at path, oldest
+// first. A missing file is an empty ledger.
+func ReadFeeWithdrawals(path string) ([]FeeWithdrawal, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var out []FeeWithdrawal
+	dec := json.NewDecoder(f)
+	for dec.More() {
+		var w FeeWithdrawal
+		if err := dec.Decode(&w); err != nil {
+			return out, fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		out = append(out, w)
+	}
+	return out, nil
+}
+
+// ParseEthAmount converts a decimal ETH amount such as "0.25" to wei.
+func ParseEthAmount(s string) (*big.Int, error) {
+	f, ok := new(big.Float).SetPrec(256).SetString(s)
+	if !ok || f.Sign() < 0 {
+		return nil, fmt.Errorf("invalid ETH amount %q", s)
+	}
+	wei, _ := f.Mul(f, big.NewFloat(1e18)).Int(nil)
+	return wei, nil
+}
+
+func weiToEthString(wei *big.Int) string {
+	return new(big.Float).Quo(new(big.Float).SetInt(wei), big.NewFloat(1e18)).Text('f', 6)
+}
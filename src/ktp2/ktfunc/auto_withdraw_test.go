@@ -0,0 +1,93 @@
+package ktfunc
+
+import (
+	"math/big"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShouldWithdrawFees(t *testing.T) {
+	logrus.SetLevel(logrus.FatalLevel)
+	defer logrus.SetLevel(logrus.InfoLevel)
+
+	oc := common.HexToAddress("0x0c")
+	eth := func(s string) *big.Int {
+		v, err := ParseEthAmount(s)
+		require.NoError(t, err)
+		return v
+	}
+	policy := &FeeWithdrawPolicy{Threshold: eth("0.1")}
+
+	for _, tc := range []struct {
+		name     string
+		head     uint64
+		owed     *big.Int
+		gasPrice int64
+		want     bool
+		reason   string
+	}{
+		{"mid-epoch, worth it", 1000, eth("0.2"), 10e9, true, "0.200000 ETH owed"},
+		{"too close to the voting window", 1091, eth("0.2"), 10e9, false, "voting window"},
+		{"inside the voting window", 1150, eth("0.2"), 10e9, false, "voting window"},
+		{"below the threshold", 1000, eth("0.1"), 10e9, false, "threshold 0.100000"},
+		// 60k gas at 1000 gwei is 0.06 ETH, 30% of 0.2 ETH.
+		{"gas too dear", 1000, eth("0.2"), 1000e9, false, "30.0% of the 0.200000 ETH owed"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			kt := &MockKtv2{}
+			client := &MockEthClient{}
+			kt.On("StartBlock", mock.Anything).Return(big.NewInt(1000), nil)
+			kt.On("EpochInterval", mock.Anything).Return(uint16(100), nil)
+			kt.On("PastOcFees", mock.Anything, oc).Return(tc.owed, nil).Maybe()
+			client.On("BlockNumber", mock.Anything).Return(tc.head, nil)
+			client.On("SuggestGasPrice", mock.Anything).Return(big.NewInt(tc.gasPrice), nil).Maybe()
+			cProps := &ConnectionProps{Kt: kt, Client: client, MyPubKey: oc}
+
+			reason, ok, err := shouldWithdrawFees(cProps, policy)
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, ok)
+			assert.Contains(t, reason, tc.reason)
+		})
+	}
+
+	// Without a policy nothing is read at all.
+	w, err := MaybeWithdrawOCFees(&ConnectionProps{Kt: &MockKtv2{}, Client: &MockEthClient{}})
+	require.NoError(t, err)
+	assert.Nil(t, w)
+}
+
+func TestFeeWithdrawalLedger(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nested", DefaultWithdrawalLedger)
+	got, err := ReadFeeWithdrawals(path)
+	require.NoError(t, err)
+	assert.Empty(t, got)
+
+	first := &FeeWithdrawal{Time: time.Unix(1700000000, 0).UTC(), OC: "0x0c", Block: 900, TxHash: "0x01", Owed: "200", Received: "150", GasCost: "50", Reason: "test"}
+	second := &FeeWithdrawal{Time: time.Unix(1700003600, 0).UTC(), OC: "0x0c", Block: 1900, TxHash: "0x02", Owed: "300", Received: "250", GasCost: "50"}
+	require.NoError(t, appendFeeWithdrawal(path, first))
+	require.NoError(t, appendFeeWithdrawal(path, second))
+
+	got, err = ReadFeeWithdrawals(path)
+	require.NoError(t, err)
+	assert.Equal(t, []FeeWithdrawal{*first, *second}, got)
+}
+
+func TestParseEthAmount(t *testing.T) {
+	v, err := ParseEthAmount("0.25")
+	require.NoError(t, err)
+	assert.Equal(t, "250000000000000000", v.String())
+	v, err = ParseEthAmount("3")
+	require.NoError(t, err)
+	assert.Equal(t, "3000000000000000000", v.String())
+	for _, bad := range []string{"", "abc", "-1"} {
+		_, err := ParseEthAmount(bad)
+		assert.Error(t, err, bad)
+	}
+}
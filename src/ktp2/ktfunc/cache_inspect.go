@@ -0,0 +1,315 @@
+package ktfunc
+
+// Cache inspection: a filterable, machine-readable view of the event cache.
+// Unlike PrintEvents it never dumps the whole cache by default, and its JSON
+// and CSV output is stable enough to feed into other tools. Amounts are
+// decimal wei strings so no precision is lost on the way out.
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Event types accepted by CacheQuery.EventType.
+const (
+	CacheEventStake    = "stake"
+	CacheEventWithdraw = "withdraw"
+	CacheEventGave     = "gave"
+)
+
+// CacheQuery filters InspectCache. The zero value matches every event.
+type CacheQuery struct {
+	Addr      *common.Address
+	FromBlock uint64
+	ToBlock   uint64 // inclusive; 0 means no upper bound
+	EventType string // "", CacheEventStake, CacheEventWithdraw or CacheEventGave
+}
+
+// CacheSections selects what InspectCache reports.
+type CacheSections struct {
+	Events  bool
+	Summary bool
+	Stats   bool
+}
+
+// CacheEvent is one cached Staked, Withdrew or Gave event.
+type CacheEvent struct {
+	Type    string `json:"type"`
+	Address string `json:"address"`
+	Amount  string `json:"amount"`
+	Block   uint64 `json:"block"`
+}
+
+// AddressSummary totals the matching events of one address. Net is staked
+// minus withdrawn over the filtered events only, so it is the address's
+// balance only when the query covers the whole history. Given is ETH
+// donated through give() and has no bearing on Net.
+type AddressSummary struct {
+	Address   string `json:"address"`
+	Stakes    int    `json:"stakes"`
+	Withdraws int    `json:"withdraws"`
+	Gives     int    `json:"gives"`
+	Staked    string `json:"staked"`
+	Withdrawn string `json:"withdrawn"`
+	Given     string `json:"given"`
+	Net       string `json:"net"`
+}
+
+// CacheStats describes the cache as a whole and ignores the query filters.
+type CacheStats struct {
+	Path          string `json:"path,omitempty"`
+	SchemaVersion uint32 `json:"schemaVersion"`
+	SizeBytes     int64  `json:"sizeBytes"`
+	Chunks        int    `json:"chunks"`
+	Events        int    `json:"events"`
+	Tip           uint64 `json:"tip"`
+	TipHash       string `json:"tipHash,omitempty"`
+}
+
+// CacheReport is the result of InspectCache. Sections that were not
+// requested are nil.
+type CacheReport struct {
+	Stats   *CacheStats      `json:"stats,omitempty"`
+	Summary []AddressSummary `json:"summary,omitempty"`
+	Events  []CacheEvent     `json:"events,omitempty"`
+}
+
+// ParseCacheEventType validates an event type filter; empty matches all.
+func ParseCacheEventType(s string) (string, error) {
+	switch t := strings.ToLower(s); t {
+	case "", CacheEventStake, CacheEventWithdraw, CacheEventGave:
+		return t, nil
+	default:
+		return "", fmt.Errorf("unknown event type %q (want %s, %s or %s)", s, CacheEventStake, CacheEventWithdraw, CacheEventGave)
+	}
+}
+
+func (q CacheQuery) matches(typ string, addr common.Address, block uint64) bool {
+	if q.EventType != "" && q.EventType != typ {
+		return false
+	}
+	if q.Addr != nil && *q.Addr != addr {
+		return false
+	}
+	return block >= q.FromBlock && (q.ToBlock == 0 || block <= q.ToBlock)
+}
+
+type addressTotals struct {
+	stakes, withdraws, gives int
+	staked, withdrawn, given *big.Int
+}
+
+// InspectCache reads the event cache of cProps.KtAddr and reports the
+// requested sections for the events matching q. It opens the cache
+// read-only and never queries the chain, so a missing cache, a legacy one
+// not yet adopted or one at another schema version is an error rather than
+// something it fixes.
+func InspectCache(cProps *ConnectionProps, q CacheQuery, sections CacheSections) (*CacheReport, error) {
+	store, release, err := openEventStoreReadOnly(cProps)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open event store: %w", err)
+	}
+	defer release()
+
+	events := []CacheEvent{}
+	totals := make(map[common.Address]*addressTotals)
+	add := func(typ string, addr common.Address, amount *big.Int, block uint64) {
+		if !q.matches(typ, addr, block) {
+			return
+		}
+		if sections.Events {
+			events = append(events, CacheEvent{Type: typ, Address: addr.Hex(), Amount: amount.String(), Block: block})
+		}
+		t := totals[addr]
+		if t == nil {
+			t = &addressTotals{staked: new(big.Int), withdrawn: new(big.Int), given: new(big.Int)}
+			totals[addr] = t
+		}
+		switch typ {
+		case CacheEventStake:
+			t.stakes++
+			t.staked.Add(t.staked, amount)
+		case CacheEventWithdraw:
+			t.withdraws++
+			t.withdrawn.Add(t.withdrawn, amount)
+		default:
+			t.gives++
+			t.given.Add(t.given, amount)
+		}
+	}
+
+	chunks, cached := 0, 0
+	err = store.ForEachChunk(func(_ uint64, chunk ChunkEvents) error {
+		chunks++
+		cached += len(chunk.StakeEvents) + len(chunk.WithdrawEvents) + len(chunk.GaveEvents)
+		for _, e := range chunk.StakeEvents {
+			add(CacheEventStake, e.Addr, e.Amount, e.Block)
+		}
+		for _, e := range chunk.WithdrawEvents {
+			add(CacheEventWithdraw, e.Addr, e.Amount, e.Block)
+		}
+		for _, e := range chunk.GaveEvents {
+			add(CacheEventGave, e.Addr, e.Amount, e.Block)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cached chunks: %w", err)
+	}
+
+	report := &CacheReport{}
+	if sections.Events {
+		sort.SliceStable(events, func(i, j int) bool { return events[i].Block < events[j].Block })
+		report.Events = events
+	}
+	if sections.Summary {
+		report.Summary = make([]AddressSummary, 0, len(totals))
+		for addr, t := range totals {
+			report.Summary = append(report.Summary, AddressSummary{
+				Address:   addr.Hex(),
+				Stakes:    t.stakes,
+				Withdraws: t.withdraws,
+				Gives:     t.gives,
+				Staked:    t.staked.String(),
+				Withdrawn: t.withdrawn.String(),
+				Given:     t.given.String(),
+				Net:       new(big.Int).Sub(t.staked, t.withdrawn).String(),
+			})
+		}
+		sort.Slice(report.Summary, func(i, j int) bool { return report.Summary[i].Address < report.Summary[j].Address })
+	}
+	if sections.Stats {
+		storeStats, err := store.Stats()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read store stats: %w", err)
+		}
+		tip, err := store.Tip()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read cache tip: %w", err)
+		}
+		report.Stats = &CacheStats{
+			Path:          storeStats.Path,
+			SchemaVersion: storeStats.SchemaVersion,
+			SizeBytes:     storeStats.SizeBytes,
+			Chunks:        chunks,
+			Events:        cached,
+			Tip:           tip.Block,
+		}
+		if tip.HasHash {
+			report.Stats.TipHash = tip.Hash.Hex()
+		}
+	}
+	return report, nil
+}
+
+// WriteCacheReport renders report to w. CSV output writes one block per
+// section (stats, summary, events), each with its own header row, separated
+// by a blank line.
+func WriteCacheReport(w io.Writer, report *CacheReport, format OutputFormat) error {
+	switch format {
+	case FormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	case FormatCSV:
+		return writeCacheReportCSV(w, report)
+	default:
+		return writeCacheReportTable(w, report)
+	}
+}
+
+// cacheStatsRows lists the stats as name/value pairs. human fills in
+// placeholders for the empty path and tip hash; CSV leaves them blank.
+func cacheStatsRows(s *CacheStats, human bool) [][2]string {
+	path, tipHash := s.Path, s.TipHash
+	if human && path == "" {
+		path = "(in memory)"
+	}
+	if human && tipHash == "" {
+		tipHash = "(none: tip not yet buried)"
+	}
+	return [][2]string{
+		{"path", path},
+		{"schema_version", strconv.FormatUint(uint64(s.SchemaVersion), 10)},
+		{"size_bytes", strconv.FormatInt(s.SizeBytes, 10)},
+		{"chunks", strconv.Itoa(s.Chunks)},
+		{"events", strconv.Itoa(s.Events)},
+		{"tip", strconv.FormatUint(s.Tip, 10)},
+		{"tip_hash", tipHash},
+	}
+}
+
+func writeCacheReportCSV(w io.Writer, report *CacheReport) error {
+	cw := csv.NewWriter(w)
+	var blocks [][][]string
+	if report.Stats != nil {
+		rows := [][]string{{"stat", "value"}}
+		for _, r := range cacheStatsRows(report.Stats, false) {
+			rows = append(rows, []string{r[0], r[1]})
+		}
+		blocks = append(blocks, rows)
+	}
+	if report.Summary != nil {
+		rows := [][]string{{"address", "stakes", "withdraws", "gives", "staked", "withdrawn", "given", "net"}}
+		for _, s := range report.Summary {
+			rows = append(rows, []string{s.Address, strconv.Itoa(s.Stakes), strconv.Itoa(s.Withdraws), strconv.Itoa(s.Gives), s.Staked, s.Withdrawn, s.Given, s.Net})
+		}
+		blocks = append(blocks, rows)
+	}
+	if report.Events != nil {
+		rows := [][]string{{"type", "address", "amount", "block"}}
+		for _, e := range report.Events {
+			rows = append(rows, []string{e.Type, e.Address, e.Amount, strconv.FormatUint(e.Block, 10)})
+		}
+		blocks = append(blocks, rows)
+	}
+	for i, rows := range blocks {
+		if i > 0 {
+			cw.Flush()
+			if _, err := io.WriteString(w, "\n"); err != nil {
+				return err
+			}
+		}
+		if err := cw.WriteAll(rows); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func writeCacheReportTable(w io.Writer, report *CacheReport) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	if report.Stats != nil {
+		fmt.Fprintln(tw, "Cache stats:")
+		for _, r := range cacheStatsRows(report.Stats, true) {
+			fmt.Fprintf(tw, "  %s\t%s\n", r[0], r[1])
+		}
+		fmt.Fprintln(tw)
+	}
+	if report.Summary != nil {
+		fmt.Fprintf(tw, "Per-address summary (%d addresses):\n", len(report.Summary))
+		fmt.Fprintln(tw, "  Address\tStakes\tWithdraws\tGives\tStaked (wei)\tWithdrawn (wei)\tGiven (wei)\tNet (wei)")
+		for _, s := range report.Summary {
+			fmt.Fprintf(tw, "  %s\t%d\t%d\t%d\t%s\t%s\t%s\t%s\n", s.Address, s.Stakes, s.Withdraws, s.Gives, s.Staked, s.Withdrawn, s.Given, s.Net)
+		}
+		fmt.Fprintln(tw)
+	}
+	if report.Events != nil {
+		fmt.Fprintf(tw, "Events (%d):\n", len(report.Events))
+		fmt.Fprintln(tw, "  Block\tType\tAddress\tAmount (wei)")
+		for _, e := range report.Events {
+			fmt.Fprintf(tw, "  %d\t%s\t%s\t%s\n", e.Block, e.Type, e.Address, e.Amount)
+		}
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,193 @@
+package ktfunc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.etcd.io/bbolt"
+)
+
+func newInspectTestProps(t *testing.T) (*ConnectionProps, common.Address, common.Address) {
+	a, b := common.HexToAddress("0x0a"), common.HexToAddress("0x0b")
+	store := NewMemoryEventStore()
+	require.NoError(t, store.StoreChunk(100, ChunkEvents{
+		StakeEvents: []StakeEvent{
+			{Addr: a, Amount: big.NewInt(100), Block: 120},
+			{Addr: b, Amount: big.NewInt(50), Block: 130},
+		},
+		WithdrawEvents: []WithdrawEvent{{Addr: a, Amount: big.NewInt(30), Block: 110}},
+	}))
+	require.NoError(t, store.StoreChunk(200, ChunkEvents{
+		StakeEvents:    []StakeEvent{{Addr: a, Amount: big.NewInt(5), Block: 250}},
+		WithdrawEvents: []WithdrawEvent{{Addr: b, Amount: big.NewInt(50), Block: 260}},
+		GaveEvents:     []GaveEvent{{Addr: b, Amount: big.NewInt(7), Block: 270}},
+	}))
+	require.NoError(t, store.SetTip(CacheTip{Block: 299, Hash: common.HexToHash("0xabc"), HasHash: true}))
+	return &ConnectionProps{Store: store}, a, b
+}
+
+func TestInspectCache_Filters(t *testing.T) {
+	cProps, a, b := newInspectTestProps(t)
+
+	report, err := InspectCache(cProps, CacheQuery{}, CacheSections{Events: true})
+	require.NoError(t, err)
+	var blocks []uint64
+	for _, e := range report.Events {
+		blocks = append(blocks, e.Block)
+	}
+	assert.Equal(t, []uint64{110, 120, 130, 250, 260, 270}, blocks, "events come out in block order")
+	assert.Nil(t, report.Summary)
+	assert.Nil(t, report.Stats)
+
+	report, err = InspectCache(cProps, CacheQuery{Addr: &a, FromBlock: 115, ToBlock: 250, EventType: CacheEventStake}, CacheSections{Events: true})
+	require.NoError(t, err)
+	require.Len(t, report.Events, 2)
+	assert.Equal(t, CacheEvent{Type: CacheEventStake, Address: a.Hex(), Amount: "100", Block: 120}, report.Events[0])
+	assert.Equal(t, uint64(250), report.Events[1].Block)
+
+	report, err = InspectCache(cProps, CacheQuery{EventType: CacheEventGave}, CacheSections{Events: true, Summary: true})
+	require.NoError(t, err)
+	require.Len(t, report.Events, 1)
+	assert.Equal(t, CacheEvent{Type: CacheEventGave, Address: b.Hex(), Amount: "7", Block: 270}, report.Events[0])
+	require.Len(t, report.Summary, 1)
+	assert.Equal(t, 1, report.Summary[0].Gives)
+	assert.Equal(t, "7", report.Summary[0].Given)
+	assert.Equal(t, "0", report.Summary[0].Net, "a donation is not stake")
+
+	report, err = InspectCache(cProps, CacheQuery{FromBlock: 1000}, CacheSections{Events: true})
+	require.NoError(t, err)
+	assert.NotNil(t, report.Events, "a requested section is present even when empty")
+	assert.Empty(t, report.Events)
+}
+
+func TestInspectCache_SummaryAndStats(t *testing.T) {
+	cProps, a, b := newInspectTestProps(t)
+
+	report, err := InspectCache(cProps, CacheQuery{ToBlock: 255}, CacheSections{Summary: true, Stats: true})
+	require.NoError(t, err)
+	assert.Nil(t, report.Events)
+	assert.Equal(t, []AddressSummary{
+		{Address: a.Hex(), Stakes: 2, Withdraws: 1, Staked: "105", Withdrawn: "30", Given: "0", Net: "75"},
+		{Address: b.Hex(), Stakes: 1, Withdraws: 0, Staked: "50", Withdrawn: "0", Given: "0", Net: "50"},
+	}, report.Summary)
+
+	// Stats describe the whole cache regardless of the filter.
+	require.NotNil(t, report.Stats)
+	assert.Equal(t, 2, report.Stats.Chunks)
+	assert.Equal(t, 6, report.Stats.Events)
+	assert.Equal(t, uint64(299), report.Stats.Tip)
+	assert.Equal(t, common.HexToHash("0xabc").Hex(), report.Stats.TipHash)
+	assert.Equal(t, cacheSchemaVersion, report.Stats.SchemaVersion)
+}
+
+func TestInspectCache_BoltStats(t *testing.T) {
+	cProps := newLedgerTestProps(t, &ledgerFakeKt{})
+	store, release, err := openEventStore(cProps)
+	require.NoError(t, err)
+	require.NoError(t, store.StoreChunk(100, ChunkEvents{}))
+	release()
+
+	report, err := InspectCache(cProps, CacheQuery{}, CacheSections{Stats: true})
+	require.NoError(t, err)
+	assert.Contains(t, report.Stats.Path, cProps.KtAddr.Hex())
+	assert.Positive(t, report.Stats.SizeBytes)
+	assert.Equal(t, 1, report.Stats.Chunks)
+	assert.Empty(t, report.Stats.TipHash)
+}
+
+// TestInspectCache_ReadOnly — inspection never creates, migrates or stamps a
+// cache: a missing cache and an outdated schema are reported as they are.
+func TestInspectCache_ReadOnly(t *testing.T) {
+	cProps := newLedgerTestProps(t, &ledgerFakeKt{})
+	_, err := InspectCache(cProps, CacheQuery{}, CacheSections{Stats: true})
+	assert.ErrorContains(t, err, "no event cache")
+	_, statErr := os.Stat(filepath.Join(cProps.CacheDir, cProps.ChainID.String()))
+	assert.True(t, os.IsNotExist(statErr), "nothing is created")
+
+	store, release, err := openEventStore(cProps)
+	require.NoError(t, err)
+	require.NoError(t, store.StoreChunk(100, ChunkEvents{}))
+	release()
+	eventsName, _ := boltCachePaths(cProps.CacheDir, cProps.ChainID, cProps.KtAddr)
+	setVersion := func(version uint32) {
+		db, err := bbolt.Open(eventsName, 0600, nil)
+		require.NoError(t, err)
+		defer db.Close()
+		require.NoError(t, db.Update(func(tx *bbolt.Tx) error {
+			v := make([]byte, 4)
+			binary.BigEndian.PutUint32(v, version)
+			return tx.Bucket([]byte("meta")).Put([]byte("schema_version"), v)
+		}))
+	}
+	setVersion(cacheSchemaVersion - 1)
+	before, err := os.ReadFile(eventsName)
+	require.NoError(t, err)
+
+	_, err = InspectCache(cProps, CacheQuery{}, CacheSections{Stats: true})
+	assert.ErrorContains(t, err, fmt.Sprintf("schema version %d", cacheSchemaVersion-1))
+	after, err := os.ReadFile(eventsName)
+	require.NoError(t, err)
+	assert.Equal(t, before, after, "the outdated cache is left for a real run to migrate")
+
+	setVersion(cacheSchemaVersion)
+	other := newLedgerTestProps(t, &ledgerFakeKt{})
+	other.CacheDir, other.ChainID = cProps.CacheDir, big.NewInt(2)
+	require.NoError(t, os.MkdirAll(filepath.Join(cProps.CacheDir, "2"), 0755))
+	otherName, _ := boltCachePaths(cProps.CacheDir, other.ChainID, other.KtAddr)
+	current, err := os.ReadFile(eventsName)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(otherName, current, 0600))
+	_, err = InspectCache(other, CacheQuery{}, CacheSections{Stats: true})
+	assert.ErrorContains(t, err, "belongs to chain 1")
+}
+
+func TestWriteCacheReport_Formats(t *testing.T) {
+	cProps, a, _ := newInspectTestProps(t)
+	report, err := InspectCache(cProps, CacheQuery{Addr: &a}, CacheSections{Events: true, Summary: true})
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteCacheReport(&buf, report, FormatJSON))
+	var decoded CacheReport
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &decoded))
+	assert.Equal(t, *report, decoded)
+	assert.NotContains(t, buf.String(), `"stats"`)
+
+	buf.Reset()
+	require.NoError(t, WriteCacheReport(&buf, report, FormatCSV))
+	sections := strings.Split(buf.String(), "\n\n")
+	require.Len(t, sections, 2)
+	summary, err := csv.NewReader(strings.NewReader(sections[0])).ReadAll()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"address", "stakes", "withdraws", "gives", "staked", "withdrawn", "given", "net"}, summary[0])
+	assert.Equal(t, []string{a.Hex(), "2", "1", "0", "105", "30", "0", "75"}, summary[1])
+	events, err := csv.NewReader(strings.NewReader(sections[1])).ReadAll()
+	require.NoError(t, err)
+	assert.Len(t, events, 4, "header plus three events")
+
+	buf.Reset()
+	require.NoError(t, WriteCacheReport(&buf, report, FormatTable))
+	assert.Contains(t, buf.String(), "Events (3):")
+}
+
+func TestParseOutputFormat(t *testing.T) {
+	f, err := ParseOutputFormat("")
+	require.NoError(t, err)
+	assert.Equal(t, FormatTable, f)
+	f, err = ParseOutputFormat("JSON")
+	require.NoError(t, err)
+	assert.Equal(t, FormatJSON, f)
+	_, err = ParseOutputFormat("xml")
+	assert.Error(t, err)
+}
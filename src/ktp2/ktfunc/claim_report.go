@@ -0,0 +1,314 @@
+package ktfunc
+
+// Staker claims against a burning stake pool. give() burns tokens out of
+// totalStk but leaves every userStks entry alone, so after the first burn
+// the stakers together claim more than the contract holds. Each claim is
+// still withdrawable on its own, but withdraw() requires amt <= totalStk,
+// so withdrawals are first come, first served: once the others have
+// withdrawn, the last stakers find totalStk short of their claim by the
+// total burned. The report shows that shortfall and, per staker, how much
+// of the claim the ordering could cost them.
+//
+// Claims are the stake cache's staked less withdrawn, which is userStks.
+// Gave events carry only the donation, so each burn is read as the change
+// in totalBurned across the block; without archive state it is unknown.
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	log "github.com/sirupsen/logrus"
+)
+
+// StakerClaim is one staker's claim. Token amounts are in wei.
+type StakerClaim struct {
+	Address string `json:"address"`
+	Claim   string `json:"claim"`
+	// AtRisk is what the staker can't withdraw if every other staker
+	// withdraws first: the smaller of the claim and the shortfall.
+	AtRisk string `json:"atRisk"`
+	// Blocked is set when the claim exceeds totalStk, so it can't be
+	// withdrawn in full even now.
+	Blocked bool `json:"blocked,omitempty"`
+}
+
+// BurnRow is a block with one or more give() calls.
+type BurnRow struct {
+	Block uint64    `json:"block"`
+	Time  time.Time `json:"time"`
+	Gives int       `json:"gives"`
+	Given string    `json:"given"` // ETH passed on to the donation address, in wei
+	// Burned is the tokens burned in the block and TotalBurned the total
+	// after it; both are empty when the node served no state at the block.
+	Burned      string `json:"burned,omitempty"`
+	TotalBurned string `json:"totalBurned,omitempty"`
+	Claims      string `json:"claims"` // staked less withdrawn, as of the block
+	// ShortfallShare is TotalBurned as a share of Claims: the part of the
+	// claims the contract can no longer pay.
+	ShortfallShare float64 `json:"shortfallShare,omitempty"`
+}
+
+// ClaimReport compares the stakers' claims with the stake the contract
+// holds, at Block.
+type ClaimReport struct {
+	Block          uint64  `json:"block"`
+	Claims         string  `json:"claims"`
+	TotalStk       string  `json:"totalStk"`
+	TotalBurned    string  `json:"totalBurned"`
+	Shortfall      string  `json:"shortfall"` // claims less totalStk
+	ShortfallShare float64 `json:"shortfallShare"`
+	// Unexplained is the shortfall not accounted for by totalBurned. It is
+	// zero unless the stake cache is missing events.
+	Unexplained string        `json:"unexplained"`
+	Stakers     []StakerClaim `json:"stakers"` // largest claim first
+	AtRisk      int           `json:"atRisk"`  // stakers with a non-zero AtRisk
+	Blocked     int           `json:"blocked"`
+	Burns       []BurnRow     `json:"burns"` // oldest first
+}
+
+// BuildClaimReport compares the claims with totalStk at the current block
+// and lists every burn since the contract was created.
+func BuildClaimReport(cProps *ConnectionProps) (*ClaimReport, error) {
+	head, err := cProps.Client.BlockNumber(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("failed to read current block: %w", err)
+	}
+	creation, err := GetContractCreationBlock(cProps)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get contract creation block: %w", err)
+	}
+	opts := &bind.CallOpts{Context: context.Background(), BlockNumber: new(big.Int).SetUint64(head)}
+	totalStk, err := cProps.Kt.TotalStk(opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get total stake: %w", err)
+	}
+	totalBurned, err := cProps.Kt.TotalBurned(opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get total burned: %w", err)
+	}
+	stakeDataMap, err := GatherStakesAndWithdraws(cProps, cProps.Kt, new(big.Int).SetUint64(creation), new(big.Int).SetUint64(head))
+	if err != nil {
+		return nil, fmt.Errorf("failed to gather stakes: %w", err)
+	}
+	gives, err := gatherGaveEvents(cProps, creation, head)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := claimsThrough(stakeDataMap, head)
+	total := new(big.Int)
+	for _, c := range claims {
+		total.Add(total, c)
+	}
+	shortfall := new(big.Int).Sub(total, totalStk)
+	if shortfall.Sign() < 0 {
+		shortfall.SetInt64(0)
+	}
+	report := &ClaimReport{
+		Block:          head,
+		Claims:         total.String(),
+		TotalStk:       totalStk.String(),
+		TotalBurned:    totalBurned.String(),
+		Shortfall:      shortfall.String(),
+		ShortfallShare: bigRatio(shortfall, total),
+		Unexplained:    new(big.Int).Sub(shortfall, totalBurned).String(),
+		Stakers:        []StakerClaim{},
+		Burns:          []BurnRow{},
+	}
+	for addr, c := range claims {
+		if c.Sign() <= 0 {
+			continue
+		}
+		sc := StakerClaim{Address: addr.Hex(), Claim: c.String(), AtRisk: bigMin(c, shortfall).String(), Blocked: c.Cmp(totalStk) > 0}
+		if shortfall.Sign() > 0 {
+			report.AtRisk++
+		}
+		if sc.Blocked {
+			report.Blocked++
+		}
+		report.Stakers = append(report.Stakers, sc)
+	}
+	sort.Slice(report.Stakers, func(i, j int) bool {
+		a, _ := new(big.Int).SetString(report.Stakers[i].Claim, 10)
+		b, _ := new(big.Int).SetString(report.Stakers[j].Claim, 10)
+		if c := a.Cmp(b); c != 0 {
+			return c > 0
+		}
+		return report.Stakers[i].Address < report.Stakers[j].Address
+	})
+
+	for _, g := range gives {
+		row := BurnRow{Block: g.block, Time: blockTime(cProps, g.block), Gives: g.count, Given: g.given.String()}
+		c := new(big.Int)
+		for _, v := range claimsThrough(stakeDataMap, g.block) {
+			c.Add(c, v)
+		}
+		row.Claims = c.String()
+		if after, before, ok := burnedAcross(cProps, g.block); ok {
+			row.TotalBurned = after.String()
+			row.Burned = new(big.Int).Sub(after, before).String()
+			row.ShortfallShare = bigRatio(after, c)
+		}
+		report.Burns = append(report.Burns, row)
+	}
+	return report, nil
+}
+
+// gaveBlock totals the give() calls of one block.
+type gaveBlock struct {
+	block uint64
+	count int
+	given *big.Int
+}
+
+// gatherGaveEvents returns the blocks in [from, to] with Gave events,
+// oldest first.
+func gatherGaveEvents(cProps *ConnectionProps, from, to uint64) ([]gaveBlock, error) {
+	gives, err := GatherGaveEvents(cProps, from, to)
+	if err != nil {
+		return nil, err
+	}
+	var out []gaveBlock
+	for _, g := range gives {
+		if n := len(out); n == 0 || out[n-1].block != g.Block {
+			out = append(out, gaveBlock{block: g.Block, given: new(big.Int)})
+		}
+		b := &out[len(out)-1]
+		b.count++
+		if g.Amount != nil {
+			b.given.Add(b.given, g.Amount)
+		}
+	}
+	return out, nil
+}
+
+// burnedAcross reads totalBurned after block and before it. ok is false
+// when either read fails, typically for want of archive state.
+func burnedAcross(cProps *ConnectionProps, block uint64) (after, before *big.Int, ok bool) {
+	read := func(b uint64) (*big.Int, error) {
+		return cProps.Kt.TotalBurned(&bind.CallOpts{Context: context.Background(), BlockNumber: new(big.Int).SetUint64(b)})
+	}
+	after, err := read(block)
+	if err == nil && block > 0 {
+		before, err = read(block - 1)
+	}
+	if err != nil || before == nil {
+		log.Debugf("Could not read totalBurned around block %d: %v", block, err)
+		return nil, nil, false
+	}
+	return after, before, true
+}
+
+// claimsThrough returns each staker's staked less withdrawn as of block.
+func claimsThrough(stakeDataMap map[common.Address]map[uint64]*UserStakeData, block uint64) map[common.Address]*big.Int {
+	claims := make(map[common.Address]*big.Int, len(stakeDataMap))
+	for addr, byBlock := range stakeDataMap {
+		c := new(big.Int)
+		for b, d := range byBlock {
+			if b <= block && d != nil && d.StakeAmount != nil {
+				c.Add(c, d.StakeAmount)
+			}
+		}
+		claims[addr] = c
+	}
+	return claims
+}
+
+func bigMin(a, b *big.Int) *big.Int {
+	if a.Cmp(b) < 0 {
+		return new(big.Int).Set(a)
+	}
+	return new(big.Int).Set(b)
+}
+
+// bigRatio returns part/whole, or 0 for an empty whole.
+func bigRatio(part, whole *big.Int) float64 {
+	if whole.Sign() <= 0 {
+		return 0
+	}
+	return ratio(part, whole)
+}
+
+// WriteClaimReport renders report to w. CSV writes the stakers and the
+// burns as two blocks separated by a blank line.
+func WriteClaimReport(w io.Writer, report *ClaimReport, format OutputFormat) error {
+	switch format {
+	case FormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	case FormatCSV:
+		cw := csv.NewWriter(w)
+		rows := [][]string{{"address", "claim", "at_risk", "blocked"}}
+		for _, s := range report.Stakers {
+			rows = append(rows, []string{s.Address, s.Claim, s.AtRisk, strconv.FormatBool(s.Blocked)})
+		}
+		if err := cw.WriteAll(rows); err != nil {
+			return err
+		}
+		if _, err := io.WriteString(w, "\n"); err != nil {
+			return err
+		}
+		rows = [][]string{{"block", "time", "gives", "given", "burned", "total_burned", "claims", "shortfall_share"}}
+		for _, b := range report.Burns {
+			rows = append(rows, []string{
+				strconv.FormatUint(b.Block, 10), formatRowTime(b.Time), strconv.Itoa(b.Gives), b.Given, b.Burned,
+				b.TotalBurned, b.Claims, strconv.FormatFloat(b.ShortfallShare, 'f', -1, 64),
+			})
+		}
+		return cw.WriteAll(rows)
+	}
+
+	orUnknown := func(s string) string {
+		if s == "" {
+			return "?"
+		}
+		return s
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "Staker claims at block %d (token amounts in wei)\n", report.Block)
+	fmt.Fprintf(tw, "  Claims (staked less withdrawn): %s\n", report.Claims)
+	fmt.Fprintf(tw, "  totalStk: %s\n", report.TotalStk)
+	fmt.Fprintf(tw, "  Shortfall: %s (%.4f%% of claims); totalBurned %s\n", report.Shortfall, report.ShortfallShare*100, report.TotalBurned)
+	if report.Unexplained != "0" {
+		fmt.Fprintf(tw, "  WARNING: %s of the shortfall is not explained by burns; the stake cache may be missing events\n", report.Unexplained)
+	}
+	fmt.Fprintf(tw, "  Stakers at risk if the others withdraw first: %d of %d; claims over totalStk now: %d\n\n", report.AtRisk, len(report.Stakers), report.Blocked)
+
+	if len(report.Stakers) > 0 {
+		fmt.Fprintln(tw, "  Staker\tClaim\tAt risk\t")
+		for _, s := range report.Stakers {
+			note := ""
+			if s.Blocked {
+				note = "over totalStk"
+			}
+			fmt.Fprintf(tw, "  %s\t%s\t%s\t%s\n", s.Address, s.Claim, s.AtRisk, note)
+		}
+		fmt.Fprintln(tw)
+	}
+
+	fmt.Fprintf(tw, "Burns (%d blocks with give() calls):\n", len(report.Burns))
+	if len(report.Burns) > 0 {
+		fmt.Fprintln(tw, "  Block\tTime\tGives\tGiven (ETH)\tBurned\tTotal burned\tClaims\tShortfall")
+		for _, b := range report.Burns {
+			given, _ := new(big.Int).SetString(b.Given, 10)
+			pct := "?"
+			if b.TotalBurned != "" {
+				pct = fmt.Sprintf("%.4f%%", b.ShortfallShare*100)
+			}
+			fmt.Fprintf(tw, "  %d\t%s\t%d\t%s\t%s\t%s\t%s\t%s\n", b.Block, formatRowTime(b.Time), b.Gives, weiToEthString(given),
+				orUnknown(b.Burned), orUnknown(b.TotalBurned), b.Claims, pct)
+		}
+	}
+	return tw.Flush()
+}
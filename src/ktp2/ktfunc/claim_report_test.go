@@ -0,0 +1,121 @@
+package ktfunc
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"math/big"
+	"testing"
+
+	"ktp2/src/abis/ktv2"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// mockGaveIter is a minimal in-memory GaveIterator for tests.
+type mockGaveIter struct {
+	events []*ktv2.Ktv2Gave
+	i      int
+}
+
+func (m *mockGaveIter) Next() bool {
+	if m.i >= len(m.events) {
+		return false
+	}
+	m.i++
+	return true
+}
+func (m *mockGaveIter) Event() *ktv2.Ktv2Gave { return m.events[m.i-1] }
+func (m *mockGaveIter) Error() error          { return nil }
+func (m *mockGaveIter) Close() error          { return nil }
+
+// gaveIn returns a FilterGave result serving the events within the requested
+// range, as the real log filter does.
+func gaveIn(events []*ktv2.Ktv2Gave) func(*bind.FilterOpts) GaveIterator {
+	return func(opts *bind.FilterOpts) GaveIterator {
+		var out []*ktv2.Ktv2Gave
+		for _, e := range events {
+			if e.Raw.BlockNumber >= opts.Start && e.Raw.BlockNumber <= *opts.End {
+				out = append(out, e)
+			}
+		}
+		return &mockGaveIter{events: out}
+	}
+}
+
+func TestBuildClaimReport(t *testing.T) {
+	logrus.SetLevel(logrus.FatalLevel)
+	defer logrus.SetLevel(logrus.InfoLevel)
+
+	a, b, donor := common.HexToAddress("0x0a"), common.HexToAddress("0x0b"), common.HexToAddress("0x0d")
+	gave := func(block uint64, amt int64) *ktv2.Ktv2Gave {
+		return &ktv2.Ktv2Gave{Arg0: donor, Arg1: big.NewInt(amt), Raw: types.Log{BlockNumber: block}}
+	}
+	base := &epochFakeKt{
+		ledgerFakeKt: &ledgerFakeKt{
+			stakes: []StakeEvent{
+				{Addr: a, Amount: big.NewInt(600), Block: 120},
+				{Addr: b, Amount: big.NewInt(400), Block: 130},
+			},
+			withdraws: []WithdrawEvent{{Addr: b, Amount: big.NewInt(100), Block: 250}},
+		},
+		start:    300,
+		interval: 100,
+	}
+	kt := mockKtHistory(base)
+	kt.On("FilterGave", mock.Anything).Return(gaveIn([]*ktv2.Ktv2Gave{gave(200, 5), gave(200, 7), gave(300, 1)}), nil)
+	// 1000 staked, 100 withdrawn and 350 burned leave 550 of the 900 claimed.
+	kt.On("TotalStk", atBlock(350)).Return(big.NewInt(550), nil)
+	kt.On("TotalBurned", atBlock(350)).Return(big.NewInt(350), nil)
+	// 100 is burned at 200 and 250 at 300, where the node has no state from
+	// the block before.
+	kt.On("TotalBurned", atBlock(199)).Return(big.NewInt(0), nil)
+	kt.On("TotalBurned", atBlock(200)).Return(big.NewInt(100), nil)
+	kt.On("TotalBurned", atBlock(299)).Return((*big.Int)(nil), errors.New("missing trie node"))
+	kt.On("TotalBurned", atBlock(300)).Return(big.NewInt(350), nil)
+	cProps := newOddsTestProps(t, base, 350)
+	cProps.Kt = kt
+
+	report, err := BuildClaimReport(cProps)
+	require.NoError(t, err)
+	assert.Equal(t, "900", report.Claims)
+	assert.Equal(t, "350", report.Shortfall)
+	assert.Equal(t, "0", report.Unexplained)
+	assert.InDelta(t, 350.0/900, report.ShortfallShare, 1e-9)
+
+	require.Len(t, report.Stakers, 2)
+	assert.Equal(t, StakerClaim{Address: a.Hex(), Claim: "600", AtRisk: "350", Blocked: true}, report.Stakers[0])
+	assert.Equal(t, StakerClaim{Address: b.Hex(), Claim: "300", AtRisk: "300"}, report.Stakers[1])
+	assert.Equal(t, 2, report.AtRisk)
+	assert.Equal(t, 1, report.Blocked)
+
+	require.Len(t, report.Burns, 2)
+	first, second := report.Burns[0], report.Burns[1]
+	assert.Equal(t, 2, first.Gives)
+	assert.Equal(t, "12", first.Given)
+	assert.Equal(t, "100", first.Burned)
+	assert.Equal(t, "1000", first.Claims)
+	assert.InDelta(t, 0.1, first.ShortfallShare, 1e-9)
+	assert.Equal(t, "900", second.Claims, "the withdrawal at 250 is counted")
+	assert.Empty(t, second.Burned, "no state before the block")
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteClaimReport(&buf, report, FormatCSV))
+	r := csv.NewReader(&buf)
+	r.FieldsPerRecord = -1
+	records, err := r.ReadAll()
+	require.NoError(t, err)
+	require.Len(t, records, 6)
+	assert.Equal(t, []string{"2", "12", "100", "100", "1000", "0.1"}, records[4][2:])
+
+	buf.Reset()
+	require.NoError(t, WriteClaimReport(&buf, report, FormatTable))
+	assert.Contains(t, buf.String(), "over totalStk")
+	kt.AssertExpectations(t)
+}
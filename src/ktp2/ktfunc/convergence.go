@@ -0,0 +1,321 @@
+package ktfunc
+
+// Guided epoch convergence. Recovering a wedged epoch used to mean reading
+// -showVotes, working out who should -resetLotteryVote and re-vote, and
+// doing it by hand on each operator's node. PlanConvergence does the
+// reading and the working out for this node: it recomputes the lottery's
+// winner, explains why the epoch hasn't paid out, and lists the reset and
+// vote this node should send. Steps the contract would revert are marked
+// blocked, and ExecuteConvergePlan refuses a plan with any blocked step.
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/big"
+	"sort"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	log "github.com/sirupsen/logrus"
+)
+
+// Converge step actions.
+const (
+	ConvergeReset = "reset"
+	ConvergeVote  = "vote"
+)
+
+// ConvergeStep is one transaction this node should send. Blocked, when set,
+// is the reason the contract would revert it.
+type ConvergeStep struct {
+	Action    string
+	Candidate common.Address
+	Data      string // vote data, for a vote
+	Reason    string
+	Blocked   string
+}
+
+// CandidateTally is the contract's vote count for one candidate.
+type CandidateTally struct {
+	Candidate common.Address
+	Votes     uint16
+}
+
+// ConvergePlan is the state of the current epoch and what this node should
+// do about it.
+type ConvergePlan struct {
+	EpochStart uint64
+	EpochEnd   uint64
+	Head       uint64
+	Required   uint16
+	TotalOC    uint16
+	IsOC       bool
+	Tallies    []CandidateTally // highest first
+	Votes      []epochVote
+	OurVote    *common.Address // this node's active vote, if any
+	Winner     common.Address  // the lottery's winner; zero if not yet computable
+	WinnerData string          // the data string the lottery would vote with
+	Diagnosis  []string
+	Steps      []ConvergeStep
+}
+
+// Executable reports whether the plan has steps and none of them is blocked.
+func (p *ConvergePlan) Executable() bool {
+	if len(p.Steps) == 0 {
+		return false
+	}
+	for _, s := range p.Steps {
+		if s.Blocked != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// PlanConvergence reads the current epoch's tallies and votes, recomputes
+// the lottery's winner and works out why the epoch is stuck and what this
+// node should send to help it converge.
+func PlanConvergence(cProps *ConnectionProps) (*ConvergePlan, error) {
+	callOpts := &bind.CallOpts{Context: context.Background(), From: cProps.MyPubKey}
+	startBlock, err := cProps.Kt.StartBlock(callOpts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read start block: %w", err)
+	}
+	interval, err := cProps.Kt.EpochInterval(callOpts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read epoch interval: %w", err)
+	}
+	required, err := cProps.Kt.ConsensusReq(callOpts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read consensus requirement: %w", err)
+	}
+	totalOC, err := cProps.Kt.TotalOC(callOpts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read OC count: %w", err)
+	}
+	isOC, err := cProps.Kt.OcRwdrs(callOpts, cProps.MyPubKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read OC status: %w", err)
+	}
+	head, err := cProps.Client.BlockNumber(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("failed to read current block: %w", err)
+	}
+	endBlock := new(big.Int).Add(startBlock, big.NewInt(int64(interval)))
+
+	p := &ConvergePlan{
+		EpochStart: startBlock.Uint64(),
+		EpochEnd:   endBlock.Uint64(),
+		Head:       head,
+		Required:   required,
+		TotalOC:    totalOC,
+		IsOC:       isOC,
+	}
+
+	// A tx lands in head+1 at the earliest, and the contract wants
+	// block.number > endBlock.
+	if head < p.EpochEnd {
+		p.Diagnosis = append(p.Diagnosis, fmt.Sprintf("the epoch is still running (head %d, ends at %d); it isn't stuck, and nothing can be voted yet", head, p.EpochEnd))
+		return p, nil
+	}
+
+	if p.Votes, err = gatherEpochVotes(cProps, startBlock, head); err != nil {
+		return nil, err
+	}
+	for i := range p.Votes {
+		if p.Votes[i].Voter == cProps.MyPubKey {
+			p.OurVote = &p.Votes[i].Candidate
+		}
+	}
+	seen := make(map[common.Address]bool)
+	for _, v := range p.Votes {
+		if seen[v.Candidate] {
+			continue
+		}
+		seen[v.Candidate] = true
+		count, err := cProps.Kt.BlockRwd(callOpts, startBlock, v.Candidate)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read tally for %s: %w", v.Candidate.Hex(), err)
+		}
+		p.Tallies = append(p.Tallies, CandidateTally{Candidate: v.Candidate, Votes: count})
+	}
+	sort.SliceStable(p.Tallies, func(i, j int) bool { return p.Tallies[i].Votes > p.Tallies[j].Votes })
+
+	for _, t := range p.Tallies {
+		if t.Votes >= required {
+			p.Diagnosis = append(p.Diagnosis, fmt.Sprintf("%s already has %d/%d votes; the epoch isn't stuck, it only needs rewarding (the running node does that on its next cycle)", t.Candidate.Hex(), t.Votes, required))
+			return p, nil
+		}
+	}
+
+	winner, data, err := lotteryVote(cProps, startBlock, endBlock)
+	if err != nil {
+		p.Diagnosis = append(p.Diagnosis, fmt.Sprintf("the lottery winner can't be computed yet: %v", err))
+		return p, nil
+	}
+	p.Winner, p.WinnerData = winner, data
+
+	p.diagnose(cProps)
+	if err := p.planSteps(cProps); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// diagnose explains why no candidate has reached consensus.
+func (p *ConvergePlan) diagnose(cProps *ConnectionProps) {
+	if p.TotalOC < p.Required {
+		p.Diagnosis = append(p.Diagnosis, fmt.Sprintf("the contract has %d OC(s) but needs %d votes; no candidate can win until more OCs are added", p.TotalOC, p.Required))
+	}
+
+	var forWinner uint16
+	var others []string
+	for _, t := range p.Tallies {
+		if t.Candidate == p.Winner {
+			forWinner = t.Votes
+			continue
+		}
+		others = append(others, fmt.Sprintf("%s (%d)", t.Candidate.Hex(), t.Votes))
+	}
+	if len(others) > 0 {
+		p.Diagnosis = append(p.Diagnosis, fmt.Sprintf("votes are split: the lottery winner %s has %d, other candidates %s", p.Winner.Hex(), forWinner, strings.Join(others, ", ")))
+		for _, v := range p.Votes {
+			if v.Candidate != p.Winner && v.Voter != cProps.MyPubKey {
+				p.Diagnosis = append(p.Diagnosis, fmt.Sprintf("%s voted for %s (%s); that operator should run -converge too", v.Voter.Hex(), v.Candidate.Hex(), v.Data))
+			}
+		}
+	}
+
+	voted := uint16(len(p.Votes))
+	if voted >= p.TotalOC {
+		return
+	}
+	p.Diagnosis = append(p.Diagnosis, fmt.Sprintf("only %d of %d OCs have voted; %s needs %d more vote(s)", voted, p.TotalOC, p.Winner.Hex(), p.Required-forWinner))
+	if waiting := p.TotalOC - voted; forWinner+waiting < p.Required && p.TotalOC >= p.Required {
+		p.Diagnosis = append(p.Diagnosis, fmt.Sprintf("even if every OC yet to vote picks %s, it reaches only %d/%d; OCs voting for other candidates must reset", p.Winner.Hex(), forWinner+waiting, p.Required))
+	}
+}
+
+// planSteps lists the reset and vote this node should send, marking any
+// the contract would revert.
+func (p *ConvergePlan) planSteps(cProps *ConnectionProps) error {
+	callOpts := &bind.CallOpts{Context: context.Background(), From: cProps.MyPubKey}
+	notOC := ""
+	if !p.IsOC {
+		notOC = fmt.Sprintf("%s is not an OC (Not authorized)", cProps.MyPubKey.Hex())
+	}
+
+	if p.OurVote != nil && *p.OurVote == p.Winner {
+		p.Diagnosis = append(p.Diagnosis, "this node already votes for the lottery winner; nothing for it to do")
+		return nil
+	}
+	if p.OurVote != nil {
+		step := ConvergeStep{
+			Action:    ConvergeReset,
+			Candidate: *p.OurVote,
+			Reason:    fmt.Sprintf("this node votes for %s, not the lottery winner", p.OurVote.Hex()),
+			Blocked:   notOC,
+		}
+		declined, err := cProps.Kt.Declines(callOpts, *p.OurVote)
+		if err != nil {
+			return fmt.Errorf("failed to read declines for %s: %w", p.OurVote.Hex(), err)
+		}
+		if declined && step.Blocked == "" {
+			step.Blocked = fmt.Sprintf("%s has declined since; the contract won't reset a vote for it (Declined)", p.OurVote.Hex())
+		}
+		p.Steps = append(p.Steps, step)
+	}
+
+	step := ConvergeStep{
+		Action:    ConvergeVote,
+		Candidate: p.Winner,
+		Data:      p.WinnerData,
+		Reason:    "cast the lottery's vote",
+		Blocked:   notOC,
+	}
+	declined, err := cProps.Kt.Declines(callOpts, p.Winner)
+	if err != nil {
+		return fmt.Errorf("failed to read declines for %s: %w", p.Winner.Hex(), err)
+	}
+	if declined && step.Blocked == "" {
+		step.Blocked = fmt.Sprintf("%s has declined since the epoch ended (Declined)", p.Winner.Hex())
+	}
+	p.Steps = append(p.Steps, step)
+	return nil
+}
+
+// lotteryVote computes the winner VoteAndReward votes for in [start, end]
+// and the data string it sends with the vote, through the same pipeline.
+// Unlike VoteAndReward it doesn't wait for the seed to be confirmed: an
+// unconfirmed seed is an error.
+func lotteryVote(cProps *ConnectionProps, start, end *big.Int) (common.Address, string, error) {
+	_, mins, err := epochLotteryStakes(cProps, start, end)
+	if err != nil {
+		return common.Address{}, "", err
+	}
+	seedBlock, seedHash, err := confirmedSeed(cProps, end)
+	if err != nil {
+		return common.Address{}, "", err
+	}
+	return drawLotteryWinner(mins, seedBlock, seedHash)
+}
+
+// WriteConvergePlan prints the plan for an operator.
+func WriteConvergePlan(w io.Writer, p *ConvergePlan) {
+	fmt.Fprintf(w, "Epoch %d-%d (head %d): %d votes needed, %d OC(s)\n", p.EpochStart, p.EpochEnd, p.Head, p.Required, p.TotalOC)
+	if len(p.Tallies) > 0 {
+		fmt.Fprintln(w, "Tallies:")
+		for _, t := range p.Tallies {
+			marker := ""
+			if t.Candidate == p.Winner && p.Winner != (common.Address{}) {
+				marker = "  <-- lottery winner"
+			}
+			fmt.Fprintf(w, "  %s: %d/%d%s\n", t.Candidate.Hex(), t.Votes, p.Required, marker)
+		}
+	}
+	if p.WinnerData != "" {
+		fmt.Fprintf(w, "Lottery winner: %s (%s)\n", p.Winner.Hex(), ParseVoteData(p.WinnerData))
+	}
+	fmt.Fprintln(w, "Diagnosis:")
+	for _, d := range p.Diagnosis {
+		fmt.Fprintf(w, "  - %s\n", d)
+	}
+	if len(p.Steps) == 0 {
+		return
+	}
+	fmt.Fprintln(w, "Steps for this node:")
+	for i, s := range p.Steps {
+		fmt.Fprintf(w, "  %d. %s %s: %s\n", i+1, s.Action, s.Candidate.Hex(), s.Reason)
+		if s.Blocked != "" {
+			fmt.Fprintf(w, "     BLOCKED: %s\n", s.Blocked)
+		}
+	}
+	if !p.Executable() {
+		fmt.Fprintln(w, "The contract would revert a step above, so this plan can't be executed.")
+	}
+}
+
+// ExecuteConvergePlan sends the plan's steps in order. It refuses a plan
+// with a blocked step rather than send part of it: a vote after a reset
+// that reverts would revert too.
+func ExecuteConvergePlan(cProps *ConnectionProps, p *ConvergePlan) error {
+	if !p.Executable() {
+		return fmt.Errorf("plan has no executable steps")
+	}
+	for _, s := range p.Steps {
+		switch s.Action {
+		case ConvergeReset:
+			if err := ResetLotteryVote(cProps, s.Candidate); err != nil {
+				return err
+			}
+		case ConvergeVote:
+			log.Printf("Voting for the lottery winner %s", s.Candidate.Hex())
+			if err := vote(cProps, s.Candidate, s.Data); err != nil {
+				return fmt.Errorf("vote for %s failed: %w", s.Candidate.Hex(), err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,174 @@
+package ktfunc
+
+import (
+	"bytes"
+	"errors"
+	"math/big"
+	"testing"
+
+	"ktp2/src/abis/ktv2"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// convergeFakeKt adds the OC set and the tallies, counted from the Voted
+// history, to epochFakeKt.
+type convergeFakeKt struct {
+	*epochFakeKt
+	required uint16
+	ocs      map[common.Address]bool
+}
+
+func (f *convergeFakeKt) ConsensusReq(*bind.CallOpts) (uint16, error) { return f.required, nil }
+func (f *convergeFakeKt) TotalOC(*bind.CallOpts) (uint16, error)      { return uint16(len(f.ocs)), nil }
+func (f *convergeFakeKt) OcRwdrs(_ *bind.CallOpts, oc common.Address) (bool, error) {
+	return f.ocs[oc], nil
+}
+func (f *convergeFakeKt) BlockRwd(_ *bind.CallOpts, start *big.Int, candidate common.Address) (uint16, error) {
+	var n uint16
+	for _, v := range f.voted {
+		if v.Arg0.Cmp(start) == 0 && v.Arg1 == candidate {
+			if v.Arg2 == resetVoteData {
+				n--
+			} else {
+				n++
+			}
+		}
+	}
+	return n, nil
+}
+
+func TestPlanConvergence(t *testing.T) {
+	logrus.SetLevel(logrus.FatalLevel)
+	defer logrus.SetLevel(logrus.InfoLevel)
+
+	a, b := common.HexToAddress("0x0a"), common.HexToAddress("0x0b")
+	chainID := big.NewInt(1)
+	xTx, ocX := signedTxFromKey(t, testKeyX, chainID)
+	yTx, ocY := signedTxFromKey(t, testKeyY, chainID)
+	_, ocZ := signedTxFromKey(t, testKeyZ, chainID)
+
+	base := &epochFakeKt{
+		ledgerFakeKt: &ledgerFakeKt{stakes: []StakeEvent{
+			{Addr: a, Amount: big.NewInt(100), Block: 150},
+			{Addr: b, Amount: big.NewInt(100), Block: 160},
+		}},
+		start:    300,
+		interval: 100,
+	}
+	kt := &convergeFakeKt{epochFakeKt: base, required: 2, ocs: map[common.Address]bool{ocX: true, ocY: true, ocZ: true}}
+	cProps := newOddsTestProps(t, base, 350)
+	cProps.Kt = kt
+	cProps.MyPubKey = ocX
+
+	plan, err := PlanConvergence(cProps)
+	require.NoError(t, err)
+	assert.Contains(t, plan.Diagnosis[0], "still running")
+	assert.Empty(t, plan.Steps)
+
+	cProps = newOddsTestProps(t, base, 500)
+	cProps.Kt = kt
+	cProps.MyPubKey = ocX
+	winner, data, err := lotteryVote(cProps, big.NewInt(300), big.NewInt(400))
+	require.NoError(t, err)
+	loser := a
+	if winner == a {
+		loser = b
+	}
+
+	// X (this node) voted for the loser, Y for the winner, Z not at all.
+	client := cProps.Client.(*MockEthClient)
+	for i, v := range []struct {
+		tx        *types.Transaction
+		candidate common.Address
+	}{{xTx, loser}, {yTx, winner}} {
+		hash := common.BigToHash(big.NewInt(int64(i + 1)))
+		base.voted = append(base.voted, &ktv2.Ktv2Voted{Arg0: big.NewInt(300), Arg1: v.candidate, Arg2: data,
+			Raw: types.Log{BlockNumber: uint64(420 + i), TxHash: hash}})
+		client.On("TransactionByHash", mock.Anything, hash).Return(v.tx, false, nil)
+	}
+
+	plan, err = PlanConvergence(cProps)
+	require.NoError(t, err)
+	assert.Equal(t, winner, plan.Winner)
+	assert.Equal(t, data, plan.WinnerData)
+	require.NotNil(t, plan.OurVote)
+	assert.Equal(t, loser, *plan.OurVote)
+	assert.Len(t, plan.Tallies, 2)
+	assert.Contains(t, plan.Diagnosis[0], "votes are split")
+	assert.Contains(t, plan.Diagnosis[1], "only 2 of 3 OCs have voted")
+	require.Len(t, plan.Steps, 2)
+	assert.Equal(t, ConvergeStep{Action: ConvergeReset, Candidate: loser, Reason: plan.Steps[0].Reason}, plan.Steps[0])
+	assert.Equal(t, ConvergeVote, plan.Steps[1].Action)
+	assert.Equal(t, winner, plan.Steps[1].Candidate)
+	assert.Equal(t, data, plan.Steps[1].Data)
+	assert.True(t, plan.Executable())
+
+	var buf bytes.Buffer
+	WriteConvergePlan(&buf, plan)
+	assert.Contains(t, buf.String(), "<-- lottery winner")
+	assert.Contains(t, buf.String(), "1. reset "+loser.Hex())
+
+	// A reset for a candidate that has since declined would revert, and so
+	// would everything after it.
+	base.declined = map[common.Address]bool{loser: true}
+	plan, err = PlanConvergence(cProps)
+	require.NoError(t, err)
+	require.Len(t, plan.Steps, 2)
+	assert.Contains(t, plan.Steps[0].Blocked, "declined")
+	assert.False(t, plan.Executable())
+	assert.Error(t, ExecuteConvergePlan(cProps, plan))
+	base.declined = nil
+
+	// A node that isn't an OC can't send anything.
+	delete(kt.ocs, ocX)
+	plan, err = PlanConvergence(cProps)
+	require.NoError(t, err)
+	assert.Contains(t, plan.Steps[0].Blocked, "not an OC")
+	assert.False(t, plan.Executable())
+	kt.ocs[ocX] = true
+
+	// Once the winner has enough votes there is nothing to converge.
+	kt.required = 1
+	plan, err = PlanConvergence(cProps)
+	require.NoError(t, err)
+	assert.Contains(t, plan.Diagnosis[0], "only needs rewarding")
+	assert.Empty(t, plan.Steps)
+}
+
+// TestLotteryVote_WaitsForConfirmationDepth — the lottery winner is only
+// computed once the seed block is as deep as VoteAndReward requires, so the
+// plan never votes on a seed the node itself wouldn't use yet.
+func TestLotteryVote_WaitsForConfirmationDepth(t *testing.T) {
+	logrus.SetLevel(logrus.FatalLevel)
+	defer logrus.SetLevel(logrus.InfoLevel)
+
+	base := &epochFakeKt{
+		ledgerFakeKt: &ledgerFakeKt{stakes: []StakeEvent{{Addr: common.HexToAddress("0x0a"), Amount: big.NewInt(100), Block: 150}}},
+		start:        300,
+		interval:     100,
+	}
+	cProps := newOddsTestProps(t, base, 500)
+	cProps.ConfirmationDepth = 10
+	required := 400 + SeedOffset + 10
+	client := &MockEthClient{}
+	client.On("BlockNumber", mock.Anything).Return(uint64(500), nil).Maybe()
+	client.On("HeaderByNumber", mock.Anything, mock.MatchedBy(func(n *big.Int) bool { return n != nil && n.Uint64() >= required })).
+		Return((*types.Header)(nil), errors.New("not found"))
+	client.On("HeaderByNumber", mock.Anything, mock.Anything).Return(&types.Header{}, nil).Maybe()
+	cProps.Client = client
+
+	_, _, err := lotteryVote(cProps, big.NewInt(300), big.NewInt(400))
+	assert.ErrorIs(t, err, errSeedNotConfirmed)
+
+	cProps.ConfirmationDepth = 1
+	_, data, err := lotteryVote(cProps, big.NewInt(300), big.NewInt(400))
+	require.NoError(t, err)
+	assert.Equal(t, 400+SeedOffset, ParseVoteData(data).SeedBlock)
+}
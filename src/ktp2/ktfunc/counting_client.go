@@ -12,9 +12,14 @@ package ktfunc
 // AND the contract-binding backend (bind.ContractBackend). The binding backend
 // is where eth_getLogs (FilterStaked/Voted/Rwd) and eth_call (contract reads)
 // actually go, which is the bulk of the traffic.
+//
+// JSON-RPC batches are counted per element, by each element's method, so a
+// batch of 100 eth_getTransactionByHash lookups shows as 100 of them, the
+// way providers bill it.
 
 import (
 	"context"
+	"errors"
 	"math/big"
 	"sort"
 	"sync"
@@ -23,6 +28,7 @@ import (
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -37,13 +43,29 @@ type fullClient interface {
 // Safe for concurrent use.
 type CountingClient struct {
 	inner  fullClient
+	batch  BatchCaller // nil when the client can't send batches
 	mu     sync.Mutex
 	counts map[string]int64
 }
 
-// NewCountingClient wraps an Ethereum client to count its RPC calls.
+// errBatchUnsupported is returned by BatchCallContext when no batch-capable
+// client has been attached.
+var errBatchUnsupported = errors.New("client does not support JSON-RPC batches")
+
+// NewCountingClient wraps an Ethereum client to count its RPC calls. Batches
+// go to inner if it can send them; *ethclient.Client can't itself, so
+// attach its rpc.Client with SetBatchCaller.
 func NewCountingClient(inner fullClient) *CountingClient {
-	return &CountingClient{inner: inner, counts: make(map[string]int64)}
+	c := &CountingClient{inner: inner, counts: make(map[string]int64)}
+	if b, ok := inner.(BatchCaller); ok {
+		c.batch = b
+	}
+	return c
+}
+
+// SetBatchCaller sets the client JSON-RPC batches are sent through.
+func (c *CountingClient) SetBatchCaller(b BatchCaller) {
+	c.batch = b
 }
 
 func (c *CountingClient) inc(method string) {
@@ -184,3 +206,15 @@ func (c *CountingClient) SubscribeNewHead(ctx context.Context, ch chan<- *types.
 	c.inc("eth_subscribe(newHeads)")
 	return c.inner.SubscribeNewHead(ctx, ch)
 }
+
+func (c *CountingClient) BatchCallContext(ctx context.Context, b []rpc.BatchElem) error {
+	if c.batch == nil {
+		return errBatchUnsupported
+	}
+	c.mu.Lock()
+	for _, elem := range b {
+		c.counts[elem.Method]++
+	}
+	c.mu.Unlock()
+	return c.batch.BatchCallContext(ctx, b)
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -65,3 +66,26 @@ func TestCountingClient_CountsByMethod(t *testing.T) {
 	_, afterReset := c.Snapshot()
 	assert.Equal(t, int64(0), afterReset)
 }
+
+func TestCountingClient_CountsBatchElements(t *testing.T) {
+	c := NewCountingClient(noopClient{})
+	batch := []rpc.BatchElem{
+		{Method: "eth_getTransactionByHash", Args: []interface{}{common.Hash{1}}},
+		{Method: "eth_getTransactionByHash", Args: []interface{}{common.Hash{2}}},
+		{Method: "eth_getTransactionReceipt", Args: []interface{}{common.Hash{1}}},
+	}
+
+	// Without a batch-capable client nothing is sent or counted.
+	assert.ErrorIs(t, c.BatchCallContext(context.Background(), batch), errBatchUnsupported)
+	_, total := c.Snapshot()
+	assert.Equal(t, int64(0), total)
+
+	inner := &batchingClient{MockEthClient: &MockEthClient{}}
+	c.SetBatchCaller(inner)
+	assert.NoError(t, c.BatchCallContext(context.Background(), batch))
+	counts, total := c.Snapshot()
+	assert.Equal(t, int64(3), total)
+	assert.Equal(t, int64(2), counts["eth_getTransactionByHash"])
+	assert.Equal(t, int64(1), counts["eth_getTransactionReceipt"])
+	assert.Equal(t, []int{3}, inner.batches)
+}
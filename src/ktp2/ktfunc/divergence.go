@@ -0,0 +1,232 @@
+package ktfunc
+
+// Divergence detection. An epoch only pays out once consensusReq OCs vote
+// for the same winner, so a node that disagrees with its peers wedges the
+// epoch, and until now that surfaced only when someone ran -showVotes.
+// After each vote the node re-reads the epoch's votes and compares every
+// peer's candidate with its own. On a disagreement it alerts and writes a
+// diagnostic bundle holding everything its winner was drawn from; operators
+// diff their bundles to find the input they don't share.
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	log "github.com/sirupsen/logrus"
+)
+
+// DivergenceBundle is what this node drew its winner from, plus every
+// vote it could see in the epoch, written when a peer voted differently.
+type DivergenceBundle struct {
+	Node        string          `json:"node"`
+	ChainID     string          `json:"chainId"`
+	Contract    string          `json:"contract"`
+	CreatedAt   time.Time       `json:"createdAt"`
+	EpochStart  uint64          `json:"epochStart"`
+	EpochEnd    uint64          `json:"epochEnd"`
+	Algorithm   int             `json:"algorithm"`
+	SeedBlock   uint64          `json:"seedBlock"`
+	SeedHash    string          `json:"seedHash"`
+	StakeDigest string          `json:"stakeDigest"`
+	TotalMin    string          `json:"totalMin"`
+	Winner      string          `json:"winner"`
+	Stakers     []EpochStaker   `json:"stakers"`
+	Votes       []DivergentVote `json:"votes"`
+}
+
+// DivergentVote is one peer's vote in the epoch. Causes names what the
+// peer's vote data says it did differently; it is empty when the peer
+// agrees with this node.
+type DivergentVote struct {
+	Voter     string   `json:"voter"`
+	Candidate string   `json:"candidate"`
+	Data      string   `json:"data"`
+	Agrees    bool     `json:"agrees"`
+	Causes    []string `json:"causes,omitempty"`
+}
+
+// Diverged reports whether any peer voted for a different winner.
+func (b *DivergenceBundle) Diverged() bool {
+	for _, v := range b.Votes {
+		if !v.Agrees {
+			return true
+		}
+	}
+	return false
+}
+
+// checkDivergence compares the epoch's current peer votes with this node's
+// winner, which it drew from mins using the vote data voteData. The bundle
+// is returned whether or not anyone diverged; see Diverged.
+func checkDivergence(
+	cProps *ConnectionProps,
+	epochStart, epochEnd *big.Int,
+	winner common.Address,
+	voteData string,
+	mins map[common.Address]*UserStakeData,
+	totalMin *big.Int,
+) (*DivergenceBundle, error) {
+	head, err := cProps.Client.BlockNumber(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("failed to read current block: %w", err)
+	}
+	votes, err := gatherEpochVotes(cProps, epochStart, head)
+	if err != nil {
+		return nil, err
+	}
+
+	ours := ParseVoteData(voteData)
+	b := &DivergenceBundle{
+		Node:        cProps.MyPubKey.Hex(),
+		Contract:    cProps.KtAddr.Hex(),
+		CreatedAt:   time.Now().UTC(),
+		EpochStart:  epochStart.Uint64(),
+		EpochEnd:    epochEnd.Uint64(),
+		Algorithm:   ours.Algorithm,
+		SeedBlock:   ours.SeedBlock,
+		SeedHash:    ours.SeedHash.Hex(),
+		StakeDigest: ours.StakeDigest.Hex(),
+		TotalMin:    totalMin.String(),
+		Winner:      winner.Hex(),
+		Stakers:     []EpochStaker{},
+		Votes:       []DivergentVote{},
+	}
+	if cProps.ChainID != nil {
+		b.ChainID = cProps.ChainID.String()
+	}
+	for addr, d := range mins {
+		s := EpochStaker{Address: addr.Hex(), MinStake: d.StakeAmount.String()}
+		if d.Prob != nil {
+			s.Probability, _ = d.Prob.Float64()
+		}
+		b.Stakers = append(b.Stakers, s)
+	}
+	sort.Slice(b.Stakers, func(i, j int) bool { return b.Stakers[i].Address < b.Stakers[j].Address })
+
+	for _, v := range votes {
+		if v.Voter == cProps.MyPubKey {
+			continue
+		}
+		dv := DivergentVote{
+			Voter:     v.Voter.Hex(),
+			Candidate: v.Candidate.Hex(),
+			Data:      v.Data.Raw,
+			Agrees:    v.Candidate == winner,
+		}
+		if !dv.Agrees {
+			dv.Causes = divergenceCauses(v.Data, ours)
+		}
+		b.Votes = append(b.Votes, dv)
+	}
+	return b, nil
+}
+
+// divergenceCauses names what a peer's vote data says it did differently
+// from this node's.
+func divergenceCauses(peer, ours VoteData) []string {
+	switch peer.Kind {
+	case VoteDataManual:
+		return []string{"the voter overrode the lottery with -voteFor"}
+	case VoteDataLegacySeed:
+		causes := []string{"the voter runs a build from before versioned vote data"}
+		if peer.SeedHash != ours.SeedHash {
+			causes = append(causes, fmt.Sprintf("the voter seeded from %s; this node from %s", peer.SeedHash.Hex(), ours.SeedHash.Hex()))
+		}
+		return causes
+	case VoteDataTagged:
+		causes := voteDifferences(peer, ours.SeedBlock, ours.StakeDigest)
+		if peer.SeedBlock == ours.SeedBlock && peer.SeedHash != ours.SeedHash {
+			causes = append(causes, fmt.Sprintf("the voter read seed hash %s for block %d; this node read %s (a reorg around the seed block, or a lagging RPC node)",
+				peer.SeedHash.Hex(), peer.SeedBlock, ours.SeedHash.Hex()))
+		}
+		if len(causes) == 0 {
+			causes = append(causes, "the voter reports the same algorithm, seed and stake set as this node; compare the bundles' stakers")
+		}
+		return causes
+	}
+	return []string{fmt.Sprintf("the voter's data %q is in no known format", peer.Raw)}
+}
+
+// WriteDivergenceBundle writes b as indented JSON into dir, named for the
+// epoch and this node so bundles from several operators can sit side by
+// side. Returns the file's path.
+func WriteDivergenceBundle(dir string, b *DivergenceBundle) (string, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("failed to create diagnostics dir %s: %w", dir, err)
+	}
+	data, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, fmt.Sprintf("divergence-%d-%s.json", b.EpochStart, strings.ToLower(b.Node)))
+	if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+		return "", fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return path, nil
+}
+
+// reportedDivergence is the disagreement reportDivergence last alerted on:
+// the epoch and the diverging peer votes, as voter>candidate pairs.
+type reportedDivergence struct {
+	epoch uint64
+	sig   string
+}
+
+// reportDivergence runs checkDivergence after this node's vote and, when a
+// peer disagrees, alerts and writes the bundle. The run loop votes every
+// cycle until the epoch is rewarded, so the same disagreement is reported
+// once; a new diverging vote reports again. Returns the bundle's path, or
+// "" when nothing new was reported.
+func reportDivergence(
+	cProps *ConnectionProps,
+	epochStart, epochEnd *big.Int,
+	winner common.Address,
+	voteData string,
+	mins map[common.Address]*UserStakeData,
+	totalMin *big.Int,
+) (string, error) {
+	b, err := checkDivergence(cProps, epochStart, epochEnd, winner, voteData, mins, totalMin)
+	if err != nil {
+		return "", err
+	}
+	if !b.Diverged() {
+		return "", nil
+	}
+
+	var key []string
+	for _, v := range b.Votes {
+		if !v.Agrees {
+			key = append(key, v.Voter+">"+v.Candidate)
+		}
+	}
+	sig := strings.Join(key, ",")
+	if cProps.divergenceReported == (reportedDivergence{epoch: b.EpochStart, sig: sig}) {
+		return "", nil
+	}
+
+	log.Errorf("DIVERGENCE: in epoch %d this node voted for %s, but %d peer(s) voted otherwise", b.EpochStart, b.Winner, len(key))
+	for _, v := range b.Votes {
+		if v.Agrees {
+			continue
+		}
+		log.Errorf("  %s voted for %s (%s)", v.Voter, v.Candidate, ParseVoteData(v.Data))
+		for _, cause := range v.Causes {
+			log.Errorf("    cause: %s", cause)
+		}
+	}
+	path, err := WriteDivergenceBundle(cProps.ResolvedDiagnosticsDir(), b)
+	if err != nil {
+		return "", err
+	}
+	log.Errorf("  Diagnostic bundle written to %s; compare it with the diverging operators' bundles.", path)
+	cProps.divergenceReported = reportedDivergence{epoch: b.EpochStart, sig: sig}
+	return path, nil
+}
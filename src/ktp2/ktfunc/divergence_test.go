@@ -0,0 +1,127 @@
+package ktfunc
+
+import (
+	"encoding/json"
+	"math/big"
+	"os"
+	"testing"
+
+	"ktp2/src/abis/ktv2"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+const testKeyZ = "0303030303030303030303030303030303030303030303030303030303030303"
+
+func TestReportDivergence(t *testing.T) {
+	logrus.SetLevel(logrus.FatalLevel)
+	defer logrus.SetLevel(logrus.InfoLevel)
+
+	a, b := common.HexToAddress("0x0a"), common.HexToAddress("0x0b")
+	mins := map[common.Address]*UserStakeData{
+		a: {StakeAmount: big.NewInt(60)},
+		b: {StakeAmount: big.NewInt(40)},
+	}
+	totalMin := big.NewInt(100)
+	calculateProbsForEachWallet(mins, totalMin)
+	seed := common.HexToHash("0x5eed")
+	ours := FormatVoteData(ConsensusAlgorithmVersion, 600+SeedOffset, seed, StakeSetDigest(mins))
+
+	chainID := big.NewInt(1)
+	xTx, ocX := signedTxFromKey(t, testKeyX, chainID)
+	yTx, ocY := signedTxFromKey(t, testKeyY, chainID)
+	zTx, ocZ := signedTxFromKey(t, testKeyZ, chainID)
+
+	// X is this node. Y agrees; Z drew b from a stake set missing a.
+	kt := &epochFakeKt{ledgerFakeKt: &ledgerFakeKt{}, start: 500, interval: 100}
+	cProps := newOddsTestProps(t, kt, 620)
+	cProps.MyPubKey = ocX
+	cProps.DiagnosticsDir = t.TempDir()
+	client := cProps.Client.(*MockEthClient)
+	peerData := FormatVoteData(ConsensusAlgorithmVersion, 600+SeedOffset, seed, StakeSetDigest(map[common.Address]*UserStakeData{b: mins[b]}))
+	for i, v := range []struct {
+		tx        *types.Transaction
+		candidate common.Address
+		data      string
+	}{{xTx, a, ours}, {yTx, a, ours}, {zTx, b, peerData}} {
+		hash := common.BigToHash(big.NewInt(int64(i + 1)))
+		kt.voted = append(kt.voted, &ktv2.Ktv2Voted{Arg0: big.NewInt(500), Arg1: v.candidate, Arg2: v.data})
+		kt.voted[i].Raw.BlockNumber = uint64(610 + i)
+		kt.voted[i].Raw.TxHash = hash
+		client.On("TransactionByHash", mock.Anything, hash).Return(v.tx, false, nil)
+	}
+
+	epochStart, epochEnd := big.NewInt(500), big.NewInt(600)
+	path, err := reportDivergence(cProps, epochStart, epochEnd, a, ours, mins, totalMin)
+	require.NoError(t, err)
+	require.NotEmpty(t, path)
+
+	raw, err := os.ReadFile(path)
+	require.NoError(t, err)
+	var bundle DivergenceBundle
+	require.NoError(t, json.Unmarshal(raw, &bundle))
+	assert.Equal(t, ocX.Hex(), bundle.Node)
+	assert.Equal(t, uint64(600+SeedOffset), bundle.SeedBlock)
+	assert.Equal(t, seed.Hex(), bundle.SeedHash)
+	assert.Equal(t, StakeSetDigest(mins).Hex(), bundle.StakeDigest)
+	require.Len(t, bundle.Stakers, 2)
+	assert.Equal(t, EpochStaker{Address: a.Hex(), MinStake: "60", Probability: bundle.Stakers[0].Probability}, bundle.Stakers[0])
+	assert.Equal(t, b.Hex(), bundle.Stakers[1].Address)
+	assert.InDelta(t, 1, bundle.Stakers[0].Probability+bundle.Stakers[1].Probability, 1e-12)
+	require.Len(t, bundle.Votes, 2, "this node's own vote is left out")
+	assert.Equal(t, DivergentVote{Voter: ocY.Hex(), Candidate: a.Hex(), Data: ours, Agrees: true}, bundle.Votes[0])
+	assert.Equal(t, ocZ.Hex(), bundle.Votes[1].Voter)
+	assert.False(t, bundle.Votes[1].Agrees)
+	require.Len(t, bundle.Votes[1].Causes, 1)
+	assert.Contains(t, bundle.Votes[1].Causes[0], "stake set")
+
+	// The next cycle sees the same split and stays quiet.
+	path, err = reportDivergence(cProps, epochStart, epochEnd, a, ours, mins, totalMin)
+	require.NoError(t, err)
+	assert.Empty(t, path)
+
+	// A new epoch replaces the one remembered, so nothing piles up.
+	cProps.divergenceReported.epoch = 400
+	path, err = reportDivergence(cProps, epochStart, epochEnd, a, ours, mins, totalMin)
+	require.NoError(t, err)
+	assert.NotEmpty(t, path, "a reported earlier epoch doesn't mute this one")
+	assert.Equal(t, uint64(500), cProps.divergenceReported.epoch)
+
+	// No divergence, no bundle.
+	kt.voted = kt.voted[:2]
+	b2, err := checkDivergence(cProps, epochStart, epochEnd, a, ours, mins, totalMin)
+	require.NoError(t, err)
+	assert.False(t, b2.Diverged())
+}
+
+func TestDivergenceCauses(t *testing.T) {
+	seed := common.HexToHash("0x5eed")
+	digest := common.HexToHash("0xd1")
+	ours := ParseVoteData(FormatVoteData(ConsensusAlgorithmVersion, 610, seed, digest))
+
+	assert.Equal(t, []string{"the voter overrode the lottery with -voteFor"}, divergenceCauses(ParseVoteData(manualVoteData), ours))
+
+	legacy := divergenceCauses(ParseVoteData(common.HexToHash("0xbeef").Hex()), ours)
+	require.Len(t, legacy, 2)
+	assert.Contains(t, legacy[0], "before versioned vote data")
+	assert.Contains(t, legacy[1], "seeded from")
+
+	reorged := divergenceCauses(ParseVoteData(FormatVoteData(ConsensusAlgorithmVersion, 610, common.HexToHash("0xbeef"), digest)), ours)
+	require.Len(t, reorged, 1)
+	assert.Contains(t, reorged[0], "seed hash")
+
+	otherStake := divergenceCauses(ParseVoteData(FormatVoteData(ConsensusAlgorithmVersion, 610, seed, common.HexToHash("0xd2"))), ours)
+	require.Len(t, otherStake, 1)
+	assert.Contains(t, otherStake[0], "this build's replay gives "+digest.Hex())
+
+	same := divergenceCauses(ours, ours)
+	require.Len(t, same, 1)
+	assert.Contains(t, same[0], "compare the bundles")
+
+	assert.Contains(t, divergenceCauses(ParseVoteData("hello"), ours)[0], "no known format")
+}
@@ -0,0 +1,401 @@
+package ktfunc
+
+// Donation history. Every give() emits Gave(donor, amount), where amount is
+// the ETH passed on to the donation address (donationPrc of msg.value), and
+// adds that same amount to totalGvn. The tokens it burns are recorded only
+// in totalBurned. give() is the only function that moves either total, so
+// over any block range the Gave events must add up to the change in
+// totalGvn, and the burns across the donation blocks must add up to the
+// change in totalBurned. A difference means the event cache is missing
+// events. The totals are read at both ends of the range, which needs
+// archive state unless the range ends at the head.
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	log "github.com/sirupsen/logrus"
+)
+
+// Donation is one give() call. Amounts are in wei.
+type Donation struct {
+	Block  uint64    `json:"block"`
+	Time   time.Time `json:"time"`
+	Donor  string    `json:"donor"`
+	Amount string    `json:"amount"`
+	// Epoch is the start block of the epoch the donation fell in, or 0 if
+	// it came before the first epoch with a vote.
+	Epoch uint64 `json:"epoch"`
+}
+
+// DonorTotal is one donor's donations over the range.
+type DonorTotal struct {
+	Donor     string  `json:"donor"`
+	Donations int     `json:"donations"`
+	Given     string  `json:"given"`
+	Share     float64 `json:"share"` // of everything given in the range
+}
+
+// EpochDonations is the donations of one epoch that fall in the range.
+type EpochDonations struct {
+	Epoch     uint64 `json:"epoch"`
+	End       uint64 `json:"end,omitempty"` // zero for the epoch still running
+	Donations int    `json:"donations"`
+	Donors    int    `json:"donors"`
+	Given     string `json:"given"`
+	// Burned is the tokens the epoch's donations burned; empty when the
+	// node served no state around one of their blocks.
+	Burned string `json:"burned,omitempty"`
+}
+
+// DonationReport lists the donations in [From, To] and reconciles them
+// against the contract's running totals. The totals are empty when the
+// node served no state at the block they are read at.
+type DonationReport struct {
+	From      uint64           `json:"from"`
+	To        uint64           `json:"to"`
+	Donations []Donation       `json:"donations"` // oldest first
+	Donors    []DonorTotal     `json:"donors"`    // largest first
+	Epochs    []EpochDonations `json:"epochs"`    // oldest first
+	Given     string           `json:"given"`
+	Burned    string           `json:"burned,omitempty"`
+	// TotalGvn and TotalBurned are the contract's totals at To; the deltas
+	// are their change across the range.
+	TotalGvn         string   `json:"totalGvn,omitempty"`
+	TotalGvnDelta    string   `json:"totalGvnDelta,omitempty"`
+	TotalBurned      string   `json:"totalBurned,omitempty"`
+	TotalBurnedDelta string   `json:"totalBurnedDelta,omitempty"`
+	Warnings         []string `json:"warnings,omitempty"`
+}
+
+// GatherGaveEvents returns every Gave event in [from, to], oldest first.
+// Events come from the event cache, which is extended as needed.
+func GatherGaveEvents(cProps *ConnectionProps, from, to uint64) ([]GaveEvent, error) {
+	creation, err := GetContractCreationBlock(cProps)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get contract creation block: %w", err)
+	}
+	from = max(from, creation)
+	if to < from {
+		return nil, nil
+	}
+	store, release, err := openEventStore(cProps)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	tip, err := reconcileCacheTip(cProps, store)
+	if err != nil {
+		return nil, err
+	}
+	chunkSize := uint64(cProps.ChunkSize)
+	if chunkSize == 0 {
+		chunkSize = uint64(DefaultChunkSize)
+	}
+	// Start on the chunk grid and drop what comes before from afterwards.
+	fetchFrom := creation + (from-creation)/chunkSize*chunkSize
+	events, err := loadEventRange(cProps, cProps.Kt, store, tip, fetchFrom, to)
+	if err != nil {
+		return nil, err
+	}
+	var out []GaveEvent
+	for _, e := range events.GaveEvents {
+		if e.Block >= from && e.Block <= to {
+			out = append(out, e)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Block < out[j].Block })
+	return out, nil
+}
+
+// BuildDonationReport lists the donations in [from, to] with totals per
+// donor and per epoch, and reconciles them against totalGvn and
+// totalBurned. to is capped at the current block.
+func BuildDonationReport(cProps *ConnectionProps, from, to uint64) (*DonationReport, error) {
+	head, err := cProps.Client.BlockNumber(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("failed to read current block: %w", err)
+	}
+	creation, err := GetContractCreationBlock(cProps)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get contract creation block: %w", err)
+	}
+	from, to = max(from, creation), min(to, head)
+	if to < from {
+		return nil, fmt.Errorf("block range %d:%d is empty (contract created at %d, head %d)", from, to, creation, head)
+	}
+	gives, err := GatherGaveEvents(cProps, from, to)
+	if err != nil {
+		return nil, err
+	}
+	epochOf, epochEnds, err := donationEpochs(cProps, from, head)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &DonationReport{
+		From: from, To: to,
+		Donations: []Donation{}, Donors: []DonorTotal{}, Epochs: []EpochDonations{},
+	}
+	given := new(big.Int)
+	donors := make(map[common.Address]*DonorTotal)
+	donorSums := make(map[common.Address]*big.Int)
+	type epochAcc struct {
+		row    *EpochDonations
+		given  *big.Int
+		burned *big.Int // nil once a burn is unknown
+		donors map[common.Address]bool
+	}
+	epochs := make(map[uint64]*epochAcc)
+	var order []uint64
+	for i, g := range gives {
+		epoch := epochOf(g.Block)
+		report.Donations = append(report.Donations, Donation{
+			Block: g.Block, Time: blockTime(cProps, g.Block), Donor: g.Addr.Hex(), Amount: g.Amount.String(), Epoch: epoch,
+		})
+		given.Add(given, g.Amount)
+
+		d := donors[g.Addr]
+		if d == nil {
+			d = &DonorTotal{Donor: g.Addr.Hex()}
+			donors[g.Addr], donorSums[g.Addr] = d, new(big.Int)
+		}
+		d.Donations++
+		donorSums[g.Addr].Add(donorSums[g.Addr], g.Amount)
+
+		e := epochs[epoch]
+		if e == nil {
+			e = &epochAcc{
+				row:    &EpochDonations{Epoch: epoch, End: epochEnds[epoch]},
+				given:  new(big.Int),
+				burned: new(big.Int),
+				donors: make(map[common.Address]bool),
+			}
+			epochs[epoch] = e
+			order = append(order, epoch)
+		}
+		e.row.Donations++
+		e.given.Add(e.given, g.Amount)
+		e.donors[g.Addr] = true
+		// A block's burn is read once, with its first donation.
+		if (i > 0 && gives[i-1].Block == g.Block) || e.burned == nil {
+			continue
+		}
+		if after, before, ok := burnedAcross(cProps, g.Block); ok {
+			e.burned.Add(e.burned, after.Sub(after, before))
+		} else {
+			e.burned = nil
+		}
+	}
+
+	burned, burnedKnown := new(big.Int), true
+	for _, epoch := range order {
+		e := epochs[epoch]
+		e.row.Given = e.given.String()
+		e.row.Donors = len(e.donors)
+		if e.burned != nil {
+			e.row.Burned = e.burned.String()
+			burned.Add(burned, e.burned)
+		} else {
+			burnedKnown = false
+		}
+		report.Epochs = append(report.Epochs, *e.row)
+	}
+	addrs := make([]common.Address, 0, len(donors))
+	for addr := range donors {
+		addrs = append(addrs, addr)
+	}
+	sort.Slice(addrs, func(i, j int) bool {
+		if c := donorSums[addrs[i]].Cmp(donorSums[addrs[j]]); c != 0 {
+			return c > 0
+		}
+		return addrs[i].Hex() < addrs[j].Hex()
+	})
+	for _, addr := range addrs {
+		d := donors[addr]
+		d.Given = donorSums[addr].String()
+		d.Share = bigRatio(donorSums[addr], given)
+		report.Donors = append(report.Donors, *d)
+	}
+	report.Given = given.String()
+	if burnedKnown {
+		report.Burned = burned.String()
+	}
+	reconcileDonations(cProps, report, creation, given, burned, burnedKnown)
+	return report, nil
+}
+
+// donationEpochs maps a block to the start of its epoch, from the epochs
+// rewarded since from and the one running now. ends holds each rewarded
+// epoch's end block.
+func donationEpochs(cProps *ConnectionProps, from, head uint64) (epochOf func(uint64) uint64, ends map[uint64]uint64, err error) {
+	past, err := GatherPastEpochs(cProps, from, head)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to gather past epochs: %w", err)
+	}
+	current, err := cProps.Kt.StartBlock(&bind.CallOpts{Context: context.Background(), From: cProps.MyPubKey})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read start block: %w", err)
+	}
+	ends = make(map[uint64]uint64, len(past))
+	starts := make([]uint64, 0, len(past)+1)
+	for _, e := range past {
+		ends[e.Start] = e.End
+		starts = append(starts, e.Start)
+	}
+	starts = append(starts, current.Uint64())
+	sort.Slice(starts, func(i, j int) bool { return starts[i] < starts[j] })
+	return func(block uint64) uint64 {
+		i := sort.Search(len(starts), func(i int) bool { return starts[i] > block }) - 1
+		if i < 0 {
+			return 0
+		}
+		return starts[i]
+	}, ends, nil
+}
+
+// reconcileDonations reads totalGvn and totalBurned at both ends of the
+// range and warns where the events don't account for their change.
+func reconcileDonations(cProps *ConnectionProps, report *DonationReport, creation uint64, given, burned *big.Int, burnedKnown bool) {
+	type totals struct{ gvn, burned *big.Int }
+	read := func(block uint64) (totals, bool) {
+		opts := &bind.CallOpts{Context: context.Background(), BlockNumber: new(big.Int).SetUint64(block)}
+		gvn, err := cProps.Kt.TotalGvn(opts)
+		if err == nil {
+			var b *big.Int
+			if b, err = cProps.Kt.TotalBurned(opts); err == nil {
+				return totals{gvn, b}, true
+			}
+		}
+		log.Debugf("Could not read totalGvn and totalBurned at block %d: %v", block, err)
+		return totals{}, false
+	}
+
+	end, ok := read(report.To)
+	if !ok {
+		report.Warnings = append(report.Warnings, fmt.Sprintf("no state at block %d, so the donations can't be reconciled (needs an archive node)", report.To))
+		return
+	}
+	report.TotalGvn, report.TotalBurned = end.gvn.String(), end.burned.String()
+	// Before the contract existed, both totals were zero.
+	start, ok := totals{new(big.Int), new(big.Int)}, true
+	if report.From > creation {
+		start, ok = read(report.From - 1)
+	}
+	if !ok {
+		report.Warnings = append(report.Warnings, fmt.Sprintf("no state at block %d, so the donations can't be reconciled (needs an archive node)", report.From-1))
+		return
+	}
+	gvnDelta := new(big.Int).Sub(end.gvn, start.gvn)
+	burnedDelta := new(big.Int).Sub(end.burned, start.burned)
+	report.TotalGvnDelta, report.TotalBurnedDelta = gvnDelta.String(), burnedDelta.String()
+	if gvnDelta.Cmp(given) != 0 {
+		report.Warnings = append(report.Warnings, fmt.Sprintf("the Gave events add up to %s but totalGvn moved by %s; the event cache may be missing events", given, gvnDelta))
+	}
+	switch {
+	case !burnedKnown:
+		report.Warnings = append(report.Warnings, "some burns could not be read, so totalBurned is only partly reconciled")
+	case burnedDelta.Cmp(burned) != 0:
+		report.Warnings = append(report.Warnings, fmt.Sprintf("the donation blocks burned %s but totalBurned moved by %s; the event cache may be missing events", burned, burnedDelta))
+	}
+}
+
+// WriteDonationReport renders report to w. CSV writes the donations, the
+// donors and the epochs as three blocks separated by blank lines.
+func WriteDonationReport(w io.Writer, report *DonationReport, format OutputFormat) error {
+	switch format {
+	case FormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	case FormatCSV:
+		cw := csv.NewWriter(w)
+		blocks := [][][]string{{{"block", "time", "donor", "amount", "epoch"}}, {{"donor", "donations", "given", "share"}}, {{"epoch", "end", "donations", "donors", "given", "burned"}}}
+		for _, d := range report.Donations {
+			blocks[0] = append(blocks[0], []string{strconv.FormatUint(d.Block, 10), formatRowTime(d.Time), d.Donor, d.Amount, strconv.FormatUint(d.Epoch, 10)})
+		}
+		for _, d := range report.Donors {
+			blocks[1] = append(blocks[1], []string{d.Donor, strconv.Itoa(d.Donations), d.Given, strconv.FormatFloat(d.Share, 'f', -1, 64)})
+		}
+		for _, e := range report.Epochs {
+			blocks[2] = append(blocks[2], []string{
+				strconv.FormatUint(e.Epoch, 10), strconv.FormatUint(e.End, 10), strconv.Itoa(e.Donations), strconv.Itoa(e.Donors), e.Given, e.Burned,
+			})
+		}
+		for i, rows := range blocks {
+			if i > 0 {
+				if _, err := io.WriteString(w, "\n"); err != nil {
+					return err
+				}
+			}
+			if err := cw.WriteAll(rows); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	orUnknown := func(s string) string {
+		if s == "" {
+			return "?"
+		}
+		return s
+	}
+	eth := func(s string) string {
+		v, ok := new(big.Int).SetString(s, 10)
+		if !ok {
+			return "?"
+		}
+		return weiToEthString(v)
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "Donations in blocks %d-%d: %d from %d donors, %s ETH given, %s tokens burned\n",
+		report.From, report.To, len(report.Donations), len(report.Donors), eth(report.Given), orUnknown(report.Burned))
+	if report.TotalGvnDelta != "" {
+		fmt.Fprintf(tw, "  totalGvn moved by %s ETH (now %s ETH); totalBurned moved by %s (now %s)\n",
+			eth(report.TotalGvnDelta), eth(report.TotalGvn), report.TotalBurnedDelta, report.TotalBurned)
+	}
+	for _, warning := range report.Warnings {
+		fmt.Fprintf(tw, "  WARNING: %s\n", warning)
+	}
+	fmt.Fprintln(tw)
+
+	if len(report.Donors) > 0 {
+		fmt.Fprintln(tw, "  Donor\tDonations\tGiven (ETH)\tShare")
+		for _, d := range report.Donors {
+			fmt.Fprintf(tw, "  %s\t%d\t%s\t%.2f%%\n", d.Donor, d.Donations, eth(d.Given), d.Share*100)
+		}
+		fmt.Fprintln(tw)
+	}
+	if len(report.Epochs) > 0 {
+		fmt.Fprintln(tw, "  Epoch\tEnd\tDonations\tDonors\tGiven (ETH)\tBurned")
+		for _, e := range report.Epochs {
+			end := "running"
+			switch {
+			case e.End != 0:
+				end = strconv.FormatUint(e.End, 10)
+			case e.Epoch == 0:
+				end = "?"
+			}
+			fmt.Fprintf(tw, "  %d\t%s\t%d\t%d\t%s\t%s\n", e.Epoch, end, e.Donations, e.Donors, eth(e.Given), orUnknown(e.Burned))
+		}
+		fmt.Fprintln(tw)
+	}
+	if len(report.Donations) > 0 {
+		fmt.Fprintln(tw, "  Block\tTime\tDonor\tGiven (ETH)\tEpoch")
+		for _, d := range report.Donations {
+			fmt.Fprintf(tw, "  %d\t%s\t%s\t%s\t%d\n", d.Block, formatRowTime(d.Time), d.Donor, eth(d.Amount), d.Epoch)
+		}
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,166 @@
+package ktfunc
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+
+	"ktp2/src/abis/ktv2"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// onTotals expects totalGvn and totalBurned to be read at block.
+func onTotals(kt *MockKtv2, block uint64, gvn, burned int64) {
+	kt.On("TotalGvn", atBlock(block)).Return(big.NewInt(gvn), nil)
+	kt.On("TotalBurned", atBlock(block)).Return(big.NewInt(burned), nil)
+}
+
+// newDonationTest serves gifts and burns at 150 (5, 3), 220 (14, 30), 350
+// (6, 12) and 420 (1, 2); the test sets up the totals it reads.
+func newDonationTest(t *testing.T) (*ConnectionProps, *MockKtv2, common.Address, common.Address) {
+	a, b := common.HexToAddress("0x0a"), common.HexToAddress("0x0b")
+	gave := func(donor common.Address, block uint64, amt int64) *ktv2.Ktv2Gave {
+		return &ktv2.Ktv2Gave{Arg0: donor, Arg1: big.NewInt(amt), Raw: types.Log{BlockNumber: block}}
+	}
+	// Epoch 200 is voted at 290 and rewarded at 300; 300 is running.
+	base := &epochFakeKt{
+		ledgerFakeKt: &ledgerFakeKt{},
+		start:        300,
+		interval:     100,
+		voted:        []*ktv2.Ktv2Voted{{Arg0: big.NewInt(200), Arg1: a, Arg2: "x", Raw: types.Log{BlockNumber: 290}}},
+		rwds:         []*ktv2.Ktv2Rwd{{Arg0: a, Arg1: big.NewInt(1), Raw: types.Log{BlockNumber: 300}}},
+	}
+	kt := mockKtHistory(base)
+	kt.On("FilterGave", mock.Anything).Return(gaveIn([]*ktv2.Ktv2Gave{
+		gave(a, 150, 5), gave(a, 220, 10), gave(b, 220, 4), gave(a, 350, 6), gave(b, 420, 1),
+	}), nil)
+	cProps := newOddsTestProps(t, base, 450)
+	cProps.Kt = kt
+	return cProps, kt, a, b
+}
+
+func TestBuildDonationReport(t *testing.T) {
+	logrus.SetLevel(logrus.FatalLevel)
+	defer logrus.SetLevel(logrus.InfoLevel)
+
+	cProps, kt, a, b := newDonationTest(t)
+	onTotals(kt, 179, 5, 3)
+	onTotals(kt, 400, 25, 45)
+	kt.On("TotalBurned", atBlock(219)).Return(big.NewInt(3), nil)
+	kt.On("TotalBurned", atBlock(220)).Return(big.NewInt(33), nil)
+	kt.On("TotalBurned", atBlock(349)).Return(big.NewInt(33), nil)
+	kt.On("TotalBurned", atBlock(350)).Return(big.NewInt(45), nil)
+	report, err := BuildDonationReport(cProps, 180, 400)
+	require.NoError(t, err)
+
+	require.Len(t, report.Donations, 3)
+	assert.Equal(t, Donation{Block: 220, Time: report.Donations[0].Time, Donor: a.Hex(), Amount: "10", Epoch: 200}, report.Donations[0])
+	assert.Equal(t, uint64(300), report.Donations[2].Epoch)
+	assert.Equal(t, "20", report.Given)
+	assert.Equal(t, "42", report.Burned)
+
+	assert.Equal(t, []DonorTotal{
+		{Donor: a.Hex(), Donations: 2, Given: "16", Share: 0.8},
+		{Donor: b.Hex(), Donations: 1, Given: "4", Share: 0.2},
+	}, report.Donors)
+	assert.Equal(t, []EpochDonations{
+		{Epoch: 200, End: 300, Donations: 2, Donors: 2, Given: "14", Burned: "30"},
+		{Epoch: 300, Donations: 1, Donors: 1, Given: "6", Burned: "12"},
+	}, report.Epochs)
+
+	// The gift and burn at 150 predate the range and are netted out.
+	assert.Equal(t, "25", report.TotalGvn)
+	assert.Equal(t, "20", report.TotalGvnDelta)
+	assert.Equal(t, "45", report.TotalBurned)
+	assert.Equal(t, "42", report.TotalBurnedDelta)
+	assert.Empty(t, report.Warnings)
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteDonationReport(&buf, report, FormatCSV))
+	blocks := strings.Split(buf.String(), "\n\n")
+	require.Len(t, blocks, 3)
+	epochs, err := csv.NewReader(strings.NewReader(blocks[2])).ReadAll()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"300", "0", "1", "1", "6", "12"}, epochs[2])
+
+	buf.Reset()
+	require.NoError(t, WriteDonationReport(&buf, report, FormatTable))
+	assert.Contains(t, buf.String(), "running")
+	assert.NotContains(t, buf.String(), "WARNING")
+	kt.AssertExpectations(t)
+}
+
+func TestBuildDonationReport_Reconciliation(t *testing.T) {
+	logrus.SetLevel(logrus.FatalLevel)
+	defer logrus.SetLevel(logrus.InfoLevel)
+
+	// totalGvn moved by more than the events show, and the burn at 350
+	// can't be read.
+	cProps, kt, _, _ := newDonationTest(t)
+	onTotals(kt, 179, 5, 3)
+	onTotals(kt, 400, 32, 45)
+	kt.On("TotalBurned", atBlock(219)).Return(big.NewInt(3), nil)
+	kt.On("TotalBurned", atBlock(220)).Return(big.NewInt(33), nil)
+	kt.On("TotalBurned", atBlock(349)).Return((*big.Int)(nil), errors.New("missing trie node"))
+	kt.On("TotalBurned", atBlock(350)).Return(big.NewInt(45), nil)
+	report, err := BuildDonationReport(cProps, 180, 400)
+	require.NoError(t, err)
+	assert.Empty(t, report.Burned)
+	assert.Empty(t, report.Epochs[1].Burned)
+	assert.Equal(t, "30", report.Epochs[0].Burned)
+	require.Len(t, report.Warnings, 2)
+	assert.Contains(t, report.Warnings[0], "totalGvn moved by 27")
+	assert.Contains(t, report.Warnings[1], "could not be read")
+
+	// Without state at the start of the range nothing is reconciled.
+	cProps, kt, _, _ = newDonationTest(t)
+	kt.On("TotalGvn", atBlock(179)).Return(big.NewInt(5), nil)
+	kt.On("TotalBurned", atBlock(179)).Return((*big.Int)(nil), errors.New("missing trie node"))
+	onTotals(kt, 400, 25, 45)
+	kt.On("TotalBurned", atBlock(219)).Return(big.NewInt(3), nil)
+	kt.On("TotalBurned", atBlock(220)).Return(big.NewInt(33), nil)
+	kt.On("TotalBurned", atBlock(349)).Return(big.NewInt(33), nil)
+	kt.On("TotalBurned", atBlock(350)).Return(big.NewInt(45), nil)
+	report, err = BuildDonationReport(cProps, 180, 400)
+	require.NoError(t, err)
+	assert.Equal(t, "25", report.TotalGvn)
+	assert.Empty(t, report.TotalGvnDelta)
+	require.Len(t, report.Warnings, 1)
+	assert.Contains(t, report.Warnings[0], "block 179")
+	kt.AssertExpectations(t)
+}
+
+func TestGatherGaveEvents_ServedFromCache(t *testing.T) {
+	logrus.SetLevel(logrus.FatalLevel)
+	defer logrus.SetLevel(logrus.InfoLevel)
+
+	cProps, kt, _, _ := newDonationTest(t)
+	gives, err := GatherGaveEvents(cProps, 0, 400)
+	require.NoError(t, err)
+	require.Len(t, gives, 4)
+	assert.Equal(t, uint64(150), gives[0].Block)
+
+	// Once cached, a narrower range is served without new log queries.
+	queries := func() (n int) {
+		for _, c := range kt.Calls {
+			if c.Method == "FilterGave" {
+				n++
+			}
+		}
+		return n
+	}
+	before := queries()
+	gives, err = GatherGaveEvents(cProps, 215, 360)
+	require.NoError(t, err)
+	assert.Len(t, gives, 3)
+	assert.Equal(t, before, queries())
+}
@@ -0,0 +1,225 @@
+package ktfunc
+
+// Epoch dataset export: one flat record per rewarded epoch for analysis
+// outside the node. Minimums, declines, probabilities and the calculated
+// winner come from the same functions VoteAndReward uses
+// (findMinOverBlockRange, filterDeclinedStakers, calculateProbsForEachWallet
+// and calcWinningWallet), so a record is what a node would have computed.
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// EpochStaker is one eligible staker in an epoch record.
+type EpochStaker struct {
+	Address     string  `json:"address"`
+	MinStake    string  `json:"minStake"`
+	Probability float64 `json:"probability"`
+}
+
+// EpochVoter is one Voted event in an epoch record. Voter is the OC that
+// sent it; Data is resetVoteData when the vote was withdrawn.
+type EpochVoter struct {
+	Voter     string `json:"voter"`
+	Candidate string `json:"candidate"`
+	Data      string `json:"data"`
+	Block     uint64 `json:"block"`
+}
+
+// EpochRecord is the exported view of one rewarded epoch.
+type EpochRecord struct {
+	Start            uint64        `json:"start"`
+	End              uint64        `json:"end"`
+	Interval         uint64        `json:"interval"`
+	SeedBlock        uint64        `json:"seedBlock"`
+	SeedHash         string        `json:"seedHash"`
+	RandomValue      float64       `json:"randomValue"`
+	TotalMin         string        `json:"totalMin"`
+	Stakers          []EpochStaker `json:"stakers"`
+	Declined         []string      `json:"declined"` // qualified, but excluded for declining rewards
+	CalculatedWinner string        `json:"calculatedWinner"`
+	Winner           string        `json:"winner"`
+	Reward           string        `json:"reward"`
+	RwdBlock         uint64        `json:"rwdBlock"`
+	Rewarder         string        `json:"rewarder"`
+	// OcFee is the OC fee accrued on the epoch by its voters and rewarder,
+	// read at the Rwd block. Empty when the node serves no state that old.
+	OcFee  string       `json:"ocFee"`
+	Voters []EpochVoter `json:"voters"`
+	Note   string       `json:"note,omitempty"`
+}
+
+// ExportEpochs builds a record for every epoch rewarded in [from, to],
+// gathering stakes once for the whole range. Declines are read as they
+// stand now, as in AuditWinners.
+func ExportEpochs(cProps *ConnectionProps, from, to uint64) ([]EpochRecord, error) {
+	epochs, err := GatherPastEpochs(cProps, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to gather rewarded epochs: %w", err)
+	}
+	records := make([]EpochRecord, 0, len(epochs))
+	if len(epochs) == 0 {
+		return records, nil
+	}
+
+	creation, err := GetContractCreationBlock(cProps)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get contract creation block: %w", err)
+	}
+	lastEnd := epochs[0].End
+	for _, ep := range epochs {
+		lastEnd = max(lastEnd, ep.End)
+	}
+	stakeDataMap, err := GatherStakesAndWithdraws(cProps, cProps.Kt, new(big.Int).SetUint64(creation), new(big.Int).SetUint64(lastEnd))
+	if err != nil {
+		return nil, fmt.Errorf("failed to gather stakes: %w", err)
+	}
+
+	senders := newTxSenders(cProps)
+	var hashes []common.Hash
+	for _, ep := range epochs {
+		for _, v := range ep.Votes {
+			hashes = append(hashes, v.TxHash)
+		}
+		hashes = append(hashes, ep.RwdTx)
+	}
+	senders.prefetch(hashes)
+	for _, ep := range epochs {
+		rec, err := exportEpoch(cProps, stakeDataMap, senders, ep)
+		if err != nil {
+			return nil, fmt.Errorf("failed to export epoch %d-%d: %w", ep.Start, ep.End, err)
+		}
+		records = append(records, rec)
+	}
+	return records, nil
+}
+
+func exportEpoch(cProps *ConnectionProps, stakeDataMap map[common.Address]map[uint64]*UserStakeData, senders *txSenders, ep PastEpoch) (EpochRecord, error) {
+	rec := EpochRecord{
+		Start:     ep.Start,
+		End:       ep.End,
+		Interval:  ep.End - ep.Start,
+		SeedBlock: ep.End + SeedOffset,
+		Winner:    ep.Winner.Hex(),
+		Reward:    ep.Amount.String(),
+		RwdBlock:  ep.RwdBlock,
+		Stakers:   []EpochStaker{},
+		Declined:  []string{},
+		Voters:    []EpochVoter{},
+	}
+
+	totalMin, mins, declined, err := replayEpochOdds(cProps, stakeDataMap, ep.Start, ep.End)
+	if err != nil {
+		return rec, err
+	}
+	rec.TotalMin = totalMin.String()
+	for _, addr := range declined {
+		rec.Declined = append(rec.Declined, addr.Hex())
+	}
+	for addr, d := range mins {
+		s := EpochStaker{Address: addr.Hex(), MinStake: d.StakeAmount.String()}
+		if d.Prob != nil {
+			s.Probability, _ = d.Prob.Float64()
+		}
+		rec.Stakers = append(rec.Stakers, s)
+	}
+	sort.Slice(rec.Stakers, func(i, j int) bool { return rec.Stakers[i].Address < rec.Stakers[j].Address })
+
+	header, err := cProps.Client.HeaderByNumber(context.Background(), new(big.Int).SetUint64(rec.SeedBlock))
+	if err != nil || header == nil {
+		return rec, fmt.Errorf("failed to read seed block %d: %v", rec.SeedBlock, err)
+	}
+	seed := header.Hash()
+	rec.SeedHash = seed.Hex()
+	rec.RandomValue, _ = seedFraction(seed).Float64()
+	winner, err := calcWinningWallet(mins, seed)
+	if err != nil {
+		return rec, fmt.Errorf("failed to calculate winning wallet: %w", err)
+	}
+	rec.CalculatedWinner = winner.Hex()
+
+	// The OCs that touched the epoch are its voters and its rewarder; the
+	// fee accrued on it is the sum of their ocFees for the epoch.
+	ocs := make(map[common.Address]bool)
+	for _, v := range ep.Votes {
+		voter, err := senders.sender(v.TxHash)
+		if err != nil {
+			return rec, err
+		}
+		ocs[voter] = true
+		rec.Voters = append(rec.Voters, EpochVoter{Voter: voter.Hex(), Candidate: v.Candidate.Hex(), Data: v.Data, Block: v.Block})
+	}
+	rewarder, err := senders.sender(ep.RwdTx)
+	if err != nil {
+		return rec, err
+	}
+	ocs[rewarder] = true
+	rec.Rewarder = rewarder.Hex()
+
+	fee := new(big.Int)
+	opts := &bind.CallOpts{Context: context.Background(), BlockNumber: new(big.Int).SetUint64(ep.RwdBlock)}
+	for oc := range ocs {
+		f, err := cProps.Kt.OcFees(opts, oc, new(big.Int).SetUint64(ep.Start))
+		if err != nil {
+			rec.Note = fmt.Sprintf("OC fee unavailable (needs state at block %d): %v", ep.RwdBlock, err)
+			fee = nil
+			break
+		}
+		fee.Add(fee, f)
+	}
+	if fee != nil {
+		rec.OcFee = fee.String()
+	}
+	return rec, nil
+}
+
+// WriteEpochRecords writes one record per line: JSON Lines, or CSV with
+// stakers and voters packed into single columns. Any format other than CSV
+// gives JSON Lines.
+func WriteEpochRecords(w io.Writer, records []EpochRecord, format OutputFormat) error {
+	if format != FormatCSV {
+		enc := json.NewEncoder(w)
+		for _, r := range records {
+			if err := enc.Encode(r); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	cw := csv.NewWriter(w)
+	rows := [][]string{{
+		"start", "end", "interval", "seed_block", "seed_hash", "random_value", "total_min",
+		"stakers", "declined", "calculated_winner", "winner", "reward", "rwd_block", "rewarder",
+		"oc_fee", "voters", "note",
+	}}
+	for _, r := range records {
+		// stakers: address:min_stake:probability;...  voters: voter:candidate:data:block;...
+		stakers := make([]string, 0, len(r.Stakers))
+		for _, s := range r.Stakers {
+			stakers = append(stakers, s.Address+":"+s.MinStake+":"+strconv.FormatFloat(s.Probability, 'f', -1, 64))
+		}
+		voters := make([]string, 0, len(r.Voters))
+		for _, v := range r.Voters {
+			voters = append(voters, v.Voter+":"+v.Candidate+":"+v.Data+":"+strconv.FormatUint(v.Block, 10))
+		}
+		rows = append(rows, []string{
+			strconv.FormatUint(r.Start, 10), strconv.FormatUint(r.End, 10), strconv.FormatUint(r.Interval, 10),
+			strconv.FormatUint(r.SeedBlock, 10), r.SeedHash, strconv.FormatFloat(r.RandomValue, 'f', -1, 64), r.TotalMin,
+			strings.Join(stakers, ";"), strings.Join(r.Declined, ";"), r.CalculatedWinner, r.Winner, r.Reward,
+			strconv.FormatUint(r.RwdBlock, 10), r.Rewarder, r.OcFee, strings.Join(voters, ";"), r.Note,
+		})
+	}
+	return cw.WriteAll(rows)
+}
@@ -0,0 +1,112 @@
+package ktfunc
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// feeFakeKt serves ocFees per (OC, epoch start), as read at a given block.
+type feeFakeKt struct {
+	*epochFakeKt
+	fees   map[common.Address]map[uint64]int64
+	readAt []uint64
+}
+
+func (f *feeFakeKt) OcFees(opts *bind.CallOpts, oc common.Address, start *big.Int) (*big.Int, error) {
+	f.readAt = append(f.readAt, opts.BlockNumber.Uint64())
+	if start.Uint64() == 100 {
+		return nil, errors.New("missing trie node")
+	}
+	return big.NewInt(f.fees[oc][start.Uint64()]), nil
+}
+
+func TestExportEpochs(t *testing.T) {
+	logrus.SetLevel(logrus.FatalLevel)
+	defer logrus.SetLevel(logrus.InfoLevel)
+
+	base, a, b := threeEpochHistory()
+	base.declined = map[common.Address]bool{b: true}
+	chainID := big.NewInt(1)
+	xTx, ocX := signedTxFromKey(t, testKeyX, chainID)
+	yTx, ocY := signedTxFromKey(t, testKeyY, chainID)
+	kt := &feeFakeKt{epochFakeKt: base, fees: map[common.Address]map[uint64]int64{
+		ocX: {200: 3, 300: 4},
+		ocY: {200: 2},
+	}}
+	cProps := newOddsTestProps(t, base, 500)
+	cProps.Kt = kt
+
+	// b's vote in 200-300 comes from OC Y, every other tx from OC X.
+	client := cProps.Client.(*MockEthClient)
+	for i, v := range base.voted {
+		v.Raw.TxHash = common.BigToHash(big.NewInt(int64(i + 1)))
+		tx := xTx
+		if i == 3 {
+			tx = yTx
+		}
+		client.On("TransactionByHash", mock.Anything, v.Raw.TxHash).Return(tx, false, nil).Once()
+	}
+	for i, r := range base.rwds {
+		r.Raw.TxHash = common.BigToHash(big.NewInt(int64(100 + i)))
+		client.On("TransactionByHash", mock.Anything, r.Raw.TxHash).Return(xTx, false, nil).Once()
+	}
+
+	records, err := ExportEpochs(cProps, 0, 500)
+	require.NoError(t, err)
+	require.Len(t, records, 3)
+	client.AssertExpectations(t)
+
+	seed := (&types.Header{}).Hash()
+	seedValue, _ := seedFraction(seed).Float64()
+	assert.Equal(t, EpochRecord{
+		Start: 300, End: 400, Interval: 100,
+		SeedBlock: 400 + SeedOffset, SeedHash: seed.Hex(), RandomValue: seedValue,
+		TotalMin:         "100",
+		Stakers:          []EpochStaker{{Address: a.Hex(), MinStake: "100", Probability: 1}},
+		Declined:         []string{b.Hex()},
+		CalculatedWinner: a.Hex(), Winner: a.Hex(), Reward: "9", RwdBlock: 441,
+		Rewarder: ocX.Hex(), OcFee: "4",
+		Voters: []EpochVoter{{Voter: ocX.Hex(), Candidate: a.Hex(), Data: "0xseed3", Block: 440}},
+	}, records[2])
+
+	// 200-300 had two OCs; the fee is the sum of both, read at the Rwd block.
+	assert.Equal(t, "5", records[1].OcFee)
+	assert.Len(t, records[1].Voters, 3)
+	assert.Equal(t, ocY.Hex(), records[1].Voters[2].Voter)
+	assert.Contains(t, kt.readAt, uint64(343))
+
+	// Nobody qualified for 100-200, and its fee read fails.
+	assert.Empty(t, records[0].Stakers)
+	assert.Equal(t, common.Address{}.Hex(), records[0].CalculatedWinner)
+	assert.Empty(t, records[0].OcFee)
+	assert.Contains(t, records[0].Note, "missing trie node")
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteEpochRecords(&buf, records, FormatJSON))
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 3)
+	var decoded EpochRecord
+	require.NoError(t, json.Unmarshal([]byte(lines[2]), &decoded))
+	assert.Equal(t, records[2], decoded)
+
+	buf.Reset()
+	require.NoError(t, WriteEpochRecords(&buf, records, FormatCSV))
+	rows, err := csv.NewReader(&buf).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, rows, 4)
+	assert.Equal(t, a.Hex()+":100:1", rows[3][7])
+	assert.Equal(t, b.Hex(), rows[3][8])
+}
@@ -0,0 +1,244 @@
+package ktfunc
+
+// Past-epoch reconstruction. The contract keeps no list of past epochs: it
+// only advances startBlock by epochInterval when an epoch is rewarded. The
+// history is still fully recoverable from events. Every vote emits
+// Voted(startBlock, candidate, data), so the distinct startBlocks seen in
+// Voted events are the epochs that were voted on, and each epoch ends where
+// the next one starts. Each Rwd event pays out the epoch voted on most
+// recently before it, since the next epoch can't be voted on until it is
+// complete.
+//
+// This relies on every rewarded epoch having at least one vote, which the
+// contract enforces as long as consensusReq is at least 1.
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// PastEpoch is one epoch the contract has rewarded.
+type PastEpoch struct {
+	Start    uint64 // the epoch's startBlock
+	End      uint64 // Start + epochInterval at the time; the next epoch's Start
+	Winner   common.Address
+	Amount   *big.Int // paid to Winner, after the OC fee
+	RwdBlock uint64
+	// VoteData is the data string of the last vote for Winner in the epoch.
+	// Operators running this node vote with the seed block hash.
+	VoteData string
+	Votes    []EpochVote // every Voted event of the epoch, resets included
+	RwdTx    common.Hash
+}
+
+// EpochVote is one Voted event. The event doesn't name the voting OC; that
+// is the sender of TxHash.
+type EpochVote struct {
+	Block     uint64
+	Candidate common.Address
+	Data      string // resetVoteData for a withdrawn vote
+	TxHash    common.Hash
+}
+
+type votedEpoch struct {
+	start     uint64
+	firstVote logPos
+	data      map[common.Address]string // candidate -> last non-reset vote data
+	votes     []EpochVote
+}
+
+// logPos is where an event sits in the chain. A Rwd and the next epoch's
+// first vote can share a block, so the block alone can't order them.
+type logPos struct {
+	block uint64
+	index uint
+}
+
+func (p logPos) after(q logPos) bool {
+	return p.block > q.block || p.block == q.block && p.index > q.index
+}
+
+// GatherPastEpochs reconstructs every rewarded epoch whose Rwd event lies in
+// [from, to], oldest first. Voted events are scanned from the contract's
+// creation block so epochs rewarded inside the range are found even when
+// their votes predate from.
+func GatherPastEpochs(cProps *ConnectionProps, from, to uint64) ([]PastEpoch, error) {
+	creation, err := GetContractCreationBlock(cProps)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get contract creation block: %w", err)
+	}
+	currentStart, err := cProps.Kt.StartBlock(&bind.CallOpts{Context: context.Background(), From: cProps.MyPubKey})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read start block: %w", err)
+	}
+	from = max(from, creation)
+	if to < from {
+		return nil, nil
+	}
+
+	epochs := make(map[uint64]*votedEpoch)
+	err = forEachBlockChunk(cProps, creation, to, func(start, end uint64) error {
+		iter, err := cProps.Kt.FilterVoted(&bind.FilterOpts{Start: start, End: &end, Context: context.Background()})
+		if err != nil {
+			return fmt.Errorf("failed to filter Voted events %d-%d: %w", start, end, err)
+		}
+		defer iter.Close()
+		for iter.Next() {
+			evt := iter.Event()
+			if evt == nil || evt.Arg0 == nil {
+				continue
+			}
+			s := evt.Arg0.Uint64()
+			e := epochs[s]
+			if e == nil {
+				e = &votedEpoch{start: s, firstVote: logPos{evt.Raw.BlockNumber, evt.Raw.Index}, data: make(map[common.Address]string)}
+				epochs[s] = e
+			}
+			e.votes = append(e.votes, EpochVote{Block: evt.Raw.BlockNumber, Candidate: evt.Arg1, Data: evt.Arg2, TxHash: evt.Raw.TxHash})
+			if evt.Arg2 == resetVoteData {
+				continue
+			}
+			e.data[evt.Arg1] = evt.Arg2
+		}
+		return iter.Error()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Only epochs before the current one have been rewarded.
+	ordered := make([]*votedEpoch, 0, len(epochs))
+	for _, e := range epochs {
+		if e.start < currentStart.Uint64() {
+			ordered = append(ordered, e)
+		}
+	}
+	sort.Slice(ordered, func(i, j int) bool { return ordered[i].start < ordered[j].start })
+
+	var past []PastEpoch
+	err = forEachBlockChunk(cProps, from, to, func(start, end uint64) error {
+		iter, err := cProps.Kt.FilterRwd(&bind.FilterOpts{Start: start, End: &end, Context: context.Background()})
+		if err != nil {
+			return fmt.Errorf("failed to filter Rwd events %d-%d: %w", start, end, err)
+		}
+		defer iter.Close()
+		for iter.Next() {
+			evt := iter.Event()
+			if evt == nil {
+				continue
+			}
+			block, pos := evt.Raw.BlockNumber, logPos{evt.Raw.BlockNumber, evt.Raw.Index}
+			i := sort.Search(len(ordered), func(i int) bool { return ordered[i].firstVote.after(pos) }) - 1
+			if i < 0 {
+				return fmt.Errorf("Rwd at block %d has no preceding Voted event", block)
+			}
+			e := ordered[i]
+			end := currentStart.Uint64()
+			if i+1 < len(ordered) {
+				end = ordered[i+1].start
+			}
+			amount := evt.Arg1
+			if amount == nil {
+				amount = new(big.Int)
+			}
+			past = append(past, PastEpoch{
+				Start:    e.start,
+				End:      end,
+				Winner:   evt.Arg0,
+				Amount:   new(big.Int).Set(amount),
+				RwdBlock: block,
+				VoteData: e.data[evt.Arg0],
+				Votes:    e.votes,
+				RwdTx:    evt.Raw.TxHash,
+			})
+		}
+		return iter.Error()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return past, nil
+}
+
+// forEachBlockChunk calls fn for consecutive [start, end] ranges of at most
+// cProps.ChunkSize blocks covering [from, to].
+func forEachBlockChunk(cProps *ConnectionProps, from, to uint64, fn func(start, end uint64) error) error {
+	chunkSize := uint64(cProps.ChunkSize)
+	if chunkSize == 0 {
+		chunkSize = uint64(DefaultChunkSize)
+	}
+	for start := from; start <= to; start += chunkSize {
+		end := min(start+chunkSize-1, to)
+		if err := fn(start, end); err != nil {
+			return err
+		}
+		if end == to {
+			break
+		}
+	}
+	return nil
+}
+
+// stakeDataThrough returns the part of stakeDataMap at or before block.
+// findMinOverBlockRange reads every delta it is given, so replaying an
+// older epoch from a map gathered further ahead needs this cut first.
+func stakeDataThrough(stakeDataMap map[common.Address]map[uint64]*UserStakeData, block uint64) map[common.Address]map[uint64]*UserStakeData {
+	out := make(map[common.Address]map[uint64]*UserStakeData, len(stakeDataMap))
+	for addr, byBlock := range stakeDataMap {
+		for b, d := range byBlock {
+			if b > block {
+				continue
+			}
+			if out[addr] == nil {
+				out[addr] = make(map[uint64]*UserStakeData)
+			}
+			out[addr][b] = d
+		}
+	}
+	return out
+}
+
+// epochOdds returns every eligible address's minimum stake and probability
+// for [start, end], computed the way the vote computes them. Declines are
+// read as they stand now; the contract keeps no history of them.
+func epochOdds(cProps *ConnectionProps, stakeDataMap map[common.Address]map[uint64]*UserStakeData, start, end uint64) (*big.Int, map[common.Address]*UserStakeData, error) {
+	totalMin, mins, _, err := replayEpochOdds(cProps, stakeDataMap, start, end)
+	return totalMin, mins, err
+}
+
+// replayEpochOdds is epochOdds that also returns the addresses the decline
+// filter removed, sorted.
+func replayEpochOdds(cProps *ConnectionProps, stakeDataMap map[common.Address]map[uint64]*UserStakeData, start, end uint64) (*big.Int, map[common.Address]*UserStakeData, []common.Address, error) {
+	_, mins, err := findMinOverBlockRange(start, end, stakeDataThrough(stakeDataMap, end))
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	qualified := make([]common.Address, 0, len(mins))
+	for addr := range mins {
+		qualified = append(qualified, addr)
+	}
+	if err := filterDeclinedStakers(mins, cProps); err != nil {
+		return nil, nil, nil, err
+	}
+	var declined []common.Address
+	for _, addr := range qualified {
+		if _, ok := mins[addr]; !ok {
+			declined = append(declined, addr)
+		}
+	}
+	sort.Slice(declined, func(i, j int) bool { return declined[i].Hex() < declined[j].Hex() })
+
+	totalMin := big.NewInt(0)
+	for _, data := range mins {
+		totalMin.Add(totalMin, data.StakeAmount)
+	}
+	if len(mins) > 0 {
+		calculateProbsForEachWallet(mins, totalMin)
+	}
+	return totalMin, mins, declined, nil
+}
@@ -0,0 +1,593 @@
+package ktfunc
+
+// EventStore decouples the node from its on-disk cache. The business logic
+// (event gathering, the stake ledger, fee discovery and withdrawal) only talks
+// to this interface. BoltEventStore is the production implementation and
+// MemoryEventStore keeps everything in process, for tests and for
+// deployments that should never write to disk.
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	log "github.com/sirupsen/logrus"
+	"go.etcd.io/bbolt"
+)
+
+// CacheTip is the highest contiguously-processed block of the chunk cache.
+// Hash is only meaningful when HasHash is set: it is recorded once the block
+// is buried reorgSafetyDepth deep and lets the next run detect a reorg.
+type CacheTip struct {
+	Block   uint64
+	Hash    common.Hash
+	HasHash bool
+}
+
+// StoreStats describes an EventStore. Path is empty and SizeBytes zero for
+// stores that don't live on disk.
+type StoreStats struct {
+	Path          string
+	SchemaVersion uint32
+	SizeBytes     int64
+}
+
+// EventStore is the storage behind the event cache, the stake ledger and
+// the OC fee cache of one KT contract.
+type EventStore interface {
+	// LoadChunk returns the events cached for the chunk starting at
+	// chunkStart and whether such a chunk exists.
+	LoadChunk(chunkStart uint64) (ChunkEvents, bool, error)
+	// StoreChunk replaces the chunk starting at chunkStart.
+	StoreChunk(chunkStart uint64, chunk ChunkEvents) error
+	// ForEachChunk calls fn for every cached chunk in ascending block order.
+	ForEachChunk(fn func(chunkStart uint64, chunk ChunkEvents) error) error
+
+	// Tip returns the cache tip; the zero CacheTip means nothing is cached.
+	Tip() (CacheTip, error)
+	// SetTip records a new tip. A tip without a hash clears any stored hash
+	// so the tip and its hash can never refer to different blocks.
+	SetTip(tip CacheTip) error
+	// ResetChunks drops every chunk, the tip and everything derived from
+	// the chunks (the stake ledger). Used after a reorg.
+	ResetChunks() error
+
+	// LoadSnapshot returns the newest stake snapshot at or below block.
+	LoadSnapshot(block uint64) (StakeSnapshot, bool, error)
+	// StoreSnapshots writes (or overwrites) the given snapshots.
+	StoreSnapshots(snaps []StakeSnapshot) error
+	// DropSnapshots deletes the whole stake ledger.
+	DropSnapshots() error
+
+	// GetFee returns the cached OC fee for addr at an epoch block.
+	GetFee(addr common.Address, block uint64) (*big.Int, bool, error)
+	// PutFees caches OC fees for addr, keyed by epoch block.
+	PutFees(addr common.Address, fees map[uint64]*big.Int) error
+
+	// FeeLedger returns how far oc's fee ledger has been advanced and its
+	// entries, oldest epoch first.
+	FeeLedger(oc common.Address) (FeeLedgerTip, []FeeLedgerEntry, error)
+	// UpdateFeeLedger moves oc's ledger to tip and writes (or overwrites)
+	// the given entries in one step.
+	UpdateFeeLedger(oc common.Address, tip FeeLedgerTip, entries []FeeLedgerEntry) error
+	// ResetFeeLedger drops oc's ledger. Used after a reorg.
+	ResetFeeLedger(oc common.Address) error
+
+	// Migrate brings the stored layout up to the current schema, wiping
+	// anything written by an incompatible older version.
+	Migrate() error
+	// Stats describes the store itself, for cache inspection.
+	Stats() (StoreStats, error)
+	// Close releases the store.
+	Close() error
+}
+
+// openEventStore returns the store configured on cProps or, by default, the
+// bbolt store under cProps.ResolvedCacheDir(). Callers must call release when
+// done. It closes the bbolt files and leaves a configured store open, since
+// its owner manages its lifetime.
+//
+// Holding a store is exclusive within the process (eventStoreMu), so the
+// background tailer and the epoch gather never interleave tip updates.
+// Callers must not open a second store before releasing the first.
+func openEventStore(cProps *ConnectionProps) (store EventStore, release func(), err error) {
+	eventStoreMu.Lock()
+	if cProps.Store != nil {
+		return cProps.Store, eventStoreMu.Unlock, nil
+	}
+	if cProps.ChainID == nil {
+		eventStoreMu.Unlock()
+		return nil, nil, fmt.Errorf("chain ID unknown: cannot locate the event cache of %s", cProps.KtAddr.Hex())
+	}
+	adoptLegacyCache(cProps)
+	bs, err := OpenBoltEventStore(cProps.ResolvedCacheDir(), cProps.ChainID, cProps.KtAddr)
+	if err != nil {
+		eventStoreMu.Unlock()
+		return nil, nil, err
+	}
+	return bs, func() {
+		if cErr := bs.Close(); cErr != nil {
+			log.Warnf("Failed to close event store: %v", cErr)
+		}
+		eventStoreMu.Unlock()
+	}, nil
+}
+
+// openEventStoreReadOnly is openEventStore for callers that only read the
+// cache: the bbolt files are opened read-only and never adopted, migrated
+// or stamped. See OpenBoltEventStoreReadOnly.
+func openEventStoreReadOnly(cProps *ConnectionProps) (store EventStore, release func(), err error) {
+	eventStoreMu.Lock()
+	if cProps.Store != nil {
+		return cProps.Store, eventStoreMu.Unlock, nil
+	}
+	if cProps.ChainID == nil {
+		eventStoreMu.Unlock()
+		return nil, nil, fmt.Errorf("chain ID unknown: cannot locate the event cache of %s", cProps.KtAddr.Hex())
+	}
+	bs, err := OpenBoltEventStoreReadOnly(cProps.ResolvedCacheDir(), cProps.ChainID, cProps.KtAddr)
+	if err != nil {
+		eventStoreMu.Unlock()
+		return nil, nil, err
+	}
+	return bs, func() {
+		if cErr := bs.Close(); cErr != nil {
+			log.Warnf("Failed to close event store: %v", cErr)
+		}
+		eventStoreMu.Unlock()
+	}, nil
+}
+
+// eventStoreMu serializes openEventStore holders; see openEventStore.
+var eventStoreMu sync.Mutex
+
+// BoltEventStore keeps a contract's cache in two bbolt files, namespaced by
+// chain ID and the full contract address:
+//
+//	<chainID>/<addr>.db       chunks, meta (tip, tip_hash, schema_version), ledger
+//	<chainID>/fees_<addr>.db  fees, fee_ledger, meta (schema_version)
+//
+// Both meta buckets also record chain_id and contract. They are stamped on
+// first open and checked on every open after that, so a file copied or
+// renamed into the wrong place is refused instead of silently served.
+//
+// Chunk keys are 8-byte BE chunk starts. Chunk endings are NOT in the key: a
+// chunk for chunkStart contains all events from
+// [chunkStart, min(chunkStart+chunkSize-1, tip)]. When a later gather extends
+// past the prior tip into the chunk, only the uncovered tail is fetched and
+// merged into the stored chunk. Ledger keys are 8-byte BE snapshot blocks.
+// The fee ledger holds one nested bucket per OC address, with the ledger
+// tip under "tip" and entries keyed by 8-byte BE epoch start.
+type BoltEventStore struct {
+	events *bbolt.DB
+	fees   *bbolt.DB
+}
+
+// OpenBoltEventStore opens (creating if needed) both cache files of ktAddr
+// on chainID in cacheDir, migrates them to the current schema and checks
+// that they belong to that chain and contract.
+func OpenBoltEventStore(cacheDir string, chainID *big.Int, ktAddr common.Address) (*BoltEventStore, error) {
+	eventsName, feesName := boltCachePaths(cacheDir, chainID, ktAddr)
+	if err := os.MkdirAll(filepath.Dir(eventsName), 0755); err != nil {
+		log.Errorf("Failed to create cache directory: %v", err)
+		return nil, fmt.Errorf("failed to create cache directory: %w", err)
+	}
+
+	events, err := bbolt.Open(eventsName, 0600, nil)
+	if err != nil {
+		log.Errorf("Failed to open database %s: %v", eventsName, err)
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	fees, err := bbolt.Open(feesName, 0600, nil)
+	if err != nil {
+		events.Close()
+		log.Errorf("Failed to open database %s: %v", feesName, err)
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	s := &BoltEventStore{events: events, fees: fees}
+	if err := s.Migrate(); err != nil {
+		s.Close()
+		return nil, err
+	}
+	for name, db := range map[string]*bbolt.DB{eventsName: events, feesName: fees} {
+		if err := checkCacheIdentity(db, chainID, ktAddr); err != nil {
+			s.Close()
+			log.Errorf("Refusing cache file %s: %v", name, err)
+			return nil, fmt.Errorf("cache file %s: %w", name, err)
+		}
+	}
+	return s, nil
+}
+
+// readOnlyOpenTimeout bounds the wait for the file lock in
+// OpenBoltEventStoreReadOnly, so inspecting the cache of a running node
+// fails instead of hanging.
+const readOnlyOpenTimeout = time.Second
+
+// OpenBoltEventStoreReadOnly opens the existing cache of ktAddr on chainID
+// without writing to it: no legacy adoption, no schema migration and no
+// identity stamp. A cache at another schema version is reported as an error
+// instead of migrated; the next command that uses the cache migrates it.
+// Only the events file is required. The fees file is opened when present,
+// and the fee methods must not be used on the returned store.
+func OpenBoltEventStoreReadOnly(cacheDir string, chainID *big.Int, ktAddr common.Address) (*BoltEventStore, error) {
+	eventsName, feesName := boltCachePaths(cacheDir, chainID, ktAddr)
+	if _, err := os.Stat(eventsName); err != nil {
+		return nil, fmt.Errorf("no event cache at %s: %w", eventsName, err)
+	}
+	opts := &bbolt.Options{ReadOnly: true, Timeout: readOnlyOpenTimeout}
+	events, err := bbolt.Open(eventsName, 0600, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database %s read-only: %w", eventsName, err)
+	}
+	s := &BoltEventStore{events: events}
+	if _, err := os.Stat(feesName); err == nil {
+		if s.fees, err = bbolt.Open(feesName, 0600, opts); err != nil {
+			s.Close()
+			return nil, fmt.Errorf("failed to open database %s read-only: %w", feesName, err)
+		}
+	}
+	err = events.View(func(tx *bbolt.Tx) error {
+		meta := tx.Bucket([]byte("meta"))
+		if meta == nil {
+			return fmt.Errorf("not an event cache: no meta bucket")
+		}
+		var stored uint32
+		if v := meta.Get([]byte("schema_version")); len(v) == 4 {
+			stored = binary.BigEndian.Uint32(v)
+		}
+		if stored != cacheSchemaVersion {
+			return fmt.Errorf("schema version %d, this release reads %d; any command that uses the cache migrates it", stored, cacheSchemaVersion)
+		}
+		return storedIdentityMismatch(meta, chainID, ktAddr)
+	})
+	if err != nil {
+		s.Close()
+		return nil, fmt.Errorf("cache file %s: %w", eventsName, err)
+	}
+	return s, nil
+}
+
+// boltCachePaths returns the events and fees file of ktAddr on chainID.
+func boltCachePaths(cacheDir string, chainID *big.Int, ktAddr common.Address) (events, fees string) {
+	dir := filepath.Join(cacheDir, chainID.String())
+	return filepath.Join(dir, ktAddr.Hex()+".db"), filepath.Join(dir, "fees_"+ktAddr.Hex()+".db")
+}
+
+// checkCacheIdentity stamps chain_id and contract into db's meta bucket if
+// they are missing and fails if they name a different chain or contract.
+// Migrate runs first, so a schema wipe just leads to a fresh stamp.
+func checkCacheIdentity(db *bbolt.DB, chainID *big.Int, ktAddr common.Address) error {
+	return db.Update(func(tx *bbolt.Tx) error {
+		meta := tx.Bucket([]byte("meta"))
+		if err := storedIdentityMismatch(meta, chainID, ktAddr); err != nil {
+			return err
+		}
+		if meta.Get([]byte("chain_id")) == nil {
+			if err := meta.Put([]byte("chain_id"), chainID.Bytes()); err != nil {
+				return err
+			}
+		}
+		if meta.Get([]byte("contract")) == nil {
+			if err := meta.Put([]byte("contract"), ktAddr.Bytes()); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// storedIdentityMismatch fails if meta names a chain or contract other than
+// chainID and ktAddr. A missing stamp is not a mismatch.
+func storedIdentityMismatch(meta *bbolt.Bucket, chainID *big.Int, ktAddr common.Address) error {
+	if v := meta.Get([]byte("chain_id")); v != nil {
+		if stored := new(big.Int).SetBytes(v); stored.Cmp(chainID) != 0 {
+			return fmt.Errorf("belongs to chain %s, not %s", stored, chainID)
+		}
+	}
+	if v := meta.Get([]byte("contract")); v != nil {
+		if stored := common.BytesToAddress(v); stored != ktAddr {
+			return fmt.Errorf("belongs to contract %s, not %s", stored.Hex(), ktAddr.Hex())
+		}
+	}
+	return nil
+}
+
+func (s *BoltEventStore) Migrate() error {
+	// Self-heal across schema changes, so operators never have to delete
+	// cache files by hand. See cacheSchemaVersion / feesCacheSchemaVersion.
+	if err := migrateOrInitCacheSchema(s.events); err != nil {
+		log.Errorf("Failed to init/migrate cache schema: %v", err)
+		return fmt.Errorf("failed to init/migrate cache schema: %w", err)
+	}
+	if err := migrateOrInitFeesCacheSchema(s.fees); err != nil {
+		log.Errorf("Failed to init/migrate fees cache schema: %v", err)
+		return fmt.Errorf("failed to init/migrate fees cache schema: %w", err)
+	}
+	return nil
+}
+
+func (s *BoltEventStore) Stats() (StoreStats, error) {
+	stats := StoreStats{Path: s.events.Path()}
+	err := s.events.View(func(tx *bbolt.Tx) error {
+		if v := tx.Bucket([]byte("meta")).Get([]byte("schema_version")); len(v) == 4 {
+			stats.SchemaVersion = binary.BigEndian.Uint32(v)
+		}
+		return nil
+	})
+	if err != nil {
+		return stats, err
+	}
+	for _, db := range []*bbolt.DB{s.events, s.fees} {
+		if db == nil {
+			continue
+		}
+		fi, err := os.Stat(db.Path())
+		if err != nil {
+			return stats, err
+		}
+		stats.SizeBytes += fi.Size()
+	}
+	return stats, nil
+}
+
+func (s *BoltEventStore) Close() error {
+	err := s.events.Close()
+	if s.fees == nil {
+		return err
+	}
+	if fErr := s.fees.Close(); err == nil {
+		err = fErr
+	}
+	return err
+}
+
+func blockKey(block uint64) []byte {
+	k := make([]byte, 8)
+	binary.BigEndian.PutUint64(k, block)
+	return k
+}
+
+func (s *BoltEventStore) LoadChunk(chunkStart uint64) (ChunkEvents, bool, error) {
+	var chunk ChunkEvents
+	var found bool
+	err := s.events.View(func(tx *bbolt.Tx) error {
+		v := tx.Bucket([]byte("chunks")).Get(blockKey(chunkStart))
+		if v == nil {
+			return nil
+		}
+		if err := gob.NewDecoder(bytes.NewReader(v)).Decode(&chunk); err != nil {
+			return err
+		}
+		found = true
+		return nil
+	})
+	return chunk, found, err
+}
+
+func (s *BoltEventStore) StoreChunk(chunkStart uint64, chunk ChunkEvents) error {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(chunk); err != nil {
+		return err
+	}
+	return s.events.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket([]byte("chunks")).Put(blockKey(chunkStart), buf.Bytes())
+	})
+}
+
+// ForEachChunk skips (and logs) chunks that fail to decode; they are
+// re-fetched by the next gather that needs them. fn runs inside a read
+// transaction and must not write to the store.
+func (s *BoltEventStore) ForEachChunk(fn func(chunkStart uint64, chunk ChunkEvents) error) error {
+	return s.events.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket([]byte("chunks")).ForEach(func(k, v []byte) error {
+			var chunk ChunkEvents
+			if err := gob.NewDecoder(bytes.NewReader(v)).Decode(&chunk); err != nil {
+				log.Warnf("Skipping undecodable chunk %x: %v", k, err)
+				return nil
+			}
+			return fn(binary.BigEndian.Uint64(k), chunk)
+		})
+	})
+}
+
+func (s *BoltEventStore) Tip() (CacheTip, error) {
+	var tip CacheTip
+	err := s.events.View(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte("meta"))
+		if v := b.Get([]byte("tip")); len(v) == 8 {
+			tip.Block = binary.BigEndian.Uint64(v)
+		}
+		if v := b.Get([]byte("tip_hash")); len(v) == common.HashLength {
+			copy(tip.Hash[:], v)
+			tip.HasHash = true
+		}
+		return nil
+	})
+	return tip, err
+}
+
+func (s *BoltEventStore) SetTip(tip CacheTip) error {
+	return s.events.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte("meta"))
+		if err := b.Put([]byte("tip"), blockKey(tip.Block)); err != nil {
+			return err
+		}
+		if tip.HasHash {
+			return b.Put([]byte("tip_hash"), tip.Hash[:])
+		}
+		return b.Delete([]byte("tip_hash"))
+	})
+}
+
+func (s *BoltEventStore) ResetChunks() error {
+	return s.events.Update(func(tx *bbolt.Tx) error {
+		for _, name := range []string{"chunks", ledgerBucket} {
+			if err := tx.DeleteBucket([]byte(name)); err != nil && err != bbolt.ErrBucketNotFound {
+				return err
+			}
+			if _, err := tx.CreateBucket([]byte(name)); err != nil {
+				return err
+			}
+		}
+		b := tx.Bucket([]byte("meta"))
+		if err := b.Delete([]byte("tip")); err != nil {
+			return err
+		}
+		return b.Delete([]byte("tip_hash"))
+	})
+}
+
+func (s *BoltEventStore) LoadSnapshot(block uint64) (StakeSnapshot, bool, error) {
+	var snap StakeSnapshot
+	var found bool
+	err := s.events.View(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte(ledgerBucket))
+		if b == nil {
+			return nil
+		}
+		key := blockKey(block)
+		c := b.Cursor()
+		k, v := c.Seek(key)
+		if k == nil || !bytes.Equal(k, key) {
+			k, v = c.Prev()
+		}
+		if k == nil {
+			return nil
+		}
+		if err := gob.NewDecoder(bytes.NewReader(v)).Decode(&snap); err != nil {
+			return fmt.Errorf("failed to decode snapshot at block %d: %w", binary.BigEndian.Uint64(k), err)
+		}
+		found = true
+		return nil
+	})
+	return snap, found, err
+}
+
+func (s *BoltEventStore) StoreSnapshots(snaps []StakeSnapshot) error {
+	if len(snaps) == 0 {
+		return nil
+	}
+	return s.events.Update(func(tx *bbolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(ledgerBucket))
+		if err != nil {
+			return err
+		}
+		for _, snap := range snaps {
+			var buf bytes.Buffer
+			if err := gob.NewEncoder(&buf).Encode(snap); err != nil {
+				return err
+			}
+			if err := b.Put(blockKey(snap.Block), buf.Bytes()); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *BoltEventStore) DropSnapshots() error {
+	return s.events.Update(func(tx *bbolt.Tx) error {
+		if err := tx.DeleteBucket([]byte(ledgerBucket)); err != nil && err != bbolt.ErrBucketNotFound {
+			return err
+		}
+		return nil
+	})
+}
+
+// feeKey is the fees bucket key: 20-byte address + '_' + 8-byte BE block.
+func feeKey(addr common.Address, block uint64) []byte {
+	key := make([]byte, common.AddressLength+1+8)
+	copy(key, addr.Bytes())
+	key[common.AddressLength] = '_'
+	binary.BigEndian.PutUint64(key[common.AddressLength+1:], block)
+	return key
+}
+
+func (s *BoltEventStore) GetFee(addr common.Address, block uint64) (*big.Int, bool, error) {
+	var fee *big.Int
+	err := s.fees.View(func(tx *bbolt.Tx) error {
+		if v := tx.Bucket([]byte("fees")).Get(feeKey(addr, block)); v != nil {
+			fee = new(big.Int).SetBytes(v)
+		}
+		return nil
+	})
+	return fee, fee != nil, err
+}
+
+func (s *BoltEventStore) PutFees(addr common.Address, fees map[uint64]*big.Int) error {
+	return s.fees.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte("fees"))
+		for block, fee := range fees {
+			if err := b.Put(feeKey(addr, block), fee.Bytes()); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// feeLedgerTipKey cannot collide with the 8-byte epoch keys next to it.
+var feeLedgerTipKey = []byte("tip")
+
+func (s *BoltEventStore) FeeLedger(oc common.Address) (FeeLedgerTip, []FeeLedgerEntry, error) {
+	var tip FeeLedgerTip
+	var entries []FeeLedgerEntry
+	err := s.fees.View(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte(feeLedgerBucket)).Bucket(oc.Bytes())
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, v []byte) error {
+			if bytes.Equal(k, feeLedgerTipKey) {
+				return gob.NewDecoder(bytes.NewReader(v)).Decode(&tip)
+			}
+			var e FeeLedgerEntry
+			if err := gob.NewDecoder(bytes.NewReader(v)).Decode(&e); err != nil {
+				return fmt.Errorf("failed to decode fee ledger entry %x: %w", k, err)
+			}
+			entries = append(entries, e)
+			return nil
+		})
+	})
+	return tip, entries, err
+}
+
+func (s *BoltEventStore) UpdateFeeLedger(oc common.Address, tip FeeLedgerTip, entries []FeeLedgerEntry) error {
+	return s.fees.Update(func(tx *bbolt.Tx) error {
+		b, err := tx.Bucket([]byte(feeLedgerBucket)).CreateBucketIfNotExists(oc.Bytes())
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			var buf bytes.Buffer
+			if err := gob.NewEncoder(&buf).Encode(e); err != nil {
+				return err
+			}
+			if err := b.Put(blockKey(e.Epoch), buf.Bytes()); err != nil {
+				return err
+			}
+		}
+		var buf bytes.Buffer
+		if err := gob.NewEncoder(&buf).Encode(tip); err != nil {
+			return err
+		}
+		return b.Put(feeLedgerTipKey, buf.Bytes())
+	})
+}
+
+func (s *BoltEventStore) ResetFeeLedger(oc common.Address) error {
+	return s.fees.Update(func(tx *bbolt.Tx) error {
+		if err := tx.Bucket([]byte(feeLedgerBucket)).DeleteBucket(oc.Bytes()); err != nil && err != bbolt.ErrBucketNotFound {
+			return err
+		}
+		return nil
+	})
+}
@@ -0,0 +1,356 @@
+package ktfunc
+
+import (
+	"encoding/binary"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.etcd.io/bbolt"
+)
+
+// eventStoreImpls returns a fresh instance of every EventStore
+// implementation so the same behaviour can be asserted against each.
+func eventStoreImpls(t *testing.T) map[string]EventStore {
+	bolt, err := OpenBoltEventStore(t.TempDir(), big.NewInt(1), common.HexToAddress("0x1234567890123456789012345678901234567890"))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = bolt.Close() })
+	return map[string]EventStore{
+		"bolt":   bolt,
+		"memory": NewMemoryEventStore(),
+	}
+}
+
+func TestEventStore_Chunks(t *testing.T) {
+	addr := common.HexToAddress("0x0a")
+	for name, store := range eventStoreImpls(t) {
+		t.Run(name, func(t *testing.T) {
+			_, found, err := store.LoadChunk(100)
+			require.NoError(t, err)
+			assert.False(t, found)
+
+			c1 := ChunkEvents{StakeEvents: []StakeEvent{{Addr: addr, Amount: big.NewInt(5), Block: 101}}}
+			c0 := ChunkEvents{WithdrawEvents: []WithdrawEvent{{Addr: addr, Amount: big.NewInt(2), Block: 3}}}
+			require.NoError(t, store.StoreChunk(100, c1))
+			require.NoError(t, store.StoreChunk(0, c0))
+
+			got, found, err := store.LoadChunk(100)
+			require.NoError(t, err)
+			require.True(t, found)
+			assert.Equal(t, c1.StakeEvents[0].Block, got.StakeEvents[0].Block)
+			assert.Equal(t, 0, got.StakeEvents[0].Amount.Cmp(big.NewInt(5)))
+
+			var order []uint64
+			require.NoError(t, store.ForEachChunk(func(start uint64, _ ChunkEvents) error {
+				order = append(order, start)
+				return nil
+			}))
+			assert.Equal(t, []uint64{0, 100}, order)
+		})
+	}
+}
+
+func TestEventStore_TipAndReset(t *testing.T) {
+	hash := common.HexToHash("0xabc")
+	for name, store := range eventStoreImpls(t) {
+		t.Run(name, func(t *testing.T) {
+			tip, err := store.Tip()
+			require.NoError(t, err)
+			assert.Equal(t, CacheTip{}, tip)
+
+			require.NoError(t, store.SetTip(CacheTip{Block: 500, Hash: hash, HasHash: true}))
+			tip, _ = store.Tip()
+			assert.Equal(t, CacheTip{Block: 500, Hash: hash, HasHash: true}, tip)
+
+			// A tip without a hash must not inherit the previous tip's hash.
+			require.NoError(t, store.SetTip(CacheTip{Block: 600}))
+			tip, _ = store.Tip()
+			assert.Equal(t, CacheTip{Block: 600}, tip)
+
+			require.NoError(t, store.StoreChunk(0, ChunkEvents{}))
+			require.NoError(t, store.StoreSnapshots([]StakeSnapshot{{Block: 300}}))
+			require.NoError(t, store.ResetChunks())
+			tip, _ = store.Tip()
+			assert.Equal(t, CacheTip{}, tip)
+			_, found, _ := store.LoadChunk(0)
+			assert.False(t, found)
+			_, found, _ = store.LoadSnapshot(300)
+			assert.False(t, found, "reset must drop the ledger derived from the chunks")
+		})
+	}
+}
+
+func TestEventStore_Snapshots(t *testing.T) {
+	addr := common.HexToAddress("0x0a")
+	for name, store := range eventStoreImpls(t) {
+		t.Run(name, func(t *testing.T) {
+			require.NoError(t, store.StoreSnapshots([]StakeSnapshot{
+				newStakeSnapshot(200, map[common.Address]*big.Int{addr: big.NewInt(7)}),
+				newStakeSnapshot(400, nil),
+			}))
+			_, found, err := store.LoadSnapshot(199)
+			require.NoError(t, err)
+			assert.False(t, found)
+
+			snap, found, err := store.LoadSnapshot(399)
+			require.NoError(t, err)
+			require.True(t, found)
+			assert.Equal(t, uint64(200), snap.Block)
+			require.Len(t, snap.Balances, 1)
+			assert.Equal(t, 0, snap.Balances[0].Amount.Cmp(big.NewInt(7)))
+
+			snap, _, _ = store.LoadSnapshot(400)
+			assert.Equal(t, uint64(400), snap.Block)
+
+			require.NoError(t, store.DropSnapshots())
+			_, found, _ = store.LoadSnapshot(1000)
+			assert.False(t, found)
+		})
+	}
+}
+
+func TestEventStore_Fees(t *testing.T) {
+	addr := common.HexToAddress("0x0a")
+	for name, store := range eventStoreImpls(t) {
+		t.Run(name, func(t *testing.T) {
+			_, found, err := store.GetFee(addr, 100)
+			require.NoError(t, err)
+			assert.False(t, found)
+
+			require.NoError(t, store.PutFees(addr, map[uint64]*big.Int{100: big.NewInt(42), 200: big.NewInt(0)}))
+			fee, found, err := store.GetFee(addr, 100)
+			require.NoError(t, err)
+			require.True(t, found)
+			assert.Equal(t, 0, fee.Cmp(big.NewInt(42)))
+
+			// A cached zero (a withdrawn epoch) is a hit, not a miss.
+			fee, found, _ = store.GetFee(addr, 200)
+			assert.True(t, found)
+			assert.Equal(t, 0, fee.Sign())
+
+			_, found, _ = store.GetFee(common.HexToAddress("0x0b"), 100)
+			assert.False(t, found)
+		})
+	}
+}
+
+func TestEventStore_FeeLedger(t *testing.T) {
+	oc, other := common.HexToAddress("0x0a"), common.HexToAddress("0x0b")
+	for name, store := range eventStoreImpls(t) {
+		t.Run(name, func(t *testing.T) {
+			tip, entries, err := store.FeeLedger(oc)
+			require.NoError(t, err)
+			assert.Equal(t, FeeLedgerTip{}, tip)
+			assert.Empty(t, entries)
+
+			first := FeeLedgerTip{CacheTip: CacheTip{Block: 300, Hash: common.HexToHash("0xabc"), HasHash: true}, LastEpoch: 200}
+			require.NoError(t, store.UpdateFeeLedger(oc, first, []FeeLedgerEntry{
+				{Epoch: 200, Voted: true, LastBlock: 250, Fee: big.NewInt(7)},
+				{Epoch: 100, Voted: true, LastBlock: 150},
+			}))
+			// Entries are overwritten by epoch; the others stay.
+			second := FeeLedgerTip{CacheTip: CacheTip{Block: 400}, LastEpoch: 200}
+			require.NoError(t, store.UpdateFeeLedger(oc, second, []FeeLedgerEntry{
+				{Epoch: 200, Voted: true, Rewarded: true, LastBlock: 320, Fee: big.NewInt(9)},
+			}))
+
+			tip, entries, err = store.FeeLedger(oc)
+			require.NoError(t, err)
+			assert.Equal(t, second, tip)
+			require.Len(t, entries, 2)
+			assert.Equal(t, FeeLedgerEntry{Epoch: 100, Voted: true, LastBlock: 150}, entries[0], "a fee that couldn't be read stays nil")
+			assert.Equal(t, uint64(320), entries[1].LastBlock)
+			assert.True(t, entries[1].Rewarded)
+			assert.Equal(t, 0, entries[1].Fee.Cmp(big.NewInt(9)))
+
+			_, entries, _ = store.FeeLedger(other)
+			assert.Empty(t, entries)
+
+			require.NoError(t, store.ResetFeeLedger(oc))
+			tip, entries, _ = store.FeeLedger(oc)
+			assert.Equal(t, FeeLedgerTip{}, tip)
+			assert.Empty(t, entries)
+			require.NoError(t, store.ResetFeeLedger(oc), "resetting an empty ledger is fine")
+		})
+	}
+}
+
+// TestGatherStakesAndWithdraws_MemoryStoreLeavesNoFiles — with a store set
+// on ConnectionProps, gathering never touches the cache directory.
+func TestGatherStakesAndWithdraws_MemoryStoreLeavesNoFiles(t *testing.T) {
+	logrus.SetLevel(logrus.FatalLevel)
+	defer logrus.SetLevel(logrus.InfoLevel)
+
+	addr := common.HexToAddress("0x0a")
+	kt := &ledgerFakeKt{
+		stakes:    []StakeEvent{{Addr: addr, Amount: big.NewInt(100), Block: 150}},
+		withdraws: []WithdrawEvent{{Addr: addr, Amount: big.NewInt(30), Block: 250}},
+	}
+	cProps := newLedgerTestProps(t, kt)
+	cProps.CacheDir = filepath.Join(t.TempDir(), "unused")
+	cProps.Store = NewMemoryEventStore()
+
+	got, err := GatherStakesAndWithdraws(cProps, kt, big.NewInt(100), big.NewInt(299))
+	require.NoError(t, err)
+	assert.Equal(t, 0, got[addr][150].StakeAmount.Cmp(big.NewInt(100)))
+	assert.Equal(t, 0, got[addr][250].StakeAmount.Cmp(big.NewInt(-30)))
+
+	tip, err := cProps.Store.Tip()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(299), tip.Block)
+
+	_, statErr := os.Stat(cProps.CacheDir)
+	assert.True(t, os.IsNotExist(statErr), "memory store must not create the cache dir")
+}
+
+// TestOpenBoltEventStore_NamespacedByChainAndAddress — the same address on
+// two chains, and two addresses sharing the old 7-character prefix, each get
+// their own cache.
+func TestOpenBoltEventStore_NamespacedByChainAndAddress(t *testing.T) {
+	dir := t.TempDir()
+	addrA := common.HexToAddress("0x1234567890123456789012345678901234567890")
+	addrB := common.HexToAddress("0x12345ffffffffffffffffffffffffffffffffff0")
+
+	open := func(chainID int64, addr common.Address) *BoltEventStore {
+		s, err := OpenBoltEventStore(dir, big.NewInt(chainID), addr)
+		require.NoError(t, err)
+		return s
+	}
+	s := open(1, addrA)
+	require.NoError(t, s.SetTip(CacheTip{Block: 500}))
+	require.NoError(t, s.Close())
+
+	for _, other := range []struct {
+		chainID int64
+		addr    common.Address
+	}{{5, addrA}, {1, addrB}} {
+		s := open(other.chainID, other.addr)
+		tip, err := s.Tip()
+		require.NoError(t, err)
+		assert.Equal(t, CacheTip{}, tip, "chain %d addr %s must not see another cache", other.chainID, other.addr.Hex())
+		require.NoError(t, s.Close())
+	}
+
+	s = open(1, addrA)
+	defer s.Close()
+	tip, err := s.Tip()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(500), tip.Block)
+}
+
+// TestOpenBoltEventStore_RefusesForeignFile — a cache file that ends up
+// under another chain's or contract's name is refused, not served.
+func TestOpenBoltEventStore_RefusesForeignFile(t *testing.T) {
+	dir := t.TempDir()
+	addr := common.HexToAddress("0x1234567890123456789012345678901234567890")
+	s, err := OpenBoltEventStore(dir, big.NewInt(1), addr)
+	require.NoError(t, err)
+	require.NoError(t, s.Close())
+
+	src, _ := boltCachePaths(dir, big.NewInt(1), addr)
+	dst, _ := boltCachePaths(dir, big.NewInt(5), addr)
+	require.NoError(t, os.MkdirAll(filepath.Dir(dst), 0755))
+	require.NoError(t, os.Rename(src, dst))
+
+	_, err = OpenBoltEventStore(dir, big.NewInt(5), addr)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "belongs to chain 1")
+}
+
+// writeLegacyCache writes pre-namespacing files for addr as the last build
+// before namespacing left them: an events file at schema v3 holding one
+// chunk and the given tip, and a fees file at schema v1 holding one fee.
+func writeLegacyCache(t *testing.T, dir string, addr common.Address, tip CacheTip) {
+	eventsName, feesName := legacyCachePaths(dir, addr)
+	events, err := bbolt.Open(eventsName, 0600, nil)
+	require.NoError(t, err)
+	defer events.Close()
+	fees, err := bbolt.Open(feesName, 0600, nil)
+	require.NoError(t, err)
+	defer fees.Close()
+	require.NoError(t, migrateOrInitCacheSchema(events))
+	require.NoError(t, migrateOrInitFeesCacheSchema(fees))
+	s := &BoltEventStore{events: events, fees: fees}
+	require.NoError(t, s.StoreChunk(100, ChunkEvents{StakeEvents: []StakeEvent{{Addr: addr, Amount: big.NewInt(1), Block: 150}}}))
+	require.NoError(t, s.SetTip(tip))
+	require.NoError(t, s.PutFees(addr, map[uint64]*big.Int{100: big.NewInt(7)}))
+	for db, version := range map[*bbolt.DB]uint32{events: 3, fees: 1} {
+		require.NoError(t, db.Update(func(tx *bbolt.Tx) error {
+			v := make([]byte, 4)
+			binary.BigEndian.PutUint32(v, version)
+			return tx.Bucket([]byte("meta")).Put([]byte("schema_version"), v)
+		}))
+	}
+}
+
+func TestOpenEventStore_AdoptsLegacyCache(t *testing.T) {
+	logrus.SetLevel(logrus.FatalLevel)
+	defer logrus.SetLevel(logrus.InfoLevel)
+
+	cProps := newLedgerTestProps(t, nil)
+	// newLedgerTestProps' client serves empty headers, so this is the hash
+	// the chain reports for every block.
+	onChain := (&types.Header{}).Hash()
+	// The contract logged the one stake writeLegacyCache caches.
+	ours := &ledgerFakeKt{stakes: []StakeEvent{{Addr: cProps.KtAddr, Amount: big.NewInt(1), Block: 150}}}
+
+	t.Run("matching tip hash and events", func(t *testing.T) {
+		cProps.CacheDir = t.TempDir()
+		cProps.Kt = ours
+		writeLegacyCache(t, cProps.CacheDir, cProps.KtAddr, CacheTip{Block: 299, Hash: onChain, HasHash: true})
+
+		store, release, err := openEventStore(cProps)
+		require.NoError(t, err)
+		defer release()
+		tip, err := store.Tip()
+		require.NoError(t, err)
+		assert.Equal(t, uint64(299), tip.Block)
+		chunk, found, _ := store.LoadChunk(100)
+		assert.True(t, found, "the old schemas are migrated in place, not wiped")
+		assert.Len(t, chunk.StakeEvents, 1)
+		assert.True(t, chunk.GaveMissing)
+		fee, found, err := store.GetFee(cProps.KtAddr, 100)
+		require.NoError(t, err)
+		assert.True(t, found)
+		assert.Equal(t, big.NewInt(7), fee)
+
+		legacy, _ := legacyCachePaths(cProps.CacheDir, cProps.KtAddr)
+		_, statErr := os.Stat(legacy)
+		assert.True(t, os.IsNotExist(statErr), "legacy file is moved, not copied")
+	})
+
+	// A contract sharing the address prefix, on the same chain, logged
+	// something else in those blocks.
+	prefixTwin := &ledgerFakeKt{stakes: []StakeEvent{{Addr: cProps.KtAddr, Amount: big.NewInt(2), Block: 150}}}
+	for name, tc := range map[string]struct {
+		tip CacheTip
+		kt  Ktv2Interface
+	}{
+		"foreign tip hash":          {CacheTip{Block: 299, Hash: common.HexToHash("0xdead"), HasHash: true}, ours},
+		"no tip hash":               {CacheTip{Block: 299}, ours},
+		"another contract's events": {CacheTip{Block: 299, Hash: onChain, HasHash: true}, prefixTwin},
+	} {
+		t.Run(name, func(t *testing.T) {
+			cProps.CacheDir = t.TempDir()
+			cProps.Kt = tc.kt
+			writeLegacyCache(t, cProps.CacheDir, cProps.KtAddr, tc.tip)
+
+			store, release, err := openEventStore(cProps)
+			require.NoError(t, err)
+			defer release()
+			got, err := store.Tip()
+			require.NoError(t, err)
+			assert.Equal(t, CacheTip{}, got, "unverifiable legacy cache is not adopted")
+
+			legacy, _ := legacyCachePaths(cProps.CacheDir, cProps.KtAddr)
+			_, statErr := os.Stat(legacy)
+			assert.NoError(t, statErr, "legacy file is left in place")
+		})
+	}
+}
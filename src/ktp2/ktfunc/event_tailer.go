@@ -0,0 +1,407 @@
+package ktfunc
+
+// Live event tailing.
+//
+// Without a tailer the event cache only advances when an epoch ends and
+// VoteAndReward gathers, so every first cycle after an epoch does a burst of
+// catch-up eth_getLogs calls right when latency matters most. The tailer runs
+// beside the vote loop and moves the cache tip forward as blocks become
+// reorgSafetyDepth deep, leaving the end-of-epoch gather only the last few
+// blocks to fetch.
+//
+// Staked/Withdrew/Gave logs arrive through SubscribeFilterLogs and are held in
+// memory until they are buried deep enough, then written straight into their
+// chunks without a single eth_getLogs call. Blocks the subscription can't
+// vouch for (everything before it started, or any time it is down, or on
+// HTTP endpoints that don't support subscriptions at all) are polled through
+// the normal chunk fetch instead.
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"ktp2/src/abis/ktv2"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	log "github.com/sirupsen/logrus"
+)
+
+// DefaultTailInterval is how often the tailer advances the cache tip.
+const DefaultTailInterval = 30 * time.Second
+
+// tailLogKey identifies one log across a subscription's add/remove pair.
+type tailLogKey struct {
+	tx    common.Hash
+	index uint
+}
+
+type eventTailer struct {
+	cProps   *ConnectionProps
+	kt       Ktv2Interface
+	creation uint64
+	interval time.Duration
+
+	parsed      abi.ABI
+	stakedID    common.Hash
+	withdrewID  common.Hash
+	gaveID      common.Hash
+	logs        chan types.Log
+	sub         ethereum.Subscription
+	subFrom     uint64 // first block the live subscription is known to cover
+	warnedNoSub bool
+	pending     map[tailLogKey]types.Log
+}
+
+// StartEventTailer keeps the event cache of cProps.KtAddr warm in the
+// background until ctx is cancelled. interval sets how often the tip is
+// advanced (DefaultTailInterval if zero).
+func StartEventTailer(ctx context.Context, cProps *ConnectionProps, interval time.Duration) error {
+	if interval <= 0 {
+		interval = DefaultTailInterval
+	}
+	t, err := newEventTailer(cProps, interval)
+	if err != nil {
+		return err
+	}
+	log.Infof("Event tailer started (every %s, events cached once %d blocks deep)", interval, reorgSafetyDepth)
+	go t.run(ctx)
+	return nil
+}
+
+func newEventTailer(cProps *ConnectionProps, interval time.Duration) (*eventTailer, error) {
+	// Resolve the creation block here, before the goroutine starts, so the
+	// tailer only ever reads cProps.KtBlock and never races the vote loop.
+	creation, err := GetContractCreationBlock(cProps)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get contract creation block: %w", err)
+	}
+	parsed, err := abi.JSON(strings.NewReader(ktv2.Ktv2MetaData.ABI))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse KT ABI: %w", err)
+	}
+	return &eventTailer{
+		cProps:     cProps,
+		kt:         cProps.Kt,
+		creation:   creation,
+		interval:   interval,
+		parsed:     parsed,
+		stakedID:   parsed.Events["Staked"].ID,
+		withdrewID: parsed.Events["Withdrew"].ID,
+		gaveID:     parsed.Events["Gave"].ID,
+		logs:       make(chan types.Log, 256),
+		pending:    make(map[tailLogKey]types.Log),
+	}, nil
+}
+
+func (t *eventTailer) run(ctx context.Context) {
+	ticker := time.NewTicker(t.interval)
+	defer ticker.Stop()
+	defer t.unsubscribe()
+
+	t.step(ctx)
+	for {
+		var subErr <-chan error
+		if t.sub != nil {
+			subErr = t.sub.Err()
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case l := <-t.logs:
+			t.buffer(l)
+		case err := <-subErr:
+			log.Warnf("Event tailer subscription dropped (%v) - polling until it can resubscribe", err)
+			t.unsubscribe()
+		case <-ticker.C:
+			t.step(ctx)
+		}
+	}
+}
+
+// step (re)subscribes if needed and advances the cache to the deepest block
+// that is reorgSafetyDepth below head.
+func (t *eventTailer) step(ctx context.Context) {
+	if t.sub == nil {
+		t.subscribe(ctx)
+	}
+	head, err := t.cProps.Client.BlockNumber(ctx)
+	if err != nil {
+		log.Warnf("Event tailer could not read head: %v", err)
+		return
+	}
+	if head < reorgSafetyDepth {
+		return
+	}
+	if err := t.advance(head - reorgSafetyDepth); err != nil {
+		log.Warnf("Event tailer failed to advance cache: %v", err)
+	}
+}
+
+func (t *eventTailer) subscribe(ctx context.Context) {
+	q := ethereum.FilterQuery{
+		Addresses: []common.Address{t.cProps.KtAddr},
+		Topics:    [][]common.Hash{{t.stakedID, t.withdrewID, t.gaveID}},
+	}
+	sub, err := t.cProps.Client.SubscribeFilterLogs(ctx, q, t.logs)
+	if err != nil {
+		if !t.warnedNoSub {
+			log.Infof("Event tailer: log subscription unavailable (%v) - falling back to polling", err)
+			t.warnedNoSub = true
+		}
+		return
+	}
+	// Read head only after subscribing: every block after it is announced
+	// after the subscription exists, so its logs are guaranteed to arrive.
+	head, err := t.cProps.Client.BlockNumber(ctx)
+	if err != nil {
+		sub.Unsubscribe()
+		log.Warnf("Event tailer could not read head after subscribing: %v", err)
+		return
+	}
+	t.sub = sub
+	t.subFrom = head + 1
+	log.Debugf("Event tailer subscribed to KT logs from block %d", t.subFrom)
+}
+
+func (t *eventTailer) unsubscribe() {
+	if t.sub != nil {
+		t.sub.Unsubscribe()
+	}
+	t.sub = nil
+	t.subFrom = 0
+	// Buffered logs can't be trusted to be complete without the
+	// subscription; those blocks get polled instead.
+	t.pending = make(map[tailLogKey]types.Log)
+}
+
+// buffer holds a subscription log until it is deep enough to cache. A log
+// delivered again with Removed set was reorged out and is dropped.
+func (t *eventTailer) buffer(l types.Log) {
+	key := tailLogKey{tx: l.TxHash, index: l.Index}
+	if l.Removed {
+		delete(t.pending, key)
+		return
+	}
+	t.pending[key] = l
+}
+
+// advance moves the cache tip up to safe: blocks the subscription covers
+// come from buffered logs, anything earlier is polled. The poll runs without
+// the store held, so a long catch-up never stalls the vote loop's gather;
+// the store is only held to read the tip and, afterwards, to write.
+func (t *eventTailer) advance(safe uint64) error {
+	tip, err := t.readTip()
+	if err != nil {
+		return err
+	}
+	defer t.dropPendingThrough(&tip)
+	if safe <= tip || safe < t.creation {
+		return nil
+	}
+
+	pollTo := safe
+	if t.sub != nil && t.subFrom-1 < pollTo {
+		pollTo = t.subFrom - 1
+	}
+	var polled map[uint64]ChunkEvents
+	if pollTo > tip && pollTo >= t.creation {
+		if polled, err = t.poll(tip, pollTo); err != nil {
+			return err
+		}
+	}
+
+	store, release, err := openEventStore(t.cProps)
+	if err != nil {
+		return err
+	}
+	defer release()
+	current, err := reconcileCacheTip(t.cProps, store)
+	if err != nil {
+		return err
+	}
+	if current != tip {
+		// The gather moved the cache, or a reorg reset it, while we
+		// polled. What we hold may overlap it; the next step starts over.
+		log.Debugf("Event tailer: cache tip moved from %d to %d while polling - retrying next step", tip, current)
+		tip = current
+		return nil
+	}
+	if polled != nil {
+		if err := t.storePolled(store, polled, tip, pollTo); err != nil {
+			return err
+		}
+		log.Debugf("Event tailer polled blocks %d-%d", tip+1, pollTo)
+		tip = pollTo
+	}
+	if t.sub == nil || safe <= tip {
+		return nil
+	}
+	if err := t.appendBuffered(store, tip, safe); err != nil {
+		return err
+	}
+	tip = safe
+	return nil
+}
+
+// readTip holds the store just long enough to reconcile and read its tip.
+func (t *eventTailer) readTip() (uint64, error) {
+	store, release, err := openEventStore(t.cProps)
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+	return reconcileCacheTip(t.cProps, store)
+}
+
+// poll fetches the events in (tip, to] chunk by chunk, keyed by chunk start.
+// It doesn't touch the store.
+func (t *eventTailer) poll(tip, to uint64) (map[uint64]ChunkEvents, error) {
+	chunkSize := t.chunkSize()
+	polled := make(map[uint64]ChunkEvents)
+	for start := t.chunkStartFor(tip + 1); start <= to; start += chunkSize {
+		from, end := max(start, tip+1), min(start+chunkSize-1, to)
+		var fetched ChunkEvents
+		if err := queryChunkWithRetry(t.cProps, t.kt, from, end, &fetched); err != nil {
+			return nil, err
+		}
+		polled[start] = fetched
+	}
+	return polled, nil
+}
+
+// storePolled writes what poll fetched for (tip, to] and moves the tip to
+// to. A chunk the tip already reaches into keeps its cached events.
+func (t *eventTailer) storePolled(store EventStore, polled map[uint64]ChunkEvents, tip, to uint64) error {
+	for start, fetched := range polled {
+		var chunk ChunkEvents
+		if start <= tip {
+			existing, found, err := store.LoadChunk(start)
+			if err != nil {
+				return fmt.Errorf("failed to load chunk %d: %w", start, err)
+			}
+			if found {
+				chunk = existing
+			}
+		}
+		chunk.StakeEvents = append(chunk.StakeEvents, fetched.StakeEvents...)
+		chunk.WithdrawEvents = append(chunk.WithdrawEvents, fetched.WithdrawEvents...)
+		chunk.GaveEvents = append(chunk.GaveEvents, fetched.GaveEvents...)
+		if err := store.StoreChunk(start, chunk); err != nil {
+			return fmt.Errorf("failed to store chunk %d: %w", start, err)
+		}
+	}
+	if err := setCacheTip(t.cProps, store, to); err != nil {
+		return fmt.Errorf("failed to advance cache tip: %w", err)
+	}
+	return nil
+}
+
+// appendBuffered writes buffered logs in (tip, safe] into their chunks and
+// moves the tip to safe. Every chunk overlapping the range is written, even
+// when it gained no events, so the gather sees it as cached.
+func (t *eventTailer) appendBuffered(store EventStore, tip, safe uint64) error {
+	chunkSize := t.chunkSize()
+	added := make(map[uint64]ChunkEvents)
+	for _, l := range t.pending {
+		if l.BlockNumber <= tip || l.BlockNumber > safe {
+			continue
+		}
+		start := t.chunkStartFor(l.BlockNumber)
+		c := added[start]
+		if err := t.decodeInto(l, &c); err != nil {
+			log.Warnf("Event tailer skipping undecodable log %s:%d: %v", l.TxHash.Hex(), l.Index, err)
+			continue
+		}
+		added[start] = c
+	}
+
+	events := 0
+	for start := t.chunkStartFor(tip + 1); start <= safe; start += chunkSize {
+		chunk, _, err := store.LoadChunk(start)
+		if err != nil {
+			return fmt.Errorf("failed to load chunk %d: %w", start, err)
+		}
+		c := added[start]
+		chunk.StakeEvents = append(chunk.StakeEvents, c.StakeEvents...)
+		chunk.WithdrawEvents = append(chunk.WithdrawEvents, c.WithdrawEvents...)
+		chunk.GaveEvents = append(chunk.GaveEvents, c.GaveEvents...)
+		if err := store.StoreChunk(start, chunk); err != nil {
+			return fmt.Errorf("failed to store chunk %d: %w", start, err)
+		}
+		events += len(c.StakeEvents) + len(c.WithdrawEvents) + len(c.GaveEvents)
+	}
+	if err := setCacheTip(t.cProps, store, safe); err != nil {
+		return fmt.Errorf("failed to advance cache tip: %w", err)
+	}
+	log.Debugf("Event tailer cached %d live events in blocks %d-%d", events, tip+1, safe)
+	return nil
+}
+
+func (t *eventTailer) dropPendingThrough(tip *uint64) {
+	for k, l := range t.pending {
+		if l.BlockNumber <= *tip {
+			delete(t.pending, k)
+		}
+	}
+}
+
+func (t *eventTailer) decodeInto(l types.Log, c *ChunkEvents) error {
+	if len(l.Topics) == 0 {
+		return fmt.Errorf("log has no topics")
+	}
+	var name string
+	switch l.Topics[0] {
+	case t.stakedID:
+		name = "Staked"
+	case t.withdrewID:
+		name = "Withdrew"
+	case t.gaveID:
+		name = "Gave"
+	default:
+		return fmt.Errorf("unexpected event topic %s", l.Topics[0].Hex())
+	}
+	values, err := t.parsed.Unpack(name, l.Data)
+	if err != nil {
+		return err
+	}
+	if len(values) != 2 {
+		return fmt.Errorf("%s: expected 2 fields, got %d", name, len(values))
+	}
+	addr, okAddr := values[0].(common.Address)
+	amount, okAmt := values[1].(*big.Int)
+	if !okAddr || !okAmt {
+		return fmt.Errorf("%s: unexpected field types", name)
+	}
+	switch name {
+	case "Staked":
+		c.StakeEvents = append(c.StakeEvents, StakeEvent{Addr: addr, Amount: amount, Block: l.BlockNumber})
+	case "Withdrew":
+		c.WithdrawEvents = append(c.WithdrawEvents, WithdrawEvent{Addr: addr, Amount: amount, Block: l.BlockNumber})
+	default:
+		c.GaveEvents = append(c.GaveEvents, GaveEvent{Addr: addr, Amount: amount, Block: l.BlockNumber})
+	}
+	return nil
+}
+
+func (t *eventTailer) chunkSize() uint64 {
+	if t.cProps.ChunkSize > 0 {
+		return uint64(t.cProps.ChunkSize)
+	}
+	return uint64(DefaultChunkSize)
+}
+
+// chunkStartFor returns the start of the chunk holding block, on the grid
+// the gather uses (creation block plus multiples of the chunk size).
+func (t *eventTailer) chunkStartFor(block uint64) uint64 {
+	if block <= t.creation {
+		return t.creation
+	}
+	cs := t.chunkSize()
+	return t.creation + (block-t.creation)/cs*cs
+}
@@ -0,0 +1,215 @@
+package ktfunc
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// tailFakeClient serves a settable head and, unless subErr is set, accepts
+// one log subscription whose channel the test feeds directly.
+type tailFakeClient struct {
+	EthClient
+	head   uint64
+	subErr error
+	subCh  chan<- types.Log
+}
+
+func (c *tailFakeClient) BlockNumber(context.Context) (uint64, error) { return c.head, nil }
+
+func (c *tailFakeClient) HeaderByNumber(_ context.Context, n *big.Int) (*types.Header, error) {
+	return &types.Header{Number: n}, nil
+}
+
+func (c *tailFakeClient) SubscribeFilterLogs(_ context.Context, _ ethereum.FilterQuery, ch chan<- types.Log) (ethereum.Subscription, error) {
+	if c.subErr != nil {
+		return nil, c.subErr
+	}
+	c.subCh = ch
+	return &tailFakeSub{err: make(chan error)}, nil
+}
+
+type tailFakeSub struct{ err chan error }
+
+func (s *tailFakeSub) Unsubscribe()      {}
+func (s *tailFakeSub) Err() <-chan error { return s.err }
+
+func newTailerForTest(t *testing.T, client *tailFakeClient, kt *ledgerFakeKt) *eventTailer {
+	cProps := &ConnectionProps{
+		Client:    client,
+		Kt:        kt,
+		KtAddr:    common.HexToAddress("0x1234567890123456789012345678901234567890"),
+		KtBlock:   big.NewInt(100),
+		ChunkSize: 100,
+		Store:     NewMemoryEventStore(),
+	}
+	tailer, err := newEventTailer(cProps, time.Second)
+	require.NoError(t, err)
+	return tailer
+}
+
+func cachedBlocks(t *testing.T, store EventStore) []uint64 {
+	var blocks []uint64
+	require.NoError(t, store.ForEachChunk(func(_ uint64, c ChunkEvents) error {
+		for _, e := range c.StakeEvents {
+			blocks = append(blocks, e.Block)
+		}
+		for _, e := range c.WithdrawEvents {
+			blocks = append(blocks, e.Block)
+		}
+		for _, e := range c.GaveEvents {
+			blocks = append(blocks, e.Block)
+		}
+		return nil
+	}))
+	sort.Slice(blocks, func(i, j int) bool { return blocks[i] < blocks[j] })
+	return blocks
+}
+
+func (t *eventTailer) testLog(tb testing.TB, event string, addr common.Address, amount int64, block uint64, index uint) types.Log {
+	data, err := t.parsed.Events[event].Inputs.Pack(addr, big.NewInt(amount))
+	require.NoError(tb, err)
+	return types.Log{
+		Address:     t.cProps.KtAddr,
+		Topics:      []common.Hash{t.parsed.Events[event].ID},
+		Data:        data,
+		BlockNumber: block,
+		TxHash:      common.BigToHash(big.NewInt(int64(block))),
+		Index:       index,
+	}
+}
+
+// TestEventTailer_PollingFallback — the endpoint rejects subscriptions, so
+// the tailer polls, and never caches anything shallower than reorgSafetyDepth.
+func TestEventTailer_PollingFallback(t *testing.T) {
+	logrus.SetLevel(logrus.FatalLevel)
+	defer logrus.SetLevel(logrus.InfoLevel)
+
+	addr := common.HexToAddress("0x0a")
+	kt := &ledgerFakeKt{stakes: []StakeEvent{
+		{Addr: addr, Amount: big.NewInt(1), Block: 150},
+		{Addr: addr, Amount: big.NewInt(1), Block: 900},
+		{Addr: addr, Amount: big.NewInt(1), Block: 990}, // within 32 of head
+	}}
+	client := &tailFakeClient{head: 1000, subErr: errors.New("notifications not supported")}
+	tailer := newTailerForTest(t, client, kt)
+
+	tailer.step(context.Background())
+
+	tip, err := tailer.cProps.Store.Tip()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1000-reorgSafetyDepth), tip.Block)
+	assert.True(t, tip.HasHash)
+	assert.Equal(t, []uint64{150, 900}, cachedBlocks(t, tailer.cProps.Store))
+	assert.Nil(t, tailer.sub)
+}
+
+// TestEventTailer_SubscriptionAppendsWithoutGetLogs — once subscribed, deep
+// enough logs are written straight into the cache, reorged-out logs are
+// dropped, and the following gather is served without any log query.
+func TestEventTailer_SubscriptionAppendsWithoutGetLogs(t *testing.T) {
+	logrus.SetLevel(logrus.FatalLevel)
+	defer logrus.SetLevel(logrus.InfoLevel)
+
+	addr := common.HexToAddress("0x0a")
+	kt := &ledgerFakeKt{stakes: []StakeEvent{{Addr: addr, Amount: big.NewInt(7), Block: 120}}}
+	client := &tailFakeClient{head: 500}
+	tailer := newTailerForTest(t, client, kt)
+
+	tailer.step(context.Background())
+	require.NotNil(t, tailer.sub)
+	assert.Equal(t, uint64(501), tailer.subFrom)
+
+	tailer.buffer(tailer.testLog(t, "Staked", addr, 10, 510, 0))
+	tailer.buffer(tailer.testLog(t, "Withdrew", addr, 3, 520, 0))
+	tailer.buffer(tailer.testLog(t, "Gave", addr, 2, 540, 0))
+	reorged := tailer.testLog(t, "Staked", addr, 99, 530, 0)
+	tailer.buffer(reorged)
+	reorged.Removed = true
+	tailer.buffer(reorged)
+	tailer.buffer(tailer.testLog(t, "Staked", addr, 5, 590, 0)) // too shallow
+
+	// Blocks up to 500 predate the subscription and are polled; blocks
+	// after it must come from the buffer alone.
+	client.head = 600
+	kt.queried = nil
+	tailer.step(context.Background())
+	for _, r := range kt.queried {
+		assert.LessOrEqual(t, r[1], uint64(500), "subscribed blocks must not be polled")
+	}
+
+	tip, err := tailer.cProps.Store.Tip()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(600-reorgSafetyDepth), tip.Block)
+	assert.Equal(t, []uint64{120, 510, 520, 540}, cachedBlocks(t, tailer.cProps.Store))
+	assert.Len(t, tailer.pending, 1, "the shallow log stays buffered")
+
+	kt.queried = nil
+	got, err := GatherStakesAndWithdraws(tailer.cProps, kt, big.NewInt(100), big.NewInt(int64(tip.Block)))
+	require.NoError(t, err)
+	assert.Empty(t, kt.queried, "gather up to the tip is a pure cache hit")
+	assert.Equal(t, 0, got[addr][510].StakeAmount.Cmp(big.NewInt(10)))
+	assert.Equal(t, 0, got[addr][520].StakeAmount.Cmp(big.NewInt(-3)))
+}
+
+// pollHookKt runs onQuery whenever the tailer polls Staked events.
+type pollHookKt struct {
+	*ledgerFakeKt
+	onQuery func()
+}
+
+func (k *pollHookKt) FilterStaked(opts *bind.FilterOpts) (StakedIterator, error) {
+	if k.onQuery != nil {
+		k.onQuery()
+	}
+	return k.ledgerFakeKt.FilterStaked(opts)
+}
+
+// TestEventTailer_PollsWithoutHoldingStore — the poll runs with the store
+// free, and a tip the gather moved meanwhile wins over what was polled.
+func TestEventTailer_PollsWithoutHoldingStore(t *testing.T) {
+	logrus.SetLevel(logrus.FatalLevel)
+	defer logrus.SetLevel(logrus.InfoLevel)
+
+	addr := common.HexToAddress("0x0a")
+	fake := &ledgerFakeKt{stakes: []StakeEvent{{Addr: addr, Amount: big.NewInt(1), Block: 150}}}
+	kt := &pollHookKt{ledgerFakeKt: fake}
+	client := &tailFakeClient{head: 1000, subErr: errors.New("notifications not supported")}
+	tailer := newTailerForTest(t, client, fake)
+	tailer.kt = kt
+	store := tailer.cProps.Store
+
+	storeFree := true
+	kt.onQuery = func() {
+		if eventStoreMu.TryLock() {
+			eventStoreMu.Unlock()
+		} else {
+			storeFree = false
+		}
+		// The gather catches the cache up to 400 in the meantime.
+		require.NoError(t, store.SetTip(CacheTip{Block: 400}))
+	}
+	tailer.step(context.Background())
+	assert.True(t, storeFree, "the store must not be held while polling")
+	tip, err := store.Tip()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(400), tip.Block, "the polled range overlaps the gather's and is dropped")
+	assert.Empty(t, cachedBlocks(t, store))
+
+	kt.onQuery = nil
+	tailer.step(context.Background())
+	tip, err = store.Tip()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1000-reorgSafetyDepth), tip.Block)
+}
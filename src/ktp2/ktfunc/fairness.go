@@ -0,0 +1,344 @@
+package ktfunc
+
+// Fairness over many draws. Replaying one epoch shows the winner was picked
+// correctly; this checks that, across many epochs, stakers win about as
+// often as their probabilities say and that the seed-derived random values
+// look uniform. Like AuditWinners, stakes are gathered once and cut at each
+// epoch's end.
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// seedBuckets is how many equal-width bins [0, 1) is split into for the
+// seed uniformity test.
+const seedBuckets = 10
+
+// FairnessDraw is one lottery draw included in the report.
+type FairnessDraw struct {
+	Start      uint64  `json:"start"`
+	End        uint64  `json:"end"`
+	Winner     string  `json:"winner"`
+	WinnerProb float64 `json:"winnerProb"` // the winner's replayed probability
+	Seed       string  `json:"seed"`
+	SeedValue  float64 `json:"seedValue"` // the random value in [0, 1) drawn from Seed
+}
+
+// FairnessSkip is a rewarded epoch left out of the statistics, and why.
+type FairnessSkip struct {
+	Start  uint64 `json:"start"`
+	End    uint64 `json:"end"`
+	Reason string `json:"reason"`
+}
+
+// StakerFairness compares one staker's expected and observed wins.
+// Expected is the sum of its per-draw probabilities.
+type StakerFairness struct {
+	Address  string  `json:"address"`
+	Draws    int     `json:"draws"` // draws it was eligible in
+	Expected float64 `json:"expected"`
+	Observed int     `json:"observed"`
+}
+
+// GoodnessOfFit is a Pearson chi-square test. The p-value is only a rough
+// guide while expected counts are small (below about 5 per category), which
+// they are for small stakers until many epochs have been drawn.
+type GoodnessOfFit struct {
+	ChiSquare        float64 `json:"chiSquare"`
+	DegreesOfFreedom int     `json:"degreesOfFreedom"`
+	PValue           float64 `json:"pValue"`
+}
+
+// SeedDistribution summarises the random values drawn from the seeds.
+// Buckets counts values per tenth of [0, 1); Uniformity tests them against
+// an even spread.
+type SeedDistribution struct {
+	Mean       float64       `json:"mean"`
+	Min        float64       `json:"min"`
+	Max        float64       `json:"max"`
+	Buckets    []int         `json:"buckets"`
+	Uniformity GoodnessOfFit `json:"uniformity"`
+}
+
+// FairnessReport is the fairness of every lottery draw rewarded in
+// [From, To].
+type FairnessReport struct {
+	From    uint64           `json:"from"`
+	To      uint64           `json:"to"`
+	Stakers []StakerFairness `json:"stakers"`
+	// Wins is the chi-square of observed against expected wins per staker.
+	Wins  GoodnessOfFit    `json:"wins"`
+	Seeds SeedDistribution `json:"seeds"`
+	Draws []FairnessDraw   `json:"draws"`
+	// Skipped epochs were not decided by the lottery (manual votes, nobody
+	// eligible) or could not be replayed, or their winner was not eligible
+	// in the replay.
+	Skipped []FairnessSkip `json:"skipped"`
+}
+
+// BuildFairnessReport replays the probabilities of every epoch rewarded in
+// [from, to] and compares them with the actual winners. Declines are read
+// as they stand now, as in AuditWinners.
+func BuildFairnessReport(cProps *ConnectionProps, from, to uint64) (*FairnessReport, error) {
+	epochs, err := GatherPastEpochs(cProps, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to gather rewarded epochs: %w", err)
+	}
+	report := &FairnessReport{From: from, To: to, Stakers: []StakerFairness{}, Draws: []FairnessDraw{}, Skipped: []FairnessSkip{}}
+
+	var stakeDataMap map[common.Address]map[uint64]*UserStakeData
+	if len(epochs) > 0 {
+		creation, err := GetContractCreationBlock(cProps)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get contract creation block: %w", err)
+		}
+		lastEnd := epochs[0].End
+		for _, ep := range epochs {
+			lastEnd = max(lastEnd, ep.End)
+		}
+		stakeDataMap, err = GatherStakesAndWithdraws(cProps, cProps.Kt, new(big.Int).SetUint64(creation), new(big.Int).SetUint64(lastEnd))
+		if err != nil {
+			return nil, fmt.Errorf("failed to gather stakes: %w", err)
+		}
+	}
+
+	stakers := make(map[common.Address]*StakerFairness)
+	for _, ep := range epochs {
+		skip := FairnessSkip{Start: ep.Start, End: ep.End}
+		if ParseVoteData(ep.VoteData).Kind == VoteDataManual {
+			skip.Reason = "winner was voted manually (-voteFor)"
+			report.Skipped = append(report.Skipped, skip)
+			continue
+		}
+		_, mins, err := epochOdds(cProps, stakeDataMap, ep.Start, ep.End)
+		if err != nil {
+			return nil, fmt.Errorf("failed to replay epoch %d-%d: %w", ep.Start, ep.End, err)
+		}
+		if len(mins) == 0 {
+			skip.Reason = "no eligible stakers"
+			report.Skipped = append(report.Skipped, skip)
+			continue
+		}
+		header, err := cProps.Client.HeaderByNumber(context.Background(), new(big.Int).SetUint64(ep.End+SeedOffset))
+		if err != nil || header == nil {
+			skip.Reason = fmt.Sprintf("failed to read seed block %d: %v", ep.End+SeedOffset, err)
+			report.Skipped = append(report.Skipped, skip)
+			continue
+		}
+
+		// A winner the replay finds ineligible (declined since, or without
+		// stake through the epoch) means this isn't the draw that was
+		// made, so its odds would skew the counts; leave it out.
+		if w := mins[ep.Winner]; w == nil || w.Prob == nil || w.Prob.Sign() == 0 {
+			skip.Reason = fmt.Sprintf("winner %s was not eligible in the replay (declined since, or no stake through the epoch)", ep.Winner.Hex())
+			report.Skipped = append(report.Skipped, skip)
+			continue
+		}
+
+		seed := header.Hash()
+		draw := FairnessDraw{Start: ep.Start, End: ep.End, Winner: ep.Winner.Hex(), Seed: seed.Hex()}
+		draw.SeedValue, _ = seedFraction(seed).Float64()
+		for addr, d := range mins {
+			if d.Prob == nil {
+				continue
+			}
+			p, _ := d.Prob.Float64()
+			s := stakers[addr]
+			if s == nil {
+				s = &StakerFairness{Address: addr.Hex()}
+				stakers[addr] = s
+			}
+			s.Draws++
+			s.Expected += p
+			if addr == ep.Winner {
+				draw.WinnerProb = p
+				s.Observed++
+			}
+		}
+		report.Draws = append(report.Draws, draw)
+	}
+
+	for _, s := range stakers {
+		report.Stakers = append(report.Stakers, *s)
+	}
+	sort.Slice(report.Stakers, func(i, j int) bool {
+		if report.Stakers[i].Expected != report.Stakers[j].Expected {
+			return report.Stakers[i].Expected > report.Stakers[j].Expected
+		}
+		return report.Stakers[i].Address < report.Stakers[j].Address
+	})
+
+	expected := make([]float64, 0, len(report.Stakers))
+	observed := make([]float64, 0, len(report.Stakers))
+	for _, s := range report.Stakers {
+		expected = append(expected, s.Expected)
+		observed = append(observed, float64(s.Observed))
+	}
+	report.Wins = pearsonChiSquare(observed, expected)
+	report.Seeds = seedDistribution(report.Draws)
+	return report, nil
+}
+
+// seedDistribution summarises the seed values of draws.
+func seedDistribution(draws []FairnessDraw) SeedDistribution {
+	dist := SeedDistribution{Buckets: make([]int, seedBuckets)}
+	if len(draws) == 0 {
+		return dist
+	}
+	dist.Min, dist.Max = 1, 0
+	for _, d := range draws {
+		dist.Mean += d.SeedValue
+		dist.Min = min(dist.Min, d.SeedValue)
+		dist.Max = max(dist.Max, d.SeedValue)
+		dist.Buckets[min(int(d.SeedValue*seedBuckets), seedBuckets-1)]++
+	}
+	dist.Mean /= float64(len(draws))
+
+	observed := make([]float64, seedBuckets)
+	expected := make([]float64, seedBuckets)
+	for i, n := range dist.Buckets {
+		observed[i] = float64(n)
+		expected[i] = float64(len(draws)) / seedBuckets
+	}
+	dist.Uniformity = pearsonChiSquare(observed, expected)
+	return dist
+}
+
+// pearsonChiSquare tests observed counts against expected ones. Categories
+// with no expectation are left out; fewer than two remaining categories
+// leave nothing to test and give a p-value of 1.
+func pearsonChiSquare(observed, expected []float64) GoodnessOfFit {
+	fit := GoodnessOfFit{PValue: 1}
+	k := 0
+	for i, e := range expected {
+		if e <= 0 {
+			continue
+		}
+		d := observed[i] - e
+		fit.ChiSquare += d * d / e
+		k++
+	}
+	if k < 2 {
+		return fit
+	}
+	fit.DegreesOfFreedom = k - 1
+	fit.PValue = chiSquareSurvival(fit.ChiSquare, fit.DegreesOfFreedom)
+	return fit
+}
+
+// chiSquareSurvival is P(X >= x) for a chi-square variable with df degrees
+// of freedom: the regularized upper incomplete gamma Q(df/2, x/2).
+func chiSquareSurvival(x float64, df int) float64 {
+	if x <= 0 {
+		return 1
+	}
+	a, x := float64(df)/2, x/2
+	lg, _ := math.Lgamma(a)
+	prefix := math.Exp(a*math.Log(x) - x - lg)
+
+	if x < a+1 {
+		// Series for the lower function P, then Q = 1 - P.
+		sum, term := 1/a, 1/a
+		for n := 1.0; n < 500; n++ {
+			term *= x / (a + n)
+			sum += term
+			if math.Abs(term) < math.Abs(sum)*1e-15 {
+				break
+			}
+		}
+		return max(0, 1-prefix*sum)
+	}
+
+	// Continued fraction for Q (modified Lentz).
+	const tiny = 1e-300
+	b := x + 1 - a
+	c, d := 1/tiny, 1/b
+	h := d
+	for i := 1.0; i < 500; i++ {
+		an := -i * (i - a)
+		b += 2
+		d = an*d + b
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		c = b + an/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		d = 1 / d
+		delta := d * c
+		h *= delta
+		if math.Abs(delta-1) < 1e-15 {
+			break
+		}
+	}
+	return min(1, prefix*h)
+}
+
+// WriteFairnessReport renders report to w as a table or JSON.
+func WriteFairnessReport(w io.Writer, report *FairnessReport, format OutputFormat) error {
+	switch format {
+	case FormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	case FormatCSV:
+		return fmt.Errorf("the fairness report is available as table or json, not csv")
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "Fairness of lottery draws rewarded in blocks %d-%d\n", report.From, report.To)
+	fmt.Fprintf(tw, "  Draws: %d, skipped: %d\n", len(report.Draws), len(report.Skipped))
+	fmt.Fprintln(tw)
+
+	fmt.Fprintf(tw, "Wins per staker (%d stakers):\n", len(report.Stakers))
+	if len(report.Stakers) > 0 {
+		fmt.Fprintln(tw, "  Address\tEligible draws\tExpected wins\tObserved wins")
+		for _, s := range report.Stakers {
+			fmt.Fprintf(tw, "  %s\t%d\t%.3f\t%d\n", s.Address, s.Draws, s.Expected, s.Observed)
+		}
+	}
+	writeFit(tw, report.Wins)
+	fmt.Fprintln(tw)
+
+	seeds := report.Seeds
+	fmt.Fprintln(tw, "Seed values:")
+	if len(report.Draws) > 0 {
+		fmt.Fprintf(tw, "  Mean %.4f (0.5 expected), min %.4f, max %.4f\n", seeds.Mean, seeds.Min, seeds.Max)
+		fmt.Fprintln(tw, "  Range\tDraws")
+		for i, n := range seeds.Buckets {
+			fmt.Fprintf(tw, "  %.1f-%.1f\t%d\n", float64(i)/seedBuckets, float64(i+1)/seedBuckets, n)
+		}
+	}
+	writeFit(tw, seeds.Uniformity)
+
+	if len(report.Skipped) > 0 {
+		fmt.Fprintln(tw)
+		fmt.Fprintln(tw, "Skipped epochs:")
+		for _, s := range report.Skipped {
+			fmt.Fprintf(tw, "  %d-%d\t%s\n", s.Start, s.End, s.Reason)
+		}
+	}
+	return tw.Flush()
+}
+
+func writeFit(w io.Writer, fit GoodnessOfFit) {
+	if fit.DegreesOfFreedom == 0 {
+		fmt.Fprintln(w, "  Chi-square: not enough data to test")
+		return
+	}
+	fmt.Fprintf(w, "  Chi-square %.3f, %d degrees of freedom, p = %.4f", fit.ChiSquare, fit.DegreesOfFreedom, fit.PValue)
+	if fit.PValue < 0.05 {
+		fmt.Fprint(w, " (unlikely under a fair draw)")
+	}
+	fmt.Fprintln(w)
+}
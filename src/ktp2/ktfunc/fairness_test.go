@@ -0,0 +1,81 @@
+package ktfunc
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChiSquareSurvival(t *testing.T) {
+	// Critical values at the 5% level.
+	assert.InDelta(t, 0.05, chiSquareSurvival(3.841, 1), 1e-4)
+	assert.InDelta(t, 0.05, chiSquareSurvival(18.307, 10), 1e-4)
+	assert.InDelta(t, 0.05, chiSquareSurvival(16.919, 9), 1e-4)
+	assert.InDelta(t, 1.0, chiSquareSurvival(0, 3), 1e-12)
+	assert.InDelta(t, 0.0, chiSquareSurvival(200, 2), 1e-12)
+
+	fit := pearsonChiSquare([]float64{3, 1}, []float64{2, 2})
+	assert.InDelta(t, 1.0, fit.ChiSquare, 1e-12)
+	assert.Equal(t, 1, fit.DegreesOfFreedom)
+
+	fit = pearsonChiSquare([]float64{1, 0}, []float64{1, 0})
+	assert.Equal(t, 0, fit.DegreesOfFreedom, "a single category can't be tested")
+	assert.Equal(t, 1.0, fit.PValue)
+}
+
+func TestBuildFairnessReport(t *testing.T) {
+	logrus.SetLevel(logrus.FatalLevel)
+	defer logrus.SetLevel(logrus.InfoLevel)
+
+	kt, a, b := threeEpochHistory()
+	cProps := newOddsTestProps(t, kt, 500)
+
+	report, err := BuildFairnessReport(cProps, 0, 500)
+	require.NoError(t, err)
+
+	// 100-200 had nobody eligible. b won 200-300 without being eligible in
+	// the replay, so that draw is left out too; only 300-400 counts.
+	require.Len(t, report.Skipped, 2)
+	assert.Equal(t, "no eligible stakers", report.Skipped[0].Reason)
+	assert.Contains(t, report.Skipped[1].Reason, "winner "+b.Hex()+" was not eligible")
+	require.Len(t, report.Draws, 1)
+
+	full := buildStakeDataMap(kt.stakes, kt.withdraws)
+	_, mins, err := epochOdds(cProps, full, 300, 400)
+	require.NoError(t, err)
+	pa, _ := mins[a].Prob.Float64()
+	pb, _ := mins[b].Prob.Float64()
+
+	require.Len(t, report.Stakers, 2)
+	assert.Equal(t, StakerFairness{Address: a.Hex(), Draws: 1, Expected: pa, Observed: 1}, report.Stakers[0])
+	assert.Equal(t, StakerFairness{Address: b.Hex(), Draws: 1, Expected: pb, Observed: 0}, report.Stakers[1])
+	assert.Equal(t, pa, report.Draws[0].WinnerProb)
+
+	wantChi := (1-pa)*(1-pa)/pa + pb
+	assert.InDelta(t, wantChi, report.Wins.ChiSquare, 1e-9)
+	assert.Equal(t, 1, report.Wins.DegreesOfFreedom)
+
+	seed, _ := seedFraction((&types.Header{}).Hash()).Float64()
+	assert.InDelta(t, seed, report.Seeds.Mean, 1e-12)
+	assert.Equal(t, 1, report.Seeds.Buckets[int(seed*seedBuckets)])
+
+	// A manually voted winner is not a draw.
+	kt.voted[3] = votedAt(342, 200, b, manualVoteData)
+	report, err = BuildFairnessReport(cProps, 300, 400)
+	require.NoError(t, err)
+	assert.Empty(t, report.Draws)
+	require.Len(t, report.Skipped, 1)
+	assert.Contains(t, report.Skipped[0].Reason, "manually")
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteFairnessReport(&buf, report, FormatJSON))
+	var decoded FairnessReport
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &decoded))
+	assert.Equal(t, *report, decoded)
+	assert.Error(t, WriteFairnessReport(&buf, report, FormatCSV))
+}
@@ -0,0 +1,329 @@
+package ktfunc
+
+// OC fee ledger. An OC accrues a fee, ocFees[oc][startBlock], each time it
+// votes or rewards in an epoch, and the contract keeps no list of those
+// epochs. The ledger records them per OC in the fees DB, together with the
+// fee accrued in each, so fee queries are local reads. It is advanced like
+// the event cache: incrementally from its tip, with the tip's block hash
+// checked for a reorg, and only through blocks buried reorgSafetyDepth
+// deep. The blocks above that are scanned fresh on every call and never
+// stored.
+//
+// Nothing is read from historical state, so any node will do. The contract
+// only keeps an epoch's fee in ocFees while it is the OC's lastStartBlock;
+// the OC's next action moves it into pastOcFees. So a fee is read from the
+// latest state while its epoch is still the OC's last, and kept from then
+// on. An epoch the ledger first scans after the OC has moved on has no fee.
+//
+// A Rwd event pays out the epoch of the last Voted event before it (see
+// GatherPastEpochs), so the ledger carries that epoch along with its tip
+// instead of reading startBlock from archive state.
+//
+// An event whose transaction sender can't be fetched is skipped with a
+// warning, as it always was, but it might be this OC's: the stored tip is
+// held below its block so the next advance scans it again.
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"sort"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	log "github.com/sirupsen/logrus"
+)
+
+const feeLedgerBucket = "fee_ledger"
+
+// FeeLedgerEntry is one epoch in which an OC voted or rewarded.
+type FeeLedgerEntry struct {
+	Epoch     uint64 // the epoch's startBlock, the key of ocFees
+	Voted     bool   // the OC cast (and possibly reset) a vote
+	Rewarded  bool   // the OC sent the epoch's rwd
+	LastBlock uint64 // the OC's last vote, reset or rwd in the epoch
+	// Fee is ocFees(oc, Epoch) as last read while Epoch was the OC's
+	// lastStartBlock: everything the OC accrued for the epoch, before a
+	// later action migrates it into pastOcFees. Nil when the ledger never
+	// saw the epoch as the OC's last.
+	Fee *big.Int
+	// Withdrawn is set once a withdrawal made by this node has paid Fee out.
+	Withdrawn bool
+}
+
+// FeeLedgerTip is how far a fee ledger has been advanced. LastEpoch is the
+// epoch of the last Voted event at or below the tip, which the next Rwd
+// pays out.
+type FeeLedgerTip struct {
+	CacheTip
+	LastEpoch uint64
+}
+
+// feeLedgerEntries advances oc's fee ledger and returns every entry whose
+// epoch starts in [from, to], oldest first, including epochs only seen in
+// the unstored blocks near head.
+func feeLedgerEntries(cProps *ConnectionProps, store EventStore, oc common.Address, from, to uint64) ([]FeeLedgerEntry, error) {
+	all, err := advanceFeeLedger(cProps, store, oc)
+	if err != nil {
+		return nil, err
+	}
+	var out []FeeLedgerEntry
+	for _, e := range all {
+		if e.Epoch >= from && e.Epoch <= to {
+			out = append(out, e)
+		}
+	}
+	return out, nil
+}
+
+// advanceFeeLedger brings oc's stored ledger up to reorgSafetyDepth below
+// head and returns all of its entries plus those in the blocks above.
+func advanceFeeLedger(cProps *ConnectionProps, store EventStore, oc common.Address) ([]FeeLedgerEntry, error) {
+	tip, stored, err := reconcileFeeLedgerTip(cProps, store, oc)
+	if err != nil {
+		return nil, err
+	}
+	creation, err := GetContractCreationBlock(cProps)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get contract creation block: %w", err)
+	}
+	head, err := cProps.Client.BlockNumber(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get latest block: %w", err)
+	}
+
+	entries := make(map[uint64]*FeeLedgerEntry, len(stored))
+	for i := range stored {
+		entries[stored[i].Epoch] = &stored[i]
+	}
+	from := creation
+	if tip.Block >= creation {
+		from = tip.Block + 1
+	}
+	senders := newTxSenders(cProps)
+	lastEpoch := tip.LastEpoch
+
+	if head >= reorgSafetyDepth && from <= head-reorgSafetyDepth {
+		safe := head - reorgSafetyDepth
+		log.Debugf("Advancing fee ledger of %s from %d to %d", oc.Hex(), from, safe)
+		held := false
+		err = forEachBlockChunk(cProps, from, safe, func(start, end uint64) error {
+			touched, skip, err := scanFeeEvents(cProps, senders, oc, start, end, &lastEpoch, entries)
+			if err != nil {
+				return err
+			}
+			// Entries past a hold are stored too; scanning them again
+			// later leaves them as they are.
+			switch {
+			case held:
+			case skip != nil:
+				held = true
+				if skip.block > start {
+					tip = FeeLedgerTip{CacheTip: feeLedgerTipAt(cProps, skip.block-1), LastEpoch: skip.lastEpoch}
+				}
+				log.Warnf("Fee ledger of %s held at block %d until the sender of tx %s can be fetched", oc.Hex(), skip.block-1, skip.tx.Hex())
+			default:
+				tip = FeeLedgerTip{CacheTip: feeLedgerTipAt(cProps, end), LastEpoch: lastEpoch}
+			}
+			if err := store.UpdateFeeLedger(oc, tip, touched); err != nil {
+				return fmt.Errorf("failed to store fee ledger: %w", err)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		from = safe + 1
+	}
+	if from <= head {
+		err = forEachBlockChunk(cProps, from, head, func(start, end uint64) error {
+			_, _, err := scanFeeEvents(cProps, senders, oc, start, end, &lastEpoch, entries)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	out := make([]FeeLedgerEntry, 0, len(entries))
+	for _, e := range entries {
+		out = append(out, *e)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Epoch < out[j].Epoch })
+	return out, nil
+}
+
+// feeLedgerTipAt returns a tip at block, with its hash when the node serves
+// the header.
+func feeLedgerTipAt(cProps *ConnectionProps, block uint64) CacheTip {
+	tip := CacheTip{Block: block}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	hdr, err := cProps.Client.HeaderByNumber(ctx, new(big.Int).SetUint64(block))
+	cancel()
+	if err == nil && hdr != nil {
+		tip.Hash, tip.HasHash = hdr.Hash(), true
+	} else if err != nil {
+		log.Debugf("Could not capture fee ledger tip hash for block %d: %v", block, err)
+	}
+	return tip
+}
+
+// reconcileFeeLedgerTip returns oc's ledger, dropping it first if the block
+// at its tip is no longer the one it was built on.
+func reconcileFeeLedgerTip(cProps *ConnectionProps, store EventStore, oc common.Address) (FeeLedgerTip, []FeeLedgerEntry, error) {
+	tip, entries, err := store.FeeLedger(oc)
+	if err != nil {
+		return tip, nil, fmt.Errorf("failed to read fee ledger: %w", err)
+	}
+	if !tip.HasHash {
+		return tip, entries, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	current, err := cProps.Client.HeaderByNumber(ctx, new(big.Int).SetUint64(tip.Block))
+	cancel()
+	if err != nil {
+		log.Warnf("Fee ledger reorg check skipped (HeaderByNumber(%d) failed): %v", tip.Block, err)
+		return tip, entries, nil
+	}
+	if current == nil || current.Hash() == tip.Hash {
+		return tip, entries, nil
+	}
+	log.Warnf("Reorg detected at fee ledger tip %d: cached=%s, on-chain=%s. Rebuilding the fee ledger.",
+		tip.Block, tip.Hash.Hex(), current.Hash().Hex())
+	if err := store.ResetFeeLedger(oc); err != nil {
+		return FeeLedgerTip{}, nil, fmt.Errorf("failed to wipe fee ledger after reorg: %w", err)
+	}
+	return FeeLedgerTip{}, nil, nil
+}
+
+type feeEvent struct {
+	block, index uint64
+	voted        bool
+	epoch        uint64 // Voted only
+	tx           common.Hash
+}
+
+// feeSkip is the first event of a scan whose sender couldn't be fetched.
+// lastEpoch is the epoch a Rwd would have paid out just before its block.
+type feeSkip struct {
+	block     uint64
+	tx        common.Hash
+	lastEpoch uint64
+}
+
+// scanFeeEvents folds the Voted and Rwd events of [start, end] into
+// entries, moving lastEpoch along, and returns the entries it changed with
+// their fees read. An event whose sender can't be fetched is skipped with a
+// warning; the first one is returned so the caller can hold its tip.
+func scanFeeEvents(cProps *ConnectionProps, senders *txSenders, oc common.Address, start, end uint64, lastEpoch *uint64, entries map[uint64]*FeeLedgerEntry) ([]FeeLedgerEntry, *feeSkip, error) {
+	opts := &bind.FilterOpts{Start: start, End: &end, Context: context.Background()}
+	var events []feeEvent
+	votedIter, err := cProps.Kt.FilterVoted(opts)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to filter Voted events %d-%d: %w", start, end, err)
+	}
+	for votedIter.Next() {
+		evt := votedIter.Event()
+		if evt == nil || evt.Arg0 == nil {
+			continue
+		}
+		events = append(events, feeEvent{block: evt.Raw.BlockNumber, index: uint64(evt.Raw.Index), voted: true, epoch: evt.Arg0.Uint64(), tx: evt.Raw.TxHash})
+	}
+	err = votedIter.Error()
+	votedIter.Close()
+	if err != nil {
+		return nil, nil, fmt.Errorf("error iterating Voted events: %w", err)
+	}
+	rwdIter, err := cProps.Kt.FilterRwd(opts)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to filter Rwd events %d-%d: %w", start, end, err)
+	}
+	for rwdIter.Next() {
+		if evt := rwdIter.Event(); evt != nil {
+			events = append(events, feeEvent{block: evt.Raw.BlockNumber, index: uint64(evt.Raw.Index), tx: evt.Raw.TxHash})
+		}
+	}
+	err = rwdIter.Error()
+	rwdIter.Close()
+	if err != nil {
+		return nil, nil, fmt.Errorf("error iterating Rwd events: %w", err)
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		if events[i].block != events[j].block {
+			return events[i].block < events[j].block
+		}
+		return events[i].index < events[j].index
+	})
+
+	hashes := make([]common.Hash, len(events))
+	for i, ev := range events {
+		hashes[i] = ev.tx
+	}
+	senders.prefetch(hashes)
+
+	touched := make(map[uint64]*FeeLedgerEntry)
+	var skip *feeSkip
+	blockStartEpoch, block := *lastEpoch, uint64(0)
+	for _, ev := range events {
+		if ev.block != block {
+			blockStartEpoch, block = *lastEpoch, ev.block
+		}
+		epoch := ev.epoch
+		if ev.voted {
+			*lastEpoch = epoch
+		} else if epoch = *lastEpoch; epoch == 0 {
+			log.Warnf("Rwd at block %d has no preceding Voted event; skipping", ev.block)
+			continue
+		}
+		sender, err := senders.sender(ev.tx)
+		if err != nil {
+			log.Warnf("Skipping event at block %d: %v", ev.block, err)
+			if skip == nil {
+				skip = &feeSkip{block: ev.block, tx: ev.tx, lastEpoch: blockStartEpoch}
+			}
+			continue
+		}
+		if sender != oc {
+			continue
+		}
+		e := entries[epoch]
+		if e == nil {
+			e = &FeeLedgerEntry{Epoch: epoch}
+			entries[epoch] = e
+		}
+		if ev.voted {
+			e.Voted = true
+		} else {
+			e.Rewarded = true
+		}
+		e.LastBlock = ev.block
+		touched[epoch] = e
+	}
+
+	if len(touched) == 0 {
+		return nil, skip, nil
+	}
+	// Only the OC's last epoch still has its fee in ocFees; the others keep
+	// what was read while they were.
+	callOpts := &bind.CallOpts{Context: context.Background()}
+	last, err := cProps.Kt.LastStartBlock(callOpts, oc)
+	if err != nil {
+		log.Debugf("Could not read lastStartBlock of %s: %v", oc.Hex(), err)
+	}
+	out := make([]FeeLedgerEntry, 0, len(touched))
+	for _, e := range touched {
+		if last != nil && last.Uint64() == e.Epoch {
+			fee, err := cProps.Kt.OcFees(callOpts, oc, new(big.Int).SetUint64(e.Epoch))
+			if err != nil {
+				log.Debugf("Could not read OC fee of epoch %d: %v", e.Epoch, err)
+			} else {
+				// A withdrawal clears ocFees, so this is only what the OC
+				// accrued since.
+				e.Fee, e.Withdrawn = fee, false
+			}
+		}
+		out = append(out, *e)
+	}
+	return out, skip, nil
+}
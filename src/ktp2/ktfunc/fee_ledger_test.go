@@ -0,0 +1,191 @@
+package ktfunc
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"ktp2/src/abis/ktv2"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// ledgerFeeFakeKt adds ocFees and lastStartBlock to epochFakeKt. Like a
+// pruned node it serves no historical state, and like the contract it only
+// keeps the fee of the OC's last epoch in ocFees. StartBlock must never be
+// needed.
+type ledgerFeeFakeKt struct {
+	*epochFakeKt
+	fees       map[uint64]int64 // by epoch
+	last       uint64
+	feeReads   []uint64 // the epoch of each read
+	startCalls int
+}
+
+func (f *ledgerFeeFakeKt) OcFees(opts *bind.CallOpts, _ common.Address, epoch *big.Int) (*big.Int, error) {
+	if opts.BlockNumber != nil {
+		return nil, errors.New("missing trie node")
+	}
+	f.feeReads = append(f.feeReads, epoch.Uint64())
+	if epoch.Uint64() != f.last {
+		return new(big.Int), nil
+	}
+	return big.NewInt(f.fees[epoch.Uint64()]), nil
+}
+
+func (f *ledgerFeeFakeKt) LastStartBlock(*bind.CallOpts, common.Address) (*big.Int, error) {
+	return new(big.Int).SetUint64(f.last), nil
+}
+
+func (f *ledgerFeeFakeKt) StartBlock(opts *bind.CallOpts) (*big.Int, error) {
+	f.startCalls++
+	return f.epochFakeKt.StartBlock(opts)
+}
+
+func TestFeeLedger(t *testing.T) {
+	logrus.SetLevel(logrus.FatalLevel)
+	defer logrus.SetLevel(logrus.InfoLevel)
+
+	chainID := big.NewInt(1337)
+	xTx, ocX := signedTxFromKey(t, testKeyX, chainID)
+	yTx, _ := signedTxFromKey(t, testKeyY, chainID)
+
+	base := &epochFakeKt{ledgerFakeKt: &ledgerFakeKt{}, start: 400, interval: 100}
+	kt := &ledgerFeeFakeKt{epochFakeKt: base, fees: map[uint64]int64{100: 3, 200: 5, 300: 2}, last: 300}
+	// X votes in every epoch and sends the reward of 200. Y rewards 100, in
+	// the same block as X's vote for 200, but before it.
+	txs := map[common.Hash]*types.Transaction{}
+	for i, ev := range []struct {
+		tx    *types.Transaction
+		block uint64
+		index uint
+		epoch int64 // 0 for a Rwd
+	}{
+		{xTx, 210, 0, 100},
+		{yTx, 211, 0, 100},
+		{yTx, 310, 0, 0},
+		{xTx, 310, 1, 200},
+		{xTx, 320, 0, 0},
+		{xTx, 480, 0, 300}, // within reorgSafetyDepth of head
+	} {
+		hash := common.BigToHash(big.NewInt(int64(i + 1)))
+		txs[hash] = ev.tx
+		raw := types.Log{BlockNumber: ev.block, Index: ev.index, TxHash: hash}
+		if ev.epoch == 0 {
+			base.rwds = append(base.rwds, &ktv2.Ktv2Rwd{Arg1: big.NewInt(1), Raw: raw})
+		} else {
+			base.voted = append(base.voted, &ktv2.Ktv2Voted{Arg0: big.NewInt(ev.epoch), Raw: raw})
+		}
+	}
+	cProps := newOddsTestProps(t, base, 500)
+	cProps.Kt = kt
+	client := cProps.Client.(*MockEthClient)
+	for hash, tx := range txs {
+		client.On("TransactionByHash", mock.Anything, hash).Return(tx, false, nil)
+	}
+
+	blocks, err := GetOwedEpochBlocks(cProps, ocX, 0, 1000)
+	require.NoError(t, err)
+	assert.Equal(t, []uint64{100, 200, 300}, blocks)
+	assert.Zero(t, kt.startCalls, "a Rwd's epoch comes from the Voted before it, not archive state")
+	client.AssertNumberOfCalls(t, "TransactionByHash", 6)
+
+	// Only the blocks buried reorgSafetyDepth deep are stored.
+	tip, stored, err := cProps.Store.FeeLedger(ocX)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(500-reorgSafetyDepth), tip.Block)
+	assert.True(t, tip.HasHash)
+	assert.Equal(t, uint64(200), tip.LastEpoch)
+	require.Len(t, stored, 2)
+	assert.Equal(t, FeeLedgerEntry{Epoch: 100, Voted: true, LastBlock: 210}, stored[0])
+	assert.Equal(t, FeeLedgerEntry{Epoch: 200, Voted: true, Rewarded: true, LastBlock: 320}, stored[1])
+	assert.Equal(t, []uint64{300}, kt.feeReads, "only the OC's last epoch still has its fee in ocFees")
+
+	// The next call only reads what lies above the tip.
+	kt.feeReads = nil
+	blocks, err = GetOwedEpochBlocks(cProps, ocX, 150, 300)
+	require.NoError(t, err)
+	assert.Equal(t, []uint64{200, 300}, blocks, "the range selects by epoch start")
+	client.AssertNumberOfCalls(t, "TransactionByHash", 7)
+	assert.Equal(t, []uint64{300}, kt.feeReads)
+
+	// A ledger built on a block that has since been reorged out is rebuilt.
+	stale := tip
+	stale.Hash = common.HexToHash("0xdead")
+	require.NoError(t, cProps.Store.UpdateFeeLedger(ocX, stale, []FeeLedgerEntry{{Epoch: 250, Voted: true}}))
+	blocks, err = GetOwedEpochBlocks(cProps, ocX, 0, 1000)
+	require.NoError(t, err)
+	assert.Equal(t, []uint64{100, 200, 300}, blocks)
+
+	// A fee read while its epoch was the OC's last is kept once the OC
+	// moves on and the contract migrates it into pastOcFees.
+	require.NoError(t, cProps.Store.ResetFeeLedger(ocX))
+	kt.last = 200
+	entries := feeEntries(t, cProps, ocX)
+	require.Len(t, entries, 3)
+	assert.Nil(t, entries[0].Fee)
+	assert.Equal(t, 0, entries[1].Fee.Cmp(big.NewInt(5)))
+	assert.Nil(t, entries[2].Fee)
+	kt.last = 300
+	entries = feeEntries(t, cProps, ocX)
+	require.Len(t, entries, 3)
+	assert.Equal(t, 0, entries[1].Fee.Cmp(big.NewInt(5)))
+	assert.Equal(t, 0, entries[2].Fee.Cmp(big.NewInt(2)))
+}
+
+// feeEntries advances oc's fee ledger and returns all of its entries.
+func feeEntries(t *testing.T, cProps *ConnectionProps, oc common.Address) []FeeLedgerEntry {
+	t.Helper()
+	store, release, err := openEventStore(cProps)
+	require.NoError(t, err)
+	defer release()
+	entries, err := feeLedgerEntries(cProps, store, oc, 0, 1000)
+	require.NoError(t, err)
+	return entries
+}
+
+// TestFeeLedger_UnresolvedSenderHoldsTheTip — an event whose sender can't
+// be fetched is skipped, but it might be this OC's, so the stored tip is
+// held below it and the next advance scans it again.
+func TestFeeLedger_UnresolvedSenderHoldsTheTip(t *testing.T) {
+	logrus.SetLevel(logrus.FatalLevel)
+	defer logrus.SetLevel(logrus.InfoLevel)
+
+	xTx, ocX := signedTxFromKey(t, testKeyX, big.NewInt(1337))
+	failing, ok := common.HexToHash("0x01"), common.HexToHash("0x02")
+	base := &epochFakeKt{ledgerFakeKt: &ledgerFakeKt{}, start: 300, interval: 100}
+	base.voted = []*ktv2.Ktv2Voted{
+		{Arg0: big.NewInt(100), Raw: types.Log{BlockNumber: 150, TxHash: ok}},
+		{Arg0: big.NewInt(200), Raw: types.Log{BlockNumber: 210, TxHash: failing}},
+		{Arg0: big.NewInt(300), Raw: types.Log{BlockNumber: 310, TxHash: ok}},
+	}
+	cProps := newOddsTestProps(t, base, 500)
+	cProps.Kt = &ledgerFeeFakeKt{epochFakeKt: base}
+	client := cProps.Client.(*MockEthClient)
+	client.On("TransactionByHash", mock.Anything, ok).Return(xTx, false, nil)
+	lookup := client.On("TransactionByHash", mock.Anything, failing).Return((*types.Transaction)(nil), false, errors.New("rpc: timeout"))
+
+	blocks, err := GetOwedEpochBlocks(cProps, ocX, 0, 1000)
+	require.NoError(t, err)
+	assert.Equal(t, []uint64{100, 300}, blocks)
+	tip, _, err := cProps.Store.FeeLedger(ocX)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(209), tip.Block)
+	assert.Equal(t, uint64(100), tip.LastEpoch)
+
+	// Once the tx can be fetched, the held blocks are scanned again.
+	lookup.Unset()
+	client.On("TransactionByHash", mock.Anything, failing).Return(xTx, false, nil)
+	blocks, err = GetOwedEpochBlocks(cProps, ocX, 0, 1000)
+	require.NoError(t, err)
+	assert.Equal(t, []uint64{100, 200, 300}, blocks)
+	tip, _, err = cProps.Store.FeeLedger(ocX)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(500-reorgSafetyDepth), tip.Block)
+}
@@ -0,0 +1,236 @@
+package ktfunc
+
+// OC fee model. FeeModel mirrors the fee accounting of Ktv2.sol: the
+// recordOCFee, resetOCFee and migrateFees internals and the vote,
+// resetVote, rwd and withdrawOCFee calls built on them, with the same
+// integer arithmetic in the same order. It models only that accounting.
+// Access checks (onlyOC, notDeclined, epochComplete), vote tallies and
+// requires are left to the contract, so a call the contract would revert
+// still goes through here.
+//
+// The node uses it to forecast what a vote will earn before sending it:
+// the fee is a share of the contract's unreserved balance, balance minus
+// tlOcFees, at the moment of each vote or rwd.
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	log "github.com/sirupsen/logrus"
+)
+
+// feePDen is Ktv2.sol's P_DEN: percentages are in tenths, so ocFee 20 is 2%.
+const feePDen = 1000
+
+// FeeModel is the fee state of a Ktv2 contract.
+type FeeModel struct {
+	Balance        *big.Int // the contract's ETH balance
+	TlOcFees       *big.Int // reserved for OC fees, included in Balance
+	OcFee          uint16
+	StartBlock     uint64
+	EpochInterval  uint64
+	OcFees         map[common.Address]map[uint64]*big.Int
+	PastOcFees     map[common.Address]*big.Int
+	LastStartBlock map[common.Address]uint64
+}
+
+// NewFeeModel returns a model with no fees recorded.
+func NewFeeModel(balance, tlOcFees *big.Int, ocFee uint16, startBlock, epochInterval uint64) *FeeModel {
+	return &FeeModel{
+		Balance:        new(big.Int).Set(balance),
+		TlOcFees:       new(big.Int).Set(tlOcFees),
+		OcFee:          ocFee,
+		StartBlock:     startBlock,
+		EpochInterval:  epochInterval,
+		OcFees:         make(map[common.Address]map[uint64]*big.Int),
+		PastOcFees:     make(map[common.Address]*big.Int),
+		LastStartBlock: make(map[common.Address]uint64),
+	}
+}
+
+// Fee returns ocFees[oc][epoch].
+func (m *FeeModel) Fee(oc common.Address, epoch uint64) *big.Int {
+	if f := m.OcFees[oc][epoch]; f != nil {
+		return new(big.Int).Set(f)
+	}
+	return new(big.Int)
+}
+
+// Past returns pastOcFees[oc].
+func (m *FeeModel) Past(oc common.Address) *big.Int {
+	if f := m.PastOcFees[oc]; f != nil {
+		return new(big.Int).Set(f)
+	}
+	return new(big.Int)
+}
+
+func (m *FeeModel) setFee(oc common.Address, epoch uint64, fee *big.Int) {
+	if m.OcFees[oc] == nil {
+		m.OcFees[oc] = make(map[uint64]*big.Int)
+	}
+	m.OcFees[oc][epoch] = fee
+}
+
+// migrateFees moves the fee of the epoch oc last acted in, if older than
+// the current one, into pastOcFees.
+func (m *FeeModel) migrateFees(oc common.Address) {
+	if last := m.LastStartBlock[oc]; last != m.StartBlock && last != 0 {
+		if old := m.Fee(oc, last); old.Sign() > 0 && last < m.StartBlock {
+			m.PastOcFees[oc] = old.Add(old, m.Past(oc))
+			m.setFee(oc, last, new(big.Int))
+		}
+	}
+	m.LastStartBlock[oc] = m.StartBlock
+}
+
+// recordOCFee credits oc with ocFee of the unreserved balance and returns
+// the amount.
+func (m *FeeModel) recordOCFee(oc common.Address) *big.Int {
+	incr := new(big.Int)
+	if m.Balance.Cmp(m.TlOcFees) > 0 {
+		incr.Sub(m.Balance, m.TlOcFees)
+		incr.Mul(incr, big.NewInt(int64(m.OcFee)))
+		incr.Quo(incr, big.NewInt(feePDen))
+		cur := m.Fee(oc, m.StartBlock)
+		m.setFee(oc, m.StartBlock, cur.Add(cur, incr))
+		m.TlOcFees = new(big.Int).Add(m.TlOcFees, incr)
+	}
+	return incr
+}
+
+// resetOCFee takes back what oc was credited in the current epoch.
+func (m *FeeModel) resetOCFee(oc common.Address) {
+	m.TlOcFees = new(big.Int).Sub(m.TlOcFees, m.Fee(oc, m.StartBlock))
+	m.setFee(oc, m.StartBlock, new(big.Int))
+}
+
+// Vote is vote(): it returns the fee oc earns for it.
+func (m *FeeModel) Vote(oc common.Address) *big.Int {
+	m.migrateFees(oc)
+	return m.recordOCFee(oc)
+}
+
+// ResetVote is resetVote().
+func (m *FeeModel) ResetVote(oc common.Address) {
+	m.migrateFees(oc)
+	m.resetOCFee(oc)
+}
+
+// Rwd is rwd(_to, amt) sent by oc. It returns the fee oc earns and the
+// reward the contract computes, amt less the fee, and starts the next
+// epoch. The reward is only transferred, and sent is only true, when it is
+// more than P_DEN wei.
+func (m *FeeModel) Rwd(oc common.Address, amt *big.Int) (fee, reward *big.Int, sent bool) {
+	m.migrateFees(oc)
+	fee = m.recordOCFee(oc)
+	reward = new(big.Int)
+	if amt.Cmp(fee) > 0 {
+		reward.Sub(amt, fee)
+	}
+	m.StartBlock += m.EpochInterval
+	if reward.Cmp(big.NewInt(feePDen)) > 0 {
+		m.Balance = new(big.Int).Sub(m.Balance, reward)
+		sent = true
+	}
+	return fee, reward, sent
+}
+
+// WithdrawOCFee is withdrawOCFee() sent by oc at block. It returns what
+// oc is paid: its pastOcFees, plus the current epoch's fee once the epoch
+// is complete. Like the contract, it clears the fees even when the
+// balance can't cover them, and then pays nothing.
+func (m *FeeModel) WithdrawOCFee(oc common.Address, block uint64) *big.Int {
+	m.migrateFees(oc)
+	amt := m.Past(oc)
+	if block > m.StartBlock+m.EpochInterval {
+		if current := m.Fee(oc, m.StartBlock); current.Sign() > 0 {
+			amt.Add(amt, current)
+			m.setFee(oc, m.StartBlock, new(big.Int))
+		}
+	}
+	m.PastOcFees[oc] = new(big.Int)
+	m.TlOcFees = new(big.Int).Sub(m.TlOcFees, amt)
+	if m.Balance.Cmp(amt) < 0 {
+		return new(big.Int)
+	}
+	m.Balance = new(big.Int).Sub(m.Balance, amt)
+	return amt
+}
+
+// FeeForecast is what the current epoch is expected to pay this node's OC
+// and the winner. Amounts are wei.
+type FeeForecast struct {
+	Epoch   uint64
+	OcFee   uint16
+	Voted   bool     // the OC already has a vote in this epoch
+	VoteFee *big.Int // recorded for the OC's vote if Voted, else forecast for voting now
+	RwdFee  *big.Int // earned on top of VoteFee if the OC also sends the rwd
+	Reward  *big.Int // what the winner is paid by a rwd right after the OC's vote
+	RwdSent bool     // whether Reward is large enough to be transferred at all
+}
+
+// ForecastEpochFees forecasts the OC's fee for the current epoch and the
+// winner's payout, assuming the OC votes now unless it has (voted says
+// whether it has) and the rwd follows with no other vote in between. Each
+// vote in between would take another ocFee share out of the payout. The
+// rwd amount is the one the node sends: balance minus tlOcFees.
+func ForecastEpochFees(cProps *ConnectionProps, voted bool) (*FeeForecast, error) {
+	opts := &bind.CallOpts{Context: context.Background(), From: cProps.MyPubKey}
+	startBlock, err := cProps.Kt.StartBlock(opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get start block: %w", err)
+	}
+	interval, err := cProps.Kt.EpochInterval(opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get epoch interval: %w", err)
+	}
+	ocFee, err := cProps.Kt.OcFee(opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get OC fee: %w", err)
+	}
+	tlOcFees, err := cProps.Kt.TlOcFees(opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get total OC fees: %w", err)
+	}
+	balance, err := cProps.Client.BalanceAt(context.Background(), cProps.KtAddr, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get contract balance: %w", err)
+	}
+	m := NewFeeModel(balance, tlOcFees, ocFee, startBlock.Uint64(), uint64(interval))
+	f := &FeeForecast{Epoch: m.StartBlock, OcFee: ocFee, Voted: voted}
+	me := cProps.MyPubKey
+	if voted {
+		if f.VoteFee, err = cProps.Kt.OcFees(opts, me, startBlock); err != nil {
+			return nil, fmt.Errorf("failed to get this OC's fee: %w", err)
+		}
+		// Already part of tlOcFees, so the model needs it only to report.
+		m.setFee(me, m.StartBlock, new(big.Int).Set(f.VoteFee))
+	} else {
+		f.VoteFee = m.Vote(me)
+	}
+	amt := new(big.Int).Sub(m.Balance, m.TlOcFees)
+	if amt.Sign() < 0 {
+		amt.SetInt64(0)
+	}
+	f.RwdFee, f.Reward, f.RwdSent = m.Rwd(me, amt)
+	return f, nil
+}
+
+// logFeeForecast prints the forecast for -showVotes and -ktProps.
+func logFeeForecast(f *FeeForecast) {
+	pct := float64(f.OcFee) / 10
+	if f.Voted {
+		log.Printf("  This OC's fee for its vote: %s ETH (ocFee %.1f%%)", weiToEthString(f.VoteFee), pct)
+	} else {
+		log.Printf("  Forecast fee for voting now: %s ETH (ocFee %.1f%% of the unreserved balance)", weiToEthString(f.VoteFee), pct)
+	}
+	log.Printf("  Forecast fee for also sending the reward: %s ETH", weiToEthString(f.RwdFee))
+	if f.RwdSent {
+		log.Printf("  Forecast winner payout: %s ETH, if the reward follows with no other vote", weiToEthString(f.Reward))
+	} else {
+		log.Printf("  Forecast winner payout: nothing; %s wei is too little for the contract to send", f.Reward)
+	}
+}
@@ -0,0 +1,113 @@
+package ktfunc
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// TestFeeModel walks an epoch through the contract's calls. The expected
+// values are worked by hand from Ktv2.sol with ocFee 20 (2%).
+func TestFeeModel(t *testing.T) {
+	a, b := common.HexToAddress("0x0a"), common.HexToAddress("0x0b")
+	m := NewFeeModel(big.NewInt(100_000), big.NewInt(0), 20, 100, 50)
+
+	// Each vote takes 2% of what is not yet reserved.
+	assert.Equal(t, int64(2000), m.Vote(a).Int64())
+	assert.Equal(t, int64(1960), m.Vote(b).Int64())
+	assert.Equal(t, int64(3960), m.TlOcFees.Int64())
+
+	// A reset gives the vote's fee back.
+	m.ResetVote(b)
+	assert.Equal(t, int64(2000), m.TlOcFees.Int64())
+	assert.Zero(t, m.Fee(b, 100).Sign())
+
+	// The node rewards balance - tlOcFees; the rwd's own fee comes out of
+	// it, and everything unreserved is paid.
+	fee, reward, sent := m.Rwd(a, new(big.Int).Sub(m.Balance, m.TlOcFees))
+	assert.Equal(t, int64(1960), fee.Int64())
+	assert.Equal(t, int64(96_040), reward.Int64())
+	assert.True(t, sent)
+	assert.Equal(t, uint64(150), m.StartBlock)
+	assert.Equal(t, int64(3960), m.Fee(a, 100).Int64())
+	assert.Equal(t, 0, m.Balance.Cmp(m.TlOcFees), "only the fees are left")
+
+	// Withdrawing in the next epoch migrates epoch 100's fee first.
+	assert.Equal(t, int64(3960), m.WithdrawOCFee(a, 160).Int64())
+	assert.Zero(t, m.Fee(a, 100).Sign())
+	assert.Zero(t, m.Past(a).Sign())
+	assert.Zero(t, m.TlOcFees.Sign())
+	assert.Zero(t, m.Balance.Sign())
+}
+
+func TestFeeModel_EdgeCases(t *testing.T) {
+	a := common.HexToAddress("0x0a")
+
+	// Integer division truncates: 999 * 20 / 1000 = 19.
+	m := NewFeeModel(big.NewInt(999), big.NewInt(0), 20, 100, 50)
+	assert.Equal(t, int64(19), m.Vote(a).Int64())
+
+	// A reward of P_DEN wei or less is not transferred.
+	_, reward, sent := m.Rwd(a, big.NewInt(900))
+	assert.Equal(t, int64(881), reward.Int64())
+	assert.False(t, sent)
+	assert.Equal(t, int64(999), m.Balance.Int64())
+
+	// Nothing is recorded when the balance is all reserved.
+	m = NewFeeModel(big.NewInt(500), big.NewInt(500), 20, 100, 50)
+	assert.Zero(t, m.Vote(a).Sign())
+
+	// The current epoch's fee is withdrawn only once the epoch is complete.
+	m = NewFeeModel(big.NewInt(100_000), big.NewInt(0), 20, 100, 50)
+	m.Vote(a)
+	assert.Zero(t, m.WithdrawOCFee(a, 150).Sign())
+	assert.Equal(t, int64(2000), m.Fee(a, 100).Int64())
+	assert.Equal(t, int64(2000), m.WithdrawOCFee(a, 151).Int64())
+	assert.Zero(t, m.TlOcFees.Sign())
+
+	// A balance short of the fees pays nothing but still clears them.
+	m = NewFeeModel(big.NewInt(100_000), big.NewInt(0), 20, 100, 50)
+	m.Vote(a)
+	m.Balance = big.NewInt(1000)
+	assert.Zero(t, m.WithdrawOCFee(a, 151).Sign())
+	assert.Zero(t, m.Fee(a, 100).Sign())
+	assert.Equal(t, int64(1000), m.Balance.Int64())
+}
+
+func TestForecastEpochFees(t *testing.T) {
+	me := common.HexToAddress("0x0c")
+	for _, tc := range []struct {
+		name           string
+		voted          bool
+		tlOcFees       int64
+		vote, rwd, pay int64
+	}{
+		// 2% of 100000, then 2% of the 98000 left, which is also the rwd amount.
+		{"not voted", false, 0, 2000, 1960, 96_040},
+		// The vote's 2000 is already reserved.
+		{"voted", true, 2000, 2000, 1960, 96_040},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			kt := &MockKtv2{}
+			client := &MockEthClient{}
+			kt.On("StartBlock", mock.Anything).Return(big.NewInt(100), nil)
+			kt.On("EpochInterval", mock.Anything).Return(uint16(50), nil)
+			kt.On("OcFee", mock.Anything).Return(uint16(20), nil)
+			kt.On("TlOcFees", mock.Anything).Return(big.NewInt(tc.tlOcFees), nil)
+			kt.On("OcFees", mock.Anything, me, big.NewInt(100)).Return(big.NewInt(2000), nil).Maybe()
+			client.On("BalanceAt", mock.Anything, mock.Anything, mock.Anything).Return(big.NewInt(100_000), nil)
+			cProps := &ConnectionProps{Kt: kt, Client: client, MyPubKey: me}
+
+			f, err := ForecastEpochFees(cProps, tc.voted)
+			require.NoError(t, err)
+			assert.Equal(t, tc.vote, f.VoteFee.Int64())
+			assert.Equal(t, tc.rwd, f.RwdFee.Int64())
+			assert.Equal(t, tc.pay, f.Reward.Int64())
+			assert.True(t, f.RwdSent)
+		})
+	}
+}
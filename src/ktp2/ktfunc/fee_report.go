@@ -0,0 +1,272 @@
+package ktfunc
+
+// OC fee income report. Accruals come from the fee ledger: one row per epoch
+// the OC voted or rewarded in, dated at its last action there. withdrawOCFee
+// emits no event, so withdrawals come from the withdrawal ledger the node
+// appends to on every -withdrawFees and automatic withdrawal, with their gas
+// cost taken from the receipt. A withdrawal made outside this node is not
+// in it.
+//
+// The running balance follows the contract: a withdrawal pays out every
+// epoch accrued before it except the one still running, whose fee stays in
+// ocFees until its epoch is complete.
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	log "github.com/sirupsen/logrus"
+)
+
+// FeeReportRow is an accrual or a withdrawal. Amounts are wei.
+type FeeReportRow struct {
+	Kind  string    `json:"kind"` // "accrual" or "withdrawal"
+	Block uint64    `json:"block"`
+	Time  time.Time `json:"time"` // the block's timestamp; zero if the header was unavailable
+	// Accrual: the epoch and the fee the OC earned in it. Fee is empty when
+	// the fee ledger never saw the epoch as the OC's last.
+	Epoch    uint64 `json:"epoch,omitempty"`
+	Voted    bool   `json:"voted,omitempty"`
+	Rewarded bool   `json:"rewarded,omitempty"`
+	Fee      string `json:"fee,omitempty"`
+	// Withdrawal: the tx, the OC's balance change net of gas, and the gas.
+	TxHash   string `json:"txHash,omitempty"`
+	Received string `json:"received,omitempty"`
+	GasCost  string `json:"gasCost,omitempty"`
+	// Owed is what the OC is owed after this row: fees accrued and not yet
+	// withdrawn, whether already in pastOcFees or still in ocFees.
+	Owed string `json:"owed"`
+}
+
+// FeeReport is the OC fee income of OC for rows in blocks [From, To].
+type FeeReport struct {
+	OC          string         `json:"oc"`
+	From        uint64         `json:"from"`
+	To          uint64         `json:"to"`
+	OpeningOwed string         `json:"openingOwed"`
+	Rows        []FeeReportRow `json:"rows"`
+	Accrued     string         `json:"accrued"`
+	Received    string         `json:"received"`
+	GasCost     string         `json:"gasCost"`
+	ClosingOwed string         `json:"closingOwed"`
+	// PastOcFees is the contract's pastOcFees for the OC now, to reconcile
+	// the running balance against.
+	PastOcFees       string `json:"pastOcFees"`
+	UnknownFees      int    `json:"unknownFees,omitempty"` // accruals with no Fee, left out of the balances
+	WithdrawalLedger string `json:"withdrawalLedger"`
+}
+
+// BuildFeeReport reports oc's fee accruals and withdrawals in blocks
+// [from, to]. The running balance is carried from the OC's first accrual,
+// so OpeningOwed is what it was owed going into the range.
+func BuildFeeReport(cProps *ConnectionProps, oc common.Address, from, to uint64) (*FeeReport, error) {
+	store, release, err := openEventStore(cProps)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := feeLedgerEntries(cProps, store, oc, 0, math.MaxUint64)
+	release()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fee ledger: %w", err)
+	}
+	ledger := cProps.ResolvedWithdrawalLedger()
+	withdrawals, err := ReadFeeWithdrawals(ledger)
+	if err != nil {
+		return nil, err
+	}
+	opts := &bind.CallOpts{Context: context.Background()}
+	interval, err := cProps.Kt.EpochInterval(opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get epoch interval: %w", err)
+	}
+	pastOcFees, err := cProps.Kt.PastOcFees(opts, oc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query pastOcFees: %w", err)
+	}
+
+	type event struct {
+		row FeeReportRow
+		fee *big.Int // an accrual's, nil when unknown
+	}
+	var events []event
+	for _, e := range entries {
+		row := FeeReportRow{Kind: "accrual", Block: e.LastBlock, Epoch: e.Epoch, Voted: e.Voted, Rewarded: e.Rewarded}
+		if e.Fee != nil {
+			row.Fee = e.Fee.String()
+		}
+		events = append(events, event{row: row, fee: e.Fee})
+	}
+	for _, w := range withdrawals {
+		if common.HexToAddress(w.OC) != oc {
+			continue
+		}
+		events = append(events, event{row: FeeReportRow{Kind: "withdrawal", Block: w.Block, TxHash: w.TxHash, Received: w.Received, GasCost: w.GasCost}})
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		if events[i].row.Block != events[j].row.Block {
+			return events[i].row.Block < events[j].row.Block
+		}
+		return events[i].row.Kind == "accrual" && events[j].row.Kind != "accrual"
+	})
+
+	report := &FeeReport{OC: oc.Hex(), From: from, To: to, Rows: []FeeReportRow{}, PastOcFees: pastOcFees.String(), WithdrawalLedger: ledger}
+	pending := make(map[uint64]*big.Int) // accrued, not yet withdrawn, by epoch
+	owed := func() *big.Int {
+		sum := new(big.Int)
+		for _, f := range pending {
+			sum.Add(sum, f)
+		}
+		return sum
+	}
+	accrued, received, gas := new(big.Int), new(big.Int), new(big.Int)
+	var opening *big.Int
+	for _, ev := range events {
+		if ev.row.Block > to {
+			break
+		}
+		row := ev.row
+		if row.Block >= from && opening == nil {
+			opening = owed()
+		}
+		if row.Kind == "accrual" {
+			if ev.fee != nil {
+				pending[row.Epoch] = ev.fee
+			}
+		} else {
+			for epoch := range pending {
+				if row.Block > epoch+uint64(interval) {
+					delete(pending, epoch)
+				}
+			}
+		}
+		if row.Block < from {
+			continue
+		}
+		row.Owed = owed().String()
+		row.Time = blockTime(cProps, row.Block)
+		switch row.Kind {
+		case "accrual":
+			if ev.fee == nil {
+				report.UnknownFees++
+			} else {
+				accrued.Add(accrued, ev.fee)
+			}
+		case "withdrawal":
+			if cost := receiptGasCost(cProps, row.TxHash); cost != nil {
+				row.GasCost = cost.String()
+			}
+			addDecimal(received, row.Received)
+			addDecimal(gas, row.GasCost)
+		}
+		report.Rows = append(report.Rows, row)
+	}
+	closing := owed()
+	if opening == nil {
+		opening = closing
+	}
+	report.OpeningOwed = opening.String()
+	report.Accrued, report.Received, report.GasCost = accrued.String(), received.String(), gas.String()
+	report.ClosingOwed = closing.String()
+	return report, nil
+}
+
+// blockTime returns the timestamp of block, or the zero time if its header
+// can't be read.
+func blockTime(cProps *ConnectionProps, block uint64) time.Time {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	hdr, err := cProps.Client.HeaderByNumber(ctx, new(big.Int).SetUint64(block))
+	if err != nil || hdr == nil {
+		log.Debugf("Could not read the timestamp of block %d: %v", block, err)
+		return time.Time{}
+	}
+	return time.Unix(int64(hdr.Time), 0).UTC()
+}
+
+// receiptGasCost returns the gas tx actually paid for, or nil if its
+// receipt can't be read.
+func receiptGasCost(cProps *ConnectionProps, txHash string) *big.Int {
+	receipt, err := cProps.Client.TransactionReceipt(context.Background(), common.HexToHash(txHash))
+	if err != nil || receipt == nil || receipt.EffectiveGasPrice == nil {
+		log.Debugf("Could not read the receipt of %s, using the recorded gas cost: %v", txHash, err)
+		return nil
+	}
+	return new(big.Int).Mul(receipt.EffectiveGasPrice, new(big.Int).SetUint64(receipt.GasUsed))
+}
+
+func addDecimal(sum *big.Int, s string) {
+	if v, ok := new(big.Int).SetString(s, 10); ok {
+		sum.Add(sum, v)
+	}
+}
+
+// WriteFeeReport writes the report as a table with totals, as JSON, or as
+// CSV with one row per accrual or withdrawal.
+func WriteFeeReport(w io.Writer, report *FeeReport, format OutputFormat) error {
+	switch format {
+	case FormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	case FormatCSV:
+		cw := csv.NewWriter(w)
+		rows := [][]string{{"kind", "block", "time", "epoch", "voted", "rewarded", "fee", "tx_hash", "received", "gas_cost", "owed"}}
+		for _, r := range report.Rows {
+			rows = append(rows, []string{
+				r.Kind, strconv.FormatUint(r.Block, 10), formatRowTime(r.Time), strconv.FormatUint(r.Epoch, 10),
+				strconv.FormatBool(r.Voted), strconv.FormatBool(r.Rewarded), r.Fee, r.TxHash, r.Received, r.GasCost, r.Owed,
+			})
+		}
+		if err := cw.WriteAll(rows); err != nil {
+			return err
+		}
+		return cw.Error()
+	}
+
+	eth := func(s string) string {
+		v, ok := new(big.Int).SetString(s, 10)
+		if !ok {
+			return "-"
+		}
+		return weiToEthString(v)
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "OC fee income of %s in blocks %d-%d (ETH)\n", report.OC, report.From, report.To)
+	fmt.Fprintf(tw, "Opening balance owed: %s\n", eth(report.OpeningOwed))
+	if len(report.Rows) > 0 {
+		fmt.Fprintln(tw, "Block\tTime\tEntry\tAccrued\tReceived\tGas\tOwed")
+		for _, r := range report.Rows {
+			if r.Kind == "accrual" {
+				fmt.Fprintf(tw, "%d\t%s\tepoch %d\t%s\t\t\t%s\n", r.Block, formatRowTime(r.Time), r.Epoch, eth(r.Fee), eth(r.Owed))
+			} else {
+				fmt.Fprintf(tw, "%d\t%s\twithdrawal %s\t\t%s\t%s\t%s\n", r.Block, formatRowTime(r.Time), r.TxHash, eth(r.Received), eth(r.GasCost), eth(r.Owed))
+			}
+		}
+	}
+	fmt.Fprintf(tw, "Accrued: %s | Received: %s | Gas: %s | Closing balance owed: %s\n",
+		eth(report.Accrued), eth(report.Received), eth(report.GasCost), eth(report.ClosingOwed))
+	fmt.Fprintf(tw, "pastOcFees now: %s (excludes the running epoch's fee)\n", eth(report.PastOcFees))
+	if report.UnknownFees > 0 {
+		fmt.Fprintf(tw, "%d epoch fee(s) unknown (no node state at the OC's last action) and left out of the balances\n", report.UnknownFees)
+	}
+	fmt.Fprintf(tw, "Withdrawals are those recorded in %s\n", report.WithdrawalLedger)
+	return tw.Flush()
+}
+
+func formatRowTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
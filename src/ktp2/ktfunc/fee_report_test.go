@@ -0,0 +1,78 @@
+package ktfunc
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"math/big"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildFeeReport(t *testing.T) {
+	logrus.SetLevel(logrus.FatalLevel)
+	defer logrus.SetLevel(logrus.InfoLevel)
+
+	_, ocX := signedTxFromKey(t, testKeyX, big.NewInt(1337))
+	base := &epochFakeKt{ledgerFakeKt: &ledgerFakeKt{}, start: 400, interval: 100}
+	kt := mockKtHistory(base)
+	kt.On("PastOcFees", mock.Anything, ocX).Return(big.NewInt(0), nil)
+	cProps := newOddsTestProps(t, base, 500)
+	cProps.Kt = kt
+	// The ledger read each fee while its epoch was the OC's last.
+	require.NoError(t, cProps.Store.UpdateFeeLedger(ocX, FeeLedgerTip{CacheTip: CacheTip{Block: 500 - reorgSafetyDepth}, LastEpoch: 300}, []FeeLedgerEntry{
+		{Epoch: 100, Voted: true, LastBlock: 210, Fee: big.NewInt(3)},
+		{Epoch: 200, Voted: true, LastBlock: 310, Fee: big.NewInt(5)},
+		{Epoch: 300, Voted: true, LastBlock: 405, Fee: big.NewInt(2)},
+	}))
+	cProps.WithdrawalLedger = filepath.Join(t.TempDir(), DefaultWithdrawalLedger)
+	client := cProps.Client.(*MockEthClient)
+
+	// The first withdrawal pays out epoch 100 only; the second, in epoch
+	// 200's voting window, pays out epoch 200.
+	first, second := common.HexToHash("0x01"), common.HexToHash("0x02")
+	for _, w := range []*FeeWithdrawal{
+		{OC: ocX.Hex(), Block: 250, TxHash: first.Hex(), Owed: "3", Received: "2", GasCost: "9"},
+		{OC: common.HexToAddress("0x0b").Hex(), Block: 260, TxHash: "0x03", Received: "100"},
+		{OC: ocX.Hex(), Block: 380, TxHash: second.Hex(), Owed: "5", Received: "4", GasCost: "1"},
+	} {
+		require.NoError(t, appendFeeWithdrawal(cProps.WithdrawalLedger, w))
+	}
+	client.On("TransactionReceipt", mock.Anything, first).Return(&types.Receipt{GasUsed: 1, EffectiveGasPrice: big.NewInt(1)}, nil)
+	client.On("TransactionReceipt", mock.Anything, second).Return((*types.Receipt)(nil), errors.New("not found"))
+
+	report, err := BuildFeeReport(cProps, ocX, 240, 1000)
+	require.NoError(t, err)
+	assert.Equal(t, "3", report.OpeningOwed)
+	type row struct {
+		kind  string
+		block uint64
+		owed  string
+	}
+	var got []row
+	for _, r := range report.Rows {
+		got = append(got, row{r.Kind, r.Block, r.Owed})
+	}
+	assert.Equal(t, []row{{"withdrawal", 250, "0"}, {"accrual", 310, "5"}, {"withdrawal", 380, "0"}, {"accrual", 405, "2"}}, got)
+	assert.Equal(t, "1", report.Rows[0].GasCost, "gas comes from the receipt")
+	assert.Equal(t, "1", report.Rows[2].GasCost, "and from the ledger without one")
+	assert.Equal(t, "7", report.Accrued)
+	assert.Equal(t, "6", report.Received)
+	assert.Equal(t, "2", report.GasCost)
+	assert.Equal(t, "2", report.ClosingOwed)
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteFeeReport(&buf, report, FormatCSV))
+	records, err := csv.NewReader(&buf).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, records, 5)
+	assert.Equal(t, []string{"accrual", "310"}, records[2][:2])
+	kt.AssertExpectations(t)
+}
@@ -5,6 +5,7 @@ import (
 	"context"
 	"encoding/binary"
 	"encoding/gob"
+	"errors"
 	"fmt"
 	"math"
 	"math/big"
@@ -35,10 +36,22 @@ type WithdrawEvent struct {
 	Block  uint64
 }
 
+// GaveEvent represents a give() donation. Amount is the ETH passed on to
+// the donation address, not msg.value.
+type GaveEvent struct {
+	Addr   common.Address
+	Amount *big.Int
+	Block  uint64
+}
+
 // ChunkEvents holds events for block chunk
 type ChunkEvents struct {
 	StakeEvents    []StakeEvent
 	WithdrawEvents []WithdrawEvent
+	GaveEvents     []GaveEvent
+	// GaveMissing marks a chunk cached before Gave events were (schema v3).
+	// loadEventRange fetches its Gave events the first time it is read.
+	GaveMissing bool
 }
 
 // Define as a variable holding a function
@@ -100,27 +113,55 @@ func VoteAndReward(cProps *ConnectionProps) error {
 		log.Warnf("Failed to print end epoch balance: %v", err)
 	}
 
+	totalMin, stakeDataMinsMap, err := epochLotteryStakes(cProps, startBlock, endBlock)
+	if err != nil {
+		return err
+	}
+	if totalMin.Cmp(big.NewInt(0)) == 0 {
+		log.Warn("No valid stakes detected - will vote for dead address.")
+	}
+
+	// Vote and potentially reward the winner
+	winner, err := calculateVoteAndReward(stakeDataMinsMap, startBlock, endBlock, cProps, totalMin)
+	if err != nil {
+		log.Errorf("Failed to vote and reward: %v", err)
+		return fmt.Errorf("failed to vote and reward: %w", err)
+	}
+
+	if winner != (common.Address{}) {
+		log.Debugf("Winner determined: %s", winner.Hex())
+	} else {
+		log.Warn("No winner determined")
+	}
+	return nil
+}
+
+// epochLotteryStakes gathers the stakes of [startBlock, endBlock] and returns
+// the set the lottery draws from: every eligible address's minimum stake over
+// the epoch, declines filtered out and probabilities set, and their total.
+func epochLotteryStakes(cProps *ConnectionProps, startBlock, endBlock *big.Int) (*big.Int, map[common.Address]*UserStakeData, error) {
 	// Get contract creation block
 	creationBlockUint64, err := GetContractCreationBlock(cProps)
 	if err != nil {
 		log.Errorf("Failed to get contract creation block: %v", err)
-		return fmt.Errorf("failed to get contract creation block: %w", err)
+		return nil, nil, fmt.Errorf("failed to get contract creation block: %w", err)
 	}
 	creationBlock := new(big.Int).SetUint64(creationBlockUint64)
-	log.Infof("Gathering stakes from creation block %d to end block %d", creationBlock.Uint64(), endBlock.Uint64())
+	log.Infof("Gathering stakes for epoch %d to %d (creation block %d)", startBlock.Uint64(), endBlock.Uint64(), creationBlock.Uint64())
 
-	// Gather stake and withdrawal events
-	stakeDataMap, err := GatherStakesAndWithdraws(cProps, cProps.Kt, creationBlock, endBlock)
+	// Gather the epoch's stake data from the stake ledger snapshot plus the
+	// epoch's own events
+	stakeDataMap, err := GatherEpochStakes(cProps, cProps.Kt, creationBlock, startBlock, endBlock)
 	if err != nil {
 		log.Errorf("Failed to gather stakes and withdraws: %v", err)
-		return fmt.Errorf("failed to gather stakes: %w", err)
+		return nil, nil, fmt.Errorf("failed to gather stakes: %w", err)
 	}
 
 	// Calculate minimum stakes over the block range
 	totalMin, stakeDataMinsMap, err := findMinOverBlockRange(startBlock.Uint64(), endBlock.Uint64(), stakeDataMap)
 	if err != nil {
 		log.Errorf("Failed to find minimum stakes: %v", err)
-		return fmt.Errorf("failed to find minimum stakes: %w", err)
+		return nil, nil, fmt.Errorf("failed to find minimum stakes: %w", err)
 	}
 	if totalMin.Cmp(big.NewInt(0)) == 0 {
 		log.Warn("No valid stakes found after minimum calculation.")
@@ -132,7 +173,7 @@ func VoteAndReward(cProps *ConnectionProps) error {
 	// Filter out declined stakers
 	if err := filterDeclinedStakers(stakeDataMinsMap, cProps); err != nil {
 		log.Errorf("Failed to filter declined stakers: %v", err)
-		return fmt.Errorf("failed to filter declined stakers: %w", err)
+		return nil, nil, fmt.Errorf("failed to filter declined stakers: %w", err)
 	}
 
 	// Recalculate totalMin after filtering
@@ -143,23 +184,7 @@ func VoteAndReward(cProps *ConnectionProps) error {
 
 	// Calculate probabilities for each wallet
 	calculateProbsForEachWallet(stakeDataMinsMap, totalMin)
-	if totalMin.Cmp(big.NewInt(0)) == 0 {
-		log.Warn("No valid stakes detected - will vote for dead address.")
-	}
-
-	// Vote and potentially reward the winner
-	winner, err := calculateVoteAndReward(stakeDataMinsMap, startBlock, endBlock, cProps, totalMin)
-	if err != nil {
-		log.Errorf("Failed to vote and reward: %v", err)
-		return fmt.Errorf("failed to vote and reward: %w", err)
-	}
-
-	if winner != (common.Address{}) {
-		log.Debugf("Winner determined: %s", winner.Hex())
-	} else {
-		log.Warn("No winner determined")
-	}
-	return nil
+	return totalMin, stakeDataMinsMap, nil
 }
 
 func calculateVoteAndReward(
@@ -184,64 +209,36 @@ func calculateVoteAndReward(
 		return common.Address{}, fmt.Errorf("epoch start or end block is nil")
 	}
 
-	// The lottery seed is sampled from a FIXED block past the epoch end:
-	// seedBlock = endBlock + SeedOffset. SeedOffset is a constant identical
-	// across every operator, so two nodes always seed from the same block and
-	// agree on the winner. The seed location must never depend on per-operator
-	// config.
-	//
-	// confirmationDepth is a separate, operator-tunable knob that ONLY delays
-	// submission: the node waits until the seed block is buried under that many
-	// further blocks before reading its hash, so a late reorg can't change the
-	// seed out from under a vote already in flight. A larger depth means more
-	// reorg safety and more latency, but never a different winner.
-	confirmationDepth := cProps.ConfirmationDepth
-	if confirmationDepth == 0 {
-		confirmationDepth = DefaultConfirmationDepth
-	}
-	seedBlockNumber := new(big.Int).Add(endEpochBlockNumber, new(big.Int).SetUint64(SeedOffset))
-	requiredBlockNumber := new(big.Int).Add(seedBlockNumber, new(big.Int).SetUint64(confirmationDepth))
-	log.Printf("Epoch start block: %d, seed block (endBlock+%d): %d, voting once block %d is reached",
-		epochStartBlock.Uint64(), SeedOffset, seedBlockNumber.Uint64(), requiredBlockNumber.Uint64())
-
-	// Wait until the chain has reached requiredBlockNumber, i.e. the seed block
-	// is buried under confirmationDepth confirmations.
-	var err error
+	// Wait until the seed block is buried under confirmationDepth
+	// confirmations; see confirmedSeed.
+	var seedBlockNumber uint64
+	var seedHash common.Hash
 	for {
-		var hdr *types.Header
-		hdr, err = cProps.Client.HeaderByNumber(context.Background(), requiredBlockNumber)
-		if err == nil && hdr != nil {
+		var err error
+		seedBlockNumber, seedHash, err = confirmedSeed(cProps, endEpochBlockNumber)
+		if err == nil {
 			break
 		}
-		if err != nil && !strings.Contains(err.Error(), "not found") {
-			log.Errorf("Failed to get confirmation block %d: %v", requiredBlockNumber.Uint64(), err)
-			return common.Address{}, fmt.Errorf("failed to get confirmation block: %w", err)
+		if !errors.Is(err, errSeedNotConfirmed) {
+			log.Errorf("Failed to read the seed: %v", err)
+			return common.Address{}, err
 		}
-		log.Infof("Block %d not available yet, waiting...", requiredBlockNumber.Uint64())
+		log.Infof("%v, waiting...", err)
 		time.Sleep(1 * time.Second) // Adjust sleep duration as needed, e.g., based on chain block time
 	}
-
-	// Read the (now settled) seed block's hash. This is the lottery seed.
-	seedBlock, err := cProps.Client.HeaderByNumber(context.Background(), seedBlockNumber)
-	if err != nil || seedBlock == nil {
-		log.Errorf("Failed to get seed block %d: %v", seedBlockNumber.Uint64(), err)
-		return common.Address{}, fmt.Errorf("failed to get seed block: %w", err)
-	}
-	seedHash := seedBlock.Hash()
-	log.Infof("Seed block: %d", seedBlock.Number)
+	log.Infof("Epoch start block: %d, seed block: %d", epochStartBlock.Uint64(), seedBlockNumber)
 
 	// Calculate winning wallet
 	if totalMin.Cmp(big.NewInt(0)) == 0 {
 		log.Debug("Total minimum stake is zero - Will select dead address as winner.")
 	}
 
-	winner, err := calcWinningWallet(stakeDataMinsMap, seedHash)
+	winner, voteData, err := drawLotteryWinner(stakeDataMinsMap, seedBlockNumber, seedHash)
 	if err != nil {
 		log.Errorf("Failed to calculate winning wallet: %v", err)
-		return common.Address{}, fmt.Errorf("failed to calculate winning wallet: %w", err)
+		return common.Address{}, err
 	}
 	if winner == (common.Address{}) {
-		winner = common.Address{}
 		log.Warn("No winner determined - Falling back to dead address")
 	}
 	if totalMin.Cmp(big.NewInt(0)) == 0 {
@@ -250,12 +247,19 @@ func calculateVoteAndReward(
 		log.Infof("Winner selected: %s", winner.Hex())
 	}
 
-	// Vote for the winner
-	if err := vote(cProps, winner, seedHash.String()); err != nil {
+	// Vote for the winner. The data string records how the winner was	// Vote for the winner. The data string records how the winner was
+	// chosen (see vote_data.go) so a disagreement can be traced later.
+	if err := vote(cProps, winner, voteData); err != nil {
 		log.Warnf("Failed to vote for %s: %v", winner.Hex(), err)
 		// Continue despite voting failure
 	}
 
+	// Compare with the peers' votes so a split surfaces now rather than
+	// when someone notices the epoch never paid out.
+	if _, err := reportDivergence(cProps, epochStartBlock, endEpochBlockNumber, winner, voteData, stakeDataMinsMap, totalMin); err != nil {
+		log.Warnf("Failed to check peer votes for divergence: %v", err)
+	}
+
 	// Get vote count and required votes
 	voteCount, voteRequired, err := getVoteCountAndRequired(cProps, epochStartBlock, winner)
 	if err != nil {
@@ -276,6 +280,61 @@ func calculateVoteAndReward(
 	return winner, nil
 }
 
+// errSeedNotConfirmed means the seed block isn't yet buried under the
+// operator's confirmation depth.
+var errSeedNotConfirmed = errors.New("seed block not yet confirmed")
+
+// confirmedSeed returns the lottery seed of the epoch ending at endBlock once
+// it is safe to vote on: the seed block number and hash, or
+// errSeedNotConfirmed while the chain hasn't reached the required depth.
+//
+// The lottery seed is sampled from a FIXED block past the epoch end:
+// seedBlock = endBlock + SeedOffset. SeedOffset is a constant identical
+// across every operator, so two nodes always seed from the same block and
+// agree on the winner. The seed location must never depend on per-operator
+// config.
+//
+// confirmationDepth is a separate, operator-tunable knob that ONLY delays
+// submission: the node waits until the seed block is buried under that many
+// further blocks before reading its hash, so a late reorg can't change the
+// seed out from under a vote already in flight. A larger depth means more
+// reorg safety and more latency, but never a different winner.
+func confirmedSeed(cProps *ConnectionProps, endBlock *big.Int) (uint64, common.Hash, error) {
+	confirmationDepth := cProps.ConfirmationDepth
+	if confirmationDepth == 0 {
+		confirmationDepth = DefaultConfirmationDepth
+	}
+	seedBlockNumber := new(big.Int).Add(endBlock, new(big.Int).SetUint64(SeedOffset))
+	requiredBlockNumber := new(big.Int).Add(seedBlockNumber, new(big.Int).SetUint64(confirmationDepth))
+
+	hdr, err := cProps.Client.HeaderByNumber(context.Background(), requiredBlockNumber)
+	if err != nil && !strings.Contains(err.Error(), "not found") {
+		return 0, common.Hash{}, fmt.Errorf("failed to get confirmation block: %w", err)
+	}
+	if err != nil || hdr == nil {
+		return 0, common.Hash{}, fmt.Errorf("%w: block %d (seed block %d + %d confirmations) not available yet",
+			errSeedNotConfirmed, requiredBlockNumber.Uint64(), seedBlockNumber.Uint64(), confirmationDepth)
+	}
+
+	// Read the (now settled) seed block's hash. This is the lottery seed.
+	seedBlock, err := cProps.Client.HeaderByNumber(context.Background(), seedBlockNumber)
+	if err != nil || seedBlock == nil {
+		return 0, common.Hash{}, fmt.Errorf("failed to get seed block %d: %v", seedBlockNumber.Uint64(), err)
+	}
+	return seedBlockNumber.Uint64(), seedBlock.Hash(), nil
+}
+
+// drawLotteryWinner draws the winner from the stake set mins with the seed
+// read by confirmedSeed, and returns it with the data string the vote
+// carries. An empty stake set draws the zero (dead) address.
+func drawLotteryWinner(mins map[common.Address]*UserStakeData, seedBlock uint64, seedHash common.Hash) (common.Address, string, error) {
+	winner, err := calcWinningWallet(mins, seedHash)
+	if err != nil {
+		return common.Address{}, "", fmt.Errorf("failed to calculate winning wallet: %w", err)
+	}
+	return winner, FormatVoteData(ConsensusAlgorithmVersion, seedBlock, seedHash, StakeSetDigest(mins)), nil
+}
+
 // printEndEpochKtEthBalance logs the KT contract's ETH balance at the specified end epoch block.
 func printEndEpochKtEthBalance(cProps *ConnectionProps, endBlock *big.Int) error {
 	log.Debugf("Printing end epoch balance")
@@ -369,10 +428,7 @@ func defaultCalculateWinningWallet(
 		return common.Address{}, nil // Return zero as dead
 	}
 
-	// Convert block hash to a float between 0 and 1
-	randInt := new(big.Int).SetBytes(randomNumber[:])
-	denominator := new(big.Int).Exp(big.NewInt(2), big.NewInt(256), nil)
-	randFloat := new(big.Float).Quo(new(big.Float).SetInt(randInt), new(big.Float).SetInt(denominator))
+	randFloat := seedFraction(randomNumber)
 	randValue, _ := randFloat.Float64()
 	log.Infof("Random value from hash: %.6f", randValue)
 
@@ -421,6 +477,14 @@ func defaultCalculateWinningWallet(
 	return common.Address{}, nil
 }
 
+// seedFraction maps a block hash to the lottery's random value in [0, 1):
+// the hash read as a 256-bit integer over 2^256.
+func seedFraction(hash common.Hash) *big.Float {
+	randInt := new(big.Int).SetBytes(hash[:])
+	denominator := new(big.Int).Exp(big.NewInt(2), big.NewInt(256), nil)
+	return new(big.Float).Quo(new(big.Float).SetInt(randInt), new(big.Float).SetInt(denominator))
+}
+
 func filterDeclinedStakers(stakeDataMinsMap map[common.Address]*UserStakeData, cProps *ConnectionProps) error {
 	if cProps.DeclinesCache == nil {
 		cProps.DeclinesCache = make(map[common.Address]bool)
@@ -891,177 +955,117 @@ func realGatherStakesAndWithdraws(cProps *ConnectionProps, kt Ktv2Interface, sta
 		log.Errorf("Start block %d exceeds end block %d", startBlock.Uint64(), endBlock.Uint64())
 		return nil, fmt.Errorf("start block %d exceeds end block %d", startBlock.Uint64(), endBlock.Uint64())
 	}
-	// Ensure cache directory exists
-	cacheDir := cProps.ResolvedCacheDir()
-	if err := os.MkdirAll(cacheDir, 0755); err != nil {
-		log.Errorf("Failed to create cache directory: %v", err)
-		return nil, fmt.Errorf("failed to create cache directory: %w", err)
+	store, release, err := openEventStore(cProps)
+	if err != nil {
+		return nil, err
 	}
+	defer release()
 
-	// Construct database file name using first 7 characters of contract address
-	dbName := fmt.Sprintf("%s/%s.db", cacheDir, cProps.KtAddr.Hex()[:7])
+	startU := startBlock.Uint64()
+	endU := endBlock.Uint64()
 
-	// Open DB
-	db, err := bbolt.Open(dbName, 0600, nil)
+	tip, err := reconcileCacheTip(cProps, store)
 	if err != nil {
-		log.Errorf("Failed to open database %s: %v", dbName, err)
-		return nil, fmt.Errorf("failed to open database: %w", err)
-	}
-	defer db.Close()
-	// Buckets:
-	//   chunks: key = 8-byte BE chunkStart, value = gob ChunkEvents
-	//   meta keys:
-	//     "tip"            = 8-byte BE highest contiguously-processed block
-	//     "schema_version" = 4-byte BE uint32; if absent or older than
-	//                        cacheSchemaVersion, both buckets are wiped on
-	//                        open so the node self-heals across upgrades.
-	// Chunk endings are NOT in the key. A chunk for chunkStart contains all
-	// events from [chunkStart, min(chunkStart+chunkSize-1, tip)]. When a new
-	// call extends past the prior tip into the chunk, we fetch only the
-	// uncovered tail and merge it into the existing chunk.
-	if err := migrateOrInitCacheSchema(db); err != nil {
-		log.Errorf("Failed to init/migrate cache schema: %v", err)
-		return nil, fmt.Errorf("failed to init/migrate cache schema: %w", err)
+		return nil, err
 	}
-	chunkSize := uint64(cProps.ChunkSize)
-	if chunkSize == 0 {
-		chunkSize = uint64(DefaultChunkSize)
+	events, err := loadEventRange(cProps, kt, store, tip, startU, endU)
+	if err != nil {
+		return nil, err
+	}
+	stakeDataMap := buildStakeDataMap(events.StakeEvents, events.WithdrawEvents)
+	log.Infof("Total addresses with events: %d", len(stakeDataMap))
+	if len(stakeDataMap) == 0 {
+		log.Warn("No events found in range - debugging with raw logs")
+		debugRawLogs(cProps, startU, endU)
 	}
+	return stakeDataMap, nil
+}
 
-	startU := startBlock.Uint64()
-	endU := endBlock.Uint64()
+// reconcileCacheTip reads the cached tip and, if a tip hash was recorded,
+// confirms the canonical chain still has that hash at that block. A mismatch
+// indicates a reorg dropped or rewrote the cached events, so the chunks and
+// everything derived from them (the stake ledger) are wiped and the returned
+// tip is 0. Returns the tip the caller should resume from.
+func reconcileCacheTip(cProps *ConnectionProps, store EventStore) (uint64, error) {
+	// tip.Hash drives the reorg check below.
+	tip, err := store.Tip()
+	if err != nil {
+		log.Errorf("Failed to read cache tip: %v", err)
+		return 0, fmt.Errorf("failed to read cache tip: %w", err)
+	}
+	log.Debugf("Cache tip on entry: %d (tipHash present: %v)", tip.Block, tip.HasHash)
 
-	// Read tip + tipHash. tipHash drives the reorg check below.
-	var tip uint64
-	var tipHash common.Hash
-	var hasTipHash bool
-	_ = db.View(func(tx *bbolt.Tx) error {
-		if b := tx.Bucket([]byte("meta")); b != nil {
-			if v := b.Get([]byte("tip")); len(v) == 8 {
-				tip = binary.BigEndian.Uint64(v)
-			}
-			if v := b.Get([]byte("tip_hash")); len(v) == common.HashLength {
-				copy(tipHash[:], v)
-				hasTipHash = true
-			}
-		}
-		return nil
-	})
-	log.Debugf("Cache tip on entry: %d (tipHash present: %v)", tip, hasTipHash)
+	if tip.Block == 0 || !tip.HasHash {
+		return tip.Block, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	current, hdrErr := cProps.Client.HeaderByNumber(ctx, new(big.Int).SetUint64(tip.Block))
+	cancel()
+	if hdrErr != nil {
+		log.Warnf("Reorg check skipped (HeaderByNumber(%d) failed): %v", tip.Block, hdrErr)
+		return tip.Block, nil
+	}
+	if current == nil || current.Hash() == tip.Hash {
+		return tip.Block, nil
+	}
+	log.Warnf("Reorg detected at cache tip %d: cached=%s, on-chain=%s. Wiping chunks and rebuilding.",
+		tip.Block, tip.Hash.Hex(), current.Hash().Hex())
+	if wErr := store.ResetChunks(); wErr != nil {
+		log.Errorf("Failed to wipe cache after reorg: %v", wErr)
+		return 0, fmt.Errorf("failed to wipe cache after reorg: %w", wErr)
+	}
+	return 0, nil
+}
 
-	// Reorg detector. If we have a tip and a recorded tipHash, confirm the
-	// canonical chain still has that hash at that block. A mismatch indicates
-	// a reorg dropped or rewrote the cached events; wipe the chunks bucket
-	// and start over.
-	if tip > 0 && hasTipHash {
+// setCacheTip moves the cache tip to newTip. The tip's block hash is recorded
+// so a future call can detect a reorg, but ONLY once the block is buried
+// under reorgSafetyDepth confirmations. Recording the hash of a near-head
+// block invites false-positive reorg wipes: recent blocks still reorg under
+// PoS and can read inconsistently across load-balanced RPC backends, which
+// would wipe the whole cache and re-fetch every chunk. When the tip is too
+// near head we store its number but no hash, and clear any previously stored
+// hash so the tip pointer and tip_hash can never refer to different blocks.
+func setCacheTip(cProps *ConnectionProps, store EventStore, newTip uint64) error {
+	var newTipHash common.Hash
+	hashCaptured := false
+	head, headErr := cProps.Client.BlockNumber(context.Background())
+	switch {
+	case headErr != nil:
+		log.Debugf("Could not read head to gauge tip burial for block %d: %v", newTip, headErr)
+	case head >= reorgSafetyDepth && newTip <= head-reorgSafetyDepth:
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		current, hdrErr := cProps.Client.HeaderByNumber(ctx, new(big.Int).SetUint64(tip))
+		hdr, hErr := cProps.Client.HeaderByNumber(ctx, new(big.Int).SetUint64(newTip))
 		cancel()
-		if hdrErr != nil {
-			log.Warnf("Reorg check skipped (HeaderByNumber(%d) failed): %v", tip, hdrErr)
-		} else if current != nil && current.Hash() != tipHash {
-			log.Warnf("Reorg detected at cache tip %d: cached=%s, on-chain=%s. Wiping chunks and rebuilding.",
-				tip, tipHash.Hex(), current.Hash().Hex())
-			if wErr := db.Update(func(tx *bbolt.Tx) error {
-				if err := tx.DeleteBucket([]byte("chunks")); err != nil && err != bbolt.ErrBucketNotFound {
-					return err
-				}
-				if _, err := tx.CreateBucket([]byte("chunks")); err != nil {
-					return err
-				}
-				b := tx.Bucket([]byte("meta"))
-				if b != nil {
-					_ = b.Delete([]byte("tip"))
-					_ = b.Delete([]byte("tip_hash"))
-				}
-				return nil
-			}); wErr != nil {
-				log.Errorf("Failed to wipe cache after reorg: %v", wErr)
-				return nil, fmt.Errorf("failed to wipe cache after reorg: %w", wErr)
-			}
-			tip = 0
-			hasTipHash = false
+		if hErr == nil && hdr != nil {
+			newTipHash = hdr.Hash()
+			hashCaptured = true
+		} else if hErr != nil {
+			log.Debugf("Could not capture tipHash for block %d: %v", newTip, hErr)
 		}
+	default:
+		log.Debugf("Tip %d within %d blocks of head %d; not recording tip hash yet", newTip, reorgSafetyDepth, head)
 	}
+	return store.SetTip(CacheTip{Block: newTip, Hash: newTipHash, HasHash: hashCaptured})
+}
 
-	chunkKey := func(chunkStart uint64) []byte {
-		k := make([]byte, 8)
-		binary.BigEndian.PutUint64(k, chunkStart)
-		return k
-	}
-	loadChunk := func(chunkStart uint64) (ChunkEvents, bool, error) {
-		var chunk ChunkEvents
-		var found bool
-		err := db.View(func(tx *bbolt.Tx) error {
-			b := tx.Bucket([]byte("chunks"))
-			v := b.Get(chunkKey(chunkStart))
-			if v == nil {
-				return nil
-			}
-			if decErr := gob.NewDecoder(bytes.NewReader(v)).Decode(&chunk); decErr != nil {
-				return decErr
-			}
-			found = true
-			return nil
-		})
-		return chunk, found, err
-	}
-	storeChunk := func(chunkStart uint64, chunk ChunkEvents) error {
-		return db.Update(func(tx *bbolt.Tx) error {
-			b := tx.Bucket([]byte("chunks"))
-			var buf bytes.Buffer
-			if err := gob.NewEncoder(&buf).Encode(chunk); err != nil {
-				return err
-			}
-			return b.Put(chunkKey(chunkStart), buf.Bytes())
-		})
+// loadEventRange returns every Staked/Withdrew/Gave event in [startU, endU],
+// serving chunks at or below tip from the cache and fetching (and storing)
+// the rest. startU must be a chunk boundary of the contract's chunk grid
+// (the creation block plus a multiple of the chunk size) so the chunk keys
+// line up with what earlier calls stored.
+func loadEventRange(cProps *ConnectionProps, kt Ktv2Interface, store EventStore, tip, startU, endU uint64) (ChunkEvents, error) {
+	chunkSize := uint64(cProps.ChunkSize)
+	if chunkSize == 0 {
+		chunkSize = uint64(DefaultChunkSize)
 	}
+	loadChunk := store.LoadChunk
+	storeChunk := store.StoreChunk
+
 	advanceTip := func(newTip uint64) error {
 		if newTip <= tip {
 			return nil
 		}
-		// Record the new tip's block hash so a future call can detect a reorg,
-		// but ONLY once the block is buried under reorgSafetyDepth confirmations.
-		// Recording the hash of a near-head block invites false-positive reorg
-		// wipes: recent blocks still reorg under PoS and can read inconsistently
-		// across load-balanced RPC backends, which would wipe the whole cache and
-		// re-fetch every chunk. When the tip is too near head we store its number
-		// but no hash, and clear any previously stored hash so the tip pointer and
-		// tip_hash can never refer to different blocks.
-		var newTipHash common.Hash
-		hashCaptured := false
-		head, headErr := cProps.Client.BlockNumber(context.Background())
-		switch {
-		case headErr != nil:
-			log.Debugf("Could not read head to gauge tip burial for block %d: %v", newTip, headErr)
-		case head >= reorgSafetyDepth && newTip <= head-reorgSafetyDepth:
-			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-			hdr, hErr := cProps.Client.HeaderByNumber(ctx, new(big.Int).SetUint64(newTip))
-			cancel()
-			if hErr == nil && hdr != nil {
-				newTipHash = hdr.Hash()
-				hashCaptured = true
-			} else if hErr != nil {
-				log.Debugf("Could not capture tipHash for block %d: %v", newTip, hErr)
-			}
-		default:
-			log.Debugf("Tip %d within %d blocks of head %d; not recording tip hash yet", newTip, reorgSafetyDepth, head)
-		}
-
-		err := db.Update(func(tx *bbolt.Tx) error {
-			b := tx.Bucket([]byte("meta"))
-			buf := make([]byte, 8)
-			binary.BigEndian.PutUint64(buf, newTip)
-			if err := b.Put([]byte("tip"), buf); err != nil {
-				return err
-			}
-			if hashCaptured {
-				return b.Put([]byte("tip_hash"), newTipHash[:])
-			}
-			// Drop any stale hash that referred to an earlier tip so the
-			// pointer and hash stay consistent.
-			return b.Delete([]byte("tip_hash"))
-		})
+		err := setCacheTip(cProps, store, newTip)
 		if err == nil {
 			tip = newTip
 		}
@@ -1072,15 +1076,16 @@ func realGatherStakesAndWithdraws(cProps *ConnectionProps, kt Ktv2Interface, sta
 		if cProps.QueryDelay > 0 {
 			time.Sleep(cProps.QueryDelay)
 		}
-		var s []StakeEvent
-		var w []WithdrawEvent
-		if err := queryChunkWithRetry(cProps, kt, fetchStart, chunkEnd, &s, &w); err != nil {
+		var fetched ChunkEvents
+		if err := queryChunkWithRetry(cProps, kt, fetchStart, chunkEnd, &fetched); err != nil {
 			return err
 		}
-		log.Infof("Fetched %d-%d: %d stakes, %d withdraws", fetchStart, chunkEnd, len(s), len(w))
+		log.Infof("Fetched %d-%d: %d stakes, %d withdraws, %d gives", fetchStart, chunkEnd,
+			len(fetched.StakeEvents), len(fetched.WithdrawEvents), len(fetched.GaveEvents))
 		merged := ChunkEvents{
-			StakeEvents:    append(existing.StakeEvents, s...),
-			WithdrawEvents: append(existing.WithdrawEvents, w...),
+			StakeEvents:    append(existing.StakeEvents, fetched.StakeEvents...),
+			WithdrawEvents: append(existing.WithdrawEvents, fetched.WithdrawEvents...),
+			GaveEvents:     append(existing.GaveEvents, fetched.GaveEvents...),
 		}
 		if err := storeChunk(chunkStart, merged); err != nil {
 			return fmt.Errorf("failed to store chunk %d: %w", chunkStart, err)
@@ -1088,8 +1093,31 @@ func realGatherStakesAndWithdraws(cProps *ConnectionProps, kt Ktv2Interface, sta
 		return advanceTip(chunkEnd)
 	}
 
-	var stakeEvents []StakeEvent
-	var withdrawEvents []WithdrawEvent
+	// fillGave fetches the Gave events of a chunk cached before they were,
+	// over the blocks it covers, and stores it back. The tip stays put.
+	fillGave := func(chunkStart uint64, chunk ChunkEvents) (ChunkEvents, error) {
+		if !chunk.GaveMissing {
+			return chunk, nil
+		}
+		coveredEnd := min(chunkStart+chunkSize-1, tip)
+		var fetched ChunkEvents
+		if err := queryGaveWithRetry(cProps, kt, chunkStart, coveredEnd, &fetched); err != nil {
+			return chunk, err
+		}
+		log.Infof("Filled in %d gives for cached chunk %d-%d", len(fetched.GaveEvents), chunkStart, coveredEnd)
+		chunk.GaveEvents, chunk.GaveMissing = fetched.GaveEvents, false
+		if err := storeChunk(chunkStart, chunk); err != nil {
+			return chunk, fmt.Errorf("failed to store chunk %d: %w", chunkStart, err)
+		}
+		return chunk, nil
+	}
+
+	var events ChunkEvents
+	appendChunk := func(chunk ChunkEvents) {
+		events.StakeEvents = append(events.StakeEvents, chunk.StakeEvents...)
+		events.WithdrawEvents = append(events.WithdrawEvents, chunk.WithdrawEvents...)
+		events.GaveEvents = append(events.GaveEvents, chunk.GaveEvents...)
+	}
 	for chunkStart := startU; chunkStart <= endU; chunkStart += chunkSize {
 		chunkEnd := chunkStart + chunkSize - 1
 		if chunkEnd > endU {
@@ -1107,24 +1135,25 @@ func realGatherStakesAndWithdraws(cProps *ConnectionProps, kt Ktv2Interface, sta
 					log.Warnf("Missing cached chunk %d (expected hit, tip=%d) - re-querying", chunkStart, tip)
 				}
 				if err := fetchAndStore(chunkStart, chunkStart, chunkEnd, ChunkEvents{}); err != nil {
-					return nil, err
+					return ChunkEvents{}, err
 				}
 				chunk, _, _ = loadChunk(chunkStart)
 			} else {
 				log.Infof("Cache HIT chunk %d (covers up to %d)", chunkStart, chunkEnd)
+				if chunk, err = fillGave(chunkStart, chunk); err != nil {
+					return ChunkEvents{}, err
+				}
 			}
-			stakeEvents = append(stakeEvents, chunk.StakeEvents...)
-			withdrawEvents = append(withdrawEvents, chunk.WithdrawEvents...)
+			appendChunk(chunk)
 
 		case chunkStart > tip:
 			// New chunk: fetch the whole requested range from scratch.
 			log.Infof("Fetching new chunk %d-%d (tip=%d)", chunkStart, chunkEnd, tip)
 			if err := fetchAndStore(chunkStart, chunkStart, chunkEnd, ChunkEvents{}); err != nil {
-				return nil, err
+				return ChunkEvents{}, err
 			}
 			chunk, _, _ := loadChunk(chunkStart)
-			stakeEvents = append(stakeEvents, chunk.StakeEvents...)
-			withdrawEvents = append(withdrawEvents, chunk.WithdrawEvents...)
+			appendChunk(chunk)
 
 		default:
 			// Partially cached: chunkStart ≤ tip < chunkEnd. Extend the chunk
@@ -1134,30 +1163,26 @@ func realGatherStakesAndWithdraws(cProps *ConnectionProps, kt Ktv2Interface, sta
 				log.Warnf("Expected partial chunk %d in cache (tip=%d) but not found - re-fetching full chunk", chunkStart, tip)
 				existing = ChunkEvents{}
 				if err := fetchAndStore(chunkStart, chunkStart, chunkEnd, existing); err != nil {
-					return nil, err
+					return ChunkEvents{}, err
 				}
 			} else {
 				log.Infof("Extending chunk %d: cached up to %d, fetching %d-%d", chunkStart, tip, tip+1, chunkEnd)
+				if existing, err = fillGave(chunkStart, existing); err != nil {
+					return ChunkEvents{}, err
+				}
 				if err := fetchAndStore(chunkStart, tip+1, chunkEnd, existing); err != nil {
-					return nil, err
+					return ChunkEvents{}, err
 				}
 			}
 			chunk, _, _ := loadChunk(chunkStart)
-			stakeEvents = append(stakeEvents, chunk.StakeEvents...)
-			withdrawEvents = append(withdrawEvents, chunk.WithdrawEvents...)
+			appendChunk(chunk)
 		}
 	}
-	stakeDataMap := buildStakeDataMap(stakeEvents, withdrawEvents)
-	log.Infof("Total addresses with events: %d", len(stakeDataMap))
-	if len(stakeDataMap) == 0 {
-		log.Warn("No events found in range - debugging with raw logs")
-		debugRawLogs(cProps, startU, endU)
-	}
-	return stakeDataMap, nil
+	return events, nil
 }
 
 // cacheSchemaVersion identifies the current on-disk layout of the per-contract
-// bbolt cache (cache/<addr>.db). Bump this whenever the storage layout
+// bbolt cache (cache/<chainID>/<addr>.db). Bump this whenever the storage layout
 // changes in a way that requires existing entries to be invalidated.
 //
 // Versions:
@@ -1166,17 +1191,26 @@ func realGatherStakesAndWithdraws(cProps *ConnectionProps, kt Ktv2Interface, sta
 //     every epoch, orphaned by the tip-pointer cache rewrite.
 //   - 2: chunks bucket with 8-byte BE chunkStart keys; meta bucket with
 //     "tip" pointer and "schema_version" marker.
-//   - 3 (current): adds "tip_hash" alongside "tip" in the meta bucket so the
+//   - 3: adds "tip_hash" alongside "tip" in the meta bucket so the
 //     node can detect a reorg at startup by comparing the cached tipHash
 //     against the current chain. If hashes mismatch, the cache is wiped and
 //     rebuilt.
-const cacheSchemaVersion uint32 = 3
+//   - 4 (current): chunks also hold Gave events. A v3 file is migrated in
+//     place: its chunks are kept and marked GaveMissing, and each one's
+//     Gave events are fetched the first time it is read.
+//
+// The "ledger" bucket (stake snapshots, stake_ledger.go) was added without a
+// bump: it is derived from the chunks, created on first write, and older
+// builds simply ignore it. Likewise the "chain_id" and "contract" meta keys
+// (see checkCacheIdentity): files without them are stamped on open.
+const cacheSchemaVersion uint32 = 4
 
 // migrateOrInitCacheSchema reads the schema_version marker from the meta
-// bucket. If it's missing or older than cacheSchemaVersion, both buckets
-// are dropped and recreated and the current version is written. The check
-// runs once per process; on subsequent calls the marker matches and the
-// function is a fast no-op that just ensures the buckets exist.
+// bucket. A v3 file is migrated in place (see migrateCacheV3). If the
+// marker is missing or older than that, both buckets are dropped and
+// recreated and the current version is written. The check runs once per
+// process; on subsequent calls the marker matches and the function is a
+// fast no-op that just ensures the buckets exist.
 //
 // This is how the node self-heals across upgrades, so operators never have
 // to delete cache files manually.
@@ -1203,6 +1237,20 @@ func migrateOrInitCacheSchema(db *bbolt.DB) error {
 			return nil
 		}
 
+		if hasStored && stored == 3 {
+			n, err := migrateCacheV3(tx)
+			if err != nil {
+				return fmt.Errorf("failed to migrate cache from v3: %w", err)
+			}
+			buf := make([]byte, 4)
+			binary.BigEndian.PutUint32(buf, cacheSchemaVersion)
+			if err := tx.Bucket([]byte("meta")).Put([]byte("schema_version"), buf); err != nil {
+				return err
+			}
+			log.Infof("Cache schema migrated: was v3, now v%d (%d chunks kept; their gives are fetched as they are read)", cacheSchemaVersion, n)
+			return nil
+		}
+
 		// Missing or older: wipe and reinitialize. Deletes silently no-op
 		// on absent buckets, which is what we want for a fresh DB.
 		if err := tx.DeleteBucket([]byte("chunks")); err != nil && err != bbolt.ErrBucketNotFound {
@@ -1211,6 +1259,9 @@ func migrateOrInitCacheSchema(db *bbolt.DB) error {
 		if err := tx.DeleteBucket([]byte("meta")); err != nil && err != bbolt.ErrBucketNotFound {
 			return err
 		}
+		if err := tx.DeleteBucket([]byte(ledgerBucket)); err != nil && err != bbolt.ErrBucketNotFound {
+			return err
+		}
 		if _, err := tx.CreateBucket([]byte("chunks")); err != nil {
 			return err
 		}
@@ -1232,6 +1283,42 @@ func migrateOrInitCacheSchema(db *bbolt.DB) error {
 	})
 }
 
+// migrateCacheV3 marks every chunk of a v3 file GaveMissing and returns how
+// many there were. Stake snapshots and meta don't involve Gave events and
+// are kept as they are.
+func migrateCacheV3(tx *bbolt.Tx) (int, error) {
+	chunks, err := tx.CreateBucketIfNotExists([]byte("chunks"))
+	if err != nil {
+		return 0, err
+	}
+	marked := make(map[string][]byte)
+	err = chunks.ForEach(func(k, v []byte) error {
+		var chunk ChunkEvents
+		if err := gob.NewDecoder(bytes.NewReader(v)).Decode(&chunk); err != nil {
+			// Left as is; loadEventRange re-fetches chunks it can't decode.
+			log.Warnf("Skipping undecodable chunk %x: %v", k, err)
+			return nil
+		}
+		chunk.GaveMissing = true
+		var buf bytes.Buffer
+		if err := gob.NewEncoder(&buf).Encode(chunk); err != nil {
+			return err
+		}
+		marked[string(k)] = buf.Bytes()
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	// A bucket can't be written while ForEach walks it.
+	for k, v := range marked {
+		if err := chunks.Put([]byte(k), v); err != nil {
+			return 0, err
+		}
+	}
+	return len(marked), nil
+}
+
 // buildStakeDataMap folds raw Staked / Withdrew events into per-address,
 // per-block signed deltas. Per-block deltas may go negative (a withdraw
 // at a block where the same wallet didn't also stake in that block);
@@ -1280,7 +1367,17 @@ func isQueryTooLargeError(err error) bool {
 	return strings.Contains(msg, "query") || strings.Contains(msg, "limit") || strings.Contains(msg, "large")
 }
 
-func queryChunkWithRetry(cProps *ConnectionProps, kt Ktv2Interface, start, end uint64, stakeOut *[]StakeEvent, withdrawOut *[]WithdrawEvent) error {
+func queryChunkWithRetry(cProps *ConnectionProps, kt Ktv2Interface, start, end uint64, out *ChunkEvents) error {
+	return queryEventsWithRetry(cProps, kt, start, end, false, out)
+}
+
+// queryGaveWithRetry is queryChunkWithRetry for Gave events alone, to fill
+// in a chunk cached before they were.
+func queryGaveWithRetry(cProps *ConnectionProps, kt Ktv2Interface, start, end uint64, out *ChunkEvents) error {
+	return queryEventsWithRetry(cProps, kt, start, end, true, out)
+}
+
+func queryEventsWithRetry(cProps *ConnectionProps, kt Ktv2Interface, start, end uint64, gaveOnly bool, out *ChunkEvents) error {
 	// maxSplitLevels caps how many times we recursively halve a range when
 	// the RPC returns "query too large". Three levels means a chunk can be
 	// quartered (or eighthed under chunks). Effective floor = chunkSize / 8.
@@ -1288,6 +1385,9 @@ func queryChunkWithRetry(cProps *ConnectionProps, kt Ktv2Interface, start, end u
 	var singleQuery func(s, e uint64) error
 
 	singleQuery = func(s, e uint64) error {
+		// Events are only handed to out once all the filters succeed, so a
+		// range that fails part-way and is split isn't counted twice.
+		var got ChunkEvents
 		if cProps.QueryDelay > 0 {
 			time.Sleep(cProps.QueryDelay)
 		}
@@ -1296,49 +1396,77 @@ func queryChunkWithRetry(cProps *ConnectionProps, kt Ktv2Interface, start, end u
 			End:     &e,
 			Context: context.Background(),
 		}
-		log.Debugf("Querying stake events for block range %d-%d", s, e)
-		stakeIter, err := kt.FilterStaked(opts)
-		if err != nil {
-			return fmt.Errorf("failed to filter stake events for %d-%d: %w", s, e, err)
-		}
-		for stakeIter.Next() {
-			e := stakeIter.Event()
-			if e == nil {
-				continue
+		if !gaveOnly {
+			log.Debugf("Querying stake events for block range %d-%d", s, e)
+			stakeIter, err := kt.FilterStaked(opts)
+			if err != nil {
+				return fmt.Errorf("failed to filter stake events for %d-%d: %w", s, e, err)
+			}
+			for stakeIter.Next() {
+				e := stakeIter.Event()
+				if e == nil {
+					continue
+				}
+				got.StakeEvents = append(got.StakeEvents, StakeEvent{
+					Addr:   e.Arg0,
+					Amount: e.Arg1,
+					Block:  e.Raw.BlockNumber,
+				})
+			}
+			if err := stakeIter.Error(); err != nil {
+				return fmt.Errorf("stake iterator error for %d-%d: %w", s, e, err)
+			}
+			stakeIter.Close()
+			if cProps.QueryDelay > 0 {
+				time.Sleep(cProps.QueryDelay)
+			}
+			log.Debugf("Querying withdraw events for block range %d-%d", s, e)
+			withdrawIter, err := kt.FilterWithdrew(opts)
+			if err != nil {
+				return fmt.Errorf("failed to filter withdrawal events for %d-%d: %w", s, e, err)
+			}
+			for withdrawIter.Next() {
+				e := withdrawIter.Event()
+				if e == nil {
+					continue
+				}
+				got.WithdrawEvents = append(got.WithdrawEvents, WithdrawEvent{
+					Addr:   e.Arg0,
+					Amount: e.Arg1,
+					Block:  e.Raw.BlockNumber,
+				})
+			}
+			if err := withdrawIter.Error(); err != nil {
+				return fmt.Errorf("withdraw iterator error for %d-%d: %w", s, e, err)
+			}
+			withdrawIter.Close()
+			if cProps.QueryDelay > 0 {
+				time.Sleep(cProps.QueryDelay)
 			}
-			*stakeOut = append(*stakeOut, StakeEvent{
-				Addr:   e.Arg0,
-				Amount: e.Arg1,
-				Block:  e.Raw.BlockNumber,
-			})
-		}
-		if err := stakeIter.Error(); err != nil {
-			return fmt.Errorf("stake iterator error for %d-%d: %w", s, e, err)
-		}
-		stakeIter.Close()
-		if cProps.QueryDelay > 0 {
-			time.Sleep(cProps.QueryDelay)
 		}
-		log.Debugf("Querying withdraw events for block range %d-%d", s, e)
-		withdrawIter, err := kt.FilterWithdrew(opts)
+		log.Debugf("Querying gave events for block range %d-%d", s, e)
+		gaveIter, err := kt.FilterGave(opts)
 		if err != nil {
-			return fmt.Errorf("failed to filter withdrawal events for %d-%d: %w", s, e, err)
+			return fmt.Errorf("failed to filter gave events for %d-%d: %w", s, e, err)
 		}
-		for withdrawIter.Next() {
-			e := withdrawIter.Event()
+		for gaveIter.Next() {
+			e := gaveIter.Event()
 			if e == nil {
 				continue
 			}
-			*withdrawOut = append(*withdrawOut, WithdrawEvent{
+			got.GaveEvents = append(got.GaveEvents, GaveEvent{
 				Addr:   e.Arg0,
 				Amount: e.Arg1,
 				Block:  e.Raw.BlockNumber,
 			})
 		}
-		if err := withdrawIter.Error(); err != nil {
-			return fmt.Errorf("withdraw iterator error for %d-%d: %w", s, e, err)
+		if err := gaveIter.Error(); err != nil {
+			return fmt.Errorf("gave iterator error for %d-%d: %w", s, e, err)
 		}
-		withdrawIter.Close()
+		gaveIter.Close()
+		out.StakeEvents = append(out.StakeEvents, got.StakeEvents...)
+		out.WithdrawEvents = append(out.WithdrawEvents, got.WithdrawEvents...)
+		out.GaveEvents = append(out.GaveEvents, got.GaveEvents...)
 		return nil
 	}
 
@@ -418,6 +418,7 @@ func (s *queryRetryScript) installOn(mockKt *MockKtv2) {
 			return nil
 		},
 	)
+	mockKt.On("FilterGave", mock.AnythingOfType("*bind.FilterOpts")).Return(&mockGaveIter{}, nil).Maybe()
 }
 
 // queryTooLarge is the error message shape providers use that the function
@@ -438,9 +439,8 @@ func TestQueryChunkWithRetry_SingleSplitSucceeds(t *testing.T) {
 	script.installOn(mockKt)
 
 	cProps := &ConnectionProps{ChunkSize: 1000}
-	var stakes []StakeEvent
-	var withdraws []WithdrawEvent
-	err := queryChunkWithRetry(cProps, mockKt, 100, 999, &stakes, &withdraws)
+	var events ChunkEvents
+	err := queryChunkWithRetry(cProps, mockKt, 100, 999, &events)
 
 	assert.NoError(t, err)
 	// We expect: 1 failed full-range attempt + 2 successful half attempts = 3
@@ -469,9 +469,8 @@ func TestQueryChunkWithRetry_RecursiveSplitWhenHalfStillTooLarge(t *testing.T) {
 	script.installOn(mockKt)
 
 	cProps := &ConnectionProps{ChunkSize: 1000}
-	var stakes []StakeEvent
-	var withdraws []WithdrawEvent
-	err := queryChunkWithRetry(cProps, mockKt, 100, 999, &stakes, &withdraws)
+	var events ChunkEvents
+	err := queryChunkWithRetry(cProps, mockKt, 100, 999, &events)
 
 	assert.NoError(t, err, "function should recurse and succeed at quarter granularity")
 }
@@ -487,9 +486,8 @@ func TestQueryChunkWithRetry_NonRetriableErrorReturnsImmediately(t *testing.T) {
 	script.installOn(mockKt)
 
 	cProps := &ConnectionProps{ChunkSize: 1000}
-	var stakes []StakeEvent
-	var withdraws []WithdrawEvent
-	err := queryChunkWithRetry(cProps, mockKt, 100, 999, &stakes, &withdraws)
+	var events ChunkEvents
+	err := queryChunkWithRetry(cProps, mockKt, 100, 999, &events)
 
 	assert.Error(t, err)
 	assert.Equal(t, 1, len(script.stakeCalls), "should NOT split on a non-retriable error; got calls %v", script.stakeCalls)
@@ -516,11 +514,14 @@ func TestQueryChunkWithRetry_GiveUpAtMaxDepthReturnsError(t *testing.T) {
 		(WithdrewIterator)(nil),
 		nil,
 	).Maybe() // shouldn't be called since FilterStaked always fails first
+	mockKt.On("FilterGave", mock.AnythingOfType("*bind.FilterOpts")).Return(
+		(GaveIterator)(nil),
+		nil,
+	).Maybe()
 
 	cProps := &ConnectionProps{ChunkSize: 1000}
-	var stakes []StakeEvent
-	var withdraws []WithdrawEvent
-	err := queryChunkWithRetry(cProps, mockKt, 100, 999, &stakes, &withdraws)
+	var events ChunkEvents
+	err := queryChunkWithRetry(cProps, mockKt, 100, 999, &events)
 
 	assert.Error(t, err, "should give up rather than recurse infinitely")
 	// Don't pin the exact call count — both pre- and post-fix should bound
@@ -558,3 +559,81 @@ func TestCache_FreshDBInitializesSchemaWithoutWipe(t *testing.T) {
 		t.Fatalf("post-init view: %v", err)
 	}
 }
+
+// TestCache_MigratesV3InPlace — a v3 file predates Gave events in chunks.
+// Its chunks, stake snapshots and tip are kept; each chunk is marked and,
+// when next read, only its Gave events are fetched.
+func TestCache_MigratesV3InPlace(t *testing.T) {
+	db, err := bbolt.Open(t.TempDir()+"/v3.db", 0600, nil)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer db.Close()
+
+	staker := common.HexToAddress("0x01")
+	var v3Chunk bytes.Buffer
+	if err := gob.NewEncoder(&v3Chunk).Encode(ChunkEvents{StakeEvents: []StakeEvent{{Addr: staker, Amount: big.NewInt(5), Block: 1001}}}); err != nil {
+		t.Fatalf("encode chunk: %v", err)
+	}
+	err = db.Update(func(tx *bbolt.Tx) error {
+		chunks, err := tx.CreateBucket([]byte("chunks"))
+		if err != nil {
+			return err
+		}
+		if err := chunks.Put(blockKey(1000), v3Chunk.Bytes()); err != nil {
+			return err
+		}
+		ledger, err := tx.CreateBucket([]byte(ledgerBucket))
+		if err != nil {
+			return err
+		}
+		if err := ledger.Put(blockKey(1000), []byte("snapshot")); err != nil {
+			return err
+		}
+		meta, err := tx.CreateBucket([]byte("meta"))
+		if err != nil {
+			return err
+		}
+		version := make([]byte, 4)
+		binary.BigEndian.PutUint32(version, 3)
+		if err := meta.Put([]byte("tip"), blockKey(1999)); err != nil {
+			return err
+		}
+		return meta.Put([]byte("schema_version"), version)
+	})
+	assert.NoError(t, err)
+
+	assert.NoError(t, migrateOrInitCacheSchema(db))
+	var chunk ChunkEvents
+	err = db.View(func(tx *bbolt.Tx) error {
+		meta := tx.Bucket([]byte("meta"))
+		assert.Equal(t, cacheSchemaVersion, binary.BigEndian.Uint32(meta.Get([]byte("schema_version"))))
+		assert.Equal(t, blockKey(1999), meta.Get([]byte("tip")))
+		assert.Equal(t, []byte("snapshot"), tx.Bucket([]byte(ledgerBucket)).Get(blockKey(1000)))
+		return gob.NewDecoder(bytes.NewReader(tx.Bucket([]byte("chunks")).Get(blockKey(1000)))).Decode(&chunk)
+	})
+	assert.NoError(t, err)
+	assert.Len(t, chunk.StakeEvents, 1)
+	assert.True(t, chunk.GaveMissing)
+
+	// Reading the chunk fetches its Gave events and nothing else.
+	store := NewMemoryEventStore()
+	assert.NoError(t, store.StoreChunk(1000, chunk))
+	mockKt := &MockKtv2{}
+	gave := &ktv2.Ktv2Gave{Arg0: staker, Arg1: big.NewInt(2), Raw: types.Log{BlockNumber: 1500}}
+	mockKt.On("FilterGave", mock.MatchedBy(func(o *bind.FilterOpts) bool {
+		return o.Start == 1000 && *o.End == 1999
+	})).Return(&mockGaveIter{events: []*ktv2.Ktv2Gave{gave}}, nil).Once()
+	events, err := loadEventRange(&ConnectionProps{ChunkSize: 1000}, mockKt, store, 1999, 1000, 1499)
+	assert.NoError(t, err)
+	assert.Len(t, events.StakeEvents, 1)
+	assert.Equal(t, []GaveEvent{{Addr: staker, Amount: big.NewInt(2), Block: 1500}}, events.GaveEvents)
+	mockKt.AssertNotCalled(t, "FilterStaked", mock.Anything)
+	mockKt.AssertNotCalled(t, "FilterWithdrew", mock.Anything)
+
+	stored, _, err := store.LoadChunk(1000)
+	assert.NoError(t, err)
+	assert.False(t, stored.GaveMissing)
+	_, err = loadEventRange(&ConnectionProps{ChunkSize: 1000}, mockKt, store, 1999, 1000, 1999)
+	assert.NoError(t, err, "a filled-in chunk is served from the cache")
+}
@@ -167,15 +167,18 @@ func TestVoteAndReward_NoStakes(t *testing.T) {
 
 	mockKt.On("FilterStaked", mock.Anything).Return(emptyStakedIter, nil).Maybe()
 	mockKt.On("FilterWithdrew", mock.Anything).Return(emptyWithdrewIter, nil).Maybe()
+	mockKt.On("FilterGave", mock.Anything).Return(&mockGaveIter{}, nil).Maybe()
 
-	// Since empty, totalMin=0, winner=zero
+	// Since empty, totalMin=0, winner=zero. The vote is tagged with the
+	// algorithm version, the seed and the digest of the (empty) stake set.
 	zeroAddr := common.Address{}
-	voteData := seedHeader.Hash().Hex()
+	voteData := FormatVoteData(ConsensusAlgorithmVersion, seedBlockNum.Uint64(), seedHeader.Hash(), StakeSetDigest(nil))
 	mockTx := types.NewTransaction(0, zeroAddr, big.NewInt(0), 0, big.NewInt(0), []byte{})
 	mockKt.On("Vote", mock.Anything, zeroAddr, voteData).Return(mockTx, nil).Maybe()
 
 	// Mock vote count < required
 	mockKt.On("BlockRwd", mock.Anything, startBlock, zeroAddr).Return(uint16(0), nil).Maybe()
+	mockKt.On("FilterVoted", mock.Anything).Return(&mockVotedIter{}, nil).Maybe() // peer votes, read after voting
 	mockKt.On("ConsensusReq", mock.Anything).Return(uint16(1), nil).Maybe()
 
 	// Mock TransactionReceipt for WaitMined
@@ -256,15 +259,18 @@ func TestVoteAndReward_WithStakesAndReward(t *testing.T) {
 
 	mockKt.On("FilterStaked", mock.Anything).Return(stakedIter, nil)
 	mockKt.On("FilterWithdrew", mock.Anything).Return(emptyWithdrewIter, nil)
+	mockKt.On("FilterGave", mock.Anything).Return(&mockGaveIter{}, nil)
 	mockKt.On("Declines", mock.Anything, stakerAddr).Return(false, nil)
 
 	// Winner will be stakerAddr, vote for it
-	voteData := seedHeader.Hash().Hex()
+	voteData := FormatVoteData(ConsensusAlgorithmVersion, seedBlockNum.Uint64(), seedHeader.Hash(),
+		StakeSetDigest(map[common.Address]*UserStakeData{stakerAddr: {StakeAmount: big.NewInt(1000)}}))
 	voteTx := types.NewTransaction(0, stakerAddr, big.NewInt(0), 0, big.NewInt(0), []byte{})
 	mockKt.On("Vote", mock.Anything, stakerAddr, voteData).Return(voteTx, nil)
 
 	// Mock votes enough for reward
 	mockKt.On("BlockRwd", mock.Anything, startBlock, stakerAddr).Return(uint16(5), nil)
+	mockKt.On("FilterVoted", mock.Anything).Return(&mockVotedIter{}, nil).Maybe() // peer votes, read after voting
 	mockKt.On("ConsensusReq", mock.Anything).Return(uint16(3), nil)
 
 	// Mock tlOcFees for reward calculation (assuming no OC fees in this test)
@@ -612,6 +618,7 @@ func TestCalculateVoteAndReward_SeedsAtFixedOffsetAndWaitsForDepth(t *testing.T)
 	mockKt.On("Vote", mock.Anything, stakerAddr, mock.AnythingOfType("string")).Return(
 		types.NewTransaction(0, common.Address{}, big.NewInt(0), 0, big.NewInt(0), []byte{}), nil)
 	mockKt.On("BlockRwd", mock.Anything, startBlock, stakerAddr).Return(uint16(1), nil)
+	mockKt.On("FilterVoted", mock.Anything).Return(&mockVotedIter{}, nil).Maybe() // peer votes, read after voting
 	mockKt.On("ConsensusReq", mock.Anything).Return(uint16(5), nil) // vote insufficient → no reward
 	mockClient.On("TransactionReceipt", mock.Anything, mock.Anything).Return(
 		&types.Receipt{Status: types.ReceiptStatusSuccessful, BlockNumber: big.NewInt(112)}, nil)
@@ -680,6 +687,7 @@ func TestCalculateVoteAndReward_ZeroConfirmationDepthFallsBackToDefault(t *testi
 	mockKt.On("Vote", mock.Anything, stakerAddr, mock.AnythingOfType("string")).Return(
 		types.NewTransaction(0, common.Address{}, big.NewInt(0), 0, big.NewInt(0), []byte{}), nil)
 	mockKt.On("BlockRwd", mock.Anything, big.NewInt(50), stakerAddr).Return(uint16(1), nil)
+	mockKt.On("FilterVoted", mock.Anything).Return(&mockVotedIter{}, nil).Maybe() // peer votes, read after voting
 	mockKt.On("ConsensusReq", mock.Anything).Return(uint16(5), nil)
 	mockClient.On("TransactionReceipt", mock.Anything, mock.Anything).Return(
 		&types.Receipt{Status: types.ReceiptStatusSuccessful, BlockNumber: big.NewInt(115)}, nil)
@@ -0,0 +1,149 @@
+package ktfunc
+
+// give() preview. GiveBurn is Ktv2.sol's give() arithmetic: the donation
+// share of msg.value, the token equivalent at the pool price, and the burn
+// curve, with the same integer operations in the same order so it burns
+// exactly what the contract would. The curve has three segments and a cap,
+// all relative to maxBrn, the most one give() may burn (maxBrnPrc of
+// totalStk, or all of it while totalStk is at most 10 * P_DEN):
+//
+//	tokens < maxBrn*P_FCTR/(2*burnFactor)  burn tokens*burnFactor/P_FCTR
+//	tokens < maxBrn*P_FCTR/burnFactor      burn tokens*burnFactor/(2*P_FCTR) + maxBrn/4
+//	tokens < maxBrn                        burn tokens*burnFactor/(4*P_FCTR) + maxBrn/2
+//	otherwise                              burn maxBrn
+//
+// burnFactor has P_FCTR built in, so 20 is a factor of 2.
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	log "github.com/sirupsen/logrus"
+)
+
+// giveFctr is Ktv2.sol's P_FCTR. P_DEN is feePDen.
+const giveFctr = 10
+
+// GiveParams is the contract state give() reads.
+type GiveParams struct {
+	TotalStk    *big.Int
+	MaxBrnPrc   uint16
+	DonationPrc uint16
+	BurnFactor  uint16
+}
+
+// GivePreview is what give() does with a msg.value. ETH amounts are wei,
+// token amounts token wei.
+type GivePreview struct {
+	Value      *big.Int
+	Donation   *big.Int // donationPrc of Value, sent on to the donation address
+	Retained   *big.Int // the rest, left in the contract for rewards
+	TokenPrice *big.Int // TokenPrice.sol's price, 18 decimals
+	Tokens     *big.Int // Value in tokens at TokenPrice
+	MaxBurn    *big.Int
+	// TierBounds are the token amounts at which tiers 2, 3 and 4 start.
+	TierBounds [3]*big.Int
+	Tier       int      // 1 to 3 on the curve, 4 at the MaxBurn cap
+	Burn       *big.Int // what the curve gives
+	Burned     bool     // false when Burn is zero or more than totalStk, so nothing burns
+}
+
+// GiveBurn computes give() for value at tknPrice. It fails where the
+// contract would revert on a division by zero.
+func GiveBurn(p GiveParams, value, tknPrice *big.Int) (*GivePreview, error) {
+	if tknPrice == nil || tknPrice.Sign() <= 0 {
+		return nil, fmt.Errorf("give() would revert: the token price is zero")
+	}
+	if p.BurnFactor == 0 {
+		return nil, fmt.Errorf("give() would revert: burnFactor is zero")
+	}
+	pDen, pFctr, bf := big.NewInt(feePDen), big.NewInt(giveFctr), big.NewInt(int64(p.BurnFactor))
+	g := &GivePreview{Value: new(big.Int).Set(value), TokenPrice: new(big.Int).Set(tknPrice)}
+
+	g.Donation = new(big.Int).Mul(value, big.NewInt(int64(p.DonationPrc)))
+	g.Donation.Quo(g.Donation, pDen)
+	g.Retained = new(big.Int).Sub(value, g.Donation)
+
+	g.Tokens = new(big.Int).Mul(value, new(big.Int).Exp(big.NewInt(10), big.NewInt(18), nil))
+	g.Tokens.Quo(g.Tokens, tknPrice)
+
+	g.MaxBurn = new(big.Int).Set(p.TotalStk)
+	if p.TotalStk.Cmp(new(big.Int).Mul(pDen, big.NewInt(10))) > 0 {
+		g.MaxBurn.Mul(p.TotalStk, big.NewInt(int64(p.MaxBrnPrc)))
+		g.MaxBurn.Quo(g.MaxBurn, pDen)
+	}
+
+	scaled := new(big.Int).Mul(g.MaxBurn, pFctr)
+	g.TierBounds[0] = new(big.Int).Quo(scaled, new(big.Int).Mul(big.NewInt(2), bf))
+	g.TierBounds[1] = new(big.Int).Quo(scaled, bf)
+	g.TierBounds[2] = new(big.Int).Set(g.MaxBurn)
+
+	curve := func(div, base int64) *big.Int {
+		b := new(big.Int).Mul(g.Tokens, bf)
+		b.Quo(b, new(big.Int).Mul(pFctr, big.NewInt(div)))
+		if base > 0 {
+			b.Add(b, new(big.Int).Quo(g.MaxBurn, big.NewInt(base)))
+		}
+		return b
+	}
+	switch {
+	case g.Tokens.Cmp(g.TierBounds[0]) < 0:
+		g.Tier, g.Burn = 1, curve(1, 0)
+	case g.Tokens.Cmp(g.TierBounds[1]) < 0:
+		g.Tier, g.Burn = 2, curve(2, 4)
+	case g.Tokens.Cmp(g.TierBounds[2]) < 0:
+		g.Tier, g.Burn = 3, curve(4, 2)
+	default:
+		g.Tier, g.Burn = 4, new(big.Int).Set(g.MaxBurn)
+	}
+	g.Burned = g.Burn.Sign() > 0 && p.TotalStk.Cmp(g.Burn) >= 0
+	return g, nil
+}
+
+// giveTokenPrice reads the token price give() would use. A variable so
+// tests can stub the price contract.
+var giveTokenPrice = TokenPrice
+
+// PreviewGive computes what a give() of value would do now.
+func PreviewGive(cProps *ConnectionProps, value *big.Int) (*GivePreview, error) {
+	opts := &bind.CallOpts{Context: context.Background(), From: cProps.MyPubKey}
+	var p GiveParams
+	var err error
+	if p.TotalStk, err = cProps.Kt.TotalStk(opts); err != nil {
+		return nil, fmt.Errorf("failed to get total stake: %w", err)
+	}
+	if p.MaxBrnPrc, err = cProps.Kt.MaxBrnPrc(opts); err != nil {
+		return nil, fmt.Errorf("failed to get max burn percentage: %w", err)
+	}
+	if p.DonationPrc, err = cProps.Kt.DonationPrc(opts); err != nil {
+		return nil, fmt.Errorf("failed to get donation percentage: %w", err)
+	}
+	if p.BurnFactor, err = cProps.Kt.BurnFactor(opts); err != nil {
+		return nil, fmt.Errorf("failed to get burn factor: %w", err)
+	}
+	price, err := giveTokenPrice(cProps, opts)
+	if err != nil {
+		return nil, err
+	}
+	return GiveBurn(p, value, price)
+}
+
+// LogGivePreview prints the preview for -previewGive.
+func LogGivePreview(g *GivePreview) {
+	log.Printf("Preview of give() with %s ETH:", weiToEthString(g.Value))
+	log.Printf("  Donated: %s ETH; left in the contract for rewards: %s ETH", weiToEthString(g.Donation), weiToEthString(g.Retained))
+	log.Printf("  Token price: %s (18 decimals); token equivalent: %s", g.TokenPrice, g.Tokens)
+	log.Printf("  Max burn: %s; tiers 2, 3 and 4 start at %s, %s and %s tokens", g.MaxBurn, g.TierBounds[0], g.TierBounds[1], g.TierBounds[2])
+	if g.Tier == 4 {
+		log.Printf("  Tier 4 of 4: capped at the max burn")
+	} else {
+		log.Printf("  Tier %d of 4", g.Tier)
+	}
+	if g.Burned {
+		log.Printf("  Burn: %s tokens", g.Burn)
+	} else {
+		log.Printf("  Burn: none (the curve gives %s, which the stake can't cover or is zero)", g.Burn)
+	}
+}
@@ -0,0 +1,96 @@
+package ktfunc
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// TestGiveBurn walks each tier of the curve. The expected burns are worked
+// by hand from Ktv2.sol's give() with the contract's defaults (maxBrnPrc 20,
+// burnFactor 20, donationPrc 500) and a price of 1e18, so tokens equal wei.
+// With totalStk 1,000,000, maxBrn is 20,000 and the tiers start at 5,000,
+// 10,000 and 20,000 tokens.
+func TestGiveBurn(t *testing.T) {
+	p := GiveParams{TotalStk: big.NewInt(1_000_000), MaxBrnPrc: 20, DonationPrc: 500, BurnFactor: 20}
+	one := big.NewInt(1e18)
+	for _, tc := range []struct {
+		value      int64
+		tier       int
+		burn       int64
+		formulaFor string
+	}{
+		{4000, 1, 8000, "4000*20/10"},
+		{4999, 1, 9998, "4999*20/10"},
+		{5000, 2, 10_000, "5000*20/20 + 20000/4"},
+		{9999, 2, 14_999, "9999*20/20 + 20000/4"},
+		{10_000, 3, 15_000, "10000*20/40 + 20000/2"},
+		{19_999, 3, 19_999, "19999*20/40 + 20000/2, truncated"},
+		{20_000, 4, 20_000, "maxBrn"},
+		{5_000_000, 4, 20_000, "maxBrn"},
+	} {
+		g, err := GiveBurn(p, big.NewInt(tc.value), one)
+		require.NoError(t, err)
+		assert.Equal(t, tc.tier, g.Tier, "value %d", tc.value)
+		assert.Equal(t, tc.burn, g.Burn.Int64(), "value %d: %s", tc.value, tc.formulaFor)
+		assert.True(t, g.Burned)
+	}
+
+	g, err := GiveBurn(p, big.NewInt(4001), one)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2000), g.Donation.Int64(), "4001*500/1000, truncated")
+	assert.Equal(t, int64(2001), g.Retained.Int64())
+	assert.Equal(t, []int64{5000, 10_000, 20_000}, []int64{g.TierBounds[0].Int64(), g.TierBounds[1].Int64(), g.TierBounds[2].Int64()})
+}
+
+func TestGiveBurn_EdgeCases(t *testing.T) {
+	one := big.NewInt(1e18)
+
+	// At most 10 * P_DEN staked, all of it may burn: maxBrn 5000, tiers at
+	// 1250, 2500 and 5000.
+	small := GiveParams{TotalStk: big.NewInt(5000), MaxBrnPrc: 20, DonationPrc: 500, BurnFactor: 20}
+	g, err := GiveBurn(small, big.NewInt(1000), one)
+	require.NoError(t, err)
+	assert.Equal(t, int64(5000), g.MaxBurn.Int64())
+	assert.Equal(t, 1, g.Tier)
+	assert.Equal(t, int64(2000), g.Burn.Int64())
+
+	// The price converts ETH to tokens: at 2e18, 8000 wei is 4000 tokens.
+	p := GiveParams{TotalStk: big.NewInt(1_000_000), MaxBrnPrc: 20, DonationPrc: 500, BurnFactor: 20}
+	g, err = GiveBurn(p, big.NewInt(8000), big.NewInt(2e18))
+	require.NoError(t, err)
+	assert.Equal(t, int64(4000), g.Tokens.Int64())
+	assert.Equal(t, int64(8000), g.Burn.Int64())
+
+	// Nothing staked, nothing burns.
+	g, err = GiveBurn(GiveParams{TotalStk: big.NewInt(0), MaxBrnPrc: 20, DonationPrc: 500, BurnFactor: 20}, big.NewInt(1000), one)
+	require.NoError(t, err)
+	assert.False(t, g.Burned)
+
+	// Where the contract divides by zero, it reverts.
+	_, err = GiveBurn(p, big.NewInt(1000), big.NewInt(0))
+	assert.Error(t, err)
+	_, err = GiveBurn(GiveParams{TotalStk: big.NewInt(1_000_000), MaxBrnPrc: 20, BurnFactor: 0}, big.NewInt(1000), one)
+	assert.Error(t, err)
+}
+
+func TestPreviewGive(t *testing.T) {
+	orig := giveTokenPrice
+	defer func() { giveTokenPrice = orig }()
+	giveTokenPrice = func(*ConnectionProps, *bind.CallOpts) (*big.Int, error) { return big.NewInt(1e18), nil }
+
+	kt := &MockKtv2{}
+	kt.On("TotalStk", mock.Anything).Return(big.NewInt(1_000_000), nil)
+	kt.On("MaxBrnPrc", mock.Anything).Return(uint16(20), nil)
+	kt.On("DonationPrc", mock.Anything).Return(uint16(500), nil)
+	kt.On("BurnFactor", mock.Anything).Return(uint16(20), nil)
+
+	g, err := PreviewGive(&ConnectionProps{Kt: kt}, big.NewInt(10_000))
+	require.NoError(t, err)
+	assert.Equal(t, 3, g.Tier)
+	assert.Equal(t, int64(15_000), g.Burn.Int64())
+}
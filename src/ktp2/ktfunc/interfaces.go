@@ -113,6 +113,13 @@ type RwdIterator interface {
 	Close() error
 }
 
+type GaveIterator interface {
+	Next() bool
+	Event() *ktv2.Ktv2Gave
+	Error() error
+	Close() error
+}
+
 type Ktv2Interface interface {
 	StartBlock(opts *bind.CallOpts) (*big.Int, error)
 	EpochInterval(opts *bind.CallOpts) (uint16, error)
@@ -128,6 +135,7 @@ type Ktv2Interface interface {
 	Give(opts *bind.TransactOpts) (*types.Transaction, error)
 	WithdrawOCFee(opts *bind.TransactOpts) (*types.Transaction, error)
 	PastOcFees(opts *bind.CallOpts, oc common.Address) (*big.Int, error)
+	LastStartBlock(opts *bind.CallOpts, oc common.Address) (*big.Int, error)
 	VoteToAdd(opts *bind.TransactOpts, newOC common.Address, data string) (*types.Transaction, error)
 	VoteToRemove(opts *bind.TransactOpts, existingOC common.Address, data string) (*types.Transaction, error)
 	ResetVoteToAdd(opts *bind.TransactOpts, newOC common.Address) (*types.Transaction, error)
@@ -142,6 +150,9 @@ type Ktv2Interface interface {
 	DonationPrc(opts *bind.CallOpts) (uint16, error)
 	BurnFactor(opts *bind.CallOpts) (uint16, error)
 	V2(opts *bind.CallOpts) (bool, error)
+	Tp(opts *bind.CallOpts) (common.Address, error)
+	Pool(opts *bind.CallOpts) (common.Address, error)
+	TokenAddr(opts *bind.CallOpts) (common.Address, error)
 	OcFee(opts *bind.CallOpts) (uint16, error)
 	OcFees(opts *bind.CallOpts, oc common.Address, blockNumber *big.Int) (*big.Int, error)
 	TlOcFees(opts *bind.CallOpts) (*big.Int, error)
@@ -150,6 +161,7 @@ type Ktv2Interface interface {
 
 	FilterRwd(opts *bind.FilterOpts) (RwdIterator, error)
 	FilterVoted(opts *bind.FilterOpts) (VotedIterator, error)
+	FilterGave(opts *bind.FilterOpts) (GaveIterator, error)
 
 	OcRwdrs(opts *bind.CallOpts, address common.Address) (bool, error)
 	Declines(opts *bind.CallOpts, address common.Address) (bool, error)
@@ -180,14 +192,38 @@ type ConnectionProps struct {
 	V2Uniswap     bool          // If true, use Uniswap V2, else V1.
 	ChunkSize     int           // Size of chunks for processing large data sets
 	WaitDuration  time.Duration // Duration to wait between operations
+	// RPCBatchSize is how many tx lookups go in one JSON-RPC batch when the
+	// client supports batching. Zero means DefaultRPCBatchSize; 1 or less
+	// sends every lookup as its own call.
+	RPCBatchSize int
 	// CacheDir is the directory for the on-disk event/fees caches. Empty means
-	// the default "cache". Set a distinct dir per node when running several
-	// operator instances on one machine so their bbolt caches don't collide.
+	// the default "cache". Files inside are namespaced by ChainID and KtAddr;
+	// set a distinct dir per node when running several operator instances on
+	// one machine, since each process locks the files it opens.
 	CacheDir string
+	// DiagnosticsDir is where the node writes diagnostic bundles, such as
+	// the one for a vote that diverges from its peers'. Empty means the
+	// default "diagnostics".
+	DiagnosticsDir string
+	// FeeWithdrawPolicy, when set, lets the -run loop withdraw this node's
+	// OC fees on its own; see auto_withdraw.go. Nil leaves withdrawals to
+	// -withdrawFees.
+	FeeWithdrawPolicy *FeeWithdrawPolicy
+	// InvariantCheckInterval is how often the -run loop checks the contract's
+	// solvency and accounting invariants; see invariants.go. Zero disables
+	// the periodic check.
+	InvariantCheckInterval time.Duration
+	// WithdrawalLedger is the JSON Lines file every OC fee withdrawal, manual
+	// or automatic, is appended to. Empty means DefaultWithdrawalLedger.
+	WithdrawalLedger string
 	// DeclinesCache memoizes Declines() lookups for the lifetime of the
 	// process. Declines is a contract state read and rarely changes, so
 	// re-querying it every epoch is wasteful. Nil = first use will create it.
 	DeclinesCache map[common.Address]bool
+	// Store overrides where the event, ledger and fee caches live. Nil means
+	// the bbolt files under ResolvedCacheDir, opened per operation. A store
+	// set here is shared across operations and never closed by ktfunc.
+	Store EventStore
 
 	// ConfirmationDepth is how many blocks past the SEED block (endBlock +
 	// SeedOffset) the node waits before submitting its vote, so the seed
@@ -203,6 +239,26 @@ type ConnectionProps struct {
 	// Contract state that DOES gate a tx or the seed is intentionally never
 	// cached here; see state_cache.go.
 	cachedGasPrice cachedValue[*big.Int]
+
+	// ledgerEpochsUnchecked counts epochs served by the stake ledger since its
+	// last full-recompute consistency check. Zero means this process has not
+	// checked the ledger yet; see stake_ledger.go.
+	ledgerEpochsUnchecked int
+
+	// divergenceReported is the last epoch a divergence was reported for
+	// and its diverging peer votes, so each disagreement is alerted once.
+	// Only the latest epoch is kept; see divergence.go.
+	divergenceReported reportedDivergence
+
+	// invariantsCheckedAt is when the run loop last checked the invariants,
+	// and invariantsReported the violations it last alerted on, so an
+	// unchanged violation is alerted once. knownOCs is every sender of a
+	// Voted or Rwd event through block knownOCsThrough, scanned
+	// incrementally; see invariants.go.
+	invariantsCheckedAt time.Time
+	invariantsReported  string
+	knownOCs            map[common.Address]bool
+	knownOCsThrough     uint64
 }
 
 // ResolvedCacheDir returns the directory for on-disk caches, defaulting to
@@ -214,6 +270,24 @@ func (cProps *ConnectionProps) ResolvedCacheDir() string {
 	return "cache"
 }
 
+// ResolvedDiagnosticsDir returns the directory for diagnostic bundles,
+// defaulting to "diagnostics" when DiagnosticsDir is unset.
+func (cProps *ConnectionProps) ResolvedDiagnosticsDir() string {
+	if cProps.DiagnosticsDir != "" {
+		return cProps.DiagnosticsDir
+	}
+	return "diagnostics"
+}
+
+// ResolvedWithdrawalLedger returns the OC fee withdrawal ledger path,
+// defaulting to DefaultWithdrawalLedger when WithdrawalLedger is unset.
+func (cProps *ConnectionProps) ResolvedWithdrawalLedger() string {
+	if cProps.WithdrawalLedger != "" {
+		return cProps.WithdrawalLedger
+	}
+	return DefaultWithdrawalLedger
+}
+
 // Addresses holds Ethereum addresses and private keys from environment variables.
 type Addresses struct {
 	MyPublicKey  string // User's public key (hex string)
@@ -304,6 +378,18 @@ func (w *RwdIteratorWrapper) Close() error {
 	return w.Ktv2RwdIterator.Close()
 }
 
+type GaveIteratorWrapper struct {
+	*ktv2.Ktv2GaveIterator
+}
+
+func (w *GaveIteratorWrapper) Event() *ktv2.Ktv2Gave {
+	return w.Ktv2GaveIterator.Event
+}
+
+func (w *GaveIteratorWrapper) Close() error {
+	return w.Ktv2GaveIterator.Close()
+}
+
 func (w *Ktv2Wrapper) FilterVoted(opts *bind.FilterOpts) (VotedIterator, error) {
 	iter, err := w.Ktv2.FilterVoted(opts)
 	if err != nil {
@@ -319,3 +405,11 @@ func (w *Ktv2Wrapper) FilterRwd(opts *bind.FilterOpts) (RwdIterator, error) {
 	}
 	return &RwdIteratorWrapper{iter}, nil
 }
+
+func (w *Ktv2Wrapper) FilterGave(opts *bind.FilterOpts) (GaveIterator, error) {
+	iter, err := w.Ktv2.FilterGave(opts)
+	if err != nil {
+		return nil, err
+	}
+	return &GaveIteratorWrapper{iter}, nil
+}
@@ -0,0 +1,267 @@
+package ktfunc
+
+// Contract solvency and accounting invariants. Rewards are paid as balance
+// minus tlOcFees and fees are withdrawn from the same balance, so the
+// contract is only solvent while its balance covers tlOcFees. tlOcFees is
+// itself a running total of the per-OC fees, and totalStk of the Staked,
+// Withdrew and burn amounts, so both can be checked against their parts:
+//
+//   - balance >= tlOcFees
+//   - tlOcFees == sum over OCs of pastOcFees[oc] + ocFees[oc][lastStartBlock[oc]]
+//   - totalStk == staked - withdrawn (from events) - totalBurned
+//
+// The OC set is every sender of a Voted or Rwd event, the only calls that
+// record a fee, so an OC that never acted holds none. Every read is pinned
+// to one block so the parts are taken from the same state.
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	log "github.com/sirupsen/logrus"
+)
+
+// DefaultInvariantCheckInterval is how often -run checks the invariants
+// unless configured otherwise.
+const DefaultInvariantCheckInterval = time.Hour
+
+// OcFeeBalance is one OC's share of tlOcFees.
+type OcFeeBalance struct {
+	OC      common.Address
+	Past    *big.Int // pastOcFees
+	Epoch   uint64   // lastStartBlock, the epoch whose ocFees are not yet migrated
+	Current *big.Int // ocFees at Epoch
+}
+
+// InvariantReport is the result of CheckInvariants. Amounts are wei, or
+// token units for the stake totals.
+type InvariantReport struct {
+	Block       uint64
+	Balance     *big.Int
+	TlOcFees    *big.Int
+	OCs         []OcFeeBalance
+	OcFeeSum    *big.Int
+	TotalStk    *big.Int
+	Staked      *big.Int // staked minus withdrawn, from events
+	TotalBurned *big.Int
+	Violations  []string
+}
+
+// OK reports whether every invariant holds.
+func (r *InvariantReport) OK() bool { return len(r.Violations) == 0 }
+
+// CheckInvariants checks the contract's invariants at the current head.
+func CheckInvariants(cProps *ConnectionProps) (*InvariantReport, error) {
+	head, err := cProps.Client.BlockNumber(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get latest block: %w", err)
+	}
+	creation, err := GetContractCreationBlock(cProps)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get contract creation block: %w", err)
+	}
+	at := new(big.Int).SetUint64(head)
+	opts := &bind.CallOpts{Context: context.Background(), BlockNumber: at}
+	r := &InvariantReport{Block: head}
+
+	if r.Balance, err = cProps.Client.BalanceAt(context.Background(), cProps.KtAddr, at); err != nil {
+		return nil, fmt.Errorf("failed to get contract balance: %w", err)
+	}
+	if r.TlOcFees, err = cProps.Kt.TlOcFees(opts); err != nil {
+		return nil, fmt.Errorf("failed to get total OC fees: %w", err)
+	}
+	if r.Balance.Cmp(r.TlOcFees) < 0 {
+		r.Violations = append(r.Violations, fmt.Sprintf("balance %s ETH is less than tlOcFees %s ETH: the contract owes %s ETH more than it holds",
+			weiToEthString(r.Balance), weiToEthString(r.TlOcFees), weiToEthString(new(big.Int).Sub(r.TlOcFees, r.Balance))))
+	}
+
+	ocs, err := knownOCs(cProps, creation, head)
+	if err != nil {
+		return nil, err
+	}
+	r.OcFeeSum = new(big.Int)
+	for _, oc := range ocs {
+		b := OcFeeBalance{OC: oc}
+		if b.Past, err = cProps.Kt.PastOcFees(opts, oc); err != nil {
+			return nil, fmt.Errorf("failed to get pastOcFees of %s: %w", oc.Hex(), err)
+		}
+		last, err := cProps.Kt.LastStartBlock(opts, oc)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get lastStartBlock of %s: %w", oc.Hex(), err)
+		}
+		b.Epoch = last.Uint64()
+		if b.Current, err = cProps.Kt.OcFees(opts, oc, last); err != nil {
+			return nil, fmt.Errorf("failed to get ocFees of %s: %w", oc.Hex(), err)
+		}
+		if b.Past.Sign() == 0 && b.Current.Sign() == 0 {
+			continue
+		}
+		r.OcFeeSum.Add(r.OcFeeSum, b.Past)
+		r.OcFeeSum.Add(r.OcFeeSum, b.Current)
+		r.OCs = append(r.OCs, b)
+	}
+	switch diff := new(big.Int).Sub(r.TlOcFees, r.OcFeeSum); diff.Sign() {
+	case 1:
+		r.Violations = append(r.Violations, fmt.Sprintf("tlOcFees %s ETH exceeds the fees of the %d known OCs by %s ETH: fees are reserved that no OC can withdraw",
+			weiToEthString(r.TlOcFees), len(r.OCs), weiToEthString(diff)))
+	case -1:
+		r.Violations = append(r.Violations, fmt.Sprintf("the known OCs are owed %s ETH, %s ETH more than tlOcFees %s ETH reserves",
+			weiToEthString(r.OcFeeSum), weiToEthString(diff.Neg(diff)), weiToEthString(r.TlOcFees)))
+	}
+
+	if r.TotalStk, err = cProps.Kt.TotalStk(opts); err != nil {
+		return nil, fmt.Errorf("failed to get total stake: %w", err)
+	}
+	if r.TotalBurned, err = cProps.Kt.TotalBurned(opts); err != nil {
+		return nil, fmt.Errorf("failed to get total burned: %w", err)
+	}
+	stakeDataMap, err := GatherStakesAndWithdraws(cProps, cProps.Kt, new(big.Int).SetUint64(creation), at)
+	if err != nil {
+		return nil, fmt.Errorf("failed to gather stakes: %w", err)
+	}
+	r.Staked = new(big.Int)
+	for _, byBlock := range stakeDataMap {
+		for _, d := range byBlock {
+			if d != nil && d.StakeAmount != nil {
+				r.Staked.Add(r.Staked, d.StakeAmount)
+			}
+		}
+	}
+	if expected := new(big.Int).Sub(r.Staked, r.TotalBurned); expected.Cmp(r.TotalStk) != 0 {
+		r.Violations = append(r.Violations, fmt.Sprintf("totalStk %s differs from the %s staked less withdrawn in events and %s burned: expected %s",
+			r.TotalStk, r.Staked, r.TotalBurned, expected))
+	}
+	return r, nil
+}
+
+// knownOCs returns every sender of a Voted or Rwd event up to head, plus
+// this node's own address. The set is kept for the life of the process and
+// only the blocks added since the last call are scanned.
+func knownOCs(cProps *ConnectionProps, creation, head uint64) ([]common.Address, error) {
+	if cProps.knownOCs == nil {
+		cProps.knownOCs = make(map[common.Address]bool)
+		cProps.knownOCsThrough = 0
+	}
+	from := max(creation, cProps.knownOCsThrough+1)
+	if from <= head {
+		senders := newTxSenders(cProps)
+		err := forEachBlockChunk(cProps, from, head, func(start, end uint64) error {
+			hashes, err := feeEventTxs(cProps, start, end)
+			if err != nil {
+				return err
+			}
+			senders.prefetch(hashes)
+			for _, h := range hashes {
+				oc, err := senders.sender(h)
+				if err != nil {
+					return err
+				}
+				cProps.knownOCs[oc] = true
+			}
+			cProps.knownOCsThrough = end
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	set := make(map[common.Address]bool, len(cProps.knownOCs)+1)
+	for oc := range cProps.knownOCs {
+		set[oc] = true
+	}
+	if cProps.MyPubKey != (common.Address{}) {
+		set[cProps.MyPubKey] = true
+	}
+	out := make([]common.Address, 0, len(set))
+	for oc := range set {
+		out = append(out, oc)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Cmp(out[j]) < 0 })
+	return out, nil
+}
+
+// feeEventTxs returns the transactions of the Voted and Rwd events in
+// [start, end].
+func feeEventTxs(cProps *ConnectionProps, start, end uint64) ([]common.Hash, error) {
+	opts := &bind.FilterOpts{Start: start, End: &end, Context: context.Background()}
+	var hashes []common.Hash
+	votedIter, err := cProps.Kt.FilterVoted(opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to filter Voted events %d-%d: %w", start, end, err)
+	}
+	for votedIter.Next() {
+		if evt := votedIter.Event(); evt != nil {
+			hashes = append(hashes, evt.Raw.TxHash)
+		}
+	}
+	err = votedIter.Error()
+	votedIter.Close()
+	if err != nil {
+		return nil, fmt.Errorf("error iterating Voted events: %w", err)
+	}
+	rwdIter, err := cProps.Kt.FilterRwd(opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to filter Rwd events %d-%d: %w", start, end, err)
+	}
+	for rwdIter.Next() {
+		if evt := rwdIter.Event(); evt != nil {
+			hashes = append(hashes, evt.Raw.TxHash)
+		}
+	}
+	err = rwdIter.Error()
+	rwdIter.Close()
+	if err != nil {
+		return nil, fmt.Errorf("error iterating Rwd events: %w", err)
+	}
+	return hashes, nil
+}
+
+// LogInvariantReport prints the report, each violation as an INVARIANT
+// error.
+func LogInvariantReport(r *InvariantReport) {
+	log.Printf("Contract invariants at block %d:", r.Block)
+	log.Printf("  Balance %s ETH, tlOcFees %s ETH", weiToEthString(r.Balance), weiToEthString(r.TlOcFees))
+	log.Printf("  Fees owed to %d OC(s): %s ETH", len(r.OCs), weiToEthString(r.OcFeeSum))
+	for _, b := range r.OCs {
+		log.Printf("    %s: past %s ETH, epoch %d %s ETH", b.OC.Hex(), weiToEthString(b.Past), b.Epoch, weiToEthString(b.Current))
+	}
+	log.Printf("  totalStk %s, staked less withdrawn %s, burned %s", r.TotalStk, r.Staked, r.TotalBurned)
+	if r.OK() {
+		log.Printf("  All invariants hold.")
+		return
+	}
+	for _, v := range r.Violations {
+		log.Errorf("INVARIANT: %s", v)
+	}
+}
+
+// MaybeCheckInvariants checks the invariants if InvariantCheckInterval has
+// passed since the last check. Violations are alerted when first seen or
+// when they change; a passing check after a violation is logged once too.
+func MaybeCheckInvariants(cProps *ConnectionProps) (*InvariantReport, error) {
+	if cProps.InvariantCheckInterval <= 0 || time.Since(cProps.invariantsCheckedAt) < cProps.InvariantCheckInterval {
+		return nil, nil
+	}
+	r, err := CheckInvariants(cProps)
+	if err != nil {
+		return nil, err
+	}
+	cProps.invariantsCheckedAt = time.Now()
+	sig := strings.Join(r.Violations, "\n")
+	switch {
+	case sig == cProps.invariantsReported:
+		log.Debugf("Contract invariants unchanged at block %d (%d violation(s))", r.Block, len(r.Violations))
+	case r.OK():
+		log.Infof("Contract invariants hold again at block %d", r.Block)
+	default:
+		LogInvariantReport(r)
+	}
+	cProps.invariantsReported = sig
+	return r, nil
+}
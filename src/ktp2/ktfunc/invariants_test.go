@@ -0,0 +1,124 @@
+package ktfunc
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"ktp2/src/abis/ktv2"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// newInvariantTest returns a contract where X voted and Y rewarded, both in
+// epoch 200, and 200 tokens are burned. onFees sets up the totals the
+// invariants compare.
+func newInvariantTest(t *testing.T) (*ConnectionProps, *MockKtv2, common.Address) {
+	chainID := big.NewInt(1337)
+	xTx, ocX := signedTxFromKey(t, testKeyX, chainID)
+	yTx, ocY := signedTxFromKey(t, testKeyY, chainID)
+	staker := common.HexToAddress("0x0a")
+	base := &epochFakeKt{
+		ledgerFakeKt: &ledgerFakeKt{
+			stakes:    []StakeEvent{{Addr: staker, Amount: big.NewInt(1000), Block: 120}},
+			withdraws: []WithdrawEvent{{Addr: staker, Amount: big.NewInt(300), Block: 220}},
+		},
+		start:    300,
+		interval: 100,
+		voted:    []*ktv2.Ktv2Voted{{Arg0: big.NewInt(200), Raw: types.Log{BlockNumber: 210, TxHash: xTx.Hash()}}},
+		rwds:     []*ktv2.Ktv2Rwd{{Arg0: staker, Arg1: big.NewInt(1), Raw: types.Log{BlockNumber: 305, TxHash: yTx.Hash()}}},
+	}
+	kt := mockKtHistory(base)
+	kt.On("FilterGave", mock.Anything).Return(&mockGaveIter{}, nil)
+	kt.On("TotalBurned", atBlock(350)).Return(big.NewInt(200), nil)
+	kt.On("PastOcFees", atBlock(350), ocY).Return(big.NewInt(0), nil)
+	kt.On("LastStartBlock", atBlock(350), mock.Anything).Return(big.NewInt(200), nil)
+	kt.On("OcFees", atBlock(350), ocX, big.NewInt(200)).Return(big.NewInt(0), nil)
+	kt.On("OcFees", atBlock(350), ocY, big.NewInt(200)).Return(big.NewInt(30), nil)
+	cProps := newOddsTestProps(t, base, 350)
+	cProps.Kt = kt
+	client := cProps.Client.(*MockEthClient)
+	client.On("TransactionByHash", mock.Anything, xTx.Hash()).Return(xTx, false, nil)
+	client.On("TransactionByHash", mock.Anything, yTx.Hash()).Return(yTx, false, nil)
+	client.On("BalanceAt", mock.Anything, cProps.KtAddr, big.NewInt(350)).Return(big.NewInt(1000), nil)
+	return cProps, kt, ocX
+}
+
+// onFees sets up tlOcFees, X's pastOcFees and totalStk. The invariants hold
+// with 70, 40 and 500: X's 40 and Y's 30 add up to tlOcFees, and 1000 staked
+// less 300 withdrawn less 200 burned leaves 500.
+func onFees(kt *MockKtv2, ocX common.Address, tlOcFees, pastX, totalStk int64) {
+	kt.On("TlOcFees", atBlock(350)).Return(big.NewInt(tlOcFees), nil)
+	kt.On("PastOcFees", atBlock(350), ocX).Return(big.NewInt(pastX), nil)
+	kt.On("TotalStk", atBlock(350)).Return(big.NewInt(totalStk), nil)
+}
+
+func TestCheckInvariants(t *testing.T) {
+	logrus.SetLevel(logrus.FatalLevel)
+	defer logrus.SetLevel(logrus.InfoLevel)
+
+	cProps, kt, ocX := newInvariantTest(t)
+	onFees(kt, ocX, 70, 40, 500)
+	r, err := CheckInvariants(cProps)
+	require.NoError(t, err)
+	assert.True(t, r.OK(), "%v", r.Violations)
+	assert.Len(t, r.OCs, 2)
+	assert.Equal(t, int64(70), r.OcFeeSum.Int64())
+	assert.Equal(t, int64(700), r.Staked.Int64())
+	assert.Equal(t, uint64(350), cProps.knownOCsThrough)
+	kt.AssertExpectations(t)
+
+	for _, tc := range []struct {
+		name                      string
+		tlOcFees, pastX, totalStk int64
+	}{
+		{"balance short of fees", 1040, 1010, 500},
+		{"fees of an unknown OC", 90, 40, 500},
+		{"fees over the reserve", 70, 60, 500},
+		{"stake mismatch", 70, 40, 700},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cProps, kt, ocX := newInvariantTest(t)
+			onFees(kt, ocX, tc.tlOcFees, tc.pastX, tc.totalStk)
+			r, err := CheckInvariants(cProps)
+			require.NoError(t, err)
+			assert.Len(t, r.Violations, 1, "%v", r.Violations)
+		})
+	}
+}
+
+func TestMaybeCheckInvariants_AlertsOnce(t *testing.T) {
+	logrus.SetLevel(logrus.FatalLevel)
+	defer logrus.SetLevel(logrus.InfoLevel)
+
+	cProps, kt, ocX := newInvariantTest(t)
+	// totalStk is off at the first check and back in line at the second.
+	kt.On("TotalStk", atBlock(350)).Return(big.NewInt(700), nil).Once()
+	onFees(kt, ocX, 70, 40, 500)
+	r, err := MaybeCheckInvariants(cProps)
+	require.NoError(t, err)
+	assert.Nil(t, r, "disabled without an interval")
+
+	cProps.InvariantCheckInterval = time.Hour
+	r, err = MaybeCheckInvariants(cProps)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	assert.False(t, r.OK())
+	assert.NotEmpty(t, cProps.invariantsReported)
+
+	r, err = MaybeCheckInvariants(cProps)
+	require.NoError(t, err)
+	assert.Nil(t, r, "not due again within the interval")
+
+	cProps.invariantsCheckedAt = time.Time{}
+	r, err = MaybeCheckInvariants(cProps)
+	require.NoError(t, err)
+	assert.True(t, r.OK())
+	assert.Empty(t, cProps.invariantsReported, "recovery clears the alert")
+	kt.AssertExpectations(t)
+}
@@ -0,0 +1,214 @@
+package ktfunc
+
+// Legacy cache adoption.
+//
+// Before caches were namespaced, a contract's files were cacheDir/<addr7>.db
+// and cacheDir/fees_<addr7>.db, where addr7 is the first 7 characters of the
+// address hex. That name says nothing about the chain and little about the
+// contract, so two contracts sharing a prefix, or one address on a testnet
+// and on mainnet, ended up in the same file.
+//
+// A legacy file is moved to the namespaced path the first time its contract
+// is opened, but only if its buried tip hash still matches the chain we are
+// talking to and one of its chunks matches what this contract logged over
+// the same blocks. The hash proves the chunks came from this chain; the
+// re-queried chunk tells apart two contracts whose addresses share the
+// prefix. Anything else is left where it is and the cache is rebuilt from
+// the creation block; the cache can always be recomputed, while adopting
+// another deployment's events would corrupt the lottery weights.
+//
+// Legacy files are at events schema v3 and fees schema v1. Opening them
+// migrates both in place, so an adopted cache keeps its chunks, tip and
+// fees.
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	log "github.com/sirupsen/logrus"
+	"go.etcd.io/bbolt"
+)
+
+// legacyCachePaths returns the pre-namespacing events and fees files of
+// ktAddr.
+func legacyCachePaths(cacheDir string, ktAddr common.Address) (events, fees string) {
+	prefix := ktAddr.Hex()[:7]
+	return filepath.Join(cacheDir, prefix+".db"), filepath.Join(cacheDir, "fees_"+prefix+".db")
+}
+
+// adoptLegacyCache moves the legacy cache files of cProps.KtAddr to their
+// namespaced paths when no namespaced cache exists yet and the legacy one
+// can be shown to come from the connected chain. Failures only cost a
+// rebuild, so they are logged and never returned. Caller holds eventStoreMu.
+func adoptLegacyCache(cProps *ConnectionProps) {
+	cacheDir := cProps.ResolvedCacheDir()
+	eventsName, feesName := boltCachePaths(cacheDir, cProps.ChainID, cProps.KtAddr)
+	if _, err := os.Stat(eventsName); !errors.Is(err, os.ErrNotExist) {
+		return
+	}
+	legacyEvents, legacyFees := legacyCachePaths(cacheDir, cProps.KtAddr)
+	if _, err := os.Stat(legacyEvents); err != nil {
+		return
+	}
+
+	if err := verifyLegacyCache(cProps, legacyEvents); err != nil {
+		log.Warnf("Not adopting legacy cache %s (%v); rebuilding under %s", legacyEvents, err, eventsName)
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(eventsName), 0755); err != nil {
+		log.Warnf("Not adopting legacy cache %s: %v", legacyEvents, err)
+		return
+	}
+	if err := os.Rename(legacyEvents, eventsName); err != nil {
+		log.Warnf("Not adopting legacy cache %s: %v", legacyEvents, err)
+		return
+	}
+	// The fee cache was written by the same deployment as the events next
+	// to it, so it follows the events file's verdict.
+	if _, err := os.Stat(feesName); errors.Is(err, os.ErrNotExist) {
+		if err := os.Rename(legacyFees, feesName); err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Warnf("Failed to move legacy fee cache %s: %v", legacyFees, err)
+		}
+	}
+	log.Infof("Migrated legacy cache %s to %s", legacyEvents, eventsName)
+}
+
+// verifyLegacyCache checks that the legacy events file at path has a buried
+// tip whose hash matches the connected chain, and that its first chunk with
+// events holds the stakes and withdrawals cProps.KtAddr logged there.
+func verifyLegacyCache(cProps *ConnectionProps, path string) error {
+	db, err := bbolt.Open(path, 0600, &bbolt.Options{ReadOnly: true, Timeout: time.Second})
+	if err != nil {
+		return fmt.Errorf("failed to open: %w", err)
+	}
+	defer db.Close()
+
+	var tip CacheTip
+	sample, found := legacyChunk{}, false
+	err = db.View(func(tx *bbolt.Tx) error {
+		meta := tx.Bucket([]byte("meta"))
+		if meta == nil {
+			return errors.New("no meta bucket")
+		}
+		if v := meta.Get([]byte("tip")); len(v) == 8 {
+			tip.Block = binary.BigEndian.Uint64(v)
+		}
+		if v := meta.Get([]byte("tip_hash")); len(v) == common.HashLength {
+			copy(tip.Hash[:], v)
+			tip.HasHash = true
+		}
+		sample, found, err = firstLegacyChunk(tx, tip.Block)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if !tip.HasHash {
+		return errors.New("its tip has no recorded block hash to check against the chain")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	header, err := cProps.Client.HeaderByNumber(ctx, new(big.Int).SetUint64(tip.Block))
+	if err != nil {
+		return fmt.Errorf("failed to read block %d: %w", tip.Block, err)
+	}
+	if header == nil || header.Hash() != tip.Hash {
+		return fmt.Errorf("block %d hash does not match chain %s", tip.Block, cProps.ChainID)
+	}
+
+	// The prefix only narrows the file down to contracts sharing the first
+	// seven characters of the address, so check the events themselves.
+	if !found {
+		return errors.New("it has no cached events to check against the contract")
+	}
+	if cProps.Kt == nil {
+		return errors.New("no contract binding to check its events against")
+	}
+	var onChain ChunkEvents
+	if err := queryChunkWithRetry(cProps, cProps.Kt, sample.start, sample.end, &onChain); err != nil {
+		return fmt.Errorf("failed to re-query blocks %d-%d: %w", sample.start, sample.end, err)
+	}
+	if !sameStakeEvents(sample.events, onChain) {
+		return fmt.Errorf("its events in blocks %d-%d don't match what contract %s logged there", sample.start, sample.end, cProps.KtAddr.Hex())
+	}
+	return nil
+}
+
+// legacyChunk is a cached chunk together with the blocks it covers.
+type legacyChunk struct {
+	start, end uint64
+	events     ChunkEvents
+}
+
+// firstLegacyChunk returns the first chunk at or below tip holding a stake
+// or withdrawal. A chunk runs up to the block before the next chunk's start
+// (or to tip for the last one), so the file's own chunk size is used
+// whatever the current -chunkSize is.
+func firstLegacyChunk(tx *bbolt.Tx, tip uint64) (legacyChunk, bool, error) {
+	chunks := tx.Bucket([]byte("chunks"))
+	if chunks == nil {
+		return legacyChunk{}, false, nil
+	}
+	c := chunks.Cursor()
+	for k, v := c.First(); k != nil; {
+		if len(k) != 8 {
+			return legacyChunk{}, false, errors.New("unrecognised chunk key layout")
+		}
+		start := binary.BigEndian.Uint64(k)
+		if start > tip {
+			break
+		}
+		var chunk ChunkEvents
+		if err := gob.NewDecoder(bytes.NewReader(v)).Decode(&chunk); err != nil {
+			return legacyChunk{}, false, fmt.Errorf("failed to decode chunk %d: %w", start, err)
+		}
+		end := tip
+		nk, nv := c.Next()
+		if len(nk) == 8 {
+			end = min(binary.BigEndian.Uint64(nk)-1, tip)
+		}
+		if len(chunk.StakeEvents)+len(chunk.WithdrawEvents) > 0 {
+			return legacyChunk{start: start, end: end, events: chunk}, true, nil
+		}
+		k, v = nk, nv
+	}
+	return legacyChunk{}, false, nil
+}
+
+// sameStakeEvents reports whether a and b hold the same stakes and
+// withdrawals, in any order. Gave events are ignored: older files never
+// cached them.
+func sameStakeEvents(a, b ChunkEvents) bool {
+	keys := func(c ChunkEvents) []string {
+		var out []string
+		for _, e := range c.StakeEvents {
+			out = append(out, fmt.Sprintf("s/%d/%s/%s", e.Block, e.Addr.Hex(), e.Amount))
+		}
+		for _, e := range c.WithdrawEvents {
+			out = append(out, fmt.Sprintf("w/%d/%s/%s", e.Block, e.Addr.Hex(), e.Amount))
+		}
+		sort.Strings(out)
+		return out
+	}
+	ka, kb := keys(a), keys(b)
+	if len(ka) != len(kb) {
+		return false
+	}
+	for i := range ka {
+		if ka[i] != kb[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,312 @@
+package ktfunc
+
+// Lottery test vectors. Every operator must compute the same winner from
+// the same chain, so two builds that disagree on any vector would split
+// consensus. A vector pins one epoch's inputs (stake history, range, seed,
+// declined stakers) and the outputs the pipeline must produce from them.
+// CheckVector runs the exact VoteAndReward pipeline, findMinOverBlockRange →
+// decline filter → calculateProbsForEachWallet → calcWinningWallet, so
+// checking a file of vectors shows whether a build agrees with the one that
+// wrote them without waiting for a live epoch.
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math/big"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// LotteryVectorVersion is the vector file format this build reads and
+// writes. Bump it when the format changes, not when expected outputs do.
+const LotteryVectorVersion = 1
+
+// LotteryVectorFile is a versioned set of vectors.
+type LotteryVectorFile struct {
+	Version int             `json:"version"`
+	Vectors []LotteryVector `json:"vectors"`
+}
+
+// LotteryVector is one epoch's inputs and expected outputs. Events are the
+// raw Staked/Withdrew history up to EpochEnd; amounts are decimal wei.
+type LotteryVector struct {
+	Name        string            `json:"name"`
+	Description string            `json:"description,omitempty"`
+	EpochStart  uint64            `json:"epochStart"`
+	EpochEnd    uint64            `json:"epochEnd"`
+	Seed        string            `json:"seed"`
+	Declined    []string          `json:"declined"`
+	Events      []CacheEvent      `json:"events"`
+	Expected    VectorExpectation `json:"expected"`
+}
+
+// VectorExpectation is what the pipeline computes for a vector. Stakers
+// are the eligible addresses in address order; probabilities must match
+// exactly, not within a tolerance.
+type VectorExpectation struct {
+	TotalMin string        `json:"totalMin"`
+	Stakers  []EpochStaker `json:"stakers"`
+	Winner   string        `json:"winner"`
+}
+
+// VectorResult is the outcome of checking one vector.
+type VectorResult struct {
+	Name  string   `json:"name"`
+	Pass  bool     `json:"pass"`
+	Diffs []string `json:"diffs,omitempty"`
+}
+
+// ReadVectorFile loads a vector file, refusing formats this build doesn't
+// know.
+func ReadVectorFile(path string) (*LotteryVectorFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var f LotteryVectorFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("failed to parse vector file %s: %w", path, err)
+	}
+	if f.Version != LotteryVectorVersion {
+		return nil, fmt.Errorf("vector file %s is format version %d; this build reads version %d", path, f.Version, LotteryVectorVersion)
+	}
+	return &f, nil
+}
+
+// WriteVectorFile writes f as indented JSON.
+func WriteVectorFile(w io.Writer, f *LotteryVectorFile) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(f)
+}
+
+// AppendVector adds v to the vector file at path, creating the file if it
+// doesn't exist.
+func AppendVector(path string, v *LotteryVector) error {
+	f, err := ReadVectorFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		f, err = &LotteryVectorFile{Version: LotteryVectorVersion}, nil
+	}
+	if err != nil {
+		return err
+	}
+	f.Vectors = append(f.Vectors, *v)
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := WriteVectorFile(out, f); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// RunVector computes a vector's outputs from its inputs, ignoring
+// v.Expected.
+func RunVector(v *LotteryVector) (*VectorExpectation, error) {
+	if v.EpochStart > v.EpochEnd {
+		return nil, fmt.Errorf("epoch start %d is after end %d", v.EpochStart, v.EpochEnd)
+	}
+	if !strings.HasPrefix(v.Seed, "0x") || len(v.Seed) != 2+2*common.HashLength {
+		return nil, fmt.Errorf("seed %q is not a 32-byte hex hash", v.Seed)
+	}
+	var stakes []StakeEvent
+	var withdraws []WithdrawEvent
+	for i, e := range v.Events {
+		if !common.IsHexAddress(e.Address) {
+			return nil, fmt.Errorf("event %d: invalid address %q", i, e.Address)
+		}
+		amount, ok := new(big.Int).SetString(e.Amount, 10)
+		if !ok || amount.Sign() < 0 {
+			return nil, fmt.Errorf("event %d: invalid amount %q", i, e.Amount)
+		}
+		if e.Block > v.EpochEnd {
+			return nil, fmt.Errorf("event %d: block %d is after the epoch end %d", i, e.Block, v.EpochEnd)
+		}
+		addr := common.HexToAddress(e.Address)
+		switch e.Type {
+		case CacheEventStake:
+			stakes = append(stakes, StakeEvent{Addr: addr, Amount: amount, Block: e.Block})
+		case CacheEventWithdraw:
+			withdraws = append(withdraws, WithdrawEvent{Addr: addr, Amount: amount, Block: e.Block})
+		default:
+			return nil, fmt.Errorf("event %d: unknown type %q", i, e.Type)
+		}
+	}
+
+	totalMin, mins, err := findMinOverBlockRange(v.EpochStart, v.EpochEnd, buildStakeDataMap(stakes, withdraws))
+	if err != nil {
+		return nil, err
+	}
+	// filterDeclinedStakers reads declines from the contract; a vector
+	// carries them, and dropping them here has the same effect.
+	for _, d := range v.Declined {
+		if !common.IsHexAddress(d) {
+			return nil, fmt.Errorf("invalid declined address %q", d)
+		}
+		delete(mins, common.HexToAddress(d))
+	}
+	totalMin = big.NewInt(0)
+	for _, data := range mins {
+		totalMin.Add(totalMin, data.StakeAmount)
+	}
+	calculateProbsForEachWallet(mins, totalMin)
+	winner, err := calcWinningWallet(mins, common.HexToHash(v.Seed))
+	if err != nil {
+		return nil, fmt.Errorf("failed to calculate winning wallet: %w", err)
+	}
+
+	out := &VectorExpectation{TotalMin: totalMin.String(), Stakers: []EpochStaker{}, Winner: winner.Hex()}
+	for addr, d := range mins {
+		s := EpochStaker{Address: addr.Hex(), MinStake: d.StakeAmount.String()}
+		if d.Prob != nil {
+			s.Probability, _ = d.Prob.Float64()
+		}
+		out.Stakers = append(out.Stakers, s)
+	}
+	sort.Slice(out.Stakers, func(i, j int) bool { return out.Stakers[i].Address < out.Stakers[j].Address })
+	return out, nil
+}
+
+// CheckVector runs v and compares the result with v.Expected.
+func CheckVector(v *LotteryVector) VectorResult {
+	res := VectorResult{Name: v.Name}
+	got, err := RunVector(v)
+	if err != nil {
+		res.Diffs = []string{err.Error()}
+		return res
+	}
+	want := v.Expected
+	if got.Winner != want.Winner {
+		res.Diffs = append(res.Diffs, fmt.Sprintf("winner: got %s, want %s", got.Winner, want.Winner))
+	}
+	if got.TotalMin != want.TotalMin {
+		res.Diffs = append(res.Diffs, fmt.Sprintf("total min: got %s, want %s", got.TotalMin, want.TotalMin))
+	}
+	wantBy := make(map[string]EpochStaker, len(want.Stakers))
+	for _, s := range want.Stakers {
+		wantBy[s.Address] = s
+	}
+	for _, g := range got.Stakers {
+		w, ok := wantBy[g.Address]
+		delete(wantBy, g.Address)
+		switch {
+		case !ok:
+			res.Diffs = append(res.Diffs, fmt.Sprintf("%s: eligible, but not expected to be", g.Address))
+		case g.MinStake != w.MinStake:
+			res.Diffs = append(res.Diffs, fmt.Sprintf("%s: min stake got %s, want %s", g.Address, g.MinStake, w.MinStake))
+		case g.Probability != w.Probability:
+			res.Diffs = append(res.Diffs, fmt.Sprintf("%s: probability got %s, want %s", g.Address,
+				strconv.FormatFloat(g.Probability, 'g', -1, 64), strconv.FormatFloat(w.Probability, 'g', -1, 64)))
+		}
+	}
+	for addr := range wantBy {
+		res.Diffs = append(res.Diffs, fmt.Sprintf("%s: expected to be eligible, but isn't", addr))
+	}
+	sort.Strings(res.Diffs)
+	res.Pass = len(res.Diffs) == 0
+	return res
+}
+
+// CheckVectors checks every vector in f.
+func CheckVectors(f *LotteryVectorFile) []VectorResult {
+	results := make([]VectorResult, 0, len(f.Vectors))
+	for i := range f.Vectors {
+		results = append(results, CheckVector(&f.Vectors[i]))
+	}
+	return results
+}
+
+// MakeVector captures the epoch [start, end] from the chain as a vector:
+// the stake history up to end from the event cache, the seed block's hash,
+// the stakers that decline today, and the outputs this build computes.
+func MakeVector(cProps *ConnectionProps, start, end uint64, name string) (*LotteryVector, error) {
+	creation, err := GetContractCreationBlock(cProps)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get contract creation block: %w", err)
+	}
+	stakeDataMap, err := GatherStakesAndWithdraws(cProps, cProps.Kt, new(big.Int).SetUint64(creation), new(big.Int).SetUint64(end))
+	if err != nil {
+		return nil, fmt.Errorf("failed to gather stakes: %w", err)
+	}
+	cached, err := InspectCache(cProps, CacheQuery{ToBlock: end}, CacheSections{Events: true})
+	if err != nil {
+		return nil, err
+	}
+	_, _, declined, err := replayEpochOdds(cProps, stakeDataMap, start, end)
+	if err != nil {
+		return nil, err
+	}
+	header, err := cProps.Client.HeaderByNumber(context.Background(), new(big.Int).SetUint64(end+SeedOffset))
+	if err != nil || header == nil {
+		return nil, fmt.Errorf("failed to read seed block %d: %v", end+SeedOffset, err)
+	}
+
+	if name == "" {
+		name = fmt.Sprintf("epoch %d-%d", start, end)
+		if cProps.ChainID != nil {
+			name = fmt.Sprintf("chain %s %s", cProps.ChainID, name)
+		}
+	}
+	v := &LotteryVector{
+		Name:       name,
+		EpochStart: start,
+		EpochEnd:   end,
+		Seed:       header.Hash().Hex(),
+		Declined:   []string{},
+		Events:     []CacheEvent{},
+	}
+	// Donations don't move stake, and the lottery never sees them.
+	for _, e := range cached.Events {
+		if e.Type != CacheEventGave {
+			v.Events = append(v.Events, e)
+		}
+	}
+	for _, addr := range declined {
+		v.Declined = append(v.Declined, addr.Hex())
+	}
+	expected, err := RunVector(v)
+	if err != nil {
+		return nil, err
+	}
+	v.Expected = *expected
+	return v, nil
+}
+
+// WriteVectorResults renders results to w as a table or JSON.
+func WriteVectorResults(w io.Writer, results []VectorResult, format OutputFormat) error {
+	switch format {
+	case FormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(results)
+	case FormatCSV:
+		return fmt.Errorf("vector results are available as table or json, not csv")
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	failed := 0
+	for _, r := range results {
+		status := "PASS"
+		if !r.Pass {
+			status = "FAIL"
+			failed++
+		}
+		fmt.Fprintf(tw, "%s\t%s\n", status, r.Name)
+		for _, d := range r.Diffs {
+			fmt.Fprintf(tw, "\t  %s\n", d)
+		}
+	}
+	fmt.Fprintf(tw, "\n%d vectors, %d passed, %d failed\n", len(results), len(results)-failed, failed)
+	return tw.Flush()
+}
@@ -0,0 +1,87 @@
+package ktfunc
+
+import (
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"ktp2/src/abis/ktv2"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestCanonicalLotteryVectors is the cross-build consensus check: a change
+// that makes any of these fail changes which wallet wins real epochs.
+func TestCanonicalLotteryVectors(t *testing.T) {
+	logrus.SetLevel(logrus.FatalLevel)
+	defer logrus.SetLevel(logrus.InfoLevel)
+
+	f, err := ReadVectorFile(filepath.Join("testdata", "lottery_vectors.json"))
+	require.NoError(t, err)
+	require.NotEmpty(t, f.Vectors)
+	for _, r := range CheckVectors(f) {
+		assert.True(t, r.Pass, "%s: %v", r.Name, r.Diffs)
+	}
+}
+
+func TestCheckVector_ReportsDiffs(t *testing.T) {
+	logrus.SetLevel(logrus.FatalLevel)
+	defer logrus.SetLevel(logrus.InfoLevel)
+
+	f, err := ReadVectorFile(filepath.Join("testdata", "lottery_vectors.json"))
+	require.NoError(t, err)
+	v := f.Vectors[1] // two stakers
+	v.Expected.Stakers = append([]EpochStaker(nil), v.Expected.Stakers...)
+	v.Expected.Winner = common.HexToAddress("0xdead").Hex()
+	v.Expected.Stakers[0].Probability += 1e-15
+
+	r := CheckVector(&v)
+	assert.False(t, r.Pass)
+	require.Len(t, r.Diffs, 2)
+	assert.Contains(t, r.Diffs[0], "probability")
+	assert.Contains(t, r.Diffs[1], "winner")
+
+	v.Events = append(v.Events, CacheEvent{Type: CacheEventStake, Address: v.Events[0].Address, Amount: "1", Block: v.EpochEnd + 1})
+	r = CheckVector(&v)
+	assert.False(t, r.Pass)
+	assert.Contains(t, r.Diffs[0], "after the epoch end")
+}
+
+func TestReadVectorFile_RejectsOtherVersions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "v.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"version": 2, "vectors": []}`), 0o644))
+	_, err := ReadVectorFile(path)
+	assert.ErrorContains(t, err, "format version 2")
+}
+
+func TestMakeVector(t *testing.T) {
+	logrus.SetLevel(logrus.FatalLevel)
+	defer logrus.SetLevel(logrus.InfoLevel)
+
+	kt, a, b := threeEpochHistory()
+	kt.declined = map[common.Address]bool{b: true}
+	// An earlier donation is cached alongside the stakes but left out.
+	kt.gave = []*ktv2.Ktv2Gave{{Arg0: a, Arg1: big.NewInt(3), Raw: types.Log{BlockNumber: 200}}}
+	cProps := newOddsTestProps(t, kt, 500)
+
+	v, err := MakeVector(cProps, 300, 400, "")
+	require.NoError(t, err)
+	assert.Equal(t, "epoch 300-400", v.Name)
+	assert.Equal(t, []string{b.Hex()}, v.Declined)
+	assert.Len(t, v.Events, 4)
+	assert.Equal(t, a.Hex(), v.Expected.Winner)
+	assert.True(t, CheckVector(v).Pass)
+
+	path := filepath.Join(t.TempDir(), "captured.json")
+	require.NoError(t, AppendVector(path, v))
+	require.NoError(t, AppendVector(path, v))
+	f, err := ReadVectorFile(path)
+	require.NoError(t, err)
+	require.Len(t, f.Vectors, 2)
+	assert.Equal(t, *v, f.Vectors[1])
+}
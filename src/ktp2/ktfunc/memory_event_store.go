@@ -0,0 +1,224 @@
+package ktfunc
+
+import (
+	"math/big"
+	"sort"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// MemoryEventStore is an EventStore held entirely in memory. Nothing
+// survives the process, so every run re-fetches its events from the chain.
+// Close is a no-op: the store stays usable for as long as its owner keeps
+// it, which lets one instance be shared through ConnectionProps.Store.
+// Safe for concurrent use.
+type MemoryEventStore struct {
+	mu        sync.Mutex
+	chunks    map[uint64]ChunkEvents
+	tip       CacheTip
+	snapshots map[uint64]StakeSnapshot
+	fees      map[common.Address]map[uint64]*big.Int
+	feeLedger map[common.Address]*memFeeLedger
+}
+
+type memFeeLedger struct {
+	tip     FeeLedgerTip
+	entries map[uint64]FeeLedgerEntry
+}
+
+// NewMemoryEventStore returns an empty in-memory store.
+func NewMemoryEventStore() *MemoryEventStore {
+	return &MemoryEventStore{
+		chunks:    make(map[uint64]ChunkEvents),
+		snapshots: make(map[uint64]StakeSnapshot),
+		fees:      make(map[common.Address]map[uint64]*big.Int),
+		feeLedger: make(map[common.Address]*memFeeLedger),
+	}
+}
+
+// copyChunk copies the event slices so callers appending to a loaded chunk
+// can't write through to the stored one.
+func copyChunk(c ChunkEvents) ChunkEvents {
+	return ChunkEvents{
+		StakeEvents:    append([]StakeEvent(nil), c.StakeEvents...),
+		WithdrawEvents: append([]WithdrawEvent(nil), c.WithdrawEvents...),
+		GaveEvents:     append([]GaveEvent(nil), c.GaveEvents...),
+		GaveMissing:    c.GaveMissing,
+	}
+}
+
+func copySnapshot(s StakeSnapshot) StakeSnapshot {
+	return StakeSnapshot{Block: s.Block, Balances: append([]SnapshotBalance(nil), s.Balances...)}
+}
+
+func (m *MemoryEventStore) LoadChunk(chunkStart uint64) (ChunkEvents, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c, ok := m.chunks[chunkStart]
+	if !ok {
+		return ChunkEvents{}, false, nil
+	}
+	return copyChunk(c), true, nil
+}
+
+func (m *MemoryEventStore) StoreChunk(chunkStart uint64, chunk ChunkEvents) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.chunks[chunkStart] = copyChunk(chunk)
+	return nil
+}
+
+func (m *MemoryEventStore) ForEachChunk(fn func(chunkStart uint64, chunk ChunkEvents) error) error {
+	m.mu.Lock()
+	starts := make([]uint64, 0, len(m.chunks))
+	chunks := make(map[uint64]ChunkEvents, len(m.chunks))
+	for k, c := range m.chunks {
+		starts = append(starts, k)
+		chunks[k] = copyChunk(c)
+	}
+	m.mu.Unlock()
+
+	// fn runs without the lock held so it may call back into the store.
+	sort.Slice(starts, func(i, j int) bool { return starts[i] < starts[j] })
+	for _, k := range starts {
+		if err := fn(k, chunks[k]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *MemoryEventStore) Tip() (CacheTip, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.tip, nil
+}
+
+func (m *MemoryEventStore) SetTip(tip CacheTip) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !tip.HasHash {
+		tip.Hash = common.Hash{}
+	}
+	m.tip = tip
+	return nil
+}
+
+func (m *MemoryEventStore) ResetChunks() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.chunks = make(map[uint64]ChunkEvents)
+	m.snapshots = make(map[uint64]StakeSnapshot)
+	m.tip = CacheTip{}
+	return nil
+}
+
+func (m *MemoryEventStore) LoadSnapshot(block uint64) (StakeSnapshot, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var best StakeSnapshot
+	found := false
+	for k, s := range m.snapshots {
+		if k <= block && (!found || k > best.Block) {
+			best, found = s, true
+		}
+	}
+	if !found {
+		return StakeSnapshot{}, false, nil
+	}
+	return copySnapshot(best), true, nil
+}
+
+func (m *MemoryEventStore) StoreSnapshots(snaps []StakeSnapshot) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, s := range snaps {
+		m.snapshots[s.Block] = copySnapshot(s)
+	}
+	return nil
+}
+
+func (m *MemoryEventStore) DropSnapshots() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.snapshots = make(map[uint64]StakeSnapshot)
+	return nil
+}
+
+func (m *MemoryEventStore) GetFee(addr common.Address, block uint64) (*big.Int, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	fee, ok := m.fees[addr][block]
+	if !ok {
+		return nil, false, nil
+	}
+	return new(big.Int).Set(fee), true, nil
+}
+
+func (m *MemoryEventStore) PutFees(addr common.Address, fees map[uint64]*big.Int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.fees[addr] == nil {
+		m.fees[addr] = make(map[uint64]*big.Int)
+	}
+	for block, fee := range fees {
+		m.fees[addr][block] = new(big.Int).Set(fee)
+	}
+	return nil
+}
+
+func (m *MemoryEventStore) FeeLedger(oc common.Address) (FeeLedgerTip, []FeeLedgerEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	l := m.feeLedger[oc]
+	if l == nil {
+		return FeeLedgerTip{}, nil, nil
+	}
+	entries := make([]FeeLedgerEntry, 0, len(l.entries))
+	for _, e := range l.entries {
+		entries = append(entries, copyFeeLedgerEntry(e))
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Epoch < entries[j].Epoch })
+	return l.tip, entries, nil
+}
+
+func (m *MemoryEventStore) UpdateFeeLedger(oc common.Address, tip FeeLedgerTip, entries []FeeLedgerEntry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	l := m.feeLedger[oc]
+	if l == nil {
+		l = &memFeeLedger{entries: make(map[uint64]FeeLedgerEntry)}
+		m.feeLedger[oc] = l
+	}
+	for _, e := range entries {
+		l.entries[e.Epoch] = copyFeeLedgerEntry(e)
+	}
+	l.tip = tip
+	return nil
+}
+
+func (m *MemoryEventStore) ResetFeeLedger(oc common.Address) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.feeLedger, oc)
+	return nil
+}
+
+func copyFeeLedgerEntry(e FeeLedgerEntry) FeeLedgerEntry {
+	if e.Fee != nil {
+		e.Fee = new(big.Int).Set(e.Fee)
+	}
+	return e
+}
+
+// Migrate is a no-op: an in-memory store is always on the current layout.
+func (m *MemoryEventStore) Migrate() error { return nil }
+
+// Close is a no-op; see MemoryEventStore.
+func (m *MemoryEventStore) Close() error { return nil }
+
+// Stats reports the current schema version; nothing is on disk.
+func (m *MemoryEventStore) Stats() (StoreStats, error) {
+	return StoreStats{SchemaVersion: cacheSchemaVersion}, nil
+}
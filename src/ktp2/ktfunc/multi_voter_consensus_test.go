@@ -45,6 +45,10 @@ func mockGatherStakesAndWithdraws(_ *ConnectionProps, _ Ktv2Interface, _ *big.In
 	return stakeDataMap, nil
 }
 
+func mockGatherEpochStakes(cProps *ConnectionProps, kt Ktv2Interface, creationBlock, _, endBlock *big.Int) (map[common.Address]map[uint64]*UserStakeData, error) {
+	return mockGatherStakesAndWithdraws(cProps, kt, creationBlock, endBlock)
+}
+
 func TestMultiVoterConsensus(t *testing.T) {
 	epochStart := big.NewInt(100)
 	epochInterval := uint16(10)
@@ -93,6 +97,9 @@ func TestMultiVoterConsensus(t *testing.T) {
 			originalGather := GatherStakesAndWithdraws
 			GatherStakesAndWithdraws = mockGatherStakesAndWithdraws
 			defer func() { GatherStakesAndWithdraws = originalGather }()
+			originalEpochGather := GatherEpochStakes
+			GatherEpochStakes = mockGatherEpochStakes
+			defer func() { GatherEpochStakes = originalEpochGather }()
 			originalCalc := calcWinningWallet
 			defer func() { calcWinningWallet = originalCalc }()
 			// Mock BlockRwd for winner (stateful)
@@ -105,6 +112,7 @@ func TestMultiVoterConsensus(t *testing.T) {
 			// Mock BlockRwd for bad winners (always 0)
 			mockKt.On("BlockRwd", mock.Anything, epochStart, mock.MatchedBy(func(addr common.Address) bool { return addr != winner })).Return(uint16(0), nil).Maybe()
 			mockKt.On("BlockRwd", mock.Anything, mock.Anything, mock.AnythingOfType("common.Address")).Return(uint16(0), nil).Maybe()
+			mockKt.On("FilterVoted", mock.Anything).Return(&mockVotedIter{}, nil).Maybe() // peer votes, read after voting
 			// Mock Vote
 			mockKt.On("Vote", mock.Anything, mock.AnythingOfType("common.Address"), mock.AnythingOfType("string")).Run(func(args mock.Arguments) {
 				rec := args.Get(1).(common.Address)
@@ -185,6 +193,7 @@ func TestImproperVoterOverruled(t *testing.T) {
 		nil,
 	)
 	mockKt.On("BlockRwd", mock.Anything, epochStart, badWinner).Return(uint16(1), nil)
+	mockKt.On("FilterVoted", mock.Anything).Return(&mockVotedIter{}, nil).Maybe() // peer votes, read after voting
 	mockKt.On("Vote", mock.Anything, mock.AnythingOfType("common.Address"), mock.AnythingOfType("string")).Run(func(args mock.Arguments) {
 		rec := args.Get(1).(common.Address)
 		if rec == winner {
@@ -195,6 +204,9 @@ func TestImproperVoterOverruled(t *testing.T) {
 	originalGather := GatherStakesAndWithdraws
 	GatherStakesAndWithdraws = mockGatherStakesAndWithdraws
 	defer func() { GatherStakesAndWithdraws = originalGather }()
+	originalEpochGather := GatherEpochStakes
+	GatherEpochStakes = mockGatherEpochStakes
+	defer func() { GatherEpochStakes = originalEpochGather }()
 	propsGood := &ConnectionProps{
 		Client:       mockClient,
 		Kt:           mockKt,
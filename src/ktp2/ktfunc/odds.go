@@ -0,0 +1,163 @@
+package ktfunc
+
+// Live odds for the epoch in progress. This runs the same pipeline the vote
+// uses (stake ledger gather, per-address minimum, declined filter,
+// log-normalized probabilities) over the blocks seen so far, so stakers can see where they
+// stand before the epoch closes. Minimums only ever fall as the epoch goes
+// on, so the numbers are provisional until endBlock.
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+)
+
+// oddsProvisionalNote is printed with every odds report that covers an
+// unfinished epoch.
+const oddsProvisionalNote = "Provisional: minimum stakes can still drop (a withdrawal before endBlock lowers a staker's minimum), which shifts everyone's odds."
+
+// OddsEntry is one eligible staker's provisional minimum and win chance.
+type OddsEntry struct {
+	Address     string  `json:"address"`
+	MinStake    string  `json:"minStake"`
+	Probability float64 `json:"probability"`
+}
+
+// OddsReport is the provisional outcome of the current epoch as of
+// ThroughBlock. Final is set once the epoch has ended, when the minimums
+// can no longer change.
+type OddsReport struct {
+	StartBlock   uint64      `json:"startBlock"`
+	EndBlock     uint64      `json:"endBlock"`
+	ThroughBlock uint64      `json:"throughBlock"`
+	Final        bool        `json:"final"`
+	TotalMin     string      `json:"totalMin"`
+	Note         string      `json:"note,omitempty"`
+	Entries      []OddsEntry `json:"entries"`
+}
+
+// EpochOdds computes every eligible staker's provisional minimum stake and
+// win probability for the current epoch, from its start block up to head
+// (or endBlock, once passed). Entries are sorted by probability, highest
+// first.
+func EpochOdds(cProps *ConnectionProps) (*OddsReport, error) {
+	callOpts := &bind.CallOpts{Context: context.Background(), From: cProps.MyPubKey}
+	startBlock, err := cProps.Kt.StartBlock(callOpts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read start block: %w", err)
+	}
+	interval, err := cProps.Kt.EpochInterval(callOpts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read epoch interval: %w", err)
+	}
+	if interval <= 0 {
+		return nil, fmt.Errorf("invalid epoch interval %d", interval)
+	}
+	head, err := cProps.Client.BlockNumber(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("failed to read current block: %w", err)
+	}
+	endBlock := startBlock.Uint64() + uint64(interval)
+	through := min(head, endBlock)
+	if through < startBlock.Uint64() {
+		return nil, fmt.Errorf("head %d is before epoch start %d", head, startBlock.Uint64())
+	}
+
+	creation, err := GetContractCreationBlock(cProps)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get contract creation block: %w", err)
+	}
+	stakeDataMap, err := readEpochStakes(cProps, cProps.Kt, creation, startBlock.Uint64(), through)
+	if err != nil {
+		return nil, fmt.Errorf("failed to gather stakes: %w", err)
+	}
+	_, mins, err := findMinOverBlockRange(startBlock.Uint64(), through, stakeDataMap)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find minimum stakes: %w", err)
+	}
+	if err := filterDeclinedStakers(mins, cProps); err != nil {
+		return nil, fmt.Errorf("failed to filter declined stakers: %w", err)
+	}
+	totalMin := big.NewInt(0)
+	for _, data := range mins {
+		totalMin.Add(totalMin, data.StakeAmount)
+	}
+	calculateProbsForEachWallet(mins, totalMin)
+
+	report := &OddsReport{
+		StartBlock:   startBlock.Uint64(),
+		EndBlock:     endBlock,
+		ThroughBlock: through,
+		Final:        head >= endBlock,
+		TotalMin:     totalMin.String(),
+		Entries:      make([]OddsEntry, 0, len(mins)),
+	}
+	if !report.Final {
+		report.Note = oddsProvisionalNote
+	}
+	for addr, data := range mins {
+		var prob float64
+		if data.Prob != nil {
+			prob, _ = data.Prob.Float64()
+		}
+		report.Entries = append(report.Entries, OddsEntry{Address: addr.Hex(), MinStake: data.StakeAmount.String(), Probability: prob})
+	}
+	sort.Slice(report.Entries, func(i, j int) bool {
+		a, b := report.Entries[i], report.Entries[j]
+		if a.Probability != b.Probability {
+			return a.Probability > b.Probability
+		}
+		return a.Address < b.Address
+	})
+	return report, nil
+}
+
+// WriteOddsReport renders report to w. CSV carries the entries only.
+func WriteOddsReport(w io.Writer, report *OddsReport, format OutputFormat) error {
+	switch format {
+	case FormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	case FormatCSV:
+		cw := csv.NewWriter(w)
+		if err := cw.Write([]string{"address", "min_stake", "probability"}); err != nil {
+			return err
+		}
+		for _, e := range report.Entries {
+			if err := cw.Write([]string{e.Address, e.MinStake, strconv.FormatFloat(e.Probability, 'f', -1, 64)}); err != nil {
+				return err
+			}
+		}
+		cw.Flush()
+		return cw.Error()
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	state := "in progress"
+	if report.Final {
+		state = "ended, awaiting reward"
+	}
+	fmt.Fprintf(tw, "Epoch %d-%d (%s), stakes through block %d, total minimum %s wei\n",
+		report.StartBlock, report.EndBlock, state, report.ThroughBlock, report.TotalMin)
+	if len(report.Entries) == 0 {
+		fmt.Fprintln(tw, "  No eligible stakers yet.")
+	} else {
+		fmt.Fprintln(tw, "  Address\tMin stake (wei)\tWin chance")
+		for _, e := range report.Entries {
+			fmt.Fprintf(tw, "  %s\t%s\t%.4f%%\n", e.Address, e.MinStake, e.Probability*100)
+		}
+	}
+	if report.Note != "" {
+		fmt.Fprintf(tw, "\n%s\n", report.Note)
+	}
+	return tw.Flush()
+}
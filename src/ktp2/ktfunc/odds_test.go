@@ -0,0 +1,194 @@
+package ktfunc
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"ktp2/src/abis/ktv2"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// epochFakeKt adds the epoch state reads and the Voted/Rwd history to
+// ledgerFakeKt's stake events.
+type epochFakeKt struct {
+	*ledgerFakeKt
+	start    int64
+	interval uint16
+	declined map[common.Address]bool
+	voted    []*ktv2.Ktv2Voted
+	rwds     []*ktv2.Ktv2Rwd
+}
+
+func (f *epochFakeKt) FilterVoted(opts *bind.FilterOpts) (VotedIterator, error) {
+	var out []*ktv2.Ktv2Voted
+	for _, e := range f.voted {
+		if e.Raw.BlockNumber >= opts.Start && e.Raw.BlockNumber <= *opts.End {
+			out = append(out, e)
+		}
+	}
+	return &mockVotedIter{events: out}, nil
+}
+
+func (f *epochFakeKt) FilterRwd(opts *bind.FilterOpts) (RwdIterator, error) {
+	var out []*ktv2.Ktv2Rwd
+	for _, e := range f.rwds {
+		if e.Raw.BlockNumber >= opts.Start && e.Raw.BlockNumber <= *opts.End {
+			out = append(out, e)
+		}
+	}
+	return &mockRwdIter{events: out}, nil
+}
+
+func (f *epochFakeKt) StartBlock(*bind.CallOpts) (*big.Int, error)  { return big.NewInt(f.start), nil }
+func (f *epochFakeKt) EpochInterval(*bind.CallOpts) (uint16, error) { return f.interval, nil }
+func (f *epochFakeKt) Declines(_ *bind.CallOpts, addr common.Address) (bool, error) {
+	return f.declined[addr], nil
+}
+
+func newOddsTestProps(t *testing.T, kt *epochFakeKt, head uint64) *ConnectionProps {
+	client := &MockEthClient{}
+	client.On("BlockNumber", mock.Anything).Return(head, nil).Maybe()
+	client.On("HeaderByNumber", mock.Anything, mock.Anything).Return(&types.Header{}, nil).Maybe()
+	return &ConnectionProps{
+		Client:    client,
+		Kt:        kt,
+		KtAddr:    common.HexToAddress("0x1234567890123456789012345678901234567890"),
+		KtBlock:   big.NewInt(100),
+		ChunkSize: 100,
+		Store:     NewMemoryEventStore(),
+	}
+}
+
+// mockKtHistory returns a MockKtv2 serving h's stake, vote and reward history
+// and epoch state, so a test only sets up the calls it is about, Gave events
+// included.
+func mockKtHistory(h *epochFakeKt) *MockKtv2 {
+	kt := &MockKtv2{}
+	kt.On("FilterStaked", mock.Anything).Return(func(o *bind.FilterOpts) StakedIterator {
+		it, _ := h.FilterStaked(o)
+		return it
+	}, nil).Maybe()
+	kt.On("FilterWithdrew", mock.Anything).Return(func(o *bind.FilterOpts) WithdrewIterator {
+		it, _ := h.FilterWithdrew(o)
+		return it
+	}, nil).Maybe()
+	kt.On("FilterVoted", mock.Anything).Return(func(o *bind.FilterOpts) VotedIterator {
+		it, _ := h.FilterVoted(o)
+		return it
+	}, nil).Maybe()
+	kt.On("FilterRwd", mock.Anything).Return(func(o *bind.FilterOpts) RwdIterator {
+		it, _ := h.FilterRwd(o)
+		return it
+	}, nil).Maybe()
+	kt.On("StartBlock", mock.Anything).Return(big.NewInt(h.start), nil).Maybe()
+	kt.On("EpochInterval", mock.Anything).Return(h.interval, nil).Maybe()
+	for addr, declined := range h.declined {
+		kt.On("Declines", mock.Anything, addr).Return(declined, nil).Maybe()
+	}
+	kt.On("Declines", mock.Anything, mock.Anything).Return(false, nil).Maybe()
+	return kt
+}
+
+// atBlock matches CallOpts reading the state at block n.
+func atBlock(n uint64) interface{} {
+	return mock.MatchedBy(func(o *bind.CallOpts) bool { return o.BlockNumber != nil && o.BlockNumber.Uint64() == n })
+}
+
+func TestEpochOdds_ProvisionalMidEpoch(t *testing.T) {
+	logrus.SetLevel(logrus.FatalLevel)
+	defer logrus.SetLevel(logrus.InfoLevel)
+
+	big1, small, declined := common.HexToAddress("0x0a"), common.HexToAddress("0x0b"), common.HexToAddress("0x0c")
+	kt := &epochFakeKt{
+		ledgerFakeKt: &ledgerFakeKt{
+			stakes: []StakeEvent{
+				{Addr: big1, Amount: big.NewInt(1_000_000), Block: 150},
+				{Addr: small, Amount: big.NewInt(1_000), Block: 160},
+				{Addr: declined, Amount: big.NewInt(5_000_000), Block: 170},
+				{Addr: small, Amount: big.NewInt(9_000), Block: 480}, // after head
+			},
+			withdraws: []WithdrawEvent{{Addr: big1, Amount: big.NewInt(400_000), Block: 350}},
+		},
+		start:    300,
+		interval: 200,
+		declined: map[common.Address]bool{declined: true},
+	}
+	cProps := newOddsTestProps(t, kt, 420)
+
+	report, err := EpochOdds(cProps)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(300), report.StartBlock)
+	assert.Equal(t, uint64(500), report.EndBlock)
+	assert.Equal(t, uint64(420), report.ThroughBlock)
+	assert.False(t, report.Final)
+	assert.NotEmpty(t, report.Note)
+	assert.Equal(t, "601000", report.TotalMin)
+
+	require.Len(t, report.Entries, 2, "declined staker is not eligible")
+	assert.Equal(t, big1.Hex(), report.Entries[0].Address)
+	assert.Equal(t, "600000", report.Entries[0].MinStake, "withdrawal inside the epoch lowers the minimum")
+	assert.Equal(t, small.Hex(), report.Entries[1].Address)
+	assert.Equal(t, "1000", report.Entries[1].MinStake, "stake after head is not counted")
+	assert.Greater(t, report.Entries[0].Probability, report.Entries[1].Probability)
+	assert.InDelta(t, 1.0, report.Entries[0].Probability+report.Entries[1].Probability, 1e-9)
+}
+
+func TestEpochOdds_FinalOnceEpochEnds(t *testing.T) {
+	logrus.SetLevel(logrus.FatalLevel)
+	defer logrus.SetLevel(logrus.InfoLevel)
+
+	addr := common.HexToAddress("0x0a")
+	kt := &epochFakeKt{
+		ledgerFakeKt: &ledgerFakeKt{stakes: []StakeEvent{{Addr: addr, Amount: big.NewInt(10), Block: 150}}},
+		start:        300,
+		interval:     200,
+	}
+	report, err := EpochOdds(newOddsTestProps(t, kt, 900))
+	require.NoError(t, err)
+	assert.True(t, report.Final)
+	assert.Empty(t, report.Note)
+	assert.Equal(t, uint64(500), report.ThroughBlock, "stakes past endBlock don't count")
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteOddsReport(&buf, report, FormatJSON))
+	var decoded OddsReport
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &decoded))
+	assert.Equal(t, *report, decoded)
+}
+
+// TestEpochOdds_ReadsStakeLedger — the odds start from the ledger snapshot
+// at the epoch start instead of folding every event since creation.
+func TestEpochOdds_ReadsStakeLedger(t *testing.T) {
+	logrus.SetLevel(logrus.FatalLevel)
+	defer logrus.SetLevel(logrus.InfoLevel)
+
+	addr := common.HexToAddress("0x0a")
+	kt := &epochFakeKt{
+		ledgerFakeKt: &ledgerFakeKt{stakes: []StakeEvent{{Addr: addr, Amount: big.NewInt(10), Block: 150}}},
+		start:        300,
+		interval:     200,
+	}
+	cProps := newOddsTestProps(t, kt, 420)
+	report, err := EpochOdds(cProps)
+	require.NoError(t, err)
+	assert.Equal(t, "10", report.TotalMin)
+	snap, found, err := cProps.Store.LoadSnapshot(300)
+	require.NoError(t, err)
+	require.True(t, found, "the buried epoch start is snapshotted")
+	assert.Equal(t, uint64(300), snap.Block)
+
+	// A snapshot the events don't back shows the ledger is what is read.
+	require.NoError(t, cProps.Store.StoreSnapshots([]StakeSnapshot{{Block: 300, Balances: []SnapshotBalance{{Addr: addr, Amount: big.NewInt(7)}}}}))
+	report, err = EpochOdds(cProps)
+	require.NoError(t, err)
+	assert.Equal(t, "7", report.TotalMin)
+}
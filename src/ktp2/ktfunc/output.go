@@ -0,0 +1,27 @@
+package ktfunc
+
+import (
+	"fmt"
+	"strings"
+)
+
+// OutputFormat selects how report commands render their results.
+type OutputFormat string
+
+const (
+	FormatTable OutputFormat = "table"
+	FormatJSON  OutputFormat = "json"
+	FormatCSV   OutputFormat = "csv"
+)
+
+// ParseOutputFormat validates a -format value; empty means FormatTable.
+func ParseOutputFormat(s string) (OutputFormat, error) {
+	switch f := OutputFormat(strings.ToLower(s)); f {
+	case "":
+		return FormatTable, nil
+	case FormatTable, FormatJSON, FormatCSV:
+		return f, nil
+	default:
+		return "", fmt.Errorf("unknown output format %q (want table, json or csv)", s)
+	}
+}
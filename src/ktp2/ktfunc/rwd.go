@@ -3,9 +3,8 @@ package ktfunc
 import (
 	"context"
 	"fmt"
+	"math"
 	"math/big"
-	"os"
-	"sort"
 	"strconv"
 	"strings"
 
@@ -13,7 +12,6 @@ import (
 
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common"
-	"github.com/ethereum/go-ethereum/core/types"
 	log "github.com/sirupsen/logrus"
 	"go.etcd.io/bbolt"
 )
@@ -23,140 +21,26 @@ type FeeInfo struct {
 	Fee   *big.Int
 }
 
-// GetOwedEpochBlocks retrieves the unique epoch start blocks where the given address accrued OC fees,
-// by filtering Voted and Rwd events and checking if the transaction was from the address.
+// GetOwedEpochBlocks returns the start blocks of the epochs in [startBlock,
+// endBlock] in which addr voted or rewarded, and so accrued OC fees. They
+// come from addr's fee ledger, which is advanced first.
 func GetOwedEpochBlocks(cProps *ConnectionProps, addr common.Address, startBlock, endBlock uint64) ([]uint64, error) {
-	uniqueBlocks := make(map[uint64]struct{})
-	chunkSize := uint64(cProps.ChunkSize)
-	if chunkSize == 0 {
+	if cProps.ChunkSize == 0 {
 		return nil, fmt.Errorf("Chunk size cannot be zero. Set it using -chunkSize or CHUNK_SIZE env var")
 	}
-
-	// Per-invocation TransactionByHash cache. The same tx hash can drive
-	// multiple events (Voted then Rwd, or multiple Voted's in one tx), and
-	// looking it up is an RPC each time. We cache the (tx, isPending, err)
-	// tuple by hash for the duration of this call.
-	type txLookup struct {
-		tx        *types.Transaction
-		isPending bool
-		err       error
-	}
-	txCache := make(map[common.Hash]txLookup)
-	lookupTx := func(hash common.Hash) (*types.Transaction, bool, error) {
-		if cached, ok := txCache[hash]; ok {
-			return cached.tx, cached.isPending, cached.err
-		}
-		tx, isPending, err := cProps.Client.TransactionByHash(context.Background(), hash)
-		txCache[hash] = txLookup{tx: tx, isPending: isPending, err: err}
-		return tx, isPending, err
-	}
-	for currentStart := startBlock; currentStart <= endBlock; currentStart += chunkSize {
-		currentEnd := currentStart + chunkSize - 1
-		if currentEnd > endBlock {
-			currentEnd = endBlock
-		}
-		endPtr := currentEnd
-		opts := &bind.FilterOpts{
-			Start:   currentStart,
-			End:     &endPtr,
-			Context: context.Background(),
-		}
-		// Filter Voted events
-		log.Debugf("Querying Voted events for block range %d-%d", currentStart, currentEnd)
-		votedIter, err := cProps.Kt.FilterVoted(opts)
-		if err != nil {
-			if strings.Contains(err.Error(), "query returned more than") || strings.Contains(err.Error(), "log limit") {
-				// If log limit exceeded, reduce chunk size and retry
-				chunkSize /= 2
-				if chunkSize < 1000 {
-					return nil, fmt.Errorf("log query failed even with small chunks: %v", err)
-				}
-				currentStart -= chunkSize // Retry this chunk with smaller size
-				continue
-			}
-			return nil, fmt.Errorf("failed to filter Voted events: %v", err)
-		}
-		for votedIter.Next() {
-			event := votedIter.Event()
-			// Get tx details to check sender
-			tx, isPending, err := lookupTx(event.Raw.TxHash)
-			if err != nil {
-				log.Warnf("Failed to get tx %s: %v", event.Raw.TxHash.Hex(), err)
-				continue
-			}
-			if isPending || tx == nil {
-				continue
-			}
-			signer := types.LatestSignerForChainID(tx.ChainId())
-			sender, err := types.Sender(signer, tx)
-			if err != nil {
-				log.Warnf("Failed to get sender for tx %s: %v", event.Raw.TxHash.Hex(), err)
-				continue
-			}
-			if sender == addr {
-				uniqueBlocks[event.Raw.BlockNumber] = struct{}{}
-			}
-		}
-		if err := votedIter.Error(); err != nil {
-			return nil, fmt.Errorf("error iterating Voted events: %v", err)
-		}
-		votedIter.Close()
-		// Filter Rwd events
-		log.Debugf("Querying Rwd events for block range %d-%d", currentStart, currentEnd)
-		rwdIter, err := cProps.Kt.FilterRwd(opts)
-		if err != nil {
-			if strings.Contains(err.Error(), "query returned more than") || strings.Contains(err.Error(), "log limit") {
-				chunkSize /= 2
-				if chunkSize < 1000 {
-					return nil, fmt.Errorf("log query failed even with small chunks: %v", err)
-				}
-				currentStart -= chunkSize
-				continue
-			}
-			return nil, fmt.Errorf("failed to filter Rwd events: %v", err)
-		}
-		for rwdIter.Next() {
-			event := rwdIter.Event()
-			// Get tx details to check sender
-			tx, isPending, err := lookupTx(event.Raw.TxHash)
-			if err != nil {
-				log.Warnf("Failed to get tx %s: %v", event.Raw.TxHash.Hex(), err)
-				continue
-			}
-			if isPending || tx == nil {
-				continue
-			}
-			signer := types.LatestSignerForChainID(tx.ChainId())
-			sender, err := types.Sender(signer, tx)
-			if err != nil {
-				log.Warnf("Failed to get sender for tx %s: %v", event.Raw.TxHash.Hex(), err)
-				continue
-			}
-			if sender == addr {
-				// For Rwd, query startBlock at the block before the event
-				prevBlockNum := big.NewInt(0).Sub(new(big.Int).SetUint64(event.Raw.BlockNumber), big.NewInt(1))
-				callOpts := &bind.CallOpts{
-					Context:     context.Background(),
-					BlockNumber: prevBlockNum,
-				}
-				start, err := cProps.Kt.StartBlock(callOpts)
-				if err != nil {
-					log.Warnf("Failed to query startBlock at block %d: %v", prevBlockNum.Uint64(), err)
-					continue
-				}
-				uniqueBlocks[start.Uint64()] = struct{}{}
-			}
-		}
-		if err := rwdIter.Error(); err != nil {
-			return nil, fmt.Errorf("error iterating Rwd events: %v", err)
-		}
-		rwdIter.Close()
+	store, release, err := openEventStore(cProps)
+	if err != nil {
+		return nil, err
 	}
-	var blocks []uint64
-	for b := range uniqueBlocks {
-		blocks = append(blocks, b)
+	defer release()
+	entries, err := feeLedgerEntries(cProps, store, addr, startBlock, endBlock)
+	if err != nil {
+		return nil, err
+	}
+	blocks := make([]uint64, 0, len(entries))
+	for _, e := range entries {
+		blocks = append(blocks, e.Epoch)
 	}
-	sort.Slice(blocks, func(i, j int) bool { return blocks[i] < blocks[j] })
 	return blocks, nil
 }
 func GetOCFeesOwed(cProps *ConnectionProps, startEndBlocks string) (*big.Float, error) {
@@ -168,22 +52,22 @@ func GetOCFeesOwed(cProps *ConnectionProps, startEndBlocks string) (*big.Float,
 		return nil, err
 	}
 	addr := ToAddr(cProps.Addresses.MyPublicKey)
-	// Open DB once
-	db, err := openFeesDB(cProps)
+	// Open the fee cache once
+	store, release, err := openEventStore(cProps)
 	if err != nil {
 		return nil, err
 	}
-	defer db.Close()
-	// Get relevant epoch blocks
-	epochBlocks, err := GetOwedEpochBlocks(cProps, addr, startBlock, endBlock)
+	defer release()
+	// Epochs with fees, from the fee ledger
+	entries, err := feeLedgerEntries(cProps, store, addr, startBlock, endBlock)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get owed epoch blocks: %v", err)
 	}
-	log.Debugf("Found %d potential epoch blocks with fees", len(epochBlocks))
+	log.Debugf("Found %d epoch blocks with fees", len(entries))
 	// Sum fees for those blocks
 	totalFees := big.NewInt(0)
 	var nonZeroFees []FeeInfo
-	numBlocks := len(epochBlocks)
+	numBlocks := len(entries)
 	processed := 0
 	progressInterval := 100
 	if numBlocks < progressInterval {
@@ -192,8 +76,17 @@ func GetOCFeesOwed(cProps *ConnectionProps, startEndBlocks string) (*big.Float,
 	if progressInterval > 0 {
 		fmt.Printf("Processing %d potential fee blocks...", numBlocks)
 	}
-	for _, block := range epochBlocks {
-		fee, err := getOcFee(db, cProps, addr, block)
+	for _, e := range entries {
+		if e.Withdrawn {
+			processed++
+			continue
+		}
+		block, fee := e.Epoch, e.Fee
+		if fee == nil {
+			// The ledger never saw the epoch as the OC's last; fall back to
+			// the fee as it stands now.
+			fee, err = getOcFee(store, cProps, addr, block)
+		}
 		if err != nil {
 			if progressInterval > 0 {
 				fmt.Println() // Ensure newline
@@ -243,85 +136,67 @@ func ParseStartEndBlocks(startEndBlocks string) (uint64, uint64, error) {
 	return uint64(start), uint64(end), nil
 }
 func WithdrawOCFees(cProps *ConnectionProps, blocks string) error {
+	_, err := withdrawAndRecordOCFees(cProps, blocks, "manual")
+	return err
+}
+
+// withdrawOCFees does the work of WithdrawOCFees and describes the
+// withdrawal it made, or returns nil when nothing was owed.
+func withdrawOCFees(cProps *ConnectionProps, blocks string) (*FeeWithdrawal, error) {
 	log.Printf("Withdrawing OC fees")
 	// Print initial contract balance
 	PrintKtBalance(cProps)
 	// Get caller address
 	caller := ToAddr(cProps.Addresses.MyPublicKey)
 	PrintBalanceOfAddr(cProps, cProps.MyPubKey)
-	// Open DB
-	db, err := openFeesDB(cProps)
-	if err != nil {
-		return err
-	}
-	defer db.Close()
-	log.Debug("Opened fees DB")
 	// Get total owed from contract (pastOcFees)
 	callOpts := &bind.CallOpts{Context: context.Background()}
 	totalFeesOwed, err := cProps.Kt.PastOcFees(callOpts, caller)
 	if err != nil {
-		return fmt.Errorf("failed to query pastOcFees: %v", err)
+		return nil, fmt.Errorf("failed to query pastOcFees: %v", err)
 	}
 	weiToEthOwed := new(big.Float).SetInt(totalFeesOwed)
 	owedEth := new(big.Float).Quo(weiToEthOwed, big.NewFloat(1e18))
 	log.Printf("Total fees owed: %.6f ETH", owedEth)
 	if owedEth.Cmp(big.NewFloat(0)) <= 0 {
 		log.Infof("No fees owed")
-		return nil
+		return nil, nil
 	}
 	// Get caller's balance before withdrawal
 	balanceBefore, err := cProps.Client.BalanceAt(context.Background(), caller, nil)
 	if err != nil {
-		return fmt.Errorf("failed to get caller's balance before withdrawal: %v", err)
+		return nil, fmt.Errorf("failed to get caller's balance before withdrawal: %v", err)
 	}
 	// Create an authenticated transactor
 	auth, err := NewTransactor(cProps)
 	if err != nil {
-		return fmt.Errorf("failed to create transactor: %v", err)
+		return nil, fmt.Errorf("failed to create transactor: %v", err)
 	}
 	// Call the withdrawOCFee function (no args)
 	tx, err := cProps.Kt.WithdrawOCFee(auth)
 	if err != nil {
-		return fmt.Errorf("failed to call withdrawOCFee: %v", err)
+		return nil, fmt.Errorf("failed to call withdrawOCFee: %v", err)
 	}
 	log.Printf("Withdraw transaction sent: %s", tx.Hash().Hex())
 	// Wait for the transaction to be mined
 	receipt, err := waitForTxMined(cProps, tx)
 	if err != nil {
-		return fmt.Errorf("failed to wait for withdraw transaction to be mined: %v", err)
+		return nil, fmt.Errorf("failed to wait for withdraw transaction to be mined: %v", err)
 	}
 	log.Debugf("Withdraw transaction mined in block: %d", receipt.BlockNumber.Uint64())
 	// Wait for additional blocks
 	err = WaitForBlocks(cProps)
 	if err != nil {
-		return fmt.Errorf("failed to wait for additional blocks: %v", err)
+		return nil, fmt.Errorf("failed to wait for additional blocks: %v", err)
 	}
-	// Update cache: Since aggregated, we can skip per-block updates or clear relevant cache entries if needed
-	// For simplicity, assuming cache is per-block, we can discover and zero them post-withdrawal
+	// Mark the epochs the withdrawal paid out in the fee ledger
 	if blocks == "" || blocks == "auto" {
-		latest, err := cProps.Client.BlockNumber(context.Background())
-		if err != nil {
-			log.Warnf("Failed to get latest block for cache update: %v", err)
-		} else {
-			epochBlocks, err := GetOwedEpochBlocks(cProps, caller, 0, latest)
-			if err != nil {
-				log.Warnf("Failed to get owed epoch blocks for cache update: %v", err)
-			} else {
-				var blocksUint32 []uint32
-				for _, b := range epochBlocks {
-					blocksUint32 = append(blocksUint32, uint32(b))
-				}
-				err = updateOcFeesToZero(db, caller, blocksUint32)
-				if err != nil {
-					log.Warnf("Failed to update cache after withdrawal: %v", err)
-				}
-			}
-		}
+		markWithdrawnFees(cProps, caller, receipt.BlockNumber.Uint64())
 	}
 	// Get caller's balance after withdrawal
 	balanceAfter, err := cProps.Client.BalanceAt(context.Background(), caller, nil)
 	if err != nil {
-		return fmt.Errorf("failed to get caller's balance after withdrawal: %v", err)
+		return nil, fmt.Errorf("failed to get caller's balance after withdrawal: %v", err)
 	}
 	// Calculate net balance change (including gas)
 	amountWithdrawn := new(big.Int).Sub(balanceAfter, balanceBefore)
@@ -345,7 +220,56 @@ func WithdrawOCFees(cProps *ConnectionProps, blocks string) error {
 	// Print final balances
 	PrintKtBalance(cProps)
 	PrintBalanceOfAddr(cProps, cProps.MyPubKey)
-	return nil
+	return &FeeWithdrawal{
+		OC:       caller.Hex(),
+		Block:    receipt.BlockNumber.Uint64(),
+		TxHash:   tx.Hash().Hex(),
+		Owed:     totalFeesOwed.String(),
+		Received: amountWithdrawn.String(),
+		GasCost:  gasCost.String(),
+	}, nil
+}
+
+// markWithdrawnFees marks the entries of caller's fee ledger that a
+// withdrawal mined at block paid out: every epoch complete by then, as in
+// the contract, which keeps a running epoch's fee until it is over. The
+// store is only opened here, not while the tx mines: opening it locks out
+// the event tailer and every other reader. The withdrawal already went
+// through, so failures are only logged.
+func markWithdrawnFees(cProps *ConnectionProps, caller common.Address, block uint64) {
+	interval, err := cProps.Kt.EpochInterval(&bind.CallOpts{Context: context.Background()})
+	if err != nil {
+		log.Warnf("Failed to get epoch interval for fee ledger update after withdrawal: %v", err)
+		return
+	}
+	store, release, err := openEventStore(cProps)
+	if err != nil {
+		log.Warnf("Failed to open fee cache for update after withdrawal: %v", err)
+		return
+	}
+	defer release()
+	log.Debug("Opened fee cache")
+	entries, err := feeLedgerEntries(cProps, store, caller, 0, math.MaxUint64)
+	if err != nil {
+		log.Warnf("Failed to get owed epoch blocks for cache update: %v", err)
+		return
+	}
+	var paid []FeeLedgerEntry
+	for _, e := range entries {
+		if !e.Withdrawn && block > e.Epoch+uint64(interval) {
+			e.Withdrawn = true
+			paid = append(paid, e)
+		}
+	}
+	tip, _, err := store.FeeLedger(caller)
+	if err == nil {
+		err = store.UpdateFeeLedger(caller, tip, paid)
+	}
+	if err != nil {
+		log.Warnf("Failed to update cache after withdrawal: %v", err)
+		return
+	}
+	log.Debugf("Marked %d epochs withdrawn in the fee ledger of %s", len(paid), caller.Hex())
 }
 
 func parseWithdrawBlocks(blocks string) ([]uint32, error) {
@@ -376,21 +300,25 @@ func parseWithdrawBlocks(blocks string) ([]uint32, error) {
 	return result, nil
 }
 
-// feesCacheSchemaVersion identifies the on-disk layout of cache/fees_*.db.
+// feesCacheSchemaVersion identifies the on-disk layout of cache/<chainID>/fees_*.db
+// (see BoltEventStore).
 // Bump this when the key format or bucket structure changes; the node
 // will self-heal by wiping and rebuilding on first run (operators never
 // have to delete files by hand).
 //
 // Versions:
-//   - 1 (current): single "fees" bucket; key = 20-byte addr + '_' + 8-byte
+//   - 1: single "fees" bucket; key = 20-byte addr + '_' + 8-byte
 //     BE block; value = raw big.Int.Bytes() of the fee. "meta" bucket
 //     holds the schema_version marker.
-const feesCacheSchemaVersion uint32 = 1
+//   - 2 (current): adds the "fee_ledger" bucket (see FeeLedgerEntry). A
+//     v1 file is migrated in place by adding it; its fees are kept.
+const feesCacheSchemaVersion uint32 = 2
 
 // migrateOrInitFeesCacheSchema mirrors migrateOrInitCacheSchema (in
-// find_receiver.go) for the fees DB. Reads meta.schema_version; if
-// missing or older than feesCacheSchemaVersion, drops the fees and
-// meta buckets, recreates them, and writes the current version.
+// find_receiver.go) for the fees DB. Reads meta.schema_version; a v1 file
+// gets the fee ledger bucket added. If missing or older than that, drops
+// the fees, fee ledger and meta buckets, recreates them, and writes the
+// current version.
 func migrateOrInitFeesCacheSchema(db *bbolt.DB) error {
 	return db.Update(func(tx *bbolt.Tx) error {
 		var stored uint32
@@ -402,23 +330,35 @@ func migrateOrInitFeesCacheSchema(db *bbolt.DB) error {
 			}
 		}
 		if hasStored && stored == feesCacheSchemaVersion {
-			if _, err := tx.CreateBucketIfNotExists([]byte("fees")); err != nil {
+			for _, name := range []string{"fees", feeLedgerBucket, "meta"} {
+				if _, err := tx.CreateBucketIfNotExists([]byte(name)); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		if hasStored && stored == 1 {
+			if _, err := tx.CreateBucketIfNotExists([]byte(feeLedgerBucket)); err != nil {
 				return err
 			}
-			if _, err := tx.CreateBucketIfNotExists([]byte("meta")); err != nil {
+			buf := make([]byte, 4)
+			binary.BigEndian.PutUint32(buf, feesCacheSchemaVersion)
+			if err := tx.Bucket([]byte("meta")).Put([]byte("schema_version"), buf); err != nil {
 				return err
 			}
+			log.Infof("Fees cache schema migrated: was v1, now v%d (fees kept)", feesCacheSchemaVersion)
 			return nil
 		}
 
-		if err := tx.DeleteBucket([]byte("fees")); err != nil && err != bbolt.ErrBucketNotFound {
-			return err
-		}
-		if err := tx.DeleteBucket([]byte("meta")); err != nil && err != bbolt.ErrBucketNotFound {
-			return err
+		for _, name := range []string{"fees", feeLedgerBucket, "meta"} {
+			if err := tx.DeleteBucket([]byte(name)); err != nil && err != bbolt.ErrBucketNotFound {
+				return err
+			}
 		}
-		if _, err := tx.CreateBucket([]byte("fees")); err != nil {
-			return err
+		for _, name := range []string{"fees", feeLedgerBucket} {
+			if _, err := tx.CreateBucket([]byte(name)); err != nil {
+				return err
+			}
 		}
 		meta, err := tx.CreateBucket([]byte("meta"))
 		if err != nil {
@@ -438,59 +378,15 @@ func migrateOrInitFeesCacheSchema(db *bbolt.DB) error {
 	})
 }
 
-// openFeesDB opens the fees database and creates the bucket if needed.
-func openFeesDB(cProps *ConnectionProps) (*bbolt.DB, error) {
-	// Ensure cache directory exists
-	cacheDir := cProps.ResolvedCacheDir()
-	if err := os.MkdirAll(cacheDir, 0755); err != nil {
-		log.Errorf("Failed to create cache directory: %v", err)
-		return nil, fmt.Errorf("failed to create cache directory: %w", err)
-	}
-	log.Debugf("Cache directory ensured: %s", cacheDir)
-	// Construct database file name using first 7 characters of contract address
-	dbName := fmt.Sprintf("%s/fees_%s.db", cacheDir, cProps.KtAddr.Hex()[:7])
-	log.Debugf("Database file name constructed: %s", dbName)
-	// Open DB
-	db, err := bbolt.Open(dbName, 0600, nil)
-	if err != nil {
-		log.Errorf("Failed to open database %s: %v", dbName, err)
-		return nil, fmt.Errorf("failed to open database: %w", err)
-	}
-	log.Debugf("Database opened successfully: %s", dbName)
-	// Self-heal across schema changes. Wipes orphaned data from older
-	// versions of the on-disk layout, then ensures buckets exist.
-	if err := migrateOrInitFeesCacheSchema(db); err != nil {
-		db.Close()
-		log.Errorf("Failed to init/migrate fees cache schema: %v", err)
-		return nil, fmt.Errorf("failed to init/migrate fees cache schema: %w", err)
-	}
-	log.Debugf("Bucket 'fees' created or verified in database")
-	return db, nil
-}
-
-// getOcFee retrieves the OC fee for a given address and block, using cache if available.
-// Assumes db is already open.
-func getOcFee(db *bbolt.DB, cProps *ConnectionProps, addr common.Address, block uint64) (*big.Int, error) {
-	// Generate key: address_bytes + "_" + block (as 8-byte big-endian)
-	key := make([]byte, common.AddressLength+1+8)
-	copy(key, addr.Bytes())
-	key[common.AddressLength] = '_'
-	binary.BigEndian.PutUint64(key[common.AddressLength+1:], block)
-	var fee *big.Int
-	err := db.View(func(tx *bbolt.Tx) error {
-		b := tx.Bucket([]byte("fees"))
-		v := b.Get(key)
-		if v != nil {
-			fee = new(big.Int).SetBytes(v)
-			log.Debugf("Loaded cached fee for address %s block %d: %s", addr.Hex(), block, fee.String())
-			return nil
-		}
-		return nil // Not found, proceed to query
-	})
+// getOcFee retrieves the OC fee for a given address and block, using the
+// fee cache if available.
+func getOcFee(store EventStore, cProps *ConnectionProps, addr common.Address, block uint64) (*big.Int, error) {
+	fee, found, err := store.GetFee(addr, block)
 	if err != nil {
 		return nil, err
 	}
-	if fee != nil {
+	if found {
+		log.Debugf("Loaded cached fee for address %s block %d: %s", addr.Hex(), block, fee.String())
 		return fee, nil
 	}
 	// Not in cache, query the node
@@ -500,46 +396,13 @@ func getOcFee(db *bbolt.DB, cProps *ConnectionProps, addr common.Address, block
 		return nil, err
 	}
 	// Store in cache
-	err = db.Update(func(tx *bbolt.Tx) error {
-		b := tx.Bucket([]byte("fees"))
-		return b.Put(key, fee.Bytes())
-	})
-	if err != nil {
+	if err := store.PutFees(addr, map[uint64]*big.Int{block: fee}); err != nil {
 		log.Warnf("Failed to cache fee for address %s block %d: %v", addr.Hex(), block, err)
 		// Continue anyway, don't fail the query
 	}
 	return fee, nil
 }
 
-// updateOcFeesToZero sets the cached OC fees to zero for the given blocks after withdrawal.
-// Assumes db is already open.
-func updateOcFeesToZero(db *bbolt.DB, addr common.Address, blocks []uint32) error {
-	zero := big.NewInt(0)
-	err := db.Update(func(tx *bbolt.Tx) error {
-		b := tx.Bucket([]byte("fees"))
-		if b == nil {
-			return nil // Bucket doesn't exist, nothing to update
-		}
-		for _, blk := range blocks {
-			block := uint64(blk)
-			key := make([]byte, common.AddressLength+1+8)
-			copy(key, addr.Bytes())
-			key[common.AddressLength] = '_'
-			binary.BigEndian.PutUint64(key[common.AddressLength+1:], block)
-			if err := b.Put(key, zero.Bytes()); err != nil {
-				return err
-			}
-			log.Debugf("Updated cache to zero for address %s block %d", addr.Hex(), block)
-		}
-		return nil
-	})
-	if err != nil {
-		log.Errorf("Failed to update cache to zero: %v", err)
-		return err
-	}
-	return nil
-}
-
 // SetOCFee sets the OC fee on the contract.
 func SetOCFee(cProps *ConnectionProps, fee uint16) error {
 	log.Printf("Setting OC fee to %d", fee)
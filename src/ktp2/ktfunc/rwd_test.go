@@ -1,6 +1,7 @@
 package ktfunc
 
 import (
+	"context"
 	"encoding/binary"
 	"errors"
 	"math/big"
@@ -15,6 +16,7 @@ import (
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 	"go.etcd.io/bbolt"
 )
 
@@ -162,7 +164,8 @@ func TestParseWithdrawBlocks(t *testing.T) {
 // This is the same shape as the Phase 4 withdraw-erasure bug: raw events
 // (Voted, Rwd) get folded into a derived structure (unique epoch blocks).
 // The function uses tx sender recovery to filter "did THIS address vote?".
-// Highest-priority area for surfacing latent bugs.
+// Highest-priority area for surfacing latent bugs. The folding now lives
+// in the fee ledger (fee_ledger.go); these run through it.
 
 // mockVotedIter is a minimal in-memory VotedIterator for tests.
 type mockVotedIter struct {
@@ -202,8 +205,8 @@ func (m *mockRwdIter) Close() error         { return nil }
 
 // signedTxFromKey signs a no-op transaction with the given hex private key
 // and returns both the tx (so its sender can be recovered) and the address
-// of that signer. Uses LatestSignerForChainID to match what GetOwedEpochBlocks
-// uses in production.
+// of that signer. Uses LatestSignerForChainID to match what txSenders uses
+// in production.
 func signedTxFromKey(t *testing.T, hexKey string, chainID *big.Int) (*types.Transaction, common.Address) {
 	t.Helper()
 	priv, err := crypto.HexToECDSA(hexKey)
@@ -226,9 +229,31 @@ const (
 	testKeyY = "0202020202020202020202020202020202020202020202020202020202020202"
 )
 
+// newOwedBlocksProps wires mockKt and mockClient for GetOwedEpochBlocks
+// over 18_000_000-18_001_000. The fee ledger also reads headers, the head
+// and each epoch's fee, which these tests don't care about.
+func newOwedBlocksProps(mockKt *MockKtv2, mockClient *MockEthClient) *ConnectionProps {
+	mockClient.On("BlockNumber", mock.Anything).Return(uint64(18_001_000), nil).Maybe()
+	mockClient.On("HeaderByNumber", mock.Anything, mock.Anything).Return(&types.Header{}, nil).Maybe()
+	mockKt.On("OcFees", mock.Anything, mock.Anything, mock.Anything).Return(big.NewInt(1), nil).Maybe()
+	mockKt.On("LastStartBlock", mock.Anything, mock.Anything).Return(big.NewInt(0), nil).Maybe()
+	return &ConnectionProps{
+		Kt:        mockKt,
+		Client:    mockClient,
+		ChunkSize: 10_000_000,
+		KtBlock:   big.NewInt(18_000_000),
+		Store:     NewMemoryEventStore(),
+	}
+}
+
+// votedFor builds a Voted event for epoch, emitted at block by tx.
+func votedFor(epoch, block uint64, tx common.Hash) *ktv2.Ktv2Voted {
+	return &ktv2.Ktv2Voted{Arg0: new(big.Int).SetUint64(epoch), Raw: types.Log{TxHash: tx, BlockNumber: block}}
+}
+
 // TestGetOwedEpochBlocks_ReturnsBlocksForMatchingSender — the basic flow:
-// folder filters Voted events by tx sender. Two votes from X, one from Y;
-// query for X. Expect X's two block numbers back, Y's filtered out.
+// the ledger filters Voted events by tx sender. Two votes from X, one from
+// Y; query for X. Expect X's two epochs back, Y's filtered out.
 func TestGetOwedEpochBlocks_ReturnsBlocksForMatchingSender(t *testing.T) {
 	chainID := big.NewInt(1337)
 	xTx, addrX := signedTxFromKey(t, testKeyX, chainID)
@@ -239,9 +264,9 @@ func TestGetOwedEpochBlocks_ReturnsBlocksForMatchingSender(t *testing.T) {
 	txHashX2 := common.HexToHash("0x3333000000000000000000000000000000000000000000000000000000000000")
 
 	votedEvents := []*ktv2.Ktv2Voted{
-		{Raw: types.Log{TxHash: txHashX1, BlockNumber: 18_000_100}},
-		{Raw: types.Log{TxHash: txHashY, BlockNumber: 18_000_400}},
-		{Raw: types.Log{TxHash: txHashX2, BlockNumber: 18_000_700}},
+		votedFor(18_000_000, 18_000_100, txHashX1),
+		votedFor(18_000_300, 18_000_400, txHashY),
+		votedFor(18_000_600, 18_000_700, txHashX2),
 	}
 
 	mockKt := &MockKtv2{}
@@ -252,16 +277,16 @@ func TestGetOwedEpochBlocks_ReturnsBlocksForMatchingSender(t *testing.T) {
 	mockClient.On("TransactionByHash", mock.Anything, txHashY).Return(yTx, false, nil)
 	mockClient.On("TransactionByHash", mock.Anything, txHashX2).Return(xTx, false, nil)
 
-	cProps := &ConnectionProps{Kt: mockKt, Client: mockClient, ChunkSize: 10_000_000}
+	cProps := newOwedBlocksProps(mockKt, mockClient)
 
 	blocks, err := GetOwedEpochBlocks(cProps, addrX, 18_000_000, 18_001_000)
 	assert.NoError(t, err)
-	assert.ElementsMatch(t, []uint64{18_000_100, 18_000_700}, blocks)
+	assert.ElementsMatch(t, []uint64{18_000_000, 18_000_600}, blocks)
 }
 
 // TestGetOwedEpochBlocks_DedupsRepeatedBlocksFromSameSender — sender voted
-// twice in the same block (two txs same block, same epoch). The function
-// stores into a map[uint64]struct{} so the block appears once.
+// twice for the same epoch (a vote and a reset, say). The ledger keys
+// entries by epoch so it appears once.
 func TestGetOwedEpochBlocks_DedupsRepeatedBlocksFromSameSender(t *testing.T) {
 	chainID := big.NewInt(1337)
 	xTx, addrX := signedTxFromKey(t, testKeyX, chainID)
@@ -270,8 +295,8 @@ func TestGetOwedEpochBlocks_DedupsRepeatedBlocksFromSameSender(t *testing.T) {
 	txHashB := common.HexToHash("0xbb00000000000000000000000000000000000000000000000000000000000000")
 
 	votedEvents := []*ktv2.Ktv2Voted{
-		{Raw: types.Log{TxHash: txHashA, BlockNumber: 18_000_500}},
-		{Raw: types.Log{TxHash: txHashB, BlockNumber: 18_000_500}}, // same block
+		votedFor(18_000_400, 18_000_500, txHashA),
+		votedFor(18_000_400, 18_000_500, txHashB), // same block, same epoch
 	}
 
 	mockKt := &MockKtv2{}
@@ -281,11 +306,11 @@ func TestGetOwedEpochBlocks_DedupsRepeatedBlocksFromSameSender(t *testing.T) {
 	mockClient.On("TransactionByHash", mock.Anything, txHashA).Return(xTx, false, nil)
 	mockClient.On("TransactionByHash", mock.Anything, txHashB).Return(xTx, false, nil)
 
-	cProps := &ConnectionProps{Kt: mockKt, Client: mockClient, ChunkSize: 10_000_000}
+	cProps := newOwedBlocksProps(mockKt, mockClient)
 
 	blocks, err := GetOwedEpochBlocks(cProps, addrX, 18_000_000, 18_001_000)
 	assert.NoError(t, err)
-	assert.Equal(t, []uint64{18_000_500}, blocks)
+	assert.Equal(t, []uint64{18_000_400}, blocks)
 }
 
 // TestGetOwedEpochBlocks_SkipsPendingTxs — when TransactionByHash returns
@@ -300,8 +325,8 @@ func TestGetOwedEpochBlocks_SkipsPendingTxs(t *testing.T) {
 	txHashPending := common.HexToHash("0xdd00000000000000000000000000000000000000000000000000000000000000")
 
 	votedEvents := []*ktv2.Ktv2Voted{
-		{Raw: types.Log{TxHash: txHashConfirmed, BlockNumber: 18_000_100}},
-		{Raw: types.Log{TxHash: txHashPending, BlockNumber: 18_000_200}},
+		votedFor(18_000_000, 18_000_100, txHashConfirmed),
+		votedFor(18_000_100, 18_000_200, txHashPending),
 	}
 
 	mockKt := &MockKtv2{}
@@ -311,11 +336,11 @@ func TestGetOwedEpochBlocks_SkipsPendingTxs(t *testing.T) {
 	mockClient.On("TransactionByHash", mock.Anything, txHashConfirmed).Return(xTx, false, nil)
 	mockClient.On("TransactionByHash", mock.Anything, txHashPending).Return(pendingTx, true, nil)
 
-	cProps := &ConnectionProps{Kt: mockKt, Client: mockClient, ChunkSize: 10_000_000}
+	cProps := newOwedBlocksProps(mockKt, mockClient)
 
 	blocks, err := GetOwedEpochBlocks(cProps, addrX, 18_000_000, 18_001_000)
 	assert.NoError(t, err)
-	assert.Equal(t, []uint64{18_000_100}, blocks)
+	assert.Equal(t, []uint64{18_000_000}, blocks)
 }
 
 // TestGetOwedEpochBlocks_SkipsTxWhenTransactionByHashErrors — RPC returns
@@ -329,8 +354,8 @@ func TestGetOwedEpochBlocks_SkipsTxWhenTransactionByHashErrors(t *testing.T) {
 	txHashErr := common.HexToHash("0xff00000000000000000000000000000000000000000000000000000000000000")
 
 	votedEvents := []*ktv2.Ktv2Voted{
-		{Raw: types.Log{TxHash: txHashOk, BlockNumber: 18_000_100}},
-		{Raw: types.Log{TxHash: txHashErr, BlockNumber: 18_000_200}},
+		votedFor(18_000_000, 18_000_100, txHashOk),
+		votedFor(18_000_100, 18_000_200, txHashErr),
 	}
 
 	mockKt := &MockKtv2{}
@@ -340,48 +365,48 @@ func TestGetOwedEpochBlocks_SkipsTxWhenTransactionByHashErrors(t *testing.T) {
 	mockClient.On("TransactionByHash", mock.Anything, txHashOk).Return(xTx, false, nil)
 	mockClient.On("TransactionByHash", mock.Anything, txHashErr).Return((*types.Transaction)(nil), false, assert.AnError)
 
-	cProps := &ConnectionProps{Kt: mockKt, Client: mockClient, ChunkSize: 10_000_000}
+	cProps := newOwedBlocksProps(mockKt, mockClient)
 
 	blocks, err := GetOwedEpochBlocks(cProps, addrX, 18_000_000, 18_001_000)
 	assert.NoError(t, err)
-	assert.Equal(t, []uint64{18_000_100}, blocks)
+	assert.Equal(t, []uint64{18_000_000}, blocks)
 }
 
-// TestGetOwedEpochBlocks_RwdEventBlockComesFromStartBlockLookup pins that
-// for Rwd events the function does NOT use event.Raw.BlockNumber directly
-// for the epoch block; it calls Kt.StartBlock(prevBlock) and uses that.
-// A future refactor mistakenly using event.Raw.BlockNumber would silently
-// pay fees for the wrong epoch.
-func TestGetOwedEpochBlocks_RwdEventBlockComesFromStartBlockLookup(t *testing.T) {
+// TestGetOwedEpochBlocks_RwdEpochComesFromPrecedingVoted pins that a Rwd
+// event pays the epoch of the last Voted event before it, whoever cast it,
+// and that neither event.Raw.BlockNumber nor archive StartBlock is used. A
+// refactor getting this wrong would silently pay fees for the wrong epoch.
+func TestGetOwedEpochBlocks_RwdEpochComesFromPrecedingVoted(t *testing.T) {
 	chainID := big.NewInt(1337)
 	xTx, addrX := signedTxFromKey(t, testKeyX, chainID)
+	yTx, _ := signedTxFromKey(t, testKeyY, chainID)
 
+	voteTxHash := common.HexToHash("0x8800000000000000000000000000000000000000000000000000000000000000")
 	rwdTxHash := common.HexToHash("0x9900000000000000000000000000000000000000000000000000000000000000")
 	const rwdBlockNum = uint64(18_000_900)
 	const epochStartBlock = uint64(18_000_400)
 
+	votedEvents := []*ktv2.Ktv2Voted{votedFor(epochStartBlock, 18_000_450, voteTxHash)}
 	rwdEvents := []*ktv2.Ktv2Rwd{
 		{Raw: types.Log{TxHash: rwdTxHash, BlockNumber: rwdBlockNum}},
 	}
 
 	mockKt := &MockKtv2{}
 	mockClient := &MockEthClient{}
-	mockKt.On("FilterVoted", mock.Anything).Return(&mockVotedIter{events: nil}, nil)
+	mockKt.On("FilterVoted", mock.Anything).Return(&mockVotedIter{events: votedEvents}, nil)
 	mockKt.On("FilterRwd", mock.Anything).Return(&mockRwdIter{events: rwdEvents}, nil)
+	mockClient.On("TransactionByHash", mock.Anything, voteTxHash).Return(yTx, false, nil)
 	mockClient.On("TransactionByHash", mock.Anything, rwdTxHash).Return(xTx, false, nil)
-	mockKt.On("StartBlock", mock.MatchedBy(func(opts *bind.CallOpts) bool {
-		// Must be queried at (rwdBlockNum - 1).
-		return opts != nil && opts.BlockNumber != nil && opts.BlockNumber.Uint64() == rwdBlockNum-1
-	})).Return(big.NewInt(int64(epochStartBlock)), nil)
 
-	cProps := &ConnectionProps{Kt: mockKt, Client: mockClient, ChunkSize: 10_000_000}
+	cProps := newOwedBlocksProps(mockKt, mockClient)
 
 	blocks, err := GetOwedEpochBlocks(cProps, addrX, 18_000_000, 18_001_000)
 	assert.NoError(t, err)
 	assert.Equal(t, []uint64{epochStartBlock}, blocks,
-		"Rwd event at block %d should resolve to epoch start %d via StartBlock(prevBlock); "+
+		"Rwd event at block %d should pay epoch %d, the last one voted for; "+
 			"if the test sees %d in the result it means a refactor regressed to using event.Raw.BlockNumber",
 		rwdBlockNum, epochStartBlock, rwdBlockNum)
+	mockKt.AssertNotCalled(t, "StartBlock", mock.Anything)
 }
 
 // TestGetOwedEpochBlocks_VotedAndRwdEventsAreBothCollected — both event
@@ -390,12 +415,15 @@ func TestGetOwedEpochBlocks_RwdEventBlockComesFromStartBlockLookup(t *testing.T)
 func TestGetOwedEpochBlocks_VotedAndRwdEventsAreBothCollected(t *testing.T) {
 	chainID := big.NewInt(1337)
 	xTx, addrX := signedTxFromKey(t, testKeyX, chainID)
+	yTx, _ := signedTxFromKey(t, testKeyY, chainID)
 
 	voteTxHash := common.HexToHash("0xaaa0000000000000000000000000000000000000000000000000000000000000")
+	otherVoteTxHash := common.HexToHash("0xccc0000000000000000000000000000000000000000000000000000000000000")
 	rwdTxHash := common.HexToHash("0xbbb0000000000000000000000000000000000000000000000000000000000000")
 
 	votedEvents := []*ktv2.Ktv2Voted{
-		{Raw: types.Log{TxHash: voteTxHash, BlockNumber: 18_000_300}},
+		votedFor(18_000_200, 18_000_300, voteTxHash),
+		votedFor(18_000_500, 18_000_600, otherVoteTxHash),
 	}
 	rwdEvents := []*ktv2.Ktv2Rwd{
 		{Raw: types.Log{TxHash: rwdTxHash, BlockNumber: 18_000_800}},
@@ -406,16 +434,16 @@ func TestGetOwedEpochBlocks_VotedAndRwdEventsAreBothCollected(t *testing.T) {
 	mockKt.On("FilterVoted", mock.Anything).Return(&mockVotedIter{events: votedEvents}, nil)
 	mockKt.On("FilterRwd", mock.Anything).Return(&mockRwdIter{events: rwdEvents}, nil)
 	mockClient.On("TransactionByHash", mock.Anything, voteTxHash).Return(xTx, false, nil)
+	mockClient.On("TransactionByHash", mock.Anything, otherVoteTxHash).Return(yTx, false, nil)
 	mockClient.On("TransactionByHash", mock.Anything, rwdTxHash).Return(xTx, false, nil)
-	mockKt.On("StartBlock", mock.Anything).Return(big.NewInt(18_000_500), nil)
 
-	cProps := &ConnectionProps{Kt: mockKt, Client: mockClient, ChunkSize: 10_000_000}
+	cProps := newOwedBlocksProps(mockKt, mockClient)
 
 	blocks, err := GetOwedEpochBlocks(cProps, addrX, 18_000_000, 18_001_000)
 	assert.NoError(t, err)
-	// Voted contributes 18_000_300 (its raw block); Rwd contributes 18_000_500
-	// (the StartBlock looked up at rwdBlock-1).
-	assert.ElementsMatch(t, []uint64{18_000_300, 18_000_500}, blocks)
+	// X's vote contributes 18_000_200; X's Rwd pays 18_000_500, the epoch
+	// Y voted for just before it.
+	assert.ElementsMatch(t, []uint64{18_000_200, 18_000_500}, blocks)
 }
 
 // TestGetOwedEpochBlocks_ZeroChunkSizeReturnsError pins the up-front guard.
@@ -442,7 +470,7 @@ func TestGetOwedEpochBlocks_ZeroChunkSizeReturnsError(t *testing.T) {
 
 // withdrawSetup builds the minimum ConnectionProps + mocks needed to
 // drive WithdrawOCFees up to the PastOcFees call. Returns a temp-dir
-// cleanup that resets the working directory (openFeesDB writes to ./cache).
+// cleanup that resets the working directory (the fee cache writes to ./cache).
 func withdrawSetup(t *testing.T) (
 	cProps *ConnectionProps,
 	mockClient *MockEthClient,
@@ -450,7 +478,7 @@ func withdrawSetup(t *testing.T) (
 	callerAddr common.Address,
 ) {
 	t.Helper()
-	// openFeesDB writes to "cache/" relative to CWD. Use a temp dir to
+	// The fee cache writes to "cache/" relative to CWD. Use a temp dir to
 	// avoid littering the repo. Restore CWD on cleanup.
 	tmp := t.TempDir()
 	oldwd, _ := os.Getwd()
@@ -543,6 +571,75 @@ func TestWithdrawOCFees_WithdrawOCFeeContractErrorPropagates(t *testing.T) {
 	assert.Contains(t, err.Error(), "withdrawOCFee")
 }
 
+// TestWithdrawOCFees_StoreNotHeldWhileMining — the event store is only
+// opened once the withdrawal has mined. Holding it through the wait would
+// stall the event tailer and every other reader in -run.
+func TestWithdrawOCFees_StoreNotHeldWhileMining(t *testing.T) {
+	cProps, mockClient, mockKt, caller := withdrawSetup(t)
+	cProps.KtBlock = big.NewInt(50)
+	cProps.ChunkSize = 1000
+
+	mockKt.On("PastOcFees", mock.Anything, caller).Return(big.NewInt(int64(1e18)), nil)
+	mockKt.On("WithdrawOCFee", mock.Anything).Return(types.NewTransaction(0, cProps.KtAddr, big.NewInt(0), 21000, big.NewInt(1), nil), nil)
+	mockKt.On("FilterVoted", mock.Anything).Return(&mockVotedIter{}, nil).Maybe()
+	mockKt.On("FilterRwd", mock.Anything).Return(&mockRwdIter{}, nil).Maybe()
+	mockKt.On("EpochInterval", mock.Anything).Return(uint16(20), nil).Maybe()
+	mockClient.On("BlockNumber", mock.Anything).Return(uint64(100), nil).Maybe()
+	mockClient.On("HeaderByNumber", mock.Anything, mock.Anything).Return(&types.Header{}, nil).Maybe()
+
+	origWaitMined := waitMined
+	t.Cleanup(func() { waitMined = origWaitMined })
+	storeFree := false
+	waitMined = func(_ context.Context, _ bind.DeployBackend, _ *types.Transaction) (*types.Receipt, error) {
+		if storeFree = eventStoreMu.TryLock(); storeFree {
+			eventStoreMu.Unlock()
+		}
+		return &types.Receipt{BlockNumber: big.NewInt(90), GasUsed: 21000}, nil
+	}
+
+	require.NoError(t, WithdrawOCFees(cProps, ""))
+	assert.True(t, storeFree, "the event store must not be held while the withdrawal mines")
+}
+
+// TestWithdrawOCFees_NothingOwedAfterwards — once a withdrawal has mined,
+// -queryFees no longer counts the epochs it paid out, though the contract
+// left their ocFees as they were read.
+func TestWithdrawOCFees_NothingOwedAfterwards(t *testing.T) {
+	cProps, mockClient, mockKt, _ := withdrawSetup(t)
+	xTx, ocX := signedTxFromKey(t, testKeyX, big.NewInt(1))
+	cProps.MyPubKey, cProps.Addresses.MyPublicKey = ocX, ocX.Hex()
+	cProps.KtBlock = big.NewInt(10)
+	cProps.ChunkSize = 1000
+
+	mockKt.On("FilterVoted", mock.Anything).Return(&mockVotedIter{events: []*ktv2.Ktv2Voted{votedFor(20, 30, xTx.Hash())}}, nil).Once()
+	mockKt.On("FilterVoted", mock.Anything).Return(&mockVotedIter{}, nil)
+	mockKt.On("FilterRwd", mock.Anything).Return(&mockRwdIter{}, nil)
+	mockKt.On("LastStartBlock", mock.Anything, ocX).Return(big.NewInt(20), nil)
+	mockKt.On("OcFees", mock.Anything, ocX, big.NewInt(20)).Return(big.NewInt(7), nil)
+	mockKt.On("EpochInterval", mock.Anything).Return(uint16(20), nil)
+	mockKt.On("PastOcFees", mock.Anything, ocX).Return(big.NewInt(7), nil)
+	mockKt.On("WithdrawOCFee", mock.Anything).Return(types.NewTransaction(0, cProps.KtAddr, big.NewInt(0), 21000, big.NewInt(1), nil), nil)
+	mockClient.On("TransactionByHash", mock.Anything, xTx.Hash()).Return(xTx, false, nil)
+	mockClient.On("BalanceAt", mock.Anything, ocX, (*big.Int)(nil)).Return(big.NewInt(int64(1e18)), nil)
+	mockClient.On("BlockNumber", mock.Anything).Return(uint64(100), nil)
+	mockClient.On("HeaderByNumber", mock.Anything, mock.Anything).Return(&types.Header{}, nil)
+
+	origWaitMined := waitMined
+	t.Cleanup(func() { waitMined = origWaitMined })
+	waitMined = func(context.Context, bind.DeployBackend, *types.Transaction) (*types.Receipt, error) {
+		return &types.Receipt{BlockNumber: big.NewInt(90), GasUsed: 21000}, nil
+	}
+
+	owed, err := GetOCFeesOwed(cProps, "0:100")
+	require.NoError(t, err)
+	assert.Equal(t, 1, owed.Sign())
+
+	require.NoError(t, WithdrawOCFees(cProps, ""))
+	owed, err = GetOCFeesOwed(cProps, "0:100")
+	require.NoError(t, err)
+	assert.Zero(t, owed.Sign(), "the withdrawal paid epoch 20 out")
+}
+
 // ============================================================================
 // Phase 5e — fees cache schema versioning tests. Mirror Phase 4c for the
 // chunks cache: operators never have to delete fees_*.db files manually.
@@ -661,6 +758,43 @@ func TestFeesCache_FreshDBInitializesSchemaWithoutWipe(t *testing.T) {
 	}
 }
 
+// TestFeesCache_MigratesV1InPlace — v2 only added the fee ledger bucket,
+// so a v1 file keeps its cached fees.
+func TestFeesCache_MigratesV1InPlace(t *testing.T) {
+	db, err := bbolt.Open(t.TempDir()+"/v1_fees.db", 0600, nil)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer db.Close()
+
+	err = db.Update(func(tx *bbolt.Tx) error {
+		fees, err := tx.CreateBucket([]byte("fees"))
+		if err != nil {
+			return err
+		}
+		if err := fees.Put([]byte("fee-key"), big.NewInt(7).Bytes()); err != nil {
+			return err
+		}
+		meta, err := tx.CreateBucket([]byte("meta"))
+		if err != nil {
+			return err
+		}
+		v := make([]byte, 4)
+		binary.BigEndian.PutUint32(v, 1)
+		return meta.Put([]byte("schema_version"), v)
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, migrateOrInitFeesCacheSchema(db))
+	err = db.View(func(tx *bbolt.Tx) error {
+		assert.Equal(t, big.NewInt(7).Bytes(), tx.Bucket([]byte("fees")).Get([]byte("fee-key")))
+		assert.NotNil(t, tx.Bucket([]byte(feeLedgerBucket)))
+		assert.Equal(t, feesCacheSchemaVersion, binary.BigEndian.Uint32(tx.Bucket([]byte("meta")).Get([]byte("schema_version"))))
+		return nil
+	})
+	require.NoError(t, err)
+}
+
 // TestGetOwedEpochBlocks_DedupsTransactionByHashCalls — when multiple
 // events share the same tx hash (e.g., a single tx that emits both a
 // Voted and a Rwd event in the same block), the function should look
@@ -672,8 +806,8 @@ func TestGetOwedEpochBlocks_DedupsTransactionByHashCalls(t *testing.T) {
 
 	// Two Voted events + one Rwd event, all from the SAME tx hash.
 	votedEvents := []*ktv2.Ktv2Voted{
-		{Raw: types.Log{TxHash: sharedTxHash, BlockNumber: 18_000_300}},
-		{Raw: types.Log{TxHash: sharedTxHash, BlockNumber: 18_000_300}},
+		votedFor(18_000_200, 18_000_300, sharedTxHash),
+		votedFor(18_000_200, 18_000_300, sharedTxHash),
 	}
 	rwdEvents := []*ktv2.Ktv2Rwd{
 		{Raw: types.Log{TxHash: sharedTxHash, BlockNumber: 18_000_900}},
@@ -684,11 +818,8 @@ func TestGetOwedEpochBlocks_DedupsTransactionByHashCalls(t *testing.T) {
 	mockKt.On("FilterVoted", mock.Anything).Return(&mockVotedIter{events: votedEvents}, nil)
 	mockKt.On("FilterRwd", mock.Anything).Return(&mockRwdIter{events: rwdEvents}, nil)
 	mockClient.On("TransactionByHash", mock.Anything, sharedTxHash).Return(xTx, false, nil)
-	mockKt.On("StartBlock", mock.MatchedBy(func(opts *bind.CallOpts) bool {
-		return opts != nil && opts.BlockNumber != nil
-	})).Return(big.NewInt(18_000_500), nil)
 
-	cProps := &ConnectionProps{Kt: mockKt, Client: mockClient, ChunkSize: 10_000_000}
+	cProps := newOwedBlocksProps(mockKt, mockClient)
 
 	_, err := GetOwedEpochBlocks(cProps, addrX, 18_000_000, 18_001_000)
 	assert.NoError(t, err)
@@ -0,0 +1,367 @@
+package ktfunc
+
+// Incremental stake ledger.
+//
+// Every epoch the lottery needs each wallet's minimum stake over
+// [epochStart, endBlock]. Computed naively that means folding every Staked /
+// Withdrew event since the contract's creation block, so the per-epoch cost
+// grows with the contract's age. The ledger persists each wallet's running
+// (clamped) balance at epoch boundaries in the "ledger" bucket of the event
+// cache. An epoch then only needs the nearest snapshot plus the events from
+// that snapshot onward.
+//
+// The ledger never computes minimums itself. It hands findMinOverBlockRange
+// a compact stakeDataMap: one synthetic pre-epoch entry per wallet carrying
+// the snapshot balance, plus the epoch's real per-block deltas. Because
+// findMinOverBlockRange clamps the running stake at every block, a wallet's
+// running stake entering the epoch depends only on its pre-epoch balance, so
+// the compact map yields exactly the same minimums as the full history. A
+// periodic full recompute (ledgerCheckInterval) enforces that in production:
+// on any mismatch the ledger is discarded and the full result is used.
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+	log "github.com/sirupsen/logrus"
+)
+
+// ledgerBucket holds StakeSnapshots keyed by 8-byte BE block number.
+const ledgerBucket = "ledger"
+
+// ledgerCheckInterval is how many ledger-served epochs may pass between
+// full-recompute consistency checks. The first ledger epoch of every process
+// is always checked.
+const ledgerCheckInterval = 24
+
+// SnapshotBalance is one wallet's clamped running stake in a StakeSnapshot.
+type SnapshotBalance struct {
+	Addr   common.Address
+	Amount *big.Int
+}
+
+// StakeSnapshot is every wallet's running stake after applying all events in
+// blocks strictly below Block. Wallets with a zero balance are omitted and
+// Balances is sorted by address so the encoding is deterministic.
+type StakeSnapshot struct {
+	Block    uint64
+	Balances []SnapshotBalance
+}
+
+// GatherEpochStakes returns a stakeDataMap for the epoch [epochStart,
+// endBlock] that findMinOverBlockRange turns into the same minimums as the
+// full history from creationBlock would. Package variable so tests can stub
+// it, like GatherStakesAndWithdraws.
+var GatherEpochStakes = realGatherEpochStakes
+
+func realGatherEpochStakes(cProps *ConnectionProps, kt Ktv2Interface, creationBlock, epochStart, endBlock *big.Int) (map[common.Address]map[uint64]*UserStakeData, error) {
+	if kt == nil {
+		return nil, fmt.Errorf("KT contract instance is nil")
+	}
+	if creationBlock == nil || epochStart == nil || endBlock == nil {
+		return nil, fmt.Errorf("invalid block range: creation, start and end blocks must be non-nil")
+	}
+	if epochStart.Cmp(endBlock) > 0 {
+		return nil, fmt.Errorf("start block %d exceeds end block %d", epochStart.Uint64(), endBlock.Uint64())
+	}
+	// Nothing precedes the first epoch, so there is nothing to skip.
+	if epochStart.Cmp(creationBlock) <= 0 {
+		return GatherStakesAndWithdraws(cProps, kt, creationBlock, endBlock)
+	}
+
+	compact, fromBlock, err := ledgerEpochStakes(cProps, kt, creationBlock.Uint64(), epochStart.Uint64(), endBlock.Uint64())
+	if err != nil {
+		log.Warnf("Stake ledger unavailable (%v) - falling back to a full rebuild from block %d", err, creationBlock.Uint64())
+		return GatherStakesAndWithdraws(cProps, kt, creationBlock, endBlock)
+	}
+	log.Infof("Stake ledger: epoch %d-%d built from snapshot at block %d (%d addresses)",
+		epochStart.Uint64(), endBlock.Uint64(), fromBlock, len(compact))
+
+	if cProps.ledgerEpochsUnchecked > 0 && cProps.ledgerEpochsUnchecked < ledgerCheckInterval {
+		cProps.ledgerEpochsUnchecked++
+		return compact, nil
+	}
+
+	full, err := GatherStakesAndWithdraws(cProps, kt, creationBlock, endBlock)
+	if err != nil {
+		return nil, err
+	}
+	if err := compareEpochMinimums(epochStart.Uint64(), endBlock.Uint64(), compact, full); err != nil {
+		log.Errorf("Stake ledger disagrees with full recompute for epoch %d-%d: %v - discarding ledger", epochStart.Uint64(), endBlock.Uint64(), err)
+		if dropErr := dropStakeLedger(cProps); dropErr != nil {
+			log.Errorf("Failed to discard stake ledger: %v", dropErr)
+		}
+		cProps.ledgerEpochsUnchecked = 0
+		return full, nil
+	}
+	log.Infof("Stake ledger consistency check passed for epoch %d-%d", epochStart.Uint64(), endBlock.Uint64())
+	cProps.ledgerEpochsUnchecked = 1
+	return compact, nil
+}
+
+// readEpochStakes is GatherEpochStakes without the full-recompute check, for
+// one-off reports such as -odds. Every process checks its first ledger
+// epoch, so going through GatherEpochStakes would rebuild from the creation
+// block on every call; the vote loop keeps checking the ledger.
+func readEpochStakes(cProps *ConnectionProps, kt Ktv2Interface, creationBlock, epochStart, endBlock uint64) (map[common.Address]map[uint64]*UserStakeData, error) {
+	if epochStart > creationBlock {
+		compact, _, err := ledgerEpochStakes(cProps, kt, creationBlock, epochStart, endBlock)
+		if err == nil {
+			return compact, nil
+		}
+		log.Warnf("Stake ledger unavailable (%v) - falling back to a full rebuild from block %d", err, creationBlock)
+	}
+	return GatherStakesAndWithdraws(cProps, kt, new(big.Int).SetUint64(creationBlock), new(big.Int).SetUint64(endBlock))
+}
+
+// VerifyStakeLedger computes the epoch [epochStart, endBlock] both from the
+// stake ledger and from a full rebuild since the creation block and reports
+// any difference in the resulting minimum stakes. The ledger is left as is;
+// VoteAndReward discards it on its own checks.
+func VerifyStakeLedger(cProps *ConnectionProps, epochStart, endBlock *big.Int) error {
+	creation, err := GetContractCreationBlock(cProps)
+	if err != nil {
+		return fmt.Errorf("failed to get contract creation block: %w", err)
+	}
+	if epochStart.Uint64() <= creation {
+		return fmt.Errorf("epoch start %d is not after the creation block %d", epochStart.Uint64(), creation)
+	}
+	compact, fromBlock, err := ledgerEpochStakes(cProps, cProps.Kt, creation, epochStart.Uint64(), endBlock.Uint64())
+	if err != nil {
+		return fmt.Errorf("failed to build epoch from stake ledger: %w", err)
+	}
+	full, err := GatherStakesAndWithdraws(cProps, cProps.Kt, new(big.Int).SetUint64(creation), endBlock)
+	if err != nil {
+		return fmt.Errorf("failed to gather stakes: %w", err)
+	}
+	if err := compareEpochMinimums(epochStart.Uint64(), endBlock.Uint64(), compact, full); err != nil {
+		return fmt.Errorf("stake ledger (snapshot at block %d) disagrees with full recompute: %w", fromBlock, err)
+	}
+	log.Infof("Stake ledger matches full recompute (snapshot at block %d, %d addresses)", fromBlock, len(compact))
+	return nil
+}
+
+// ledgerEpochStakes builds the compact stakeDataMap for [epochStart, endBlock]
+// from the newest usable snapshot at or below epochStart, and stores
+// snapshots at epochStart and endBlock (the next epoch's start) once they
+// are buried deep enough to survive a reorg. Returns the map and the block
+// of the snapshot it started from (creationBlock if none was usable).
+func ledgerEpochStakes(cProps *ConnectionProps, kt Ktv2Interface, creationBlock, epochStart, endBlock uint64) (map[common.Address]map[uint64]*UserStakeData, uint64, error) {
+	store, release, err := openEventStore(cProps)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer release()
+
+	// The reorg check must run before the snapshot is read: it wipes the
+	// ledger together with the chunks it was derived from.
+	tip, err := reconcileCacheTip(cProps, store)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	base := StakeSnapshot{Block: creationBlock}
+	snap, found, err := store.LoadSnapshot(epochStart)
+	switch {
+	case err != nil:
+		log.Warnf("Failed to read stake snapshot at or below block %d: %v - rebuilding from creation block", epochStart, err)
+	case !found:
+		log.Debugf("No stake snapshot at or below block %d", epochStart)
+	case snap.Block < creationBlock || snap.Block > tip+1:
+		// A snapshot past the cached tip cannot have come from these
+		// chunks; resuming from it would leave a gap in the cache.
+		log.Warnf("Ignoring stake snapshot at block %d (creation %d, cache tip %d)", snap.Block, creationBlock, tip)
+	default:
+		base = snap
+	}
+
+	chunkSize := uint64(cProps.ChunkSize)
+	if chunkSize == 0 {
+		chunkSize = uint64(DefaultChunkSize)
+	}
+	// Chunk keys are laid out on a grid starting at the creation block, so
+	// the read has to start on that grid, not at the snapshot block.
+	fetchFrom := creationBlock + (base.Block-creationBlock)/chunkSize*chunkSize
+	events, err := loadEventRange(cProps, kt, store, tip, fetchFrom, endBlock)
+	if err != nil {
+		return nil, 0, err
+	}
+	deltas := buildStakeDataMap(
+		stakeEventsFrom(events.StakeEvents, base.Block),
+		withdrawEventsFrom(events.WithdrawEvents, base.Block),
+	)
+
+	atStart := rollStakeBalances(snapshotBalances(base), deltas, base.Block, epochStart)
+	compact := epochStakeDataMap(atStart, deltas, epochStart)
+
+	head, headErr := cProps.Client.BlockNumber(context.Background())
+	if headErr != nil {
+		log.Debugf("Could not read head to gauge snapshot burial: %v", headErr)
+		return compact, base.Block, nil
+	}
+	buried := func(block uint64) bool {
+		return head >= reorgSafetyDepth && block <= head-reorgSafetyDepth
+	}
+	toStore := make([]StakeSnapshot, 0, 2)
+	if epochStart > base.Block && buried(epochStart) {
+		toStore = append(toStore, newStakeSnapshot(epochStart, atStart))
+	}
+	if endBlock > epochStart && buried(endBlock) {
+		atEnd := rollStakeBalances(atStart, deltas, epochStart, endBlock)
+		toStore = append(toStore, newStakeSnapshot(endBlock, atEnd))
+	}
+	if err := store.StoreSnapshots(toStore); err != nil {
+		log.Warnf("Failed to store stake snapshots: %v", err)
+	}
+	return compact, base.Block, nil
+}
+
+// rollStakeBalances applies every per-block delta in [fromBlock, toBlock) to
+// balances, clamping at zero after each block exactly as
+// findMinOverBlockRange does. balances is not modified.
+func rollStakeBalances(balances map[common.Address]*big.Int, deltas map[common.Address]map[uint64]*UserStakeData, fromBlock, toBlock uint64) map[common.Address]*big.Int {
+	out := make(map[common.Address]*big.Int, len(balances))
+	for addr, amt := range balances {
+		out[addr] = new(big.Int).Set(amt)
+	}
+	for addr, blockData := range deltas {
+		var blocks []uint64
+		for blk, data := range blockData {
+			if blk >= fromBlock && blk < toBlock && data != nil && data.StakeAmount != nil {
+				blocks = append(blocks, blk)
+			}
+		}
+		if len(blocks) == 0 {
+			continue
+		}
+		sort.Slice(blocks, func(i, j int) bool { return blocks[i] < blocks[j] })
+		current := out[addr]
+		if current == nil {
+			current = big.NewInt(0)
+		}
+		for _, blk := range blocks {
+			current.Add(current, blockData[blk].StakeAmount)
+			if current.Sign() < 0 {
+				current.SetInt64(0)
+			}
+		}
+		if current.Sign() > 0 {
+			out[addr] = current
+		} else {
+			delete(out, addr)
+		}
+	}
+	return out
+}
+
+// epochStakeDataMap builds the stakeDataMap handed to findMinOverBlockRange:
+// each wallet's balance entering the epoch as a single entry at
+// epochStart-1, plus its real deltas from epochStart onward.
+func epochStakeDataMap(atStart map[common.Address]*big.Int, deltas map[common.Address]map[uint64]*UserStakeData, epochStart uint64) map[common.Address]map[uint64]*UserStakeData {
+	out := make(map[common.Address]map[uint64]*UserStakeData)
+	for addr, amt := range atStart {
+		if amt.Sign() <= 0 {
+			continue
+		}
+		out[addr] = map[uint64]*UserStakeData{
+			epochStart - 1: {StakeAmount: new(big.Int).Set(amt)},
+		}
+	}
+	for addr, blockData := range deltas {
+		for blk, data := range blockData {
+			if blk < epochStart {
+				continue
+			}
+			if out[addr] == nil {
+				out[addr] = make(map[uint64]*UserStakeData)
+			}
+			out[addr][blk] = data
+		}
+	}
+	return out
+}
+
+// compareEpochMinimums runs findMinOverBlockRange on both maps and returns an
+// error describing the first difference in the per-address minimums.
+func compareEpochMinimums(epochStart, endBlock uint64, ledger, full map[common.Address]map[uint64]*UserStakeData) error {
+	ledgerTotal, ledgerMins, err := findMinOverBlockRange(epochStart, endBlock, ledger)
+	if err != nil {
+		return fmt.Errorf("ledger minimums: %w", err)
+	}
+	fullTotal, fullMins, err := findMinOverBlockRange(epochStart, endBlock, full)
+	if err != nil {
+		return fmt.Errorf("full minimums: %w", err)
+	}
+	if len(ledgerMins) != len(fullMins) {
+		return fmt.Errorf("%d addresses from ledger, %d from full recompute", len(ledgerMins), len(fullMins))
+	}
+	for addr, want := range fullMins {
+		got, ok := ledgerMins[addr]
+		if !ok {
+			return fmt.Errorf("%s missing from ledger result", addr.Hex())
+		}
+		if got.StakeAmount.Cmp(want.StakeAmount) != 0 {
+			return fmt.Errorf("%s: ledger min %s, full min %s", addr.Hex(), got.StakeAmount, want.StakeAmount)
+		}
+	}
+	if ledgerTotal.Cmp(fullTotal) != 0 {
+		return fmt.Errorf("total: ledger %s, full %s", ledgerTotal, fullTotal)
+	}
+	return nil
+}
+
+func stakeEventsFrom(events []StakeEvent, fromBlock uint64) []StakeEvent {
+	out := make([]StakeEvent, 0, len(events))
+	for _, e := range events {
+		if e.Block >= fromBlock {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+func withdrawEventsFrom(events []WithdrawEvent, fromBlock uint64) []WithdrawEvent {
+	out := make([]WithdrawEvent, 0, len(events))
+	for _, e := range events {
+		if e.Block >= fromBlock {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+func newStakeSnapshot(block uint64, balances map[common.Address]*big.Int) StakeSnapshot {
+	snap := StakeSnapshot{Block: block}
+	for addr, amt := range balances {
+		if amt.Sign() > 0 {
+			snap.Balances = append(snap.Balances, SnapshotBalance{Addr: addr, Amount: new(big.Int).Set(amt)})
+		}
+	}
+	sort.Slice(snap.Balances, func(i, j int) bool {
+		return bytes.Compare(snap.Balances[i].Addr[:], snap.Balances[j].Addr[:]) < 0
+	})
+	return snap
+}
+
+func snapshotBalances(snap StakeSnapshot) map[common.Address]*big.Int {
+	out := make(map[common.Address]*big.Int, len(snap.Balances))
+	for _, b := range snap.Balances {
+		out[b.Addr] = new(big.Int).Set(b.Amount)
+	}
+	return out
+}
+
+// dropStakeLedger deletes every stored snapshot. The next epoch rebuilds
+// from the creation block and starts a fresh ledger.
+func dropStakeLedger(cProps *ConnectionProps) error {
+	store, release, err := openEventStore(cProps)
+	if err != nil {
+		return err
+	}
+	defer release()
+	return store.DropSnapshots()
+}
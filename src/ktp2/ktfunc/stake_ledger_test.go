@@ -0,0 +1,206 @@
+package ktfunc
+
+import (
+	"math/big"
+	"math/rand"
+	"testing"
+
+	"ktp2/src/abis/ktv2"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// ledgerFakeKt serves a fixed event history, honouring the requested block
+// range the way the real log filter does.
+type ledgerFakeKt struct {
+	Ktv2Interface
+	stakes    []StakeEvent
+	withdraws []WithdrawEvent
+	gave      []*ktv2.Ktv2Gave
+	queried   [][2]uint64 // FilterStaked ranges, in call order
+}
+
+func (f *ledgerFakeKt) FilterStaked(opts *bind.FilterOpts) (StakedIterator, error) {
+	f.queried = append(f.queried, [2]uint64{opts.Start, *opts.End})
+	var out []StakeEvent
+	for _, e := range f.stakes {
+		if e.Block >= opts.Start && (opts.End == nil || e.Block <= *opts.End) {
+			out = append(out, e)
+		}
+	}
+	return &mockStakedIterator{events: out}, nil
+}
+
+func (f *ledgerFakeKt) FilterWithdrew(opts *bind.FilterOpts) (WithdrewIterator, error) {
+	var out []WithdrawEvent
+	for _, e := range f.withdraws {
+		if e.Block >= opts.Start && (opts.End == nil || e.Block <= *opts.End) {
+			out = append(out, e)
+		}
+	}
+	return &mockWithdrewIterator{events: out}, nil
+}
+
+func (f *ledgerFakeKt) FilterGave(opts *bind.FilterOpts) (GaveIterator, error) {
+	return gaveIn(f.gave)(opts), nil
+}
+
+// randomStakeHistory builds a history that exercises same-block
+// stake+withdraw, over-withdrawal (the clamp) and events landing exactly on
+// epoch boundaries.
+func randomStakeHistory(rng *rand.Rand, addrs []common.Address, from, to uint64, n int) ([]StakeEvent, []WithdrawEvent) {
+	var stakes []StakeEvent
+	var withdraws []WithdrawEvent
+	for i := 0; i < n; i++ {
+		addr := addrs[rng.Intn(len(addrs))]
+		block := from + uint64(rng.Int63n(int64(to-from+1)))
+		if rng.Intn(10) == 0 {
+			block = from + (block-from)/50*50 // epoch boundary
+		}
+		amount := big.NewInt(rng.Int63n(1000) + 1)
+		if rng.Intn(3) == 0 {
+			withdraws = append(withdraws, WithdrawEvent{Addr: addr, Amount: amount, Block: block})
+		} else {
+			stakes = append(stakes, StakeEvent{Addr: addr, Amount: amount, Block: block})
+		}
+	}
+	return stakes, withdraws
+}
+
+func TestStakeLedger_MatchesFullRecompute(t *testing.T) {
+	logrus.SetLevel(logrus.FatalLevel)
+	defer logrus.SetLevel(logrus.InfoLevel)
+
+	addrs := []common.Address{
+		common.HexToAddress("0x01"), common.HexToAddress("0x02"), common.HexToAddress("0x03"),
+		common.HexToAddress("0x04"), common.HexToAddress("0x05"),
+	}
+	const creation, interval, epochs = uint64(100), uint64(50), 20
+
+	for seed := int64(1); seed <= 25; seed++ {
+		rng := rand.New(rand.NewSource(seed))
+		stakes, withdraws := randomStakeHistory(rng, addrs, creation, creation+interval*epochs, 300)
+		full := buildStakeDataMap(stakes, withdraws)
+
+		// Walk the epochs the way the node does: each epoch starts from the
+		// snapshot the previous one stored at its end block.
+		snapBlock := creation
+		snap := map[common.Address]*big.Int{}
+		for e := uint64(1); e < epochs; e++ {
+			start := creation + e*interval
+			end := start + interval
+
+			atStart := rollStakeBalances(snap, full, snapBlock, start)
+			compact := epochStakeDataMap(atStart, full, start)
+			require.NoError(t, compareEpochMinimums(start, end, compact, full), "seed %d epoch %d-%d", seed, start, end)
+
+			snap = rollStakeBalances(atStart, full, start, end)
+			snapBlock = end
+		}
+	}
+}
+
+func TestRollStakeBalances_ClampsPerBlock(t *testing.T) {
+	addr := common.HexToAddress("0x01")
+	deltas := map[common.Address]map[uint64]*UserStakeData{
+		addr: {
+			10: {StakeAmount: big.NewInt(100)},
+			11: {StakeAmount: big.NewInt(-250)}, // over-withdraw clamps to 0
+			12: {StakeAmount: big.NewInt(40)},
+			20: {StakeAmount: big.NewInt(500)}, // outside the window
+		},
+	}
+	got := rollStakeBalances(map[common.Address]*big.Int{}, deltas, 10, 20)
+	assert.Equal(t, big.NewInt(40), got[addr])
+
+	got = rollStakeBalances(map[common.Address]*big.Int{}, deltas, 10, 12)
+	_, present := got[addr]
+	assert.False(t, present, "zero balances are dropped from the snapshot")
+}
+
+func newLedgerTestProps(t *testing.T, kt Ktv2Interface) *ConnectionProps {
+	mockClient := &MockEthClient{}
+	mockClient.On("BlockNumber", mock.Anything).Return(uint64(10000), nil).Maybe()
+	mockClient.On("HeaderByNumber", mock.Anything, mock.Anything).Return(&types.Header{}, nil).Maybe()
+	return &ConnectionProps{
+		Client:    mockClient,
+		Kt:        kt,
+		KtAddr:    common.HexToAddress("0x1234567890123456789012345678901234567890"),
+		ChainID:   big.NewInt(1),
+		ChunkSize: 100,
+		CacheDir:  t.TempDir(),
+	}
+}
+
+func TestGatherEpochStakes_StoresSnapshotsAndSkipsRecheck(t *testing.T) {
+	logrus.SetLevel(logrus.FatalLevel)
+	defer logrus.SetLevel(logrus.InfoLevel)
+
+	addrs := []common.Address{common.HexToAddress("0x0a"), common.HexToAddress("0x0b"), common.HexToAddress("0x0c")}
+	stakes, withdraws := randomStakeHistory(rand.New(rand.NewSource(7)), addrs, 100, 700, 120)
+	kt := &ledgerFakeKt{stakes: stakes, withdraws: withdraws}
+	cProps := newLedgerTestProps(t, kt)
+	creation := big.NewInt(100)
+
+	for _, epoch := range [][2]int64{{200, 300}, {300, 400}, {400, 500}} {
+		start, end := big.NewInt(epoch[0]), big.NewInt(epoch[1])
+		got, err := GatherEpochStakes(cProps, kt, creation, start, end)
+		require.NoError(t, err)
+		full, err := GatherStakesAndWithdraws(cProps, kt, creation, end)
+		require.NoError(t, err)
+		assert.NoError(t, compareEpochMinimums(start.Uint64(), end.Uint64(), got, full))
+	}
+	// First epoch ran the consistency check, the next two were served from
+	// the ledger alone.
+	assert.Equal(t, 3, cProps.ledgerEpochsUnchecked)
+
+	store, release, err := openEventStore(cProps)
+	require.NoError(t, err)
+	defer release()
+	for _, block := range []uint64{200, 300, 400, 500} {
+		snap, found, err := store.LoadSnapshot(block)
+		require.NoError(t, err)
+		assert.True(t, found)
+		assert.Equal(t, block, snap.Block)
+	}
+}
+
+func TestGatherEpochStakes_DiscardsInconsistentLedger(t *testing.T) {
+	logrus.SetLevel(logrus.FatalLevel)
+	defer logrus.SetLevel(logrus.InfoLevel)
+
+	addr := common.HexToAddress("0x0a")
+	kt := &ledgerFakeKt{stakes: []StakeEvent{{Addr: addr, Amount: big.NewInt(100), Block: 150}}}
+	cProps := newLedgerTestProps(t, kt)
+
+	// Plant a snapshot that disagrees with the chain's history.
+	store, release, err := openEventStore(cProps)
+	require.NoError(t, err)
+	require.NoError(t, store.StoreSnapshots([]StakeSnapshot{
+		newStakeSnapshot(200, map[common.Address]*big.Int{addr: big.NewInt(999)}),
+	}))
+	// Mark the cache as covering the snapshot so the ledger will trust it.
+	_, err = loadEventRange(cProps, kt, store, 0, 100, 299)
+	require.NoError(t, err)
+	release()
+
+	got, err := GatherEpochStakes(cProps, kt, big.NewInt(100), big.NewInt(200), big.NewInt(300))
+	require.NoError(t, err)
+	_, mins, err := findMinOverBlockRange(200, 300, got)
+	require.NoError(t, err)
+	assert.Equal(t, big.NewInt(100), mins[addr].StakeAmount, "full recompute wins on mismatch")
+	assert.Equal(t, 0, cProps.ledgerEpochsUnchecked)
+
+	store, release, err = openEventStore(cProps)
+	require.NoError(t, err)
+	defer release()
+	_, found, err := store.LoadSnapshot(1 << 62)
+	require.NoError(t, err)
+	assert.False(t, found, "ledger should be dropped")
+}
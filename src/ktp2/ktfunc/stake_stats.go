@@ -0,0 +1,219 @@
+package ktfunc
+
+// Staking health. Fee and burn parameters are governance decisions, and
+// what they should be depends on how concentrated the stake is and how many
+// stakers the lottery really spreads its rewards over. These statistics are
+// computed per rewarded epoch from the replayed minimums, the numbers the
+// lottery itself draws from, so they show the stake that counted rather
+// than what happened to be staked at some instant.
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// DefaultTopN is how many of the largest stakers the top-N share covers
+// unless asked otherwise.
+const DefaultTopN = 5
+
+// EpochStakeStats is the staking health of one rewarded epoch. Stakers and
+// the concentration measures cover eligible stakers only; declined stakers
+// are counted separately.
+type EpochStakeStats struct {
+	Start         uint64  `json:"start"`
+	End           uint64  `json:"end"`
+	Stakers       int     `json:"stakers"`
+	TotalMin      string  `json:"totalMin"`
+	Declined      int     `json:"declined"`
+	DeclinedStake string  `json:"declinedStake"`
+	DeclinedShare float64 `json:"declinedShare"` // of eligible plus declined minimums
+	Gini          float64 `json:"gini"`
+	TopShare      float64 `json:"topShare"` // of TotalMin, held by the top N stakers
+	// EffectiveByStake and EffectiveByProbability are the inverse Simpson
+	// index 1/sum(w^2) of the stake shares and of the lottery's
+	// log-normalized probabilities: how many equal stakers would give the
+	// same concentration.
+	EffectiveByStake       float64 `json:"effectiveByStake"`
+	EffectiveByProbability float64 `json:"effectiveByProbability"`
+}
+
+// StakeStatsReport is the staking health of every epoch rewarded in
+// [From, To], oldest first.
+type StakeStatsReport struct {
+	From   uint64            `json:"from"`
+	To     uint64            `json:"to"`
+	TopN   int               `json:"topN"`
+	Epochs []EpochStakeStats `json:"epochs"`
+}
+
+// BuildStakeStats computes EpochStakeStats for every epoch rewarded in
+// [from, to]. Stakes are gathered once for the range; declines are read as
+// they stand now, as everywhere an epoch is replayed.
+func BuildStakeStats(cProps *ConnectionProps, from, to uint64, topN int) (*StakeStatsReport, error) {
+	if topN <= 0 {
+		topN = DefaultTopN
+	}
+	epochs, err := GatherPastEpochs(cProps, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to gather rewarded epochs: %w", err)
+	}
+	report := &StakeStatsReport{From: from, To: to, TopN: topN, Epochs: []EpochStakeStats{}}
+	if len(epochs) == 0 {
+		return report, nil
+	}
+
+	creation, err := GetContractCreationBlock(cProps)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get contract creation block: %w", err)
+	}
+	lastEnd := epochs[0].End
+	for _, ep := range epochs {
+		lastEnd = max(lastEnd, ep.End)
+	}
+	stakeDataMap, err := GatherStakesAndWithdraws(cProps, cProps.Kt, new(big.Int).SetUint64(creation), new(big.Int).SetUint64(lastEnd))
+	if err != nil {
+		return nil, fmt.Errorf("failed to gather stakes: %w", err)
+	}
+
+	for _, ep := range epochs {
+		s, err := epochStakeStats(cProps, stakeDataMap, ep.Start, ep.End, topN)
+		if err != nil {
+			return nil, fmt.Errorf("failed to replay epoch %d-%d: %w", ep.Start, ep.End, err)
+		}
+		report.Epochs = append(report.Epochs, s)
+	}
+	return report, nil
+}
+
+func epochStakeStats(cProps *ConnectionProps, stakeDataMap map[common.Address]map[uint64]*UserStakeData, start, end uint64, topN int) (EpochStakeStats, error) {
+	s := EpochStakeStats{Start: start, End: end}
+	totalMin, mins, declined, err := replayEpochOdds(cProps, stakeDataMap, start, end)
+	if err != nil {
+		return s, err
+	}
+	s.Stakers = len(mins)
+	s.TotalMin = totalMin.String()
+	s.Declined = len(declined)
+
+	declinedStake := new(big.Int)
+	if len(declined) > 0 {
+		_, all, err := findMinOverBlockRange(start, end, stakeDataThrough(stakeDataMap, end))
+		if err != nil {
+			return s, err
+		}
+		for _, addr := range declined {
+			declinedStake.Add(declinedStake, all[addr].StakeAmount)
+		}
+	}
+	s.DeclinedStake = declinedStake.String()
+	if whole := new(big.Int).Add(totalMin, declinedStake); whole.Sign() > 0 {
+		s.DeclinedShare = ratio(declinedStake, whole)
+	}
+	if totalMin.Sign() == 0 {
+		return s, nil
+	}
+
+	amounts := make([]*big.Int, 0, len(mins))
+	var probSquares float64
+	for _, d := range mins {
+		amounts = append(amounts, d.StakeAmount)
+		if d.Prob != nil {
+			p, _ := d.Prob.Float64()
+			probSquares += p * p
+		}
+	}
+	sort.Slice(amounts, func(i, j int) bool { return amounts[i].Cmp(amounts[j]) < 0 })
+
+	shares := make([]float64, len(amounts))
+	var shareSquares float64
+	for i, a := range amounts {
+		shares[i] = ratio(a, totalMin)
+		shareSquares += shares[i] * shares[i]
+	}
+	s.Gini = gini(shares)
+	for i := len(shares) - 1; i >= 0 && i >= len(shares)-topN; i-- {
+		s.TopShare += shares[i]
+	}
+	s.EffectiveByStake = 1 / shareSquares
+	if probSquares > 0 {
+		s.EffectiveByProbability = 1 / probSquares
+	}
+	return s, nil
+}
+
+// gini is the Gini coefficient of shares, which must be sorted ascending
+// and sum to 1: 0 when everyone holds the same, approaching 1 when one
+// staker holds everything.
+func gini(shares []float64) float64 {
+	n := float64(len(shares))
+	var weighted float64
+	for i, x := range shares {
+		weighted += float64(i+1) * x
+	}
+	return 2*weighted/n - (n+1)/n
+}
+
+func ratio(a, b *big.Int) float64 {
+	r, _ := new(big.Rat).SetFrac(a, b).Float64()
+	return r
+}
+
+// WriteStakeStats writes the report as a table with each epoch's change
+// from the one before, as JSON, or as CSV with one row per epoch.
+func WriteStakeStats(w io.Writer, report *StakeStatsReport, format OutputFormat) error {
+	switch format {
+	case FormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	case FormatCSV:
+		cw := csv.NewWriter(w)
+		f := func(x float64) string { return strconv.FormatFloat(x, 'f', -1, 64) }
+		rows := [][]string{{
+			"start", "end", "stakers", "total_min", "declined", "declined_stake", "declined_share",
+			"gini", "top_share", "effective_by_stake", "effective_by_probability",
+		}}
+		for _, s := range report.Epochs {
+			rows = append(rows, []string{
+				strconv.FormatUint(s.Start, 10), strconv.FormatUint(s.End, 10), strconv.Itoa(s.Stakers), s.TotalMin,
+				strconv.Itoa(s.Declined), s.DeclinedStake, f(s.DeclinedShare),
+				f(s.Gini), f(s.TopShare), f(s.EffectiveByStake), f(s.EffectiveByProbability),
+			})
+		}
+		if err := cw.WriteAll(rows); err != nil {
+			return err
+		}
+		return cw.Error()
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "Stake statistics for epochs rewarded in blocks %d-%d (%d epochs)\n", report.From, report.To, len(report.Epochs))
+	if len(report.Epochs) == 0 {
+		return tw.Flush()
+	}
+	fmt.Fprintf(tw, "Epoch\tStakers\tDeclined share\tGini\tTop %d share\tEffective (stake)\tEffective (odds)\n", report.TopN)
+	for i, s := range report.Epochs {
+		if i == 0 {
+			fmt.Fprintf(tw, "%d-%d\t%d\t%.1f%%\t%.3f\t%.1f%%\t%.2f\t%.2f\n", s.Start, s.End, s.Stakers,
+				100*s.DeclinedShare, s.Gini, 100*s.TopShare, s.EffectiveByStake, s.EffectiveByProbability)
+			continue
+		}
+		p := report.Epochs[i-1]
+		fmt.Fprintf(tw, "%d-%d\t%d (%+d)\t%.1f%% (%+.1f)\t%.3f (%+.3f)\t%.1f%% (%+.1f)\t%.2f (%+.2f)\t%.2f (%+.2f)\n", s.Start, s.End,
+			s.Stakers, s.Stakers-p.Stakers,
+			100*s.DeclinedShare, 100*(s.DeclinedShare-p.DeclinedShare),
+			s.Gini, s.Gini-p.Gini,
+			100*s.TopShare, 100*(s.TopShare-p.TopShare),
+			s.EffectiveByStake, s.EffectiveByStake-p.EffectiveByStake,
+			s.EffectiveByProbability, s.EffectiveByProbability-p.EffectiveByProbability)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,62 @@
+package ktfunc
+
+import (
+	"bytes"
+	"encoding/csv"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildStakeStats(t *testing.T) {
+	logrus.SetLevel(logrus.FatalLevel)
+	defer logrus.SetLevel(logrus.InfoLevel)
+
+	kt, _, b := threeEpochHistory()
+	cProps := newOddsTestProps(t, kt, 500)
+
+	report, err := BuildStakeStats(cProps, 0, 500, 1)
+	require.NoError(t, err)
+	require.Len(t, report.Epochs, 3)
+
+	assert.Equal(t, EpochStakeStats{Start: 100, End: 200, TotalMin: "0", DeclinedStake: "0"}, report.Epochs[0], "everyone staked inside the first epoch")
+	assert.Equal(t, 1, report.Epochs[1].Stakers, "b had withdrawn to zero")
+	assert.InDelta(t, 0, report.Epochs[1].Gini, 1e-12)
+	assert.InDelta(t, 1, report.Epochs[1].EffectiveByStake, 1e-12)
+
+	// a holds 100 and b 10 of the 300-400 minimums.
+	last := report.Epochs[2]
+	assert.Equal(t, 2, last.Stakers)
+	assert.Equal(t, "110", last.TotalMin)
+	assert.InDelta(t, 90.0/220, last.Gini, 1e-12)
+	assert.InDelta(t, 100.0/110, last.TopShare, 1e-12)
+	assert.InDelta(t, 121.0/101, last.EffectiveByStake, 1e-9)
+	assert.Greater(t, last.EffectiveByProbability, last.EffectiveByStake, "log weighting spreads the odds")
+	assert.Zero(t, last.DeclinedShare)
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteStakeStats(&buf, report, FormatTable))
+	assert.Contains(t, buf.String(), "2 (+1)")
+	buf.Reset()
+	require.NoError(t, WriteStakeStats(&buf, report, FormatCSV))
+	rows, err := csv.NewReader(&buf).ReadAll()
+	require.NoError(t, err)
+	assert.Len(t, rows, 4)
+
+	// Declined stake is left out of the concentration measures.
+	kt.declined = map[common.Address]bool{b: true}
+	cProps = newOddsTestProps(t, kt, 500)
+	report, err = BuildStakeStats(cProps, 400, 500, 0)
+	require.NoError(t, err)
+	require.Len(t, report.Epochs, 1)
+	assert.Equal(t, DefaultTopN, report.TopN)
+	last = report.Epochs[0]
+	assert.Equal(t, 1, last.Stakers)
+	assert.Equal(t, 1, last.Declined)
+	assert.Equal(t, "10", last.DeclinedStake)
+	assert.InDelta(t, 10.0/110, last.DeclinedShare, 1e-12)
+	assert.InDelta(t, 1, last.TopShare, 1e-12)
+}
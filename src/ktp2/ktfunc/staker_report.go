@@ -0,0 +1,205 @@
+package ktfunc
+
+// Per-staker history: one address's stake/withdraw timeline (with its
+// donations), its minimum and win chance in every rewarded epoch since it
+// first staked, the epochs it won and whether it currently declines rewards.
+// Built from the event cache plus the Voted/Rwd history (see
+// epoch_history.go).
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// StakerEvent is one stake, withdrawal or donation with the stake balance
+// right after it. A donation's amount is the ETH given and leaves the balance
+// as it was.
+type StakerEvent struct {
+	Block   uint64 `json:"block"`
+	Type    string `json:"type"`
+	Amount  string `json:"amount"`
+	Balance string `json:"balance"`
+}
+
+// StakerEpoch is the staker's standing in one rewarded epoch. MinStake is
+// "0" and Probability 0 when it did not qualify.
+type StakerEpoch struct {
+	Start       uint64  `json:"start"`
+	End         uint64  `json:"end"`
+	MinStake    string  `json:"minStake"`
+	Probability float64 `json:"probability"`
+	Winner      string  `json:"winner"`
+	Won         bool    `json:"won"`
+	Amount      string  `json:"amount,omitempty"`
+}
+
+// StakerReport is the history of one address.
+type StakerReport struct {
+	Address  string        `json:"address"`
+	Declined bool          `json:"declined"`
+	Balance  string        `json:"balance"`
+	Through  uint64        `json:"through"`
+	Events   []StakerEvent `json:"events"`
+	Epochs   []StakerEpoch `json:"epochs"`
+	Wins     int           `json:"wins"`
+	TotalWon string        `json:"totalWon"`
+}
+
+// BuildStakerReport assembles the history of addr up to the current block.
+// Past probabilities use today's decline flags, since the contract keeps no
+// history of them.
+func BuildStakerReport(cProps *ConnectionProps, addr common.Address) (*StakerReport, error) {
+	head, err := cProps.Client.BlockNumber(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("failed to read current block: %w", err)
+	}
+	creation, err := GetContractCreationBlock(cProps)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get contract creation block: %w", err)
+	}
+	declined, err := cProps.Kt.Declines(&bind.CallOpts{Context: context.Background(), From: cProps.MyPubKey}, addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read decline status: %w", err)
+	}
+
+	// Gathering fills the cache up to head; the timeline is then read back
+	// from it event by event, before same-block events are netted.
+	stakeDataMap, err := GatherStakesAndWithdraws(cProps, cProps.Kt, new(big.Int).SetUint64(creation), new(big.Int).SetUint64(head))
+	if err != nil {
+		return nil, fmt.Errorf("failed to gather stakes: %w", err)
+	}
+	cached, err := InspectCache(cProps, CacheQuery{Addr: &addr, ToBlock: head}, CacheSections{Events: true})
+	if err != nil {
+		return nil, err
+	}
+	epochs, err := GatherPastEpochs(cProps, creation, head)
+	if err != nil {
+		return nil, fmt.Errorf("failed to gather past epochs: %w", err)
+	}
+
+	report := &StakerReport{
+		Address:  addr.Hex(),
+		Declined: declined,
+		Through:  head,
+		Events:   make([]StakerEvent, 0, len(cached.Events)),
+		Epochs:   []StakerEpoch{},
+	}
+	balance := new(big.Int)
+	var firstStake *uint64
+	for _, e := range cached.Events {
+		amount, _ := new(big.Int).SetString(e.Amount, 10)
+		switch e.Type {
+		case CacheEventStake:
+			balance.Add(balance, amount)
+			if firstStake == nil {
+				firstStake = &e.Block
+			}
+		case CacheEventWithdraw:
+			if balance.Sub(balance, amount); balance.Sign() < 0 {
+				balance.SetInt64(0) // same clamp as findMinOverBlockRange
+			}
+		}
+		report.Events = append(report.Events, StakerEvent{Block: e.Block, Type: e.Type, Amount: e.Amount, Balance: balance.String()})
+	}
+	report.Balance = balance.String()
+
+	totalWon := new(big.Int)
+	for _, ep := range epochs {
+		won := ep.Winner == addr
+		staked := firstStake != nil && ep.End >= *firstStake
+		if !staked && !won {
+			continue // before the address ever staked
+		}
+		_, mins, err := epochOdds(cProps, stakeDataMap, ep.Start, ep.End)
+		if err != nil {
+			return nil, fmt.Errorf("failed to replay epoch %d-%d: %w", ep.Start, ep.End, err)
+		}
+		row := StakerEpoch{Start: ep.Start, End: ep.End, MinStake: "0", Winner: ep.Winner.Hex(), Won: won}
+		if d, ok := mins[addr]; ok {
+			row.MinStake = d.StakeAmount.String()
+			if d.Prob != nil {
+				row.Probability, _ = d.Prob.Float64()
+			}
+		}
+		if won {
+			row.Amount = ep.Amount.String()
+			report.Wins++
+			totalWon.Add(totalWon, ep.Amount)
+		}
+		report.Epochs = append(report.Epochs, row)
+	}
+	report.TotalWon = totalWon.String()
+	return report, nil
+}
+
+// WriteStakerReport renders report to w. CSV writes the timeline and the
+// epochs as two blocks separated by a blank line.
+func WriteStakerReport(w io.Writer, report *StakerReport, format OutputFormat) error {
+	switch format {
+	case FormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	case FormatCSV:
+		cw := csv.NewWriter(w)
+		rows := [][]string{{"block", "type", "amount", "balance"}}
+		for _, e := range report.Events {
+			rows = append(rows, []string{strconv.FormatUint(e.Block, 10), e.Type, e.Amount, e.Balance})
+		}
+		if err := cw.WriteAll(rows); err != nil {
+			return err
+		}
+		if _, err := io.WriteString(w, "\n"); err != nil {
+			return err
+		}
+		rows = [][]string{{"start", "end", "min_stake", "probability", "winner", "won", "amount"}}
+		for _, e := range report.Epochs {
+			rows = append(rows, []string{
+				strconv.FormatUint(e.Start, 10), strconv.FormatUint(e.End, 10), e.MinStake,
+				strconv.FormatFloat(e.Probability, 'f', -1, 64), e.Winner, strconv.FormatBool(e.Won), e.Amount,
+			})
+		}
+		return cw.WriteAll(rows)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	status := "eligible"
+	if report.Declined {
+		status = "DECLINES rewards (never selected)"
+	}
+	fmt.Fprintf(tw, "Staker %s (through block %d)\n", report.Address, report.Through)
+	fmt.Fprintf(tw, "  Status: %s\n", status)
+	fmt.Fprintf(tw, "  Current stake: %s wei\n", report.Balance)
+	fmt.Fprintf(tw, "  Epochs won: %d, total %s wei\n\n", report.Wins, report.TotalWon)
+
+	fmt.Fprintf(tw, "Timeline (%d events):\n", len(report.Events))
+	if len(report.Events) > 0 {
+		fmt.Fprintln(tw, "  Block\tType\tAmount (wei)\tBalance after (wei)")
+		for _, e := range report.Events {
+			fmt.Fprintf(tw, "  %d\t%s\t%s\t%s\n", e.Block, e.Type, e.Amount, e.Balance)
+		}
+	}
+	fmt.Fprintln(tw)
+
+	fmt.Fprintf(tw, "Rewarded epochs (%d):\n", len(report.Epochs))
+	if len(report.Epochs) > 0 {
+		fmt.Fprintln(tw, "  Epoch\tMin stake (wei)\tWin chance\tResult")
+		for _, e := range report.Epochs {
+			result := "lost to " + e.Winner
+			if e.Won {
+				result = "WON " + e.Amount + " wei"
+			}
+			fmt.Fprintf(tw, "  %d-%d\t%s\t%.4f%%\t%s\n", e.Start, e.End, e.MinStake, e.Probability*100, result)
+		}
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,161 @@
+package ktfunc
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"ktp2/src/abis/ktv2"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func votedAt(block, epochStart uint64, candidate common.Address, data string) *ktv2.Ktv2Voted {
+	return &ktv2.Ktv2Voted{Arg0: new(big.Int).SetUint64(epochStart), Arg1: candidate, Arg2: data, Raw: types.Log{BlockNumber: block}}
+}
+
+func rwdAt(block uint64, winner common.Address, amount int64) *ktv2.Ktv2Rwd {
+	return &ktv2.Ktv2Rwd{Arg0: winner, Arg1: big.NewInt(amount), Raw: types.Log{BlockNumber: block}}
+}
+
+// threeEpochHistory is a contract created at block 100 with a 100-block
+// interval and three rewarded epochs: 100-200 won by a, 200-300 won by b
+// (after a reset vote), 300-400 won by a. b dips to zero in the second
+// epoch, then restakes.
+func threeEpochHistory() (*epochFakeKt, common.Address, common.Address) {
+	a, b := common.HexToAddress("0x0a"), common.HexToAddress("0x0b")
+	kt := &epochFakeKt{
+		ledgerFakeKt: &ledgerFakeKt{
+			stakes: []StakeEvent{
+				{Addr: a, Amount: big.NewInt(100), Block: 150},
+				{Addr: b, Amount: big.NewInt(50), Block: 120},
+				{Addr: b, Amount: big.NewInt(10), Block: 260},
+			},
+			withdraws: []WithdrawEvent{{Addr: b, Amount: big.NewInt(50), Block: 250}},
+		},
+		start:    400,
+		interval: 100,
+		voted: []*ktv2.Ktv2Voted{
+			votedAt(240, 100, a, "0xseed1"),
+			votedAt(340, 200, a, "0xwrong"),
+			votedAt(341, 200, a, resetVoteData),
+			votedAt(342, 200, b, "0xseed2"),
+			votedAt(440, 300, a, "0xseed3"),
+		},
+		rwds: []*ktv2.Ktv2Rwd{rwdAt(241, a, 5), rwdAt(343, b, 7), rwdAt(441, a, 9)},
+	}
+	return kt, a, b
+}
+
+func TestGatherPastEpochs(t *testing.T) {
+	logrus.SetLevel(logrus.FatalLevel)
+	defer logrus.SetLevel(logrus.InfoLevel)
+
+	kt, a, b := threeEpochHistory()
+	cProps := newOddsTestProps(t, kt, 500)
+
+	epochs, err := GatherPastEpochs(cProps, 0, 500)
+	require.NoError(t, err)
+	require.Len(t, epochs, 3)
+	assert.Equal(t, []EpochVote{
+		{Block: 340, Candidate: a, Data: "0xwrong"},
+		{Block: 341, Candidate: a, Data: resetVoteData},
+		{Block: 342, Candidate: b, Data: "0xseed2"},
+	}, epochs[1].Votes)
+	for i := range epochs {
+		epochs[i].Votes = nil
+	}
+	assert.Equal(t, PastEpoch{Start: 100, End: 200, Winner: a, Amount: big.NewInt(5), RwdBlock: 241, VoteData: "0xseed1"}, epochs[0])
+	assert.Equal(t, PastEpoch{Start: 200, End: 300, Winner: b, Amount: big.NewInt(7), RwdBlock: 343, VoteData: "0xseed2"}, epochs[1])
+	assert.Equal(t, PastEpoch{Start: 300, End: 400, Winner: a, Amount: big.NewInt(9), RwdBlock: 441, VoteData: "0xseed3"}, epochs[2])
+
+	// A range selects epochs by their Rwd block; votes before it still count.
+	epochs, err = GatherPastEpochs(cProps, 300, 400)
+	require.NoError(t, err)
+	require.Len(t, epochs, 1)
+	assert.Equal(t, uint64(200), epochs[0].Start)
+}
+
+// TestGatherPastEpochs_RwdAndNextVoteInOneBlock — the Rwd that closes an
+// epoch and the first vote on the next can land in the same block. The log
+// index decides which epoch the Rwd pays.
+func TestGatherPastEpochs_RwdAndNextVoteInOneBlock(t *testing.T) {
+	logrus.SetLevel(logrus.FatalLevel)
+	defer logrus.SetLevel(logrus.InfoLevel)
+
+	a, b := common.HexToAddress("0x0a"), common.HexToAddress("0x0b")
+	nextVote := votedAt(343, 300, b, "0xseed3")
+	nextVote.Raw.Index = 1
+	kt := &epochFakeKt{
+		ledgerFakeKt: &ledgerFakeKt{},
+		start:        400,
+		interval:     100,
+		voted:        []*ktv2.Ktv2Voted{votedAt(240, 100, a, "0xseed1"), votedAt(340, 200, a, "0xseed2"), nextVote},
+		rwds:         []*ktv2.Ktv2Rwd{rwdAt(241, a, 5), rwdAt(343, a, 7), rwdAt(441, b, 9)},
+	}
+	cProps := newOddsTestProps(t, kt, 500)
+
+	epochs, err := GatherPastEpochs(cProps, 300, 400)
+	require.NoError(t, err)
+	require.Len(t, epochs, 1)
+	assert.Equal(t, uint64(200), epochs[0].Start, "the Rwd comes before the vote on 300 in block 343")
+	assert.Equal(t, "0xseed2", epochs[0].VoteData)
+}
+
+func TestBuildStakerReport(t *testing.T) {
+	logrus.SetLevel(logrus.FatalLevel)
+	defer logrus.SetLevel(logrus.InfoLevel)
+
+	kt, a, b := threeEpochHistory()
+	kt.declined = map[common.Address]bool{b: true}
+	// b's donation is listed but leaves its stake alone.
+	kt.gave = []*ktv2.Ktv2Gave{{Arg0: b, Arg1: big.NewInt(4), Raw: types.Log{BlockNumber: 270}}}
+	cProps := newOddsTestProps(t, kt, 500)
+
+	report, err := BuildStakerReport(cProps, b)
+	require.NoError(t, err)
+	assert.True(t, report.Declined)
+	assert.Equal(t, "10", report.Balance)
+	assert.Equal(t, []StakerEvent{
+		{Block: 120, Type: CacheEventStake, Amount: "50", Balance: "50"},
+		{Block: 250, Type: CacheEventWithdraw, Amount: "50", Balance: "0"},
+		{Block: 260, Type: CacheEventStake, Amount: "10", Balance: "10"},
+		{Block: 270, Type: CacheEventGave, Amount: "4", Balance: "10"},
+	}, report.Events)
+	assert.Equal(t, 1, report.Wins)
+	assert.Equal(t, "7", report.TotalWon)
+
+	require.Len(t, report.Epochs, 3)
+	assert.Equal(t, "0", report.Epochs[1].MinStake, "the withdrawal drops b to zero for 200-300")
+	assert.True(t, report.Epochs[1].Won)
+	assert.Equal(t, "7", report.Epochs[1].Amount)
+	// b declines today, so it is filtered out of every replayed epoch.
+	assert.Equal(t, "0", report.Epochs[2].MinStake)
+
+	kt.declined = nil
+	cProps.DeclinesCache = nil
+	report, err = BuildStakerReport(cProps, b)
+	require.NoError(t, err)
+	assert.Equal(t, "10", report.Epochs[2].MinStake)
+	assert.Greater(t, report.Epochs[2].Probability, 0.0)
+	assert.Less(t, report.Epochs[2].Probability, 0.5, "a's 100 outweighs b's 10")
+
+	report, err = BuildStakerReport(cProps, a)
+	require.NoError(t, err)
+	assert.Equal(t, 2, report.Wins)
+	assert.Equal(t, "14", report.TotalWon)
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteStakerReport(&buf, report, FormatJSON))
+	var decoded StakerReport
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &decoded))
+	assert.Equal(t, *report, decoded)
+	buf.Reset()
+	require.NoError(t, WriteStakerReport(&buf, report, FormatTable))
+	assert.Contains(t, buf.String(), "WON 9 wei")
+}
@@ -54,11 +54,13 @@ func voteAndRewardTestProps(t *testing.T) (*ConnectionProps, *MockEthClient, *Mo
 	emptyWithdrew := &MockWithdrewIterator{events: []*ktv2.Ktv2Withdrew{}}
 	mockKt.On("FilterStaked", mock.Anything).Return(emptyStaked, nil).Maybe()
 	mockKt.On("FilterWithdrew", mock.Anything).Return(emptyWithdrew, nil).Maybe()
+	mockKt.On("FilterGave", mock.Anything).Return(&mockGaveIter{}, nil).Maybe()
 
 	zeroAddr := common.Address{}
 	mockKt.On("Vote", mock.Anything, zeroAddr, mock.AnythingOfType("string")).Return(
 		types.NewTransaction(0, zeroAddr, big.NewInt(0), 0, big.NewInt(0), []byte{}), nil).Maybe()
 	mockKt.On("BlockRwd", mock.Anything, mock.Anything, zeroAddr).Return(uint16(0), nil).Maybe()
+	mockKt.On("FilterVoted", mock.Anything).Return(&mockVotedIter{}, nil).Maybe() // peer votes, read after voting
 	mockClient.On("TransactionReceipt", mock.Anything, mock.Anything).Return(
 		&types.Receipt{Status: types.ReceiptStatusSuccessful, BlockNumber: big.NewInt(112)}, nil).Maybe()
 
@@ -0,0 +1,237 @@
+package ktfunc
+
+// Token price. give() converts ETH to tokens at the price the contract's
+// TokenPrice contract (tp) reads from its pool: price(pool) on a Uniswap v3
+// pool, from slot0's sqrtPriceX96, or priceV2(pool) on a v2 pair, from its
+// reserves, chosen by the contract's v2 flag. Either way the price is
+// token1 per token0 scaled by 1e18, and TokenPrice assumes both tokens have
+// 18 decimals; for any other pair the number is off by the difference.
+//
+// CheckTokenPrice reads the same pool state directly and repeats the
+// arithmetic, so a wrong pool, a wrong v2 flag or a token order give() does
+// not expect shows up before a donation is priced with it.
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"ktp2/src/abis/shib"
+	"ktp2/src/abis/tokenprice"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	log "github.com/sirupsen/logrus"
+)
+
+// tokenPriceDecimals is TokenPrice.sol's ASSUMED_DECIMALS.
+const tokenPriceDecimals = 18
+
+// TokenPrice returns the price give() uses now: tp.priceV2(pool) or
+// tp.price(pool) by the contract's v2 flag.
+func TokenPrice(cProps *ConnectionProps, opts *bind.CallOpts) (*big.Int, error) {
+	src, err := readPriceSource(cProps, opts)
+	if err != nil {
+		return nil, err
+	}
+	return src.contractPrice(cProps, opts)
+}
+
+// priceSource is where the contract reads its price from.
+type priceSource struct {
+	tp, pool common.Address
+	v2       bool
+}
+
+func readPriceSource(cProps *ConnectionProps, opts *bind.CallOpts) (priceSource, error) {
+	var src priceSource
+	var err error
+	if src.tp, err = cProps.Kt.Tp(opts); err != nil {
+		return src, fmt.Errorf("failed to get the TokenPrice address: %w", err)
+	}
+	if src.pool, err = cProps.Kt.Pool(opts); err != nil {
+		return src, fmt.Errorf("failed to get the pool address: %w", err)
+	}
+	if src.v2, err = cProps.Kt.V2(opts); err != nil {
+		return src, fmt.Errorf("failed to get the v2 flag: %w", err)
+	}
+	return src, nil
+}
+
+func (src priceSource) contractPrice(cProps *ConnectionProps, opts *bind.CallOpts) (*big.Int, error) {
+	tp, err := tokenprice.NewTokenPriceCaller(src.tp, cProps.Backend)
+	if err != nil {
+		return nil, err
+	}
+	var price *big.Int
+	if src.v2 {
+		price, err = tp.PriceV2(opts, src.pool)
+	} else {
+		price, err = tp.Price(opts, src.pool)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the price from %s: %w", src.tp.Hex(), err)
+	}
+	return price, nil
+}
+
+// TokenPriceCheck is the contract's price next to one computed from the
+// pool's own state.
+type TokenPriceCheck struct {
+	TokenPrice common.Address
+	Pool       common.Address
+	V2         bool
+	Price      *big.Int // from the TokenPrice contract; nil if the call fails
+	// Direct is the same price computed here from slot0 or the reserves.
+	Direct    *big.Int
+	Token     common.Address // the contract's token
+	Token0    common.Address
+	Token1    common.Address
+	Decimals0 uint8
+	Decimals1 uint8
+	Warnings  []string
+}
+
+// CheckTokenPrice reads the contract's price and cross-checks it against
+// the pool.
+func CheckTokenPrice(cProps *ConnectionProps) (*TokenPriceCheck, error) {
+	head, err := cProps.Client.BlockNumber(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get latest block: %w", err)
+	}
+	// One block for every read, so the pool can't move between them.
+	opts := &bind.CallOpts{Context: context.Background(), BlockNumber: new(big.Int).SetUint64(head)}
+	src, err := readPriceSource(cProps, opts)
+	if err != nil {
+		return nil, err
+	}
+	c := &TokenPriceCheck{TokenPrice: src.tp, Pool: src.pool, V2: src.v2}
+	if c.Token, err = cProps.Kt.TokenAddr(opts); err != nil {
+		return nil, fmt.Errorf("failed to get the token address: %w", err)
+	}
+	// A failing price call is what the check is for, so it is reported
+	// rather than returned.
+	if c.Price, err = src.contractPrice(cProps, opts); err != nil {
+		c.Warnings = append(c.Warnings, fmt.Sprintf("%v; give() reverts while it does", err))
+	}
+
+	if src.v2 {
+		pair, err := tokenprice.NewUniswapV2PairCaller(src.pool, cProps.Backend)
+		if err != nil {
+			return nil, err
+		}
+		r, err := pair.GetReserves(opts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the reserves of %s: %w", src.pool.Hex(), err)
+		}
+		c.Direct = priceFromReserves(r.Reserve0, r.Reserve1)
+		if c.Token0, err = pair.Token0(opts); err == nil {
+			c.Token1, err = pair.Token1(opts)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the tokens of %s: %w", src.pool.Hex(), err)
+		}
+	} else {
+		pool, err := tokenprice.NewUniswapV3PoolCaller(src.pool, cProps.Backend)
+		if err != nil {
+			return nil, err
+		}
+		s, err := pool.Slot0(opts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read slot0 of %s: %w", src.pool.Hex(), err)
+		}
+		c.Direct = priceFromSqrtX96(s.SqrtPriceX96)
+		if c.Token0, err = pool.Token0(opts); err == nil {
+			c.Token1, err = pool.Token1(opts)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the tokens of %s: %w", src.pool.Hex(), err)
+		}
+	}
+	if c.Decimals0, err = tokenDecimals(cProps, opts, c.Token0); err != nil {
+		return nil, err
+	}
+	if c.Decimals1, err = tokenDecimals(cProps, opts, c.Token1); err != nil {
+		return nil, err
+	}
+
+	if c.Direct == nil {
+		c.Warnings = append(c.Warnings, "the pair's reserve0 is zero, so priceV2 reverts and so does give()")
+	} else if c.Price != nil && c.Direct.Cmp(c.Price) != 0 {
+		c.Warnings = append(c.Warnings, fmt.Sprintf("the pool's own state gives %s, not the contract's %s", c.Direct, c.Price))
+	}
+	if c.Decimals0 != tokenPriceDecimals || c.Decimals1 != tokenPriceDecimals {
+		c.Warnings = append(c.Warnings, fmt.Sprintf("TokenPrice assumes 18 decimals but the pool's tokens have %d and %d, so the price is off by a factor of 10^%d",
+			c.Decimals0, c.Decimals1, int(c.Decimals0)-int(c.Decimals1)))
+	}
+	switch c.Token {
+	case c.Token0:
+	case c.Token1:
+		c.Warnings = append(c.Warnings, "the contract's token is the pool's token1, so the price is tokens per ETH, the inverse of what give() divides by")
+	default:
+		c.Warnings = append(c.Warnings, fmt.Sprintf("the pool does not hold the contract's token %s", c.Token.Hex()))
+	}
+	if cProps.Addresses != nil {
+		if a := cProps.Addresses.PoolAddr; a != "" && ToAddr(a) != src.pool {
+			c.Warnings = append(c.Warnings, fmt.Sprintf("POOL_ADDR is %s but the contract prices from %s", a, src.pool.Hex()))
+		}
+		if a := cProps.Addresses.TknPrcAddr; a != "" && ToAddr(a) != src.tp {
+			c.Warnings = append(c.Warnings, fmt.Sprintf("TKN_PRC_ADDR is %s but the contract reads its price from %s", a, src.tp.Hex()))
+		}
+	}
+	if cProps.V2Uniswap != src.v2 {
+		c.Warnings = append(c.Warnings, fmt.Sprintf("-v2Uniswap is %t but the contract's v2 flag is %t", cProps.V2Uniswap, src.v2))
+	}
+	return c, nil
+}
+
+func tokenDecimals(cProps *ConnectionProps, opts *bind.CallOpts, token common.Address) (uint8, error) {
+	erc20, err := shib.NewShibCaller(token, cProps.Backend)
+	if err != nil {
+		return 0, err
+	}
+	d, err := erc20.Decimals(opts)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read the decimals of %s: %w", token.Hex(), err)
+	}
+	return d, nil
+}
+
+// priceFromSqrtX96 is TokenPrice.price: sqrtPriceX96^2 * 1e18 / 2^192,
+// rounded down.
+func priceFromSqrtX96(sqrtPriceX96 *big.Int) *big.Int {
+	p := new(big.Int).Mul(sqrtPriceX96, sqrtPriceX96)
+	p.Mul(p, new(big.Int).Exp(big.NewInt(10), big.NewInt(tokenPriceDecimals), nil))
+	return p.Rsh(p, 192)
+}
+
+// priceFromReserves is TokenPrice.priceV2: reserve1 * 1e18 / reserve0. It
+// returns nil for an empty reserve0, where priceV2 reverts.
+func priceFromReserves(reserve0, reserve1 *big.Int) *big.Int {
+	if reserve0.Sign() == 0 {
+		return nil
+	}
+	p := new(big.Int).Mul(reserve1, new(big.Int).Exp(big.NewInt(10), big.NewInt(tokenPriceDecimals), nil))
+	return p.Quo(p, reserve0)
+}
+
+// LogTokenPriceCheck prints the check for -tokenPrice, each warning as one.
+func LogTokenPriceCheck(c *TokenPriceCheck) {
+	kind := "Uniswap v3 pool, price(pool)"
+	if c.V2 {
+		kind = "Uniswap v2 pair, priceV2(pair)"
+	}
+	log.Printf("Token price:")
+	log.Printf("  TokenPrice contract: %s", c.TokenPrice.Hex())
+	log.Printf("  Pool: %s (%s)", c.Pool.Hex(), kind)
+	log.Printf("  token0 %s (%d decimals), token1 %s (%d decimals)", c.Token0.Hex(), c.Decimals0, c.Token1.Hex(), c.Decimals1)
+	if c.Price != nil {
+		log.Printf("  Price: %s (%s ETH per token, assuming 18 decimals)", c.Price, weiToEthString(c.Price))
+	}
+	if c.Direct != nil {
+		log.Printf("  From the pool's state: %s", c.Direct)
+	}
+	for _, w := range c.Warnings {
+		log.Warnf("  %s", w)
+	}
+}
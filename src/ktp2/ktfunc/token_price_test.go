@@ -0,0 +1,148 @@
+package ktfunc
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+
+	"ktp2/src/abis/shib"
+	"ktp2/src/abis/tokenprice"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPriceFromSqrtX96(t *testing.T) {
+	q96 := new(big.Int).Lsh(big.NewInt(1), 96)
+	assert.Equal(t, "1000000000000000000", priceFromSqrtX96(q96).String(), "sqrt price 1 is price 1")
+	assert.Equal(t, "4000000000000000000", priceFromSqrtX96(new(big.Int).Mul(q96, big.NewInt(2))).String())
+	assert.Equal(t, "250000000000000000", priceFromSqrtX96(new(big.Int).Rsh(q96, 1)).String())
+}
+
+func TestPriceFromReserves(t *testing.T) {
+	assert.Equal(t, "2500000000000000000", priceFromReserves(big.NewInt(400), big.NewInt(1000)).String())
+	assert.Equal(t, "333333333333333333", priceFromReserves(big.NewInt(3), big.NewInt(1)).String(), "rounded down")
+	assert.Nil(t, priceFromReserves(big.NewInt(0), big.NewInt(1000)))
+}
+
+// priceFakeBackend answers contract calls from canned outputs, keyed by
+// address and method name.
+type priceFakeBackend struct {
+	bind.ContractBackend
+	abis    map[common.Address]*abi.ABI
+	outputs map[common.Address]map[string][]interface{}
+	fail    map[common.Address]map[string]bool
+}
+
+func newPriceFakeBackend() *priceFakeBackend {
+	return &priceFakeBackend{
+		abis:    map[common.Address]*abi.ABI{},
+		outputs: map[common.Address]map[string][]interface{}{},
+		fail:    map[common.Address]map[string]bool{},
+	}
+}
+
+func (b *priceFakeBackend) serve(t *testing.T, addr common.Address, md *bind.MetaData, outputs map[string][]interface{}) {
+	parsed, err := md.GetAbi()
+	require.NoError(t, err)
+	b.abis[addr] = parsed
+	b.outputs[addr] = outputs
+}
+
+func (b *priceFakeBackend) CallContract(_ context.Context, call ethereum.CallMsg, _ *big.Int) ([]byte, error) {
+	parsed, ok := b.abis[*call.To]
+	if !ok {
+		return nil, errors.New("no contract")
+	}
+	method, err := parsed.MethodById(call.Data[:4])
+	if err != nil {
+		return nil, err
+	}
+	if b.fail[*call.To][method.Name] {
+		return nil, errors.New("execution reverted")
+	}
+	return method.Outputs.Pack(b.outputs[*call.To][method.Name]...)
+}
+
+func (b *priceFakeBackend) CodeAt(context.Context, common.Address, *big.Int) ([]byte, error) {
+	return []byte{1}, nil
+}
+
+func TestCheckTokenPrice(t *testing.T) {
+	tpAddr, poolAddr := common.HexToAddress("0x71"), common.HexToAddress("0x72")
+	token, weth := common.HexToAddress("0x0a"), common.HexToAddress("0x0e")
+	q96 := new(big.Int).Lsh(big.NewInt(1), 96)
+
+	setup := func(v2 bool, decimals0 uint8, price *big.Int) (*ConnectionProps, *priceFakeBackend) {
+		kt := &MockKtv2{}
+		kt.On("Tp", mock.Anything).Return(tpAddr, nil)
+		kt.On("Pool", mock.Anything).Return(poolAddr, nil)
+		kt.On("V2", mock.Anything).Return(v2, nil)
+		kt.On("TokenAddr", mock.Anything).Return(token, nil)
+		client := &MockEthClient{}
+		client.On("BlockNumber", mock.Anything).Return(uint64(500), nil)
+
+		backend := newPriceFakeBackend()
+		backend.serve(t, tpAddr, tokenprice.TokenPriceMetaData, map[string][]interface{}{
+			"price":   {price},
+			"priceV2": {price},
+		})
+		backend.serve(t, token, shib.ShibMetaData, map[string][]interface{}{"decimals": {decimals0}})
+		backend.serve(t, weth, shib.ShibMetaData, map[string][]interface{}{"decimals": {uint8(18)}})
+		if v2 {
+			backend.serve(t, poolAddr, tokenprice.UniswapV2PairMetaData, map[string][]interface{}{
+				"getReserves": {big.NewInt(400), big.NewInt(1000), uint32(0)},
+				"token0":      {token},
+				"token1":      {weth},
+			})
+		} else {
+			backend.serve(t, poolAddr, tokenprice.UniswapV3PoolMetaData, map[string][]interface{}{
+				"slot0":  {q96, big.NewInt(0), uint16(0), uint16(1), uint16(1), uint8(0), true},
+				"token0": {token},
+				"token1": {weth},
+			})
+		}
+		cProps := &ConnectionProps{Kt: kt, Client: client, Backend: backend, V2Uniswap: v2}
+		return cProps, backend
+	}
+
+	// A v3 pool at sqrt price 1 matching the contract: nothing to warn about.
+	cProps, _ := setup(false, 18, big.NewInt(1e18))
+	c, err := CheckTokenPrice(cProps)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1e18), c.Price.Int64())
+	assert.Equal(t, int64(1e18), c.Direct.Int64())
+	assert.Empty(t, c.Warnings)
+
+	// A v2 pair, read through priceV2.
+	cProps, _ = setup(true, 18, big.NewInt(2_500_000_000_000_000_000))
+	c, err = CheckTokenPrice(cProps)
+	require.NoError(t, err)
+	assert.Equal(t, "2500000000000000000", c.Direct.String())
+	assert.Empty(t, c.Warnings)
+
+	// A mismatched price, 6-decimal token, a flag the node disagrees with and
+	// a reverting price call each get a warning.
+	cProps, _ = setup(false, 6, big.NewInt(7))
+	cProps.V2Uniswap = true
+	c, err = CheckTokenPrice(cProps)
+	require.NoError(t, err)
+	require.Len(t, c.Warnings, 3)
+	assert.Contains(t, c.Warnings[0], "not the contract's 7")
+	assert.Contains(t, c.Warnings[1], "10^-12")
+	assert.Contains(t, c.Warnings[2], "-v2Uniswap")
+
+	cProps, backend := setup(false, 18, big.NewInt(1e18))
+	backend.fail[tpAddr] = map[string]bool{"price": true}
+	c, err = CheckTokenPrice(cProps)
+	require.NoError(t, err)
+	assert.Nil(t, c.Price)
+	require.Len(t, c.Warnings, 1)
+	assert.Contains(t, c.Warnings[0], "give() reverts")
+}
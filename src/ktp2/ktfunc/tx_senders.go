@@ -0,0 +1,124 @@
+package ktfunc
+
+// Transaction sender resolution. Voted and Rwd events don't record the OC
+// that emitted them, so the voter or rewarder is the sender of the event's
+// transaction, one eth_getTransactionByHash per event. Scans over many
+// events prefetch their senders in JSON-RPC batches when the client supports
+// them, RPCBatchSize lookups per round trip. A batch the endpoint rejects, or
+// a lookup within one that fails or finds the tx pending, is left to the
+// single call sender makes.
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+	log "github.com/sirupsen/logrus"
+)
+
+// DefaultRPCBatchSize is how many lookups go in one JSON-RPC batch unless
+// configured otherwise. Hosted endpoints cap batches at 100 to 1000 calls.
+const DefaultRPCBatchSize = 100
+
+// BatchCaller is a client that can send JSON-RPC batch requests, such as
+// *rpc.Client or a CountingClient wrapping one.
+type BatchCaller interface {
+	BatchCallContext(ctx context.Context, b []rpc.BatchElem) error
+}
+
+// txSenders resolves and caches the sender of transactions. One vote or
+// reward tx is looked up once however many records refer to it.
+type txSenders struct {
+	cProps *ConnectionProps
+	cache  map[common.Hash]common.Address
+}
+
+func newTxSenders(cProps *ConnectionProps) *txSenders {
+	return &txSenders{cProps: cProps, cache: make(map[common.Hash]common.Address)}
+}
+
+func (s *txSenders) sender(hash common.Hash) (common.Address, error) {
+	if addr, ok := s.cache[hash]; ok {
+		return addr, nil
+	}
+	tx, isPending, err := s.cProps.Client.TransactionByHash(context.Background(), hash)
+	if err != nil || tx == nil {
+		return common.Address{}, fmt.Errorf("failed to get tx %s: %v", hash.Hex(), err)
+	}
+	// An event's tx is mined by definition; a node that says otherwise
+	// hasn't caught up, so its answer isn't cached.
+	if isPending {
+		return common.Address{}, fmt.Errorf("tx %s is still pending", hash.Hex())
+	}
+	addr, err := types.Sender(types.LatestSignerForChainID(tx.ChainId()), tx)
+	if err != nil {
+		return common.Address{}, fmt.Errorf("failed to get sender of tx %s: %w", hash.Hex(), err)
+	}
+	s.cache[hash] = addr
+	return addr, nil
+}
+
+// prefetch resolves the senders of hashes in batches, so the sender calls
+// that follow are served from the cache. It does nothing when the client
+// can't batch or RPCBatchSize is 1 or less, and gives up at the first batch
+// that fails; whatever it didn't resolve, sender looks up one by one.
+func (s *txSenders) prefetch(hashes []common.Hash) {
+	bc, ok := s.cProps.Client.(BatchCaller)
+	size := s.cProps.RPCBatchSize
+	if size == 0 {
+		size = DefaultRPCBatchSize
+	}
+	if !ok || size <= 1 {
+		return
+	}
+	var todo []common.Hash
+	queued := make(map[common.Hash]bool)
+	for _, h := range hashes {
+		if _, ok := s.cache[h]; !ok && !queued[h] {
+			queued[h] = true
+			todo = append(todo, h)
+		}
+	}
+	for i := 0; i < len(todo); i += size {
+		batch := todo[i:min(i+size, len(todo))]
+		results := make([]json.RawMessage, len(batch))
+		elems := make([]rpc.BatchElem, len(batch))
+		for j, h := range batch {
+			elems[j] = rpc.BatchElem{Method: "eth_getTransactionByHash", Args: []interface{}{h}, Result: &results[j]}
+		}
+		if err := bc.BatchCallContext(context.Background(), elems); err != nil {
+			log.Debugf("Batched lookup of %d txs failed, falling back to single calls: %v", len(batch), err)
+			return
+		}
+		for j, raw := range results {
+			if elems[j].Error != nil {
+				continue
+			}
+			if tx := minedTx(raw); tx != nil {
+				if addr, err := types.Sender(types.LatestSignerForChainID(tx.ChainId()), tx); err == nil {
+					s.cache[batch[j]] = addr
+				}
+			}
+		}
+	}
+}
+
+// minedTx decodes an eth_getTransactionByHash result. Like sender, it
+// returns nil for a tx the node reports as pending (no blockNumber), as well
+// as for a missing or undecodable one.
+func minedTx(raw json.RawMessage) *types.Transaction {
+	var extra struct {
+		BlockNumber *string `json:"blockNumber"`
+	}
+	if len(raw) == 0 || json.Unmarshal(raw, &extra) != nil || extra.BlockNumber == nil {
+		return nil
+	}
+	tx := new(types.Transaction)
+	if err := json.Unmarshal(raw, tx); err != nil {
+		return nil
+	}
+	return tx
+}
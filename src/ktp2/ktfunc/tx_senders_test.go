@@ -0,0 +1,154 @@
+package ktfunc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// batchingClient adds JSON-RPC batches to MockEthClient, answering
+// eth_getTransactionByHash from txs the way a node would: mined at block 1
+// unless listed in pending.
+type batchingClient struct {
+	*MockEthClient
+	txs     map[common.Hash]*types.Transaction
+	pending map[common.Hash]bool
+	batches []int // the size of each batch sent
+	fail    error // returned for the whole batch
+}
+
+func (c *batchingClient) BatchCallContext(_ context.Context, b []rpc.BatchElem) error {
+	c.batches = append(c.batches, len(b))
+	if c.fail != nil {
+		return c.fail
+	}
+	for i := range b {
+		tx, ok := c.txs[b[i].Args[0].(common.Hash)]
+		if !ok {
+			b[i].Error = errors.New("not found")
+			continue
+		}
+		raw, err := json.Marshal(tx)
+		if err != nil {
+			return err
+		}
+		var fields map[string]interface{}
+		if err := json.Unmarshal(raw, &fields); err != nil {
+			return err
+		}
+		fields["blockNumber"] = "0x1"
+		if c.pending[tx.Hash()] {
+			fields["blockNumber"] = nil
+		}
+		if raw, err = json.Marshal(fields); err != nil {
+			return err
+		}
+		if err := json.Unmarshal(raw, b[i].Result); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// senderTestTxs signs n distinct transactions from testKeyX.
+func senderTestTxs(t *testing.T, n int) ([]*types.Transaction, common.Address) {
+	t.Helper()
+	priv, err := crypto.HexToECDSA(testKeyX)
+	require.NoError(t, err)
+	signer := types.LatestSignerForChainID(big.NewInt(1337))
+	txs := make([]*types.Transaction, n)
+	for i := range txs {
+		txs[i], err = types.SignTx(types.NewTransaction(uint64(i), common.Address{}, big.NewInt(0), 21000, big.NewInt(1e9), nil), signer, priv)
+		require.NoError(t, err)
+	}
+	return txs, crypto.PubkeyToAddress(priv.PublicKey)
+}
+
+func TestTxSenders_Prefetch(t *testing.T) {
+	logrus.SetLevel(logrus.FatalLevel)
+	defer logrus.SetLevel(logrus.InfoLevel)
+
+	txs, from := senderTestTxs(t, 6)
+	hashes := make([]common.Hash, len(txs))
+	newClient := func() *batchingClient {
+		c := &batchingClient{MockEthClient: &MockEthClient{}, txs: map[common.Hash]*types.Transaction{}}
+		for i, tx := range txs {
+			hashes[i] = tx.Hash()
+			c.txs[tx.Hash()] = tx
+		}
+		return c
+	}
+
+	t.Run("batches and dedups", func(t *testing.T) {
+		client := newClient()
+		senders := newTxSenders(&ConnectionProps{Client: client, RPCBatchSize: 2})
+		senders.prefetch(append(hashes[:5:5], hashes[0], hashes[4]))
+		assert.Equal(t, []int{2, 2, 1}, client.batches)
+		for _, h := range hashes[:5] {
+			addr, err := senders.sender(h)
+			require.NoError(t, err)
+			assert.Equal(t, from, addr)
+		}
+		client.AssertNotCalled(t, "TransactionByHash", mock.Anything, mock.Anything)
+
+		// Cached hashes aren't fetched again.
+		senders.prefetch(hashes)
+		assert.Equal(t, []int{2, 2, 1, 1}, client.batches)
+	})
+
+	t.Run("a lookup missing from the batch falls back", func(t *testing.T) {
+		client := newClient()
+		delete(client.txs, hashes[1])
+		client.On("TransactionByHash", mock.Anything, hashes[1]).Return(txs[1], false, nil).Once()
+		senders := newTxSenders(&ConnectionProps{Client: client})
+		senders.prefetch(hashes)
+		assert.Equal(t, []int{6}, client.batches)
+		for _, h := range hashes {
+			_, err := senders.sender(h)
+			require.NoError(t, err)
+		}
+		client.AssertNumberOfCalls(t, "TransactionByHash", 1)
+	})
+
+	t.Run("a pending tx is left to the single call", func(t *testing.T) {
+		client := newClient()
+		client.pending = map[common.Hash]bool{hashes[2]: true}
+		client.On("TransactionByHash", mock.Anything, hashes[2]).Return(txs[2], true, nil).Once()
+		senders := newTxSenders(&ConnectionProps{Client: client})
+		senders.prefetch(hashes)
+		assert.Len(t, senders.cache, 5, "the pending tx isn't cached")
+		_, err := senders.sender(hashes[2])
+		assert.ErrorContains(t, err, "pending")
+	})
+
+	t.Run("a rejected batch falls back to single calls", func(t *testing.T) {
+		client := newClient()
+		client.fail = errors.New("batch too large")
+		client.On("TransactionByHash", mock.Anything, mock.Anything).Return(txs[0], false, nil)
+		senders := newTxSenders(&ConnectionProps{Client: client, RPCBatchSize: 2})
+		senders.prefetch(hashes)
+		assert.Equal(t, []int{2}, client.batches, "no more batches after one fails")
+		for _, h := range hashes {
+			_, err := senders.sender(h)
+			require.NoError(t, err)
+		}
+		client.AssertNumberOfCalls(t, "TransactionByHash", 6)
+	})
+
+	t.Run("batch size 1 disables batching", func(t *testing.T) {
+		client := newClient()
+		newTxSenders(&ConnectionProps{Client: client, RPCBatchSize: 1}).prefetch(hashes)
+		assert.Empty(t, client.batches)
+	})
+}
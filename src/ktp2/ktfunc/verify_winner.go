@@ -61,6 +61,49 @@ func VerifyWinnerCalculation(
 	}, nil
 }
 
+// replayStakeDigest is StakeSetDigest of the eligible stakers for
+// [start, end], computed as the vote computes them (declines included).
+func replayStakeDigest(cProps *ConnectionProps, stakeDataMap map[common.Address]map[uint64]*UserStakeData, start, end uint64) (common.Hash, error) {
+	_, mins, err := findMinOverBlockRange(start, end, stakeDataThrough(stakeDataMap, end))
+	if err != nil {
+		return common.Hash{}, err
+	}
+	if err := filterDeclinedStakers(mins, cProps); err != nil {
+		return common.Hash{}, err
+	}
+	return StakeSetDigest(mins), nil
+}
+
+// mismatchCauses compares a tagged winning vote with this build's replay
+// of the epoch ending at end (whose eligible stakers digest to digest) and
+// names every difference. If there is none, the single cause returned says
+// so: the two agree on every input, so one of them must misreport its
+// algorithm version.
+func mismatchCauses(vote VoteData, end uint64, digest common.Hash) []string {
+	causes := voteDifferences(vote, end+SeedOffset, digest)
+	if len(causes) == 0 {
+		causes = append(causes, "the voter reports the same algorithm, seed block and stake set as this build")
+	}
+	return causes
+}
+
+// voteDifferences lists how a tagged vote's algorithm, seed block and
+// stake set differ from this build's, which seeds from seedBlock and sees
+// the stake set digest.
+func voteDifferences(vote VoteData, seedBlock uint64, digest common.Hash) []string {
+	var diffs []string
+	if vote.Algorithm != ConsensusAlgorithmVersion {
+		diffs = append(diffs, fmt.Sprintf("the voter ran lottery algorithm v%d; this build runs v%d", vote.Algorithm, ConsensusAlgorithmVersion))
+	}
+	if vote.SeedBlock != seedBlock {
+		diffs = append(diffs, fmt.Sprintf("the voter seeded from block %d; this build seeds from %d", vote.SeedBlock, seedBlock))
+	}
+	if vote.StakeDigest != digest {
+		diffs = append(diffs, fmt.Sprintf("the voter drew from stake set %s; this build's replay gives %s (missed stake events, or different declines)", vote.StakeDigest.Hex(), digest.Hex()))
+	}
+	return diffs
+}
+
 // VerifyLastWinner fetches on-chain Rwd and Voted events, then replays the winner
 // calculation to verify the last rewarded winner was correctly selected.
 func VerifyLastWinner(cProps *ConnectionProps) error {
@@ -145,7 +188,10 @@ func VerifyLastWinner(cProps *ConnectionProps) error {
 	// winner address with BlockNumber <= lastRwdBlock is the most recent vote
 	// preceding the reward, from the same epoch. If the same wallet
 	// won earlier epochs in the search range, those earlier Voted events get
-	// overwritten and we end up with the correct (latest) one.
+	// overwritten and we end up with the correct (latest) one. A resetVote
+	// also emits Voted for the candidate, with resetVoteData and no seed, so
+	// it is skipped: a peer withdrawing its vote for the winner after this
+	// node voted must not hide the seed.
 	var votedEpochStart *big.Int
 	var votedBlockHash string
 	var votedFound bool
@@ -154,7 +200,7 @@ func VerifyLastWinner(cProps *ConnectionProps) error {
 		if evt == nil {
 			continue
 		}
-		if evt.Arg1 == lastRwdAddr && evt.Raw.BlockNumber <= lastRwdBlock {
+		if evt.Arg1 == lastRwdAddr && evt.Raw.BlockNumber <= lastRwdBlock && evt.Arg2 != resetVoteData {
 			votedEpochStart = evt.Arg0
 			votedBlockHash = evt.Arg2
 			votedFound = true
@@ -168,9 +214,19 @@ func VerifyLastWinner(cProps *ConnectionProps) error {
 		return fmt.Errorf("no matching Voted event found for winner %s", lastRwdAddr.Hex())
 	}
 
+	voteData := ParseVoteData(votedBlockHash)
 	log.Infof("Matching Voted event found")
 	log.Infof("  Epoch start block: %d", votedEpochStart.Uint64())
-	log.Infof("  Block hash used: %s", votedBlockHash)
+	log.Infof("  Vote data: %s", voteData)
+	switch voteData.Kind {
+	case VoteDataManual:
+		log.Warn("  The winner was voted manually (-voteFor), not drawn by the lottery. Nothing to replay.")
+		return nil
+	case VoteDataUnknown:
+		// Read it as a hash, as builds before versioned vote data did.
+		log.Warnf("  Vote data is in no known format; reading it as the seed hash")
+		voteData.SeedHash = common.HexToHash(voteData.Raw)
+	}
 
 	endBlock := new(big.Int).Add(votedEpochStart, big.NewInt(int64(interval)))
 	log.Infof("  Epoch end block: %d", endBlock.Uint64())
@@ -190,7 +246,7 @@ func VerifyLastWinner(cProps *ConnectionProps) error {
 	}
 
 	// Replay the winner calculation
-	blockHash := common.HexToHash(votedBlockHash)
+	blockHash := voteData.SeedHash
 	result, err := VerifyWinnerCalculation(
 		stakeDataMap,
 		votedEpochStart.Uint64(),
@@ -209,8 +265,18 @@ func VerifyLastWinner(cProps *ConnectionProps) error {
 
 	if result.CalculatedWinner == lastRwdAddr {
 		log.Info("  VERIFIED: The last winner was correctly selected.")
+	} else if voteData.Kind == VoteDataTagged {
+		log.Warn("  MISMATCH: The calculated winner does not match the on-chain winner!")
+		digest, err := replayStakeDigest(cProps, stakeDataMap, votedEpochStart.Uint64(), endBlock.Uint64())
+		if err != nil {
+			return fmt.Errorf("failed to replay the stake set: %w", err)
+		}
+		for _, cause := range mismatchCauses(voteData, endBlock.Uint64(), digest) {
+			log.Warnf("  Cause: %s", cause)
+		}
 	} else {
 		log.Warn("  MISMATCH: The calculated winner does not match the on-chain winner!")
+		log.Warn("  The vote predates versioned vote data, so the cause can't be pinned down.")
 		log.Warn("  Possible causes:")
 		log.Warn("    - the epoch was rewarded before the min-stake or withdraw-erasure")
 		log.Warn("      fix shipped, so the on-chain winner was selected by a pre-fix algorithm;")
@@ -1,6 +1,7 @@
 package ktfunc
 
 import (
+	"bytes"
 	"math/big"
 	"testing"
 
@@ -337,3 +338,51 @@ func TestVerifyLastWinner_ReplayMismatchReturnsNilButLogsWarning(t *testing.T) {
 	// Pin: no error propagation.
 	assert.NoError(t, err)
 }
+
+// TestVerifyLastWinner_SkipsResetVotes — a peer withdraws its vote for the
+// winner after the seeded vote. The reset's Voted event carries "rst", not
+// a seed, so the replay must still use the seed of the vote before it.
+func TestVerifyLastWinner_SkipsResetVotes(t *testing.T) {
+	cProps, mockClient, mockKt := vlwSetup(t)
+
+	winner := common.HexToAddress("0x000000000000000000000000000000000000Win0")
+	epochStart := big.NewInt(18_000_500)
+	seed := common.HexToHash("0x0102030405060708091011121314151617181920212223242526272829303132")
+
+	rwdEvents := []*ktv2.Ktv2Rwd{
+		{Arg0: winner, Arg1: big.NewInt(int64(1e18)),
+			Raw: types.Log{BlockNumber: 18_000_900}},
+	}
+	votedEvents := []*ktv2.Ktv2Voted{
+		{Arg0: epochStart, Arg1: winner, Arg2: seed.Hex(),
+			Raw: types.Log{BlockNumber: 18_000_850}},
+		{Arg0: epochStart, Arg1: winner, Arg2: resetVoteData,
+			Raw: types.Log{BlockNumber: 18_000_860}},
+	}
+
+	mockClient.On("BlockNumber", mock.Anything).Return(uint64(18_001_000), nil)
+	mockKt.On("EpochInterval", mock.Anything).Return(uint16(600), nil)
+	mockKt.On("FilterRwd", mock.Anything).Return(&mockRwdIter{events: rwdEvents}, nil)
+	mockKt.On("FilterVoted", mock.Anything).Return(&mockVotedIter{events: votedEvents}, nil)
+
+	origGather := GatherStakesAndWithdraws
+	GatherStakesAndWithdraws = func(_ *ConnectionProps, _ Ktv2Interface, _, _ *big.Int) (map[common.Address]map[uint64]*UserStakeData, error) {
+		return map[common.Address]map[uint64]*UserStakeData{
+			winner: {18_000_000: {StakeAmount: big.NewInt(int64(1e18))}},
+		}, nil
+	}
+	defer func() { GatherStakesAndWithdraws = origGather }()
+
+	var logs bytes.Buffer
+	orig := logrus.StandardLogger().Out
+	logrus.SetOutput(&logs)
+	logrus.SetLevel(logrus.InfoLevel)
+	t.Cleanup(func() {
+		logrus.SetOutput(orig)
+		logrus.SetLevel(logrus.FatalLevel)
+	})
+
+	assert.NoError(t, VerifyLastWinner(cProps))
+	assert.Contains(t, logs.String(), "untagged seed "+seed.Hex(), "the reset vote carries no seed")
+	assert.Contains(t, logs.String(), "VERIFIED")
+}
@@ -0,0 +1,214 @@
+package ktfunc
+
+// Full-history winner audit. Where VerifyLastWinner replays only the most
+// recent reward, AuditWinners replays every rewarded epoch in a block range.
+// Stakes are gathered once, up to the last epoch's end, and each epoch is
+// replayed from that one map cut at its end block, so a long range costs one
+// (cached) gather instead of one per epoch.
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Outcomes of replaying one rewarded epoch.
+const (
+	AuditMatch          = "match"           // the replay picks the on-chain winner
+	AuditMismatch       = "mismatch"        // the replay picks someone else
+	AuditManualOverride = "manual-override" // the winner was voted with -voteFor, not the lottery
+	AuditNoStake        = "no-stake"        // nobody qualified; the lottery had no one to pick
+	AuditError          = "error"           // the epoch could not be replayed (see Note)
+)
+
+// WinnerAudit is the replay of one rewarded epoch.
+type WinnerAudit struct {
+	Start            uint64 `json:"start"`
+	End              uint64 `json:"end"`
+	RwdBlock         uint64 `json:"rwdBlock"`
+	SeedBlock        uint64 `json:"seedBlock"`
+	Seed             string `json:"seed,omitempty"`
+	OnChainWinner    string `json:"onChainWinner"`
+	CalculatedWinner string `json:"calculatedWinner,omitempty"`
+	Amount           string `json:"amount"`
+	Status           string `json:"status"`
+	// VoteAlgorithm is the lottery algorithm version the winning vote
+	// reports; 0 for votes cast before vote data was versioned.
+	VoteAlgorithm int    `json:"voteAlgorithm,omitempty"`
+	Cause         string `json:"cause,omitempty"` // why a mismatch happened, when the vote data tells
+	Note          string `json:"note,omitempty"`
+}
+
+// AuditWinners replays every epoch rewarded in [from, to] and reports, per
+// epoch, whether the on-chain winner is the one the lottery picks. Stakers
+// that decline rewards today are left out of every replay, as the vote
+// leaves them out; earlier decline changes can't be seen and show up as
+// mismatches.
+func AuditWinners(cProps *ConnectionProps, from, to uint64) ([]WinnerAudit, error) {
+	epochs, err := GatherPastEpochs(cProps, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to gather rewarded epochs: %w", err)
+	}
+	audits := make([]WinnerAudit, 0, len(epochs))
+	if len(epochs) == 0 {
+		return audits, nil
+	}
+
+	creation, err := GetContractCreationBlock(cProps)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get contract creation block: %w", err)
+	}
+	lastEnd := epochs[0].End
+	for _, ep := range epochs {
+		lastEnd = max(lastEnd, ep.End)
+	}
+	stakeDataMap, err := GatherStakesAndWithdraws(cProps, cProps.Kt, new(big.Int).SetUint64(creation), new(big.Int).SetUint64(lastEnd))
+	if err != nil {
+		return nil, fmt.Errorf("failed to gather stakes: %w", err)
+	}
+	if err := dropDeclinedStakers(cProps, stakeDataMap); err != nil {
+		return nil, err
+	}
+
+	for _, ep := range epochs {
+		audits = append(audits, auditEpoch(cProps, stakeDataMap, ep))
+	}
+	return audits, nil
+}
+
+// dropDeclinedStakers removes stakers that currently decline rewards from
+// stakeDataMap. Each address's minimum is independent of the others, so
+// dropping them before findMinOverBlockRange is the same as the vote's
+// filter after it.
+func dropDeclinedStakers(cProps *ConnectionProps, stakeDataMap map[common.Address]map[uint64]*UserStakeData) error {
+	mins := make(map[common.Address]*UserStakeData, len(stakeDataMap))
+	for addr := range stakeDataMap {
+		mins[addr] = &UserStakeData{}
+	}
+	if err := filterDeclinedStakers(mins, cProps); err != nil {
+		return fmt.Errorf("failed to filter declined stakers: %w", err)
+	}
+	for addr := range stakeDataMap {
+		if _, ok := mins[addr]; !ok {
+			delete(stakeDataMap, addr)
+		}
+	}
+	return nil
+}
+
+func auditEpoch(cProps *ConnectionProps, stakeDataMap map[common.Address]map[uint64]*UserStakeData, ep PastEpoch) WinnerAudit {
+	a := WinnerAudit{
+		Start:         ep.Start,
+		End:           ep.End,
+		RwdBlock:      ep.RwdBlock,
+		SeedBlock:     ep.End + SeedOffset,
+		OnChainWinner: ep.Winner.Hex(),
+		Amount:        ep.Amount.String(),
+	}
+	vote := ParseVoteData(ep.VoteData)
+	if vote.Kind == VoteDataManual {
+		a.Status = AuditManualOverride
+		a.Note = "winner was voted manually (-voteFor)"
+		return a
+	}
+
+	header, err := cProps.Client.HeaderByNumber(context.Background(), new(big.Int).SetUint64(a.SeedBlock))
+	if err != nil || header == nil {
+		a.Status = AuditError
+		a.Note = fmt.Sprintf("failed to read seed block: %v", err)
+		return a
+	}
+	seed := header.Hash()
+	a.Seed = seed.Hex()
+	switch vote.Kind {
+	case VoteDataTagged, VoteDataLegacySeed:
+		a.VoteAlgorithm = vote.Algorithm
+		if vote.SeedHash != seed {
+			a.Note = fmt.Sprintf("winning vote was seeded with %s, not the seed block hash", vote.SeedHash.Hex())
+		}
+	case VoteDataUnknown:
+		if ep.VoteData != "" {
+			a.Note = fmt.Sprintf("winning vote carried %q, not a known vote data format", ep.VoteData)
+		}
+	}
+
+	result, err := VerifyWinnerCalculation(stakeDataThrough(stakeDataMap, ep.End), ep.Start, ep.End, seed)
+	if err != nil {
+		a.Status = AuditError
+		a.Note = err.Error()
+		return a
+	}
+	if result.CalculatedWinner == (common.Address{}) {
+		a.Status = AuditNoStake
+		return a
+	}
+	a.CalculatedWinner = result.CalculatedWinner.Hex()
+	if result.CalculatedWinner == ep.Winner {
+		a.Status = AuditMatch
+		return a
+	}
+	a.Status = AuditMismatch
+	if vote.Kind != VoteDataTagged {
+		a.Cause = "unknown: the winning vote predates versioned vote data"
+		return a
+	}
+	digest, err := replayStakeDigest(cProps, stakeDataMap, ep.Start, ep.End)
+	if err != nil {
+		a.Cause = fmt.Sprintf("unknown: failed to replay the stake set: %v", err)
+		return a
+	}
+	a.Cause = strings.Join(mismatchCauses(vote, ep.End, digest), "; ")
+	return a
+}
+
+// WriteWinnerAudit renders audits to w.
+func WriteWinnerAudit(w io.Writer, audits []WinnerAudit, format OutputFormat) error {
+	switch format {
+	case FormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(audits)
+	case FormatCSV:
+		cw := csv.NewWriter(w)
+		rows := [][]string{{"start", "end", "rwd_block", "seed_block", "seed", "on_chain_winner", "calculated_winner", "amount", "status", "note", "vote_algorithm", "cause"}}
+		for _, a := range audits {
+			rows = append(rows, []string{
+				strconv.FormatUint(a.Start, 10), strconv.FormatUint(a.End, 10),
+				strconv.FormatUint(a.RwdBlock, 10), strconv.FormatUint(a.SeedBlock, 10), a.Seed,
+				a.OnChainWinner, a.CalculatedWinner, a.Amount, a.Status, a.Note,
+				strconv.Itoa(a.VoteAlgorithm), a.Cause,
+			})
+		}
+		return cw.WriteAll(rows)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	counts := make(map[string]int)
+	fmt.Fprintf(tw, "Winner audit (%d rewarded epochs):\n", len(audits))
+	if len(audits) > 0 {
+		fmt.Fprintln(tw, "  Epoch\tRwd block\tOn-chain winner\tCalculated winner\tStatus\tNote")
+	}
+	for _, a := range audits {
+		counts[a.Status]++
+		calc := a.CalculatedWinner
+		if calc == "" {
+			calc = "-"
+		}
+		note := a.Note
+		if a.Cause != "" {
+			note = strings.TrimPrefix(note+"; "+a.Cause, "; ")
+		}
+		fmt.Fprintf(tw, "  %d-%d\t%d\t%s\t%s\t%s\t%s\n", a.Start, a.End, a.RwdBlock, a.OnChainWinner, calc, a.Status, note)
+	}
+	fmt.Fprintf(tw, "\n%d match, %d mismatch, %d manual-override, %d no-stake, %d error\n",
+		counts[AuditMatch], counts[AuditMismatch], counts[AuditManualOverride], counts[AuditNoStake], counts[AuditError])
+	return tw.Flush()
+}
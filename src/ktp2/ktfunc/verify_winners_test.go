@@ -0,0 +1,82 @@
+package ktfunc
+
+import (
+	"bytes"
+	"encoding/csv"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuditWinners(t *testing.T) {
+	logrus.SetLevel(logrus.FatalLevel)
+	defer logrus.SetLevel(logrus.InfoLevel)
+
+	kt, a, b := threeEpochHistory()
+	cProps := newOddsTestProps(t, kt, 500)
+	seed := (&types.Header{}).Hash() // what the test client serves for every block
+
+	// Make the last epoch's on-chain winner the one the lottery really picks.
+	full := buildStakeDataMap(kt.stakes, kt.withdraws)
+	want, err := VerifyWinnerCalculation(stakeDataThrough(full, 400), 300, 400, seed)
+	require.NoError(t, err)
+	kt.rwds[2].Arg0 = want.CalculatedWinner
+	kt.voted[4] = votedAt(440, 300, want.CalculatedWinner, seed.Hex())
+
+	gathers := 0
+	orig := GatherStakesAndWithdraws
+	GatherStakesAndWithdraws = func(cProps *ConnectionProps, kt Ktv2Interface, from, to *big.Int) (map[common.Address]map[uint64]*UserStakeData, error) {
+		gathers++
+		return orig(cProps, kt, from, to)
+	}
+	defer func() { GatherStakesAndWithdraws = orig }()
+
+	audits, err := AuditWinners(cProps, 0, 500)
+	require.NoError(t, err)
+	assert.Equal(t, 1, gathers, "stakes are gathered once for the whole range")
+	require.Len(t, audits, 3)
+
+	assert.Equal(t, AuditNoStake, audits[0].Status, "everyone staked inside the first epoch")
+	assert.Equal(t, AuditMismatch, audits[1].Status, "b had withdrawn to zero, only a qualified")
+	assert.Equal(t, a.Hex(), audits[1].CalculatedWinner)
+	assert.Contains(t, audits[1].Note, "0xseed2")
+	assert.Equal(t, AuditMatch, audits[2].Status)
+	assert.Empty(t, audits[2].Note)
+	assert.Equal(t, uint64(400+SeedOffset), audits[2].SeedBlock)
+	assert.Equal(t, seed.Hex(), audits[2].Seed)
+
+	// A tagged vote says why its winner differs from the replay.
+	loser := a
+	if want.CalculatedWinner == a {
+		loser = b
+	}
+	kt.rwds[2].Arg0 = loser
+	kt.voted[4] = votedAt(440, 300, loser, FormatVoteData(ConsensusAlgorithmVersion+1, 400+SeedOffset, seed, common.HexToHash("0xd1")))
+	audits, err = AuditWinners(cProps, 400, 500)
+	require.NoError(t, err)
+	require.Len(t, audits, 1)
+	assert.Equal(t, AuditMismatch, audits[0].Status)
+	assert.Equal(t, ConsensusAlgorithmVersion+1, audits[0].VoteAlgorithm)
+	assert.Contains(t, audits[0].Cause, "algorithm v2")
+	assert.Contains(t, audits[0].Cause, "stake set")
+	assert.NotContains(t, audits[0].Cause, "seeded from")
+
+	// A -voteFor winner is reported as such, not as a mismatch.
+	kt.voted[3] = votedAt(342, 200, kt.rwds[1].Arg0, manualVoteData)
+	audits, err = AuditWinners(cProps, 300, 400)
+	require.NoError(t, err)
+	require.Len(t, audits, 1)
+	assert.Equal(t, AuditManualOverride, audits[0].Status)
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteWinnerAudit(&buf, audits, FormatCSV))
+	rows, err := csv.NewReader(&buf).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, rows, 2)
+	assert.Equal(t, AuditManualOverride, rows[1][8])
+}
@@ -0,0 +1,161 @@
+package ktfunc
+
+// Structured vote data. The contract stores the data string of every vote
+// in its Voted event and never reads it, so it is free for the voting node
+// to describe how it chose the winner. Format 1 is
+//
+//	kt1:<algorithm>:<seedBlock>:<seedHash>:<stakeDigest>
+//
+// where algorithm is ConsensusAlgorithmVersion, seedBlock and seedHash are
+// the lottery seed, and stakeDigest is StakeSetDigest of the eligible
+// stakers. With these a mismatched winner can be traced to a different
+// algorithm, a different stake set or a different seed rather than guessed
+// at. Older builds voted with the bare seed hash; ParseVoteData still reads
+// those, as well as the manual-override and reset markers.
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// ConsensusAlgorithmVersion identifies the winner-selection algorithm this
+// build runs. Bump it with any change that can make the lottery pick a
+// different winner from the same chain (the canonical lottery vectors are
+// the check), so votes from the old and new algorithm can be told apart.
+const ConsensusAlgorithmVersion = 1
+
+// voteDataPrefix tags format 1 of the vote data.
+const voteDataPrefix = "kt1"
+
+// VoteDataKind says what a Voted event's data string holds.
+type VoteDataKind int
+
+const (
+	VoteDataUnknown    VoteDataKind = iota // not produced by any ktoc build
+	VoteDataTagged                         // format 1: algorithm, seed and stake digest
+	VoteDataLegacySeed                     // a bare seed hash, from builds before format 1
+	VoteDataManual                         // -voteFor override
+	VoteDataReset                          // resetVote
+)
+
+func (k VoteDataKind) String() string {
+	switch k {
+	case VoteDataTagged:
+		return "tagged"
+	case VoteDataLegacySeed:
+		return "legacy-seed"
+	case VoteDataManual:
+		return "manual-override"
+	case VoteDataReset:
+		return "reset"
+	}
+	return "unknown"
+}
+
+// VoteData is a parsed vote data string. Algorithm, SeedBlock and
+// StakeDigest are set only for VoteDataTagged; SeedHash also for
+// VoteDataLegacySeed.
+type VoteData struct {
+	Kind        VoteDataKind
+	Algorithm   int
+	SeedBlock   uint64
+	SeedHash    common.Hash
+	StakeDigest common.Hash
+	Raw         string
+}
+
+// FormatVoteData returns the format 1 data string for a lottery vote.
+func FormatVoteData(algorithm int, seedBlock uint64, seedHash, stakeDigest common.Hash) string {
+	return fmt.Sprintf("%s:%d:%d:%s:%s", voteDataPrefix, algorithm, seedBlock, seedHash.Hex(), stakeDigest.Hex())
+}
+
+// ParseVoteData reads any data string a Voted event may carry. Strings it
+// doesn't recognise come back as VoteDataUnknown rather than an error:
+// vote data is free text as far as the contract is concerned.
+func ParseVoteData(s string) VoteData {
+	d := VoteData{Raw: s}
+	switch {
+	case s == manualVoteData:
+		d.Kind = VoteDataManual
+	case s == resetVoteData:
+		d.Kind = VoteDataReset
+	case isHashHex(s):
+		d.Kind = VoteDataLegacySeed
+		d.SeedHash = common.HexToHash(s)
+	case strings.HasPrefix(s, voteDataPrefix+":"):
+		parts := strings.Split(s, ":")
+		if len(parts) != 5 || !isHashHex(parts[3]) || !isHashHex(parts[4]) {
+			return d
+		}
+		algorithm, err := strconv.Atoi(parts[1])
+		if err != nil {
+			return d
+		}
+		seedBlock, err := strconv.ParseUint(parts[2], 10, 64)
+		if err != nil {
+			return d
+		}
+		d.Kind = VoteDataTagged
+		d.Algorithm = algorithm
+		d.SeedBlock = seedBlock
+		d.SeedHash = common.HexToHash(parts[3])
+		d.StakeDigest = common.HexToHash(parts[4])
+	}
+	return d
+}
+
+// String describes d for status and verification output.
+func (d VoteData) String() string {
+	switch d.Kind {
+	case VoteDataTagged:
+		return fmt.Sprintf("algorithm v%d, seed block %d (%s), stake set %s", d.Algorithm, d.SeedBlock, d.SeedHash.Hex(), d.StakeDigest.Hex())
+	case VoteDataLegacySeed:
+		return fmt.Sprintf("untagged seed %s (pre-versioning build)", d.SeedHash.Hex())
+	case VoteDataManual:
+		return "manual override"
+	case VoteDataReset:
+		return "reset"
+	}
+	return fmt.Sprintf("unrecognised data %q", d.Raw)
+}
+
+func isHashHex(s string) bool {
+	if len(s) != 2+2*common.HashLength || !strings.HasPrefix(s, "0x") {
+		return false
+	}
+	for _, c := range s[2:] {
+		if !strings.ContainsRune("0123456789abcdefABCDEF", c) {
+			return false
+		}
+	}
+	return true
+}
+
+// StakeSetDigest fingerprints the eligible stakers and their minimums, the
+// lottery's whole input besides the seed: keccak256 over each address (20
+// bytes) followed by its minimum stake (32 bytes, big-endian), in ascending
+// address order. Two nodes with the same digest drew from the same set.
+func StakeSetDigest(mins map[common.Address]*UserStakeData) common.Hash {
+	addrs := make([]common.Address, 0, len(mins))
+	for addr := range mins {
+		addrs = append(addrs, addr)
+	}
+	sort.Slice(addrs, func(i, j int) bool { return bytes.Compare(addrs[i][:], addrs[j][:]) < 0 })
+	buf := make([]byte, 0, len(addrs)*(common.AddressLength+32))
+	for _, addr := range addrs {
+		buf = append(buf, addr[:]...)
+		var amount [32]byte
+		if d := mins[addr]; d != nil && d.StakeAmount != nil {
+			math.ReadBits(d.StakeAmount, amount[:])
+		}
+		buf = append(buf, amount[:]...)
+	}
+	return crypto.Keccak256Hash(buf)
+}
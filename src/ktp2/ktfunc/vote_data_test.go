@@ -0,0 +1,43 @@
+package ktfunc
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVoteData_FormatAndParse(t *testing.T) {
+	seed := common.HexToHash("0x1f1a")
+	digest := common.HexToHash("0xd1")
+	s := FormatVoteData(1, 142, seed, digest)
+	assert.Equal(t, "kt1:1:142:"+seed.Hex()+":"+digest.Hex(), s)
+	assert.Equal(t, VoteData{Kind: VoteDataTagged, Algorithm: 1, SeedBlock: 142, SeedHash: seed, StakeDigest: digest, Raw: s}, ParseVoteData(s))
+
+	// Builds before format 1 voted with the bare seed hash.
+	legacy := ParseVoteData(seed.Hex())
+	assert.Equal(t, VoteDataLegacySeed, legacy.Kind)
+	assert.Equal(t, seed, legacy.SeedHash)
+
+	assert.Equal(t, VoteDataManual, ParseVoteData(manualVoteData).Kind)
+	assert.Equal(t, VoteDataReset, ParseVoteData(resetVoteData).Kind)
+	for _, bad := range []string{"", "0xabcd", "kt1:1:142:" + seed.Hex(), "kt1:x:142:" + seed.Hex() + ":" + digest.Hex(), "kt1:1:142:0xzz:" + digest.Hex()} {
+		assert.Equal(t, VoteDataUnknown, ParseVoteData(bad).Kind, bad)
+	}
+}
+
+func TestStakeSetDigest(t *testing.T) {
+	// keccak256 of nothing: the digest of an empty stake set.
+	assert.Equal(t, "0xc5d2460186f7233c927e7db2dcc703c0e500b653ca82273b7bfad8045d85a470", StakeSetDigest(nil).Hex())
+
+	a, b := common.HexToAddress("0x0a"), common.HexToAddress("0x0b")
+	mins := map[common.Address]*UserStakeData{a: {StakeAmount: big.NewInt(100)}, b: {StakeAmount: big.NewInt(10)}}
+	d := StakeSetDigest(mins)
+	assert.Equal(t, d, StakeSetDigest(map[common.Address]*UserStakeData{b: {StakeAmount: big.NewInt(10)}, a: {StakeAmount: big.NewInt(100)}}))
+
+	mins[b] = &UserStakeData{StakeAmount: big.NewInt(11)}
+	assert.NotEqual(t, d, StakeSetDigest(mins), "a different minimum is a different set")
+	delete(mins, b)
+	assert.NotEqual(t, d, StakeSetDigest(mins), "a missing staker is a different set")
+}
@@ -227,9 +227,13 @@ func (m *MockKtv2) Withdraw(opts *bind.TransactOpts, amount *big.Int) (*types.Tr
 	return args.Get(0).(*types.Transaction), args.Error(1)
 }
 
-// FilterRwd mock
+// FilterRwd mock. Like FilterGave and FilterVoted, it also accepts a
+// func(*bind.FilterOpts) RwdIterator return, to serve the requested range.
 func (m *MockKtv2) FilterRwd(opts *bind.FilterOpts) (RwdIterator, error) {
 	args := m.Called(opts)
+	if fn, ok := args.Get(0).(func(*bind.FilterOpts) RwdIterator); ok {
+		return fn(opts), args.Error(1)
+	}
 	v := args.Get(0)
 	if v == nil {
 		return nil, args.Error(1)
@@ -238,8 +242,39 @@ func (m *MockKtv2) FilterRwd(opts *bind.FilterOpts) (RwdIterator, error) {
 }
 
 // FilterVoted mock
+func (m *MockKtv2) Tp(opts *bind.CallOpts) (common.Address, error) {
+	args := m.Called(opts)
+	return args.Get(0).(common.Address), args.Error(1)
+}
+
+func (m *MockKtv2) Pool(opts *bind.CallOpts) (common.Address, error) {
+	args := m.Called(opts)
+	return args.Get(0).(common.Address), args.Error(1)
+}
+
+func (m *MockKtv2) TokenAddr(opts *bind.CallOpts) (common.Address, error) {
+	args := m.Called(opts)
+	return args.Get(0).(common.Address), args.Error(1)
+}
+
+// FilterGave mock
+func (m *MockKtv2) FilterGave(opts *bind.FilterOpts) (GaveIterator, error) {
+	args := m.Called(opts)
+	if fn, ok := args.Get(0).(func(*bind.FilterOpts) GaveIterator); ok {
+		return fn(opts), args.Error(1)
+	}
+	v := args.Get(0)
+	if v == nil {
+		return nil, args.Error(1)
+	}
+	return v.(GaveIterator), args.Error(1)
+}
+
 func (m *MockKtv2) FilterVoted(opts *bind.FilterOpts) (VotedIterator, error) {
 	args := m.Called(opts)
+	if fn, ok := args.Get(0).(func(*bind.FilterOpts) VotedIterator); ok {
+		return fn(opts), args.Error(1)
+	}
 	v := args.Get(0)
 	if v == nil {
 		return nil, args.Error(1)
@@ -362,6 +397,12 @@ func (m *MockKtv2) PastOcFees(opts *bind.CallOpts, oc common.Address) (*big.Int,
 	return args.Get(0).(*big.Int), args.Error(1)
 }
 
+// LastStartBlock
+func (m *MockKtv2) LastStartBlock(opts *bind.CallOpts, oc common.Address) (*big.Int, error) {
+	args := m.Called(opts, oc)
+	return args.Get(0).(*big.Int), args.Error(1)
+}
+
 // TestValidateAddress tests the address validation helper.
 func TestValidateAddress(t *testing.T) {
 	tests := []struct {
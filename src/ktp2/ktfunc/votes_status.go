@@ -10,13 +10,13 @@ package ktfunc
 import (
 	"context"
 	"fmt"
+	"ktp2/src/abis/ktv2"
 	"math/big"
 	"sort"
 	"strings"
 
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common"
-	"github.com/ethereum/go-ethereum/core/types"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -28,6 +28,7 @@ const resetVoteData = "rst"
 type epochVote struct {
 	Voter     common.Address
 	Candidate common.Address
+	Data      VoteData
 }
 
 // PrintEpochVoteStatus reconstructs and prints, for the current epoch, the
@@ -67,6 +68,16 @@ func PrintEpochVoteStatus(cProps *ConnectionProps) error {
 		log.Printf("  Epoch is not yet complete (head %d <= end %d). Voting has not opened.", head, endBlock.Uint64())
 	}
 
+	voted := false
+	for _, v := range votes {
+		voted = voted || v.Voter == cProps.MyPubKey
+	}
+	if forecast, err := ForecastEpochFees(cProps, voted); err != nil {
+		log.Warnf("  Could not forecast this epoch's fees: %v", err)
+	} else {
+		logFeeForecast(forecast)
+	}
+
 	if len(votes) == 0 {
 		log.Printf("  No votes cast in this epoch yet.")
 		return nil
@@ -102,11 +113,51 @@ func PrintEpochVoteStatus(cProps *ConnectionProps) error {
 	})
 	log.Printf("  Votes by node (OC):")
 	for _, v := range votes {
-		log.Printf("    %s voted for %s", v.Voter.Hex(), v.Candidate.Hex())
+		log.Printf("    %s voted for %s (%s)", v.Voter.Hex(), v.Candidate.Hex(), v.Data)
+	}
+	if why := voteDisagreement(votes); why != "" {
+		log.Warnf("  Lottery votes disagree on %s; see the vote data above.", why)
 	}
 	return nil
 }
 
+// voteDisagreement names what the tagged lottery votes differ on (algorithm
+// version, seed or stake set), or returns "" when they agree. Untagged and
+// manual votes carry nothing to compare.
+func voteDisagreement(votes []epochVote) string {
+	var first *VoteData
+	var diffs []string
+	for i := range votes {
+		d := &votes[i].Data
+		if d.Kind != VoteDataTagged {
+			continue
+		}
+		if first == nil {
+			first = d
+			continue
+		}
+		if d.Algorithm != first.Algorithm && !contains(diffs, "algorithm version") {
+			diffs = append(diffs, "algorithm version")
+		}
+		if (d.SeedBlock != first.SeedBlock || d.SeedHash != first.SeedHash) && !contains(diffs, "seed") {
+			diffs = append(diffs, "seed")
+		}
+		if d.StakeDigest != first.StakeDigest && !contains(diffs, "stake set") {
+			diffs = append(diffs, "stake set")
+		}
+	}
+	return strings.Join(diffs, ", ")
+}
+
+func contains(list []string, s string) bool {
+	for _, x := range list {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
+
 // gatherEpochVotes scans Voted events for the given epoch and returns each OC's
 // current active vote (resets net out an earlier vote). Voters are resolved
 // from the transaction sender, since the Voted event records the candidate but
@@ -117,29 +168,12 @@ func gatherEpochVotes(cProps *ConnectionProps, startBlock *big.Int, head uint64)
 		chunkSize = uint64(DefaultChunkSize)
 	}
 
-	txSender := make(map[common.Hash]common.Address)
-	resolveSender := func(txHash common.Hash) (common.Address, bool) {
-		if s, ok := txSender[txHash]; ok {
-			return s, s != (common.Address{})
-		}
-		tx, isPending, err := cProps.Client.TransactionByHash(context.Background(), txHash)
-		if err != nil || isPending || tx == nil {
-			txSender[txHash] = common.Address{}
-			return common.Address{}, false
-		}
-		sender, err := types.Sender(types.LatestSignerForChainID(tx.ChainId()), tx)
-		if err != nil {
-			txSender[txHash] = common.Address{}
-			return common.Address{}, false
-		}
-		txSender[txHash] = sender
-		return sender, true
-	}
+	senders := newTxSenders(cProps)
 
 	// Track each OC's latest vote in event order; a reset clears it. seen keeps
 	// the display order stable and prevents a re-vote after a reset from listing
 	// the same voter twice.
-	current := make(map[common.Address]common.Address)
+	current := make(map[common.Address]epochVote)
 	seen := make(map[common.Address]bool)
 	order := make([]common.Address, 0)
 
@@ -154,13 +188,29 @@ func gatherEpochVotes(cProps *ConnectionProps, startBlock *big.Int, head uint64)
 		if err != nil {
 			return nil, fmt.Errorf("failed to filter Voted events %d-%d: %w", from, to, err)
 		}
+		var events []*ktv2.Ktv2Voted
 		for iter.Next() {
 			evt := iter.Event()
 			if evt == nil || evt.Arg0 == nil || evt.Arg0.Cmp(startBlock) != 0 {
 				continue // not this epoch
 			}
-			voter, ok := resolveSender(evt.Raw.TxHash)
-			if !ok {
+			events = append(events, evt)
+		}
+		if err := iter.Error(); err != nil {
+			iter.Close()
+			return nil, fmt.Errorf("error iterating Voted events: %w", err)
+		}
+		iter.Close()
+
+		hashes := make([]common.Hash, len(events))
+		for i, evt := range events {
+			hashes[i] = evt.Raw.TxHash
+		}
+		senders.prefetch(hashes)
+		for _, evt := range events {
+			voter, err := senders.sender(evt.Raw.TxHash)
+			if err != nil {
+				log.Debugf("Skipping vote in tx %s: %v", evt.Raw.TxHash.Hex(), err)
 				continue
 			}
 			if !seen[voter] {
@@ -171,19 +221,14 @@ func gatherEpochVotes(cProps *ConnectionProps, startBlock *big.Int, head uint64)
 				delete(current, voter)
 				continue
 			}
-			current[voter] = evt.Arg1
+			current[voter] = epochVote{Voter: voter, Candidate: evt.Arg1, Data: ParseVoteData(evt.Arg2)}
 		}
-		if err := iter.Error(); err != nil {
-			iter.Close()
-			return nil, fmt.Errorf("error iterating Voted events: %w", err)
-		}
-		iter.Close()
 	}
 
 	result := make([]epochVote, 0, len(current))
 	for _, voter := range order {
-		if c, ok := current[voter]; ok {
-			result = append(result, epochVote{Voter: voter, Candidate: c})
+		if v, ok := current[voter]; ok {
+			result = append(result, v)
 		}
 	}
 	return result, nil
@@ -57,8 +57,8 @@ func TestGatherEpochVotes_ReconstructsPerOCVotesWithResetNetting(t *testing.T) {
 
 	// X's final active vote is candC (A was reset); Y's is candB. X listed first.
 	assert.Equal(t, []epochVote{
-		{Voter: addrX, Candidate: candC},
-		{Voter: addrY, Candidate: candB},
+		{Voter: addrX, Candidate: candC, Data: ParseVoteData("data")},
+		{Voter: addrY, Candidate: candB, Data: ParseVoteData("data")},
 	}, votes)
 }
 
@@ -113,7 +113,23 @@ func TestPrintEpochVoteStatus_HappyPath(t *testing.T) {
 	mockKt.On("FilterVoted", mock.Anything).Return(&mockVotedIter{events: events}, nil)
 	mockClient.On("TransactionByHash", mock.Anything, h1).Return(xTx, false, nil)
 	mockKt.On("BlockRwd", mock.Anything, big.NewInt(1000), candA).Return(uint16(1), nil)
+	mockKt.On("OcFee", mock.Anything).Return(uint16(20), nil)
+	mockKt.On("TlOcFees", mock.Anything).Return(big.NewInt(0), nil)
+	mockClient.On("BalanceAt", mock.Anything, mock.Anything, mock.Anything).Return(big.NewInt(1e18), nil)
 
 	cProps := &ConnectionProps{Kt: mockKt, Client: mockClient, ChunkSize: 10_000_000}
 	assert.NoError(t, PrintEpochVoteStatus(cProps))
 }
+
+func TestVoteDisagreement(t *testing.T) {
+	seed, digest := common.HexToHash("0x01"), common.HexToHash("0xd1")
+	tagged := func(algorithm int, seedBlock uint64, digest common.Hash) epochVote {
+		return epochVote{Data: ParseVoteData(FormatVoteData(algorithm, seedBlock, seed, digest))}
+	}
+
+	agree := []epochVote{tagged(1, 132, digest), tagged(1, 132, digest), {Data: ParseVoteData(manualVoteData)}}
+	assert.Empty(t, voteDisagreement(agree), "manual votes carry nothing to compare")
+
+	split := []epochVote{tagged(1, 132, digest), tagged(2, 132, common.HexToHash("0xd2")), tagged(1, 133, digest)}
+	assert.Equal(t, "algorithm version, stake set, seed", voteDisagreement(split))
+}